@@ -1,6 +1,13 @@
 package concurrent
 
-import "time"
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jhunters/goassist/base"
+)
 
 // SafeChanClose to close chan for safty way. if channel is closed will retrun false
 func SafeCloseChan[E any](c chan E) (ok bool) {
@@ -56,3 +63,310 @@ func TryRecevieChan[E any](c <-chan E, timeout time.Duration) (ok bool, v E) {
 		return false, v
 	}
 }
+
+// send value to channel unless context is done, return false if context is done
+func sendCtx[E any](ctx context.Context, c chan<- E, v E) bool {
+	select {
+	case c <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// OrDone wraps channel c and return a channel which will be closed if either c is closed or ctx is done.
+// it is useful to range a channel without checking context in the loop.
+func OrDone[E any](ctx context.Context, c <-chan E) <-chan E {
+	out := make(chan E)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-c:
+				if !ok {
+					return
+				}
+				if !sendCtx(ctx, out, v) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Merge fan-in multiple channels into one channel. the returned channel will be closed after all input channels are closed or ctx is done
+func Merge[E any](ctx context.Context, cs ...<-chan E) <-chan E {
+	out := make(chan E)
+	var wg sync.WaitGroup
+	wg.Add(len(cs))
+	for _, c := range cs {
+		go func(c <-chan E) {
+			defer wg.Done()
+			for v := range OrDone(ctx, c) {
+				if !sendCtx(ctx, out, v) {
+					return
+				}
+			}
+		}(c)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// Broadcast fan-out every value from channel c to n channels. a value is sent to all returned channels
+// before next value is received, so the slowest reader decides the speed.
+// all returned channels will be closed after c is closed or ctx is done. n less than 1 is treated as 1
+func Broadcast[E any](ctx context.Context, c <-chan E, n int) []<-chan E {
+	if n <= 0 {
+		n = 1
+	}
+	outs := make([]chan E, n)
+	ret := make([]<-chan E, n)
+	for i := range outs {
+		outs[i] = make(chan E)
+		ret[i] = outs[i]
+	}
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+		// cases[0] is context done, others are send cases of each output channel
+		cases := make([]reflect.SelectCase, n+1)
+		cases[0] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())}
+		for v := range OrDone(ctx, c) {
+			rv := reflect.ValueOf(&v).Elem()
+			for i, out := range outs {
+				cases[i+1] = reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(out), Send: rv}
+			}
+			for left := n; left > 0; left-- {
+				chosen, _, _ := reflect.Select(cases)
+				if chosen == 0 {
+					return
+				}
+				// disable the sent case by nil channel
+				cases[chosen].Chan = reflect.Value{}
+			}
+		}
+	}()
+	return ret
+}
+
+// Tee split channel c into two channels and each value is sent to both of them
+func Tee[E any](ctx context.Context, c <-chan E) (<-chan E, <-chan E) {
+	outs := Broadcast(ctx, c, 2)
+	return outs[0], outs[1]
+}
+
+// Partition route values from channel c by key to the channel of same key in returned map.
+// values with a key not in keys are sent to the returned default channel.
+// values with the same key keep the order as received. it panics if keyFn is nil
+func Partition[E any, K comparable](ctx context.Context, c <-chan E, keyFn base.Func[K, E], keys ...K) (map[K]<-chan E, <-chan E) {
+	if keyFn == nil {
+		panic("concurrent: Partition keyFn is nil")
+	}
+	outs := make(map[K]chan E, len(keys))
+	ret := make(map[K]<-chan E, len(keys))
+	for _, k := range keys {
+		if _, ok := outs[k]; ok {
+			continue
+		}
+		out := make(chan E)
+		outs[k] = out
+		ret[k] = out
+	}
+	others := make(chan E)
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+			close(others)
+		}()
+		for v := range OrDone(ctx, c) {
+			out, ok := outs[keyFn(v)]
+			if !ok {
+				out = others
+			}
+			if !sendCtx(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return ret, others
+}
+
+// PartitionN route values from channel c to n channels by hash of value, hashFn(v) % n decides the target channel.
+// values with the same hash keep the order as received. n less than 1 is treated as 1, it panics if hashFn is nil
+func PartitionN[E any](ctx context.Context, c <-chan E, n int, hashFn base.Func[uint64, E]) []<-chan E {
+	if hashFn == nil {
+		panic("concurrent: PartitionN hashFn is nil")
+	}
+	if n <= 0 {
+		n = 1
+	}
+	outs := make([]chan E, n)
+	ret := make([]<-chan E, n)
+	for i := range outs {
+		outs[i] = make(chan E)
+		ret[i] = outs[i]
+	}
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+		for v := range OrDone(ctx, c) {
+			if !sendCtx(ctx, outs[hashFn(v)%uint64(n)], v) {
+				return
+			}
+		}
+	}()
+	return ret
+}
+
+// Batch group values from channel c into slices. a batch is sent once it reaches size,
+// or window duration elapsed since the first value of the batch if window is large than zero.
+// remaining values are flushed as the last batch after c is closed
+func Batch[E any](ctx context.Context, c <-chan E, size int, window time.Duration) <-chan []E {
+	out := make(chan []E)
+	if size <= 0 {
+		size = 1
+	}
+	go func() {
+		defer close(out)
+		batch := make([]E, 0, size)
+		timer := time.NewTimer(window)
+		stopTimer(timer)
+		defer timer.Stop()
+		var timeout <-chan time.Time
+
+		flush := func() bool {
+			if len(batch) == 0 {
+				return true
+			}
+			stopTimer(timer)
+			timeout = nil
+			b := batch
+			batch = make([]E, 0, size)
+			return sendCtx(ctx, out, b)
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-c:
+				if !ok {
+					flush()
+					return
+				}
+				batch = append(batch, v)
+				if len(batch) == 1 && window > 0 {
+					timer.Reset(window)
+					timeout = timer.C
+				}
+				if len(batch) >= size && !flush() {
+					return
+				}
+			case <-timeout:
+				timeout = nil
+				if !flush() {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Debounce emits the latest value from channel c only after wait duration has passed without another value received.
+// the pending value is flushed after c is closed
+func Debounce[E any](ctx context.Context, c <-chan E, wait time.Duration) <-chan E {
+	out := make(chan E)
+	go func() {
+		defer close(out)
+		timer := time.NewTimer(wait)
+		stopTimer(timer)
+		defer timer.Stop()
+		var timeout <-chan time.Time
+		var latest E
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-c:
+				if !ok {
+					if timeout != nil {
+						sendCtx(ctx, out, latest)
+					}
+					return
+				}
+				latest = v
+				stopTimer(timer)
+				timer.Reset(wait)
+				timeout = timer.C
+			case <-timeout:
+				timeout = nil
+				if !sendCtx(ctx, out, latest) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Throttle emits the first value from channel c and drops values received in the following interval duration
+func Throttle[E any](ctx context.Context, c <-chan E, interval time.Duration) <-chan E {
+	out := make(chan E)
+	go func() {
+		defer close(out)
+		var last time.Time
+		for v := range OrDone(ctx, c) {
+			now := time.Now()
+			if !last.IsZero() && now.Sub(last) < interval {
+				continue
+			}
+			last = now
+			if !sendCtx(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Bridge flatten a channel of channels into one channel. values are read from each inner channel in order until it is closed
+func Bridge[E any](ctx context.Context, cs <-chan (<-chan E)) <-chan E {
+	out := make(chan E)
+	go func() {
+		defer close(out)
+		for c := range OrDone(ctx, cs) {
+			for v := range OrDone(ctx, c) {
+				if !sendCtx(ctx, out, v) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// stopTimer stop timer and drain its channel
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package concurrent_test
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"testing"
 	"time"
 
@@ -206,3 +208,238 @@ func ExampleTryRecevieChan() {
 	// true hello
 	// false
 }
+
+func produce[E any](vs ...E) <-chan E {
+	ch := make(chan E)
+	go func() {
+		defer close(ch)
+		for _, v := range vs {
+			ch <- v
+		}
+	}()
+	return ch
+}
+
+func collect[E any](c <-chan E) []E {
+	ret := make([]E, 0)
+	for v := range c {
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+func TestOrDone(t *testing.T) {
+	Convey("TestOrDone", t, func() {
+		Convey("input closed", func() {
+			ret := collect(concurrent.OrDone(context.Background(), produce(1, 2, 3)))
+			So(ret, ShouldResemble, []int{1, 2, 3})
+		})
+
+		Convey("context cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			ch := make(chan int)
+			out := concurrent.OrDone(ctx, ch)
+			cancel()
+			_, ok := <-out
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestMerge(t *testing.T) {
+	Convey("TestMerge", t, func() {
+		ctx := context.Background()
+		ret := collect(concurrent.Merge(ctx, produce(1, 2), produce(3), produce(4, 5, 6)))
+		sort.Ints(ret)
+		So(ret, ShouldResemble, []int{1, 2, 3, 4, 5, 6})
+
+		ret = collect(concurrent.Merge[int](ctx))
+		So(ret, ShouldBeEmpty)
+	})
+}
+
+func TestBroadcast(t *testing.T) {
+	Convey("TestBroadcast", t, func() {
+		ctx := context.Background()
+		outs := concurrent.Broadcast(ctx, produce("a", "b", "c"), 3)
+		So(len(outs), ShouldEqual, 3)
+		results := make(chan []string, 3)
+		for _, out := range outs {
+			go func(c <-chan string) {
+				results <- collect(c)
+			}(out)
+		}
+		for i := 0; i < 3; i++ {
+			So(<-results, ShouldResemble, []string{"a", "b", "c"})
+		}
+
+		Convey("Tee", func() {
+			o1, o2 := concurrent.Tee(ctx, produce(1, 2))
+			// read in reverse order should not block
+			So(<-o2, ShouldEqual, 1)
+			So(<-o1, ShouldEqual, 1)
+			So(<-o1, ShouldEqual, 2)
+			So(<-o2, ShouldEqual, 2)
+		})
+
+		Convey("context cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			outs := concurrent.Broadcast(ctx, make(chan int), 2)
+			cancel()
+			_, ok := <-outs[0]
+			So(ok, ShouldBeFalse)
+			_, ok = <-outs[1]
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("invalid n", func() {
+			outs := concurrent.Broadcast(ctx, produce(1, 2), -1)
+			So(len(outs), ShouldEqual, 1)
+			So(collect(outs[0]), ShouldResemble, []int{1, 2})
+		})
+
+		Convey("nil key function", func() {
+			So(func() { concurrent.Partition[int, int](ctx, nil, nil, 0) }, ShouldPanic)
+			So(func() { concurrent.PartitionN[int](ctx, nil, 2, nil) }, ShouldPanic)
+		})
+	})
+}
+
+func TestPartition(t *testing.T) {
+	Convey("TestPartition", t, func() {
+		ctx := context.Background()
+		outs, others := concurrent.Partition(ctx, produce(1, 2, 3, 4, 5, 6, 7), func(v int) int {
+			return v % 3
+		}, 0, 1)
+
+		results := make(chan []int, 3)
+		go func() { results <- collect(outs[0]) }()
+		go func() { results <- collect(outs[1]) }()
+		go func() { results <- collect(others) }()
+		all := make([][]int, 0)
+		for i := 0; i < 3; i++ {
+			all = append(all, <-results)
+		}
+		sort.Slice(all, func(i, j int) bool { return all[i][0] < all[j][0] })
+		So(all, ShouldResemble, [][]int{{1, 4, 7}, {2, 5}, {3, 6}})
+
+		Convey("PartitionN", func() {
+			outs := concurrent.PartitionN(ctx, produce(1, 2, 3, 4), 2, func(v int) uint64 {
+				return uint64(v)
+			})
+			results := make(chan []int, 2)
+			go func() { results <- collect(outs[0]) }()
+			go func() { results <- collect(outs[1]) }()
+			r1, r2 := <-results, <-results
+			if r1[0] > r2[0] {
+				r1, r2 = r2, r1
+			}
+			So(r1, ShouldResemble, []int{1, 3})
+			So(r2, ShouldResemble, []int{2, 4})
+
+			outs = concurrent.PartitionN(ctx, produce(1, 2), 0, func(v int) uint64 {
+				return uint64(v)
+			})
+			So(len(outs), ShouldEqual, 1)
+			So(collect(outs[0]), ShouldResemble, []int{1, 2})
+		})
+
+		Convey("nil key function", func() {
+			So(func() { concurrent.Partition[int, int](ctx, nil, nil, 0) }, ShouldPanic)
+			So(func() { concurrent.PartitionN[int](ctx, nil, 2, nil) }, ShouldPanic)
+		})
+	})
+}
+
+func TestBatch(t *testing.T) {
+	Convey("TestBatch", t, func() {
+		ctx := context.Background()
+
+		Convey("batch by size", func() {
+			ret := collect(concurrent.Batch(ctx, produce(1, 2, 3, 4, 5), 2, 0))
+			So(ret, ShouldResemble, [][]int{{1, 2}, {3, 4}, {5}})
+		})
+
+		Convey("batch by time window", func() {
+			ch := make(chan int)
+			out := concurrent.Batch(ctx, ch, 10, 50*time.Millisecond)
+			go func() {
+				ch <- 1
+				ch <- 2
+				time.Sleep(100 * time.Millisecond)
+				ch <- 3
+				close(ch)
+			}()
+			So(<-out, ShouldResemble, []int{1, 2})
+			So(<-out, ShouldResemble, []int{3})
+			_, ok := <-out
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestDebounceAndThrottle(t *testing.T) {
+	Convey("TestDebounce", t, func() {
+		ch := make(chan int)
+		out := concurrent.Debounce(context.Background(), ch, 50*time.Millisecond)
+		go func() {
+			for i := 1; i <= 3; i++ {
+				ch <- i
+			}
+			time.Sleep(100 * time.Millisecond)
+			ch <- 4
+			ch <- 5
+			close(ch)
+		}()
+		So(collect(out), ShouldResemble, []int{3, 5})
+	})
+
+	Convey("TestThrottle", t, func() {
+		ch := make(chan int)
+		out := concurrent.Throttle(context.Background(), ch, 50*time.Millisecond)
+		go func() {
+			for i := 1; i <= 3; i++ {
+				ch <- i
+			}
+			time.Sleep(100 * time.Millisecond)
+			ch <- 4
+			ch <- 5
+			close(ch)
+		}()
+		So(collect(out), ShouldResemble, []int{1, 4})
+	})
+}
+
+func TestBridge(t *testing.T) {
+	Convey("TestBridge", t, func() {
+		cs := make(chan (<-chan int))
+		go func() {
+			defer close(cs)
+			cs <- produce(1, 2)
+			cs <- produce(3)
+			cs <- produce(4, 5)
+		}()
+		So(collect(concurrent.Bridge(context.Background(), cs)), ShouldResemble, []int{1, 2, 3, 4, 5})
+	})
+}
+
+func ExampleMerge() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c1 := make(chan int, 2)
+	c2 := make(chan int, 2)
+	c1 <- 1
+	c2 <- 2
+	close(c1)
+	close(c2)
+
+	sum := 0
+	for v := range concurrent.Merge(ctx, c1, c2) {
+		sum += v
+	}
+	fmt.Println(sum)
+
+	// Output:
+	// 3
+}
@@ -0,0 +1,291 @@
+// The cron spec parser in this file (field bounds, descriptors and range/step parsing)
+// is derived from github.com/robfig/cron (parser.go, spec.go), used under the MIT License:
+//
+// Copyright (C) 2012 Rob Figueroa
+// All Rights Reserved.
+//
+// MIT LICENSE
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package concurrent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron field bounds and names
+type cronBounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	cronSeconds = cronBounds{0, 59, nil}
+	cronMinutes = cronBounds{0, 59, nil}
+	cronHours   = cronBounds{0, 23, nil}
+	cronDom     = cronBounds{1, 31, nil}
+	cronMonths  = cronBounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	cronDow = cronBounds{0, 6, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+)
+
+// star bit marks the field is '*' or '?'
+const cronStarBit = 1 << 63
+
+// CronSchedule is a parsed cron expression.
+//
+// Both standard five fields "minute hour day-of-month month day-of-week" and
+// six fields with a leading second field are supported. each field accepts '*', '?', single value,
+// range 'a-b', step '*/n' or 'a-b/n', list 'a,b,c' and names of month(jan-dec) and week day(sun-sat).
+// Descriptors @yearly, @annually, @monthly, @weekly, @daily, @midnight and @hourly are supported too.
+type CronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	location                              *time.Location
+}
+
+// ParseCron parse cron expression and return CronSchedule in local time zone
+func ParseCron(spec string) (*CronSchedule, error) {
+	return ParseCronInLocation(spec, time.Local)
+}
+
+// ParseCronInLocation parse cron expression and return CronSchedule in target time zone
+func ParseCronInLocation(spec string, loc *time.Location) (*CronSchedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	spec = strings.TrimSpace(spec)
+	if d, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid cron expression '%s', expected 5 or 6 fields but found %d", spec, len(fields))
+	}
+
+	cs := &CronSchedule{location: loc}
+	var err error
+	targets := []struct {
+		bits   *uint64
+		bounds cronBounds
+	}{
+		{&cs.second, cronSeconds},
+		{&cs.minute, cronMinutes},
+		{&cs.hour, cronHours},
+		{&cs.dom, cronDom},
+		{&cs.month, cronMonths},
+		{&cs.dow, cronDow},
+	}
+	for i, t := range targets {
+		*t.bits, err = parseCronField(fields[i], t.bounds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s', %v", spec, err)
+		}
+	}
+	return cs, nil
+}
+
+func parseCronField(field string, b cronBounds) (uint64, error) {
+	var bits uint64
+	for _, expr := range strings.Split(field, ",") {
+		v, err := parseCronRange(expr, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= v
+	}
+	return bits, nil
+}
+
+func parseCronRange(expr string, b cronBounds) (uint64, error) {
+	var start, end, step uint = 0, 0, 1
+	var extra uint64
+
+	rangeAndStep := strings.Split(expr, "/")
+	if len(rangeAndStep) > 2 {
+		return 0, fmt.Errorf("too many slashes in '%s'", expr)
+	}
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	if len(lowAndHigh) > 2 {
+		return 0, fmt.Errorf("too many hyphens in '%s'", expr)
+	}
+
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		if len(lowAndHigh) > 1 {
+			return 0, fmt.Errorf("invalid range '%s'", expr)
+		}
+		start, end = b.min, b.max
+		extra = cronStarBit
+	} else {
+		var err error
+		start, err = parseCronValue(lowAndHigh[0], b)
+		if err != nil {
+			return 0, err
+		}
+		end = start
+		if len(lowAndHigh) == 2 {
+			end, err = parseCronValue(lowAndHigh[1], b)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if len(rangeAndStep) == 2 {
+		s, err := strconv.ParseUint(rangeAndStep[1], 10, 32)
+		if err != nil || s == 0 {
+			return 0, fmt.Errorf("invalid step in '%s'", expr)
+		}
+		step = uint(s)
+		// 'n/step' means from n to max
+		if len(lowAndHigh) == 1 && extra == 0 {
+			end = b.max
+		}
+		// star with step is not a full star any more
+		if step > 1 {
+			extra = 0
+		}
+	}
+
+	if start < b.min || end > b.max || start > end {
+		return 0, fmt.Errorf("value out of range [%d, %d] in '%s'", b.min, b.max, expr)
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits | extra, nil
+}
+
+func parseCronValue(s string, b cronBounds) (uint, error) {
+	if b.names != nil {
+		if v, ok := b.names[strings.ToLower(s)]; ok {
+			return v, nil
+		}
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", s)
+	}
+	return uint(v), nil
+}
+
+// Next return the next activation time later than t. return zero time if no time could be found in five years
+func (cs *CronSchedule) Next(t time.Time) time.Time {
+	origLoc := t.Location()
+	t = t.In(cs.location)
+
+	// start from next whole second
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+	added := false
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&cs.month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, cs.location)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !cs.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, cs.location)
+		}
+		t = t.AddDate(0, 0, 1)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Hour())&cs.hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, cs.location)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Minute())&cs.minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Second())&cs.second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t.In(origLoc)
+}
+
+// dayMatches day of month and day of week are matched by 'or' if both are restricted, otherwise by 'and'
+func (cs *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&cs.dom > 0
+	dowMatch := 1<<uint(t.Weekday())&cs.dow > 0
+	if cs.dom&cronStarBit > 0 || cs.dow&cronStarBit > 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
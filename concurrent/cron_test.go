@@ -0,0 +1,81 @@
+package concurrent_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/concurrent"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseCron(t *testing.T) {
+	Convey("TestParseCron", t, func() {
+		base := time.Date(2024, time.January, 15, 10, 20, 30, 0, time.UTC) // Monday
+
+		next := func(spec string, from time.Time) time.Time {
+			cs, err := concurrent.ParseCronInLocation(spec, time.UTC)
+			So(err, ShouldBeNil)
+			return cs.Next(from)
+		}
+
+		Convey("every minute with five fields", func() {
+			So(next("* * * * *", base), ShouldEqual, time.Date(2024, time.January, 15, 10, 21, 0, 0, time.UTC))
+		})
+
+		Convey("every second with six fields", func() {
+			So(next("* * * * * *", base), ShouldEqual, base.Add(time.Second))
+		})
+
+		Convey("step and range", func() {
+			So(next("*/15 * * * *", base), ShouldEqual, time.Date(2024, time.January, 15, 10, 30, 0, 0, time.UTC))
+			So(next("0 9-17/4 * * *", base), ShouldEqual, time.Date(2024, time.January, 15, 13, 0, 0, 0, time.UTC))
+		})
+
+		Convey("list and names", func() {
+			So(next("0 0 1 jan,Jul *", base), ShouldEqual, time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC))
+			So(next("30 8 * * sat", base), ShouldEqual, time.Date(2024, time.January, 20, 8, 30, 0, 0, time.UTC))
+		})
+
+		Convey("day of month or day of week", func() {
+			// 20th or any Wednesday
+			So(next("0 0 20 * wed", base), ShouldEqual, time.Date(2024, time.January, 17, 0, 0, 0, 0, time.UTC))
+		})
+
+		Convey("leap day", func() {
+			So(next("0 0 29 2 *", base), ShouldEqual, time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC))
+			So(next("0 0 29 2 *", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)), ShouldEqual,
+				time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC))
+		})
+
+		Convey("descriptors", func() {
+			So(next("@daily", base), ShouldEqual, time.Date(2024, time.January, 16, 0, 0, 0, 0, time.UTC))
+			So(next("@hourly", base), ShouldEqual, time.Date(2024, time.January, 15, 11, 0, 0, 0, time.UTC))
+			So(next("@yearly", base), ShouldEqual, time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC))
+		})
+
+		Convey("no activation time", func() {
+			So(next("0 0 30 2 *", base).IsZero(), ShouldBeTrue)
+		})
+
+		Convey("invalid expressions", func() {
+			for _, spec := range []string{"", "* * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "1-2-3 * * * *"} {
+				_, err := concurrent.ParseCron(spec)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func ExampleParseCron() {
+	cs, err := concurrent.ParseCron("0 */6 * * *")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	t := time.Date(2024, time.January, 1, 7, 0, 0, 0, time.Local)
+	fmt.Println(cs.Next(t).Format("15:04"))
+
+	// Output:
+	// 12:00
+}
@@ -0,0 +1,422 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// wildcard matches exactly one segment of topic
+	Single_Wildcard = "*"
+	// wildcard matches zero or more segments of topic, only allowed as the last segment
+	Multi_Wildcard = "**"
+	// separator of topic segments
+	Topic_Separator = "."
+)
+
+// OverflowPolicy decides what to do if buffer of async subscriber is full
+type OverflowPolicy int
+
+const (
+	Block_Policy      OverflowPolicy = 1 // block the publisher until buffer has space or context is done
+	DropNewest_Policy OverflowPolicy = 2 // drop the event being published
+	DropOldest_Policy OverflowPolicy = 3 // drop the oldest event in buffer to make room
+)
+
+// Event is the event delivered to subscribers
+type Event[T any] struct {
+	Topic   string    `json:"topic"`
+	Payload T         `json:"payload"`
+	Time    time.Time `json:"time"`
+}
+
+// Topic is a topic name bind with payload type
+type Topic[T any] struct {
+	name string
+}
+
+// NewTopic create a typed topic, name is segments split by '.' like "order.created"
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{name: name}
+}
+
+// Name return name of topic
+func (t Topic[T]) Name() string {
+	return t.name
+}
+
+type envelope struct {
+	topic   string
+	payload any
+	time    time.Time
+}
+
+// Subscription is the handle returned by Subscribe, use Unsubscribe to stop receiving events
+type Subscription struct {
+	bus      *EventBus
+	pattern  string
+	wildcard bool
+
+	accept func(payload any) bool
+	handle func(e envelope)
+
+	async   bool
+	queue   chan envelope
+	policy  OverflowPolicy
+	dropped atomic.Uint64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+// EventBus is an in-process publish/subscribe event bus, it is safe for concurrent use
+type EventBus struct {
+	mu        sync.RWMutex
+	exact     map[string][]*Subscription
+	wildcards []*Subscription
+	closed    bool
+}
+
+// NewEventBus create a new EventBus
+func NewEventBus() *EventBus {
+	return &EventBus{exact: make(map[string][]*Subscription)}
+}
+
+// Subscribe register a handler which is called synchronously in the publisher goroutine.
+// pattern could be a topic name or contains wildcards, "*" matches one segment and "**" as the last segment matches any segments.
+// only events with payload assignable to T are delivered, so subscribe with T=any to receive all events of matched topics.
+func Subscribe[T any](bus *EventBus, pattern string, handler func(Event[T])) (*Subscription, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("handler is nil")
+	}
+	sub, err := newSubscription(bus, pattern, handler)
+	if err != nil {
+		return nil, err
+	}
+	return sub, bus.add(sub)
+}
+
+// SubscribeAsync register a handler which is called in a dedicated goroutine of the subscription.
+// events are buffered by bufferSize and policy decides what to do if buffer is full.
+func SubscribeAsync[T any](bus *EventBus, pattern string, handler func(Event[T]), bufferSize int, policy OverflowPolicy) (*Subscription, error) {
+	if handler == nil {
+		return nil, fmt.Errorf("handler is nil")
+	}
+	if bufferSize <= 0 {
+		return nil, fmt.Errorf("invalid buffer size %d, must be large than zero", bufferSize)
+	}
+	if policy != Block_Policy && policy != DropNewest_Policy && policy != DropOldest_Policy {
+		return nil, fmt.Errorf("invalid overflow policy value %d", policy)
+	}
+	sub, err := newSubscription(bus, pattern, handler)
+	if err != nil {
+		return nil, err
+	}
+	sub.async = true
+	sub.policy = policy
+	sub.queue = make(chan envelope, bufferSize)
+	if err = bus.add(sub); err != nil {
+		return nil, err
+	}
+	go sub.loop()
+	return sub, nil
+}
+
+func newSubscription[T any](bus *EventBus, pattern string, handler func(Event[T])) (*Subscription, error) {
+	if bus == nil {
+		return nil, fmt.Errorf("event bus is nil")
+	}
+	wildcard, err := checkPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sub := &Subscription{
+		bus:      bus,
+		pattern:  pattern,
+		wildcard: wildcard,
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	sub.accept = func(payload any) bool {
+		_, ok := payload.(T)
+		if !ok {
+			// untyped nil payload is accepted by interface types
+			var t T
+			ok = payload == nil && any(t) == nil
+		}
+		return ok
+	}
+	sub.handle = func(e envelope) {
+		p, _ := e.payload.(T)
+		handler(Event[T]{Topic: e.topic, Payload: p, Time: e.time})
+	}
+	return sub, nil
+}
+
+// Publish publish payload to topic, return count of subscriptions the event is delivered to.
+// if a subscription use Block_Policy and its buffer is full, Publish waits until buffer has space.
+func Publish[T any](bus *EventBus, topic Topic[T], payload T) int {
+	return PublishContext(context.Background(), bus, topic, payload)
+}
+
+// PublishContext publish payload to topic, blocking delivery gives up if ctx is done.
+// return count of subscriptions the event is delivered to
+func PublishContext[T any](ctx context.Context, bus *EventBus, topic Topic[T], payload T) int {
+	return bus.publish(ctx, topic.name, payload)
+}
+
+// PublishAny publish payload to topic name without type binding
+func (bus *EventBus) PublishAny(ctx context.Context, topic string, payload any) int {
+	return bus.publish(ctx, topic, payload)
+}
+
+func (bus *EventBus) publish(ctx context.Context, topic string, payload any) int {
+	subs := bus.match(topic)
+	e := envelope{topic: topic, payload: payload, time: time.Now()}
+	count := 0
+	for _, sub := range subs {
+		if !sub.accept(payload) {
+			continue
+		}
+		if sub.deliver(ctx, e) {
+			count++
+		}
+	}
+	return count
+}
+
+// match return all subscriptions matched topic
+func (bus *EventBus) match(topic string) []*Subscription {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	if bus.closed {
+		return nil
+	}
+	exact := bus.exact[topic]
+	ret := make([]*Subscription, 0, len(exact))
+	ret = append(ret, exact...)
+	for _, sub := range bus.wildcards {
+		if MatchTopic(sub.pattern, topic) {
+			ret = append(ret, sub)
+		}
+	}
+	return ret
+}
+
+func (bus *EventBus) add(sub *Subscription) error {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if bus.closed {
+		return fmt.Errorf("event bus is closed")
+	}
+	if sub.wildcard {
+		bus.wildcards = append(bus.wildcards, sub)
+	} else {
+		bus.exact[sub.pattern] = append(bus.exact[sub.pattern], sub)
+	}
+	return nil
+}
+
+func (bus *EventBus) remove(sub *Subscription) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if sub.wildcard {
+		bus.wildcards = removeSubscription(bus.wildcards, sub)
+		return
+	}
+	subs := removeSubscription(bus.exact[sub.pattern], sub)
+	if len(subs) == 0 {
+		delete(bus.exact, sub.pattern)
+	} else {
+		bus.exact[sub.pattern] = subs
+	}
+}
+
+func removeSubscription(subs []*Subscription, sub *Subscription) []*Subscription {
+	ret := make([]*Subscription, 0, len(subs))
+	for _, s := range subs {
+		if s != sub {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// Size return count of subscriptions
+func (bus *EventBus) Size() int {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	count := len(bus.wildcards)
+	for _, subs := range bus.exact {
+		count += len(subs)
+	}
+	return count
+}
+
+// Close unsubscribe all subscriptions, publish or subscribe on a closed bus has no effect
+func (bus *EventBus) Close() {
+	bus.mu.Lock()
+	if bus.closed {
+		bus.mu.Unlock()
+		return
+	}
+	bus.closed = true
+	subs := bus.wildcards
+	for _, s := range bus.exact {
+		subs = append(subs, s...)
+	}
+	bus.wildcards = nil
+	bus.exact = make(map[string][]*Subscription)
+	bus.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.stop()
+	}
+}
+
+// deliver event to subscription, return false if event is dropped
+func (sub *Subscription) deliver(ctx context.Context, e envelope) bool {
+	if !sub.async {
+		select {
+		case <-sub.closed:
+			return false
+		default:
+		}
+		sub.handle(e)
+		return true
+	}
+
+	select {
+	case sub.queue <- e:
+		return true
+	case <-sub.closed:
+		return false
+	default:
+	}
+
+	// buffer is full
+	switch sub.policy {
+	case DropNewest_Policy:
+		sub.dropped.Add(1)
+		return false
+	case DropOldest_Policy:
+		for {
+			select {
+			case <-sub.queue:
+				sub.dropped.Add(1)
+			default:
+			}
+			select {
+			case sub.queue <- e:
+				return true
+			case <-sub.closed:
+				return false
+			default:
+			}
+		}
+	default:
+		select {
+		case sub.queue <- e:
+			return true
+		case <-sub.closed:
+			return false
+		case <-ctx.Done():
+			sub.dropped.Add(1)
+			return false
+		}
+	}
+}
+
+func (sub *Subscription) loop() {
+	defer close(sub.done)
+	for {
+		select {
+		case <-sub.closed:
+			return
+		case e := <-sub.queue:
+			sub.handle(e)
+		}
+	}
+}
+
+// Pattern return topic pattern of the subscription
+func (sub *Subscription) Pattern() string {
+	return sub.pattern
+}
+
+// Dropped return count of events dropped due to buffer full
+func (sub *Subscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Pending return count of events waiting in buffer, always zero for synchronous subscription
+func (sub *Subscription) Pending() int {
+	return len(sub.queue)
+}
+
+// Unsubscribe stop receiving events, pending events in buffer are discarded.
+// the handler in progress is not interrupted
+func (sub *Subscription) Unsubscribe() {
+	sub.bus.remove(sub)
+	sub.stop()
+}
+
+func (sub *Subscription) stop() {
+	sub.closeOnce.Do(func() {
+		close(sub.closed)
+	})
+}
+
+// Done return a channel closed after the subscription is unsubscribed and its delivery goroutine exited
+func (sub *Subscription) Done() <-chan struct{} {
+	if !sub.async {
+		return sub.closed
+	}
+	return sub.done
+}
+
+// checkPattern validate topic pattern and return true if it contains wildcard
+func checkPattern(pattern string) (bool, error) {
+	if pattern == "" {
+		return false, fmt.Errorf("topic pattern is empty")
+	}
+	wildcard := false
+	segments := strings.Split(pattern, Topic_Separator)
+	for i, seg := range segments {
+		switch seg {
+		case "":
+			return false, fmt.Errorf("invalid topic pattern '%s', empty segment", pattern)
+		case Single_Wildcard:
+			wildcard = true
+		case Multi_Wildcard:
+			if i != len(segments)-1 {
+				return false, fmt.Errorf("invalid topic pattern '%s', '%s' must be the last segment", pattern, Multi_Wildcard)
+			}
+			wildcard = true
+		}
+	}
+	return wildcard, nil
+}
+
+// MatchTopic return true if topic matches pattern. "*" matches one segment and "**" as the last segment matches any segments
+func MatchTopic(pattern, topic string) bool {
+	ps := strings.Split(pattern, Topic_Separator)
+	ts := strings.Split(topic, Topic_Separator)
+	for i, p := range ps {
+		if p == Multi_Wildcard {
+			return true
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if p != Single_Wildcard && p != ts[i] {
+			return false
+		}
+	}
+	return len(ps) == len(ts)
+}
@@ -0,0 +1,267 @@
+package eventbus_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/concurrent/eventbus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type Order struct {
+	Id    int
+	Price float64
+}
+
+func TestMatchTopic(t *testing.T) {
+	Convey("TestMatchTopic", t, func() {
+		So(eventbus.MatchTopic("order.created", "order.created"), ShouldBeTrue)
+		So(eventbus.MatchTopic("order.*", "order.created"), ShouldBeTrue)
+		So(eventbus.MatchTopic("order.*", "order.created.v1"), ShouldBeFalse)
+		So(eventbus.MatchTopic("*.created", "order.created"), ShouldBeTrue)
+		So(eventbus.MatchTopic("order.**", "order.created.v1"), ShouldBeTrue)
+		So(eventbus.MatchTopic("order.**", "order"), ShouldBeTrue)
+		So(eventbus.MatchTopic("**", "any.topic"), ShouldBeTrue)
+		So(eventbus.MatchTopic("order.*", "user.created"), ShouldBeFalse)
+		So(eventbus.MatchTopic("order.created.v1", "order.created"), ShouldBeFalse)
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	Convey("TestSubscribe", t, func() {
+		bus := eventbus.NewEventBus()
+		defer bus.Close()
+		created := eventbus.NewTopic[*Order]("order.created")
+		paid := eventbus.NewTopic[*Order]("order.paid")
+		greeting := eventbus.NewTopic[string]("order.greeting")
+
+		Convey("sync subscribe", func() {
+			var received []*Order
+			sub, err := eventbus.Subscribe(bus, created.Name(), func(e eventbus.Event[*Order]) {
+				received = append(received, e.Payload)
+			})
+			So(err, ShouldBeNil)
+			So(bus.Size(), ShouldEqual, 1)
+
+			So(eventbus.Publish(bus, created, &Order{Id: 1}), ShouldEqual, 1)
+			So(eventbus.Publish(bus, paid, &Order{Id: 2}), ShouldEqual, 0)
+			So(len(received), ShouldEqual, 1)
+			So(received[0].Id, ShouldEqual, 1)
+
+			sub.Unsubscribe()
+			So(bus.Size(), ShouldEqual, 0)
+			So(eventbus.Publish(bus, created, &Order{Id: 3}), ShouldEqual, 0)
+			So(len(received), ShouldEqual, 1)
+		})
+
+		Convey("wildcard subscribe with payload type filter", func() {
+			var orders, all atomic.Int32
+			topics := make([]string, 0)
+			sub1, err := eventbus.Subscribe(bus, "order.*", func(e eventbus.Event[*Order]) {
+				orders.Add(1)
+			})
+			So(err, ShouldBeNil)
+			defer sub1.Unsubscribe()
+			sub2, err := eventbus.Subscribe(bus, "**", func(e eventbus.Event[any]) {
+				all.Add(1)
+				topics = append(topics, e.Topic)
+			})
+			So(err, ShouldBeNil)
+			defer sub2.Unsubscribe()
+
+			So(eventbus.Publish(bus, created, &Order{Id: 1}), ShouldEqual, 2)
+			So(eventbus.Publish(bus, paid, &Order{Id: 1}), ShouldEqual, 2)
+			So(eventbus.Publish(bus, greeting, "hello"), ShouldEqual, 1) // type not matched for sub1
+			So(orders.Load(), ShouldEqual, 2)
+			So(all.Load(), ShouldEqual, 3)
+			So(topics, ShouldResemble, []string{"order.created", "order.paid", "order.greeting"})
+		})
+
+		Convey("invalid subscribe", func() {
+			_, err := eventbus.Subscribe(bus, "", func(e eventbus.Event[any]) {})
+			So(err, ShouldNotBeNil)
+			_, err = eventbus.Subscribe(bus, "a..b", func(e eventbus.Event[any]) {})
+			So(err, ShouldNotBeNil)
+			_, err = eventbus.Subscribe(bus, "a.**.b", func(e eventbus.Event[any]) {})
+			So(err, ShouldNotBeNil)
+			_, err = eventbus.Subscribe[any](bus, "a", nil)
+			So(err, ShouldNotBeNil)
+			_, err = eventbus.SubscribeAsync(bus, "a", func(e eventbus.Event[any]) {}, 0, eventbus.Block_Policy)
+			So(err, ShouldNotBeNil)
+			_, err = eventbus.SubscribeAsync(bus, "a", func(e eventbus.Event[any]) {}, 1, 0)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSubscribeAsync(t *testing.T) {
+	Convey("TestSubscribeAsync", t, func() {
+		bus := eventbus.NewEventBus()
+		defer bus.Close()
+		topic := eventbus.NewTopic[int]("number")
+
+		Convey("async delivery in order", func() {
+			ch := make(chan int, 10)
+			sub, err := eventbus.SubscribeAsync(bus, "number", func(e eventbus.Event[int]) {
+				ch <- e.Payload
+			}, 10, eventbus.Block_Policy)
+			So(err, ShouldBeNil)
+			for i := 0; i < 5; i++ {
+				eventbus.Publish(bus, topic, i)
+			}
+			for i := 0; i < 5; i++ {
+				So(<-ch, ShouldEqual, i)
+			}
+			sub.Unsubscribe()
+			<-sub.Done()
+		})
+
+		Convey("drop newest", func() {
+			block := make(chan bool)
+			ch := make(chan int, 10)
+			sub, _ := eventbus.SubscribeAsync(bus, "number", func(e eventbus.Event[int]) {
+				<-block
+				ch <- e.Payload
+			}, 2, eventbus.DropNewest_Policy)
+			defer sub.Unsubscribe()
+
+			eventbus.Publish(bus, topic, 0) // handling
+			time.Sleep(20 * time.Millisecond)
+			eventbus.Publish(bus, topic, 1)
+			eventbus.Publish(bus, topic, 2)
+			So(eventbus.Publish(bus, topic, 3), ShouldEqual, 0) // dropped
+			So(sub.Dropped(), ShouldEqual, 1)
+			close(block)
+			So([]int{<-ch, <-ch, <-ch}, ShouldResemble, []int{0, 1, 2})
+		})
+
+		Convey("drop oldest", func() {
+			block := make(chan bool)
+			ch := make(chan int, 10)
+			sub, _ := eventbus.SubscribeAsync(bus, "number", func(e eventbus.Event[int]) {
+				<-block
+				ch <- e.Payload
+			}, 2, eventbus.DropOldest_Policy)
+			defer sub.Unsubscribe()
+
+			eventbus.Publish(bus, topic, 0) // handling
+			time.Sleep(20 * time.Millisecond)
+			eventbus.Publish(bus, topic, 1)
+			eventbus.Publish(bus, topic, 2)
+			So(eventbus.Publish(bus, topic, 3), ShouldEqual, 1)
+			So(sub.Dropped(), ShouldEqual, 1)
+			close(block)
+			So([]int{<-ch, <-ch, <-ch}, ShouldResemble, []int{0, 2, 3})
+		})
+
+		Convey("block with context", func() {
+			block := make(chan bool)
+			sub, _ := eventbus.SubscribeAsync(bus, "number", func(e eventbus.Event[int]) {
+				<-block
+			}, 1, eventbus.Block_Policy)
+			defer sub.Unsubscribe()
+			defer close(block)
+
+			eventbus.Publish(bus, topic, 0) // handling
+			time.Sleep(20 * time.Millisecond)
+			eventbus.Publish(bus, topic, 1)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			now := time.Now()
+			So(eventbus.PublishContext(ctx, bus, topic, 2), ShouldEqual, 0)
+			So(time.Since(now), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+		})
+
+		Convey("concurrent publish", func() {
+			var count atomic.Int32
+			sub, _ := eventbus.SubscribeAsync(bus, "number", func(e eventbus.Event[int]) {
+				count.Add(1)
+			}, 16, eventbus.Block_Policy)
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						eventbus.Publish(bus, topic, j)
+					}
+				}()
+			}
+			wg.Wait()
+			for count.Load() < 1000 && sub.Pending() >= 0 {
+				time.Sleep(time.Millisecond)
+			}
+			So(count.Load(), ShouldEqual, 1000)
+			sub.Unsubscribe()
+		})
+	})
+}
+
+func TestEventStreamHandler(t *testing.T) {
+	Convey("TestEventStreamHandler", t, func() {
+		bus := eventbus.NewEventBus()
+		defer bus.Close()
+		topic := eventbus.NewTopic[string]("news")
+
+		ts := httptest.NewServer(http.HandlerFunc(eventbus.EventStreamHandler[string](bus, "news", 10, nil)))
+		defer ts.Close()
+
+		// response header is flushed with the first event, so do request in another goroutine
+		respCh := make(chan *http.Response, 1)
+		go func() {
+			resp, err := http.Get(ts.URL)
+			if err != nil {
+				close(respCh)
+				return
+			}
+			respCh <- resp
+		}()
+
+		// wait client subscribed
+		for bus.Size() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		eventbus.Publish(bus, topic, "hello")
+		resp, ok := <-respCh
+		So(ok, ShouldBeTrue)
+		defer resp.Body.Close()
+
+		reader := bufio.NewReader(resp.Body)
+		line, err := reader.ReadString('\n')
+		So(err, ShouldBeNil)
+		So(strings.HasPrefix(line, "data: "), ShouldBeTrue)
+		So(line, ShouldContainSubstring, `"topic":"news"`)
+		So(line, ShouldContainSubstring, `"payload":"hello"`)
+
+		// client disconnect should unsubscribe
+		resp.Body.Close()
+		for bus.Size() != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		So(bus.Size(), ShouldEqual, 0)
+	})
+}
+
+func ExampleSubscribe() {
+	bus := eventbus.NewEventBus()
+	defer bus.Close()
+
+	created := eventbus.NewTopic[*Order]("order.created")
+	sub, _ := eventbus.Subscribe(bus, "order.*", func(e eventbus.Event[*Order]) {
+		fmt.Println(e.Topic, e.Payload.Id)
+	})
+	defer sub.Unsubscribe()
+
+	eventbus.Publish(bus, created, &Order{Id: 100})
+
+	// Output:
+	// order.created 100
+}
@@ -0,0 +1,61 @@
+package eventbus
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/jhunters/goassist/web"
+)
+
+// EventStreamHandler return a http handler function to push events matched pattern to server-sent events clients.
+// each client gets an async subscription buffered by bufferSize which drops oldest events if client is too slow.
+// encode converts event to bytes sent to client, if encode is nil, events are sent as "data: <json>\n\n"
+func EventStreamHandler[T any](bus *EventBus, pattern string, bufferSize int, encode func(Event[T]) []byte) func(http.ResponseWriter, *http.Request) {
+	if encode == nil {
+		encode = EncodeJsonEvent[T]
+	}
+	return web.EventStreamHandler(func(r *http.Request, ch chan<- []byte) {
+		defer close(ch)
+		ctx := r.Context()
+
+		local := make(chan []byte)
+		sub, err := SubscribeAsync(bus, pattern, func(e Event[T]) {
+			select {
+			case local <- encode(e):
+			case <-ctx.Done():
+			}
+		}, bufferSize, DropOldest_Policy)
+		if err != nil {
+			return
+		}
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.Done(): // bus closed
+				return
+			case b := <-local:
+				select {
+				case ch <- b:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	})
+}
+
+// EncodeJsonEvent encode event as json in server-sent events data field
+func EncodeJsonEvent[T any](e Event[T]) []byte {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil
+	}
+	buf := bytes.NewBufferString("data: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+	return buf.Bytes()
+}
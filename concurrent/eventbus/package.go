@@ -0,0 +1,4 @@
+/*
+ * Package eventbus provides an in-process publish/subscribe event bus with typed topics
+ */
+package eventbus
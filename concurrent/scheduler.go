@@ -0,0 +1,248 @@
+package concurrent
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jhunters/goassist/base"
+)
+
+// Scheduler schedules tasks to run after a given delay, or to execute periodically or by cron expression.
+// all tasks are driven by a TimingWheel owned by or shared with the scheduler.
+type Scheduler struct {
+	tw       *TimingWheel
+	ownWheel bool
+
+	mu      sync.Mutex
+	tasks   map[*ScheduledTask]base.Null
+	stopped bool
+}
+
+// ScheduledTask is a cancellable handle of task scheduled by Scheduler
+type ScheduledTask struct {
+	s         *Scheduler
+	mu        sync.Mutex
+	timer     *WheelTimer
+	cancelled bool
+	periodic  bool
+	runs      atomic.Int64
+}
+
+// NewScheduler create a new Scheduler with a new started TimingWheel, the wheel will be stopped by Scheduler.Stop
+func NewScheduler(tick time.Duration, wheelSize int) (*Scheduler, error) {
+	if wheelSize <= 0 {
+		wheelSize = defaultWheelSize
+	}
+	tw, err := NewTimingWheel(tick, wheelSize)
+	if err != nil {
+		return nil, err
+	}
+	tw.Start()
+	s := NewSchedulerWithTimingWheel(tw)
+	s.ownWheel = true
+	return s, nil
+}
+
+// NewSchedulerWithTimingWheel create a new Scheduler backed by target TimingWheel.
+// the wheel could be shared by multiple schedulers and will not be stopped by Scheduler.Stop
+func NewSchedulerWithTimingWheel(tw *TimingWheel) *Scheduler {
+	return &Scheduler{tw: tw, tasks: make(map[*ScheduledTask]base.Null)}
+}
+
+// Schedule run task once after delay
+func (s *Scheduler) Schedule(delay time.Duration, task base.Call) (*ScheduledTask, error) {
+	if task == nil {
+		return nil, fmt.Errorf("task is nil")
+	}
+	st, err := s.newTask(false)
+	if err != nil {
+		return nil, err
+	}
+	err = st.next(delay, func() {
+		st.runs.Add(1)
+		s.remove(st)
+		base.SafetyCall(task)
+	})
+	return st.checkScheduled(err)
+}
+
+// ScheduleAtFixedRate run task first after initialDelay, and subsequently with the given period.
+// executions of same task never overlap, if an execution takes longer than period, the next one starts immediately after it finished
+func (s *Scheduler) ScheduleAtFixedRate(initialDelay, period time.Duration, task base.Call) (*ScheduledTask, error) {
+	if task == nil {
+		return nil, fmt.Errorf("task is nil")
+	}
+	if period <= 0 {
+		return nil, fmt.Errorf("invalid period %v, must be large than zero", period)
+	}
+	st, err := s.newTask(true)
+	if err != nil {
+		return nil, err
+	}
+	nextTime := time.Now().Add(initialDelay)
+	var run base.Call
+	run = func() {
+		st.runs.Add(1)
+		base.SafetyCall(task)
+		nextTime = nextTime.Add(period)
+		st.next(time.Until(nextTime), run)
+	}
+	return st.checkScheduled(st.next(initialDelay, run))
+}
+
+// ScheduleWithFixedDelay run task first after initialDelay, and subsequently with the given delay between
+// the termination of one execution and the commencement of the next
+func (s *Scheduler) ScheduleWithFixedDelay(initialDelay, delay time.Duration, task base.Call) (*ScheduledTask, error) {
+	if task == nil {
+		return nil, fmt.Errorf("task is nil")
+	}
+	if delay <= 0 {
+		return nil, fmt.Errorf("invalid delay %v, must be large than zero", delay)
+	}
+	st, err := s.newTask(true)
+	if err != nil {
+		return nil, err
+	}
+	var run base.Call
+	run = func() {
+		st.runs.Add(1)
+		base.SafetyCall(task)
+		st.next(delay, run)
+	}
+	return st.checkScheduled(st.next(initialDelay, run))
+}
+
+// ScheduleCron run task at every activation time of cron expression. see CronSchedule for expression format
+func (s *Scheduler) ScheduleCron(spec string, task base.Call) (*ScheduledTask, error) {
+	cs, err := ParseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	return s.ScheduleCronSchedule(cs, task)
+}
+
+// ScheduleCronSchedule run task at every activation time of parsed CronSchedule
+func (s *Scheduler) ScheduleCronSchedule(cs *CronSchedule, task base.Call) (*ScheduledTask, error) {
+	if task == nil {
+		return nil, fmt.Errorf("task is nil")
+	}
+	if cs == nil {
+		return nil, fmt.Errorf("cron schedule is nil")
+	}
+	first := cs.Next(time.Now())
+	if first.IsZero() {
+		return nil, fmt.Errorf("cron schedule has no activation time")
+	}
+	st, err := s.newTask(true)
+	if err != nil {
+		return nil, err
+	}
+	nextTime := first
+	var run base.Call
+	run = func() {
+		st.runs.Add(1)
+		base.SafetyCall(task)
+		nextTime = cs.Next(nextTime)
+		if nextTime.IsZero() {
+			s.remove(st)
+			return
+		}
+		st.next(time.Until(nextTime), run)
+	}
+	return st.checkScheduled(st.next(time.Until(first), run))
+}
+
+// Size return count of scheduled tasks which are not cancelled or finished
+func (s *Scheduler) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tasks)
+}
+
+// Stop cancel all scheduled tasks and stop the TimingWheel if it is created by scheduler
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	tasks := s.tasks
+	s.tasks = make(map[*ScheduledTask]base.Null)
+	s.mu.Unlock()
+
+	for st := range tasks {
+		st.Cancel()
+	}
+	if s.ownWheel {
+		s.tw.Stop()
+	}
+}
+
+func (s *Scheduler) newTask(periodic bool) (*ScheduledTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil, fmt.Errorf("scheduler is stopped")
+	}
+	st := &ScheduledTask{s: s, periodic: periodic}
+	s.tasks[st] = base.Empty
+	return st, nil
+}
+
+func (s *Scheduler) remove(st *ScheduledTask) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tasks, st)
+}
+
+// next add next execution to timing wheel unless task is cancelled
+func (st *ScheduledTask) next(delay time.Duration, run base.Call) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.cancelled {
+		return nil
+	}
+	t, err := st.s.tw.AfterFunc(delay, run)
+	if err != nil {
+		return err
+	}
+	st.timer = t
+	return nil
+}
+
+func (st *ScheduledTask) checkScheduled(err error) (*ScheduledTask, error) {
+	if err != nil {
+		st.s.remove(st)
+		return nil, err
+	}
+	return st, nil
+}
+
+// Cancel cancel the task, the execution in progress will not be interrupted.
+// return false if task is already cancelled or a one-shot task already run
+func (st *ScheduledTask) Cancel() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.cancelled {
+		return false
+	}
+	st.cancelled = true
+	st.s.remove(st)
+	stopped := st.timer != nil && st.timer.Stop()
+	return st.periodic || stopped
+}
+
+// IsCancelled return true if task is cancelled
+func (st *ScheduledTask) IsCancelled() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.cancelled
+}
+
+// Runs return execution count of the task
+func (st *ScheduledTask) Runs() int64 {
+	return st.runs.Load()
+}
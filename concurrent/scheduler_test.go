@@ -0,0 +1,147 @@
+package concurrent_test
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/concurrent"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScheduler(t *testing.T) {
+	Convey("TestScheduler", t, func() {
+		s, err := concurrent.NewScheduler(5*time.Millisecond, 16)
+		So(err, ShouldBeNil)
+		defer s.Stop()
+
+		Convey("Schedule once", func() {
+			ch := make(chan string, 1)
+			task, err := s.Schedule(20*time.Millisecond, func() {
+				ch <- var_s
+			})
+			So(err, ShouldBeNil)
+			So(<-ch, ShouldEqual, var_s)
+			So(task.Runs(), ShouldEqual, 1)
+			So(task.Cancel(), ShouldBeFalse)
+		})
+
+		Convey("Schedule cancel", func() {
+			var count atomic.Int32
+			task, err := s.Schedule(50*time.Millisecond, func() {
+				count.Add(1)
+			})
+			So(err, ShouldBeNil)
+			So(s.Size(), ShouldEqual, 1)
+			So(task.Cancel(), ShouldBeTrue)
+			So(task.IsCancelled(), ShouldBeTrue)
+			So(s.Size(), ShouldEqual, 0)
+			time.Sleep(100 * time.Millisecond)
+			So(count.Load(), ShouldEqual, 0)
+		})
+
+		Convey("ScheduleAtFixedRate", func() {
+			var count atomic.Int32
+			task, err := s.ScheduleAtFixedRate(0, 20*time.Millisecond, func() {
+				count.Add(1)
+			})
+			So(err, ShouldBeNil)
+			time.Sleep(210 * time.Millisecond)
+			So(task.Cancel(), ShouldBeTrue)
+			c := count.Load()
+			So(c, ShouldBeBetweenOrEqual, 8, 12)
+			time.Sleep(50 * time.Millisecond)
+			So(count.Load(), ShouldEqual, c)
+		})
+
+		Convey("ScheduleWithFixedDelay", func() {
+			var count atomic.Int32
+			task, err := s.ScheduleWithFixedDelay(0, 20*time.Millisecond, func() {
+				count.Add(1)
+				time.Sleep(20 * time.Millisecond)
+			})
+			So(err, ShouldBeNil)
+			time.Sleep(210 * time.Millisecond)
+			task.Cancel()
+			So(count.Load(), ShouldBeBetweenOrEqual, 4, 6)
+		})
+
+		Convey("ScheduleCron", func() {
+			ch := make(chan time.Time, 1)
+			task, err := s.ScheduleCron("* * * * * *", func() {
+				ch <- time.Now()
+			})
+			So(err, ShouldBeNil)
+			fired := <-ch
+			So(fired.Nanosecond(), ShouldBeLessThan, 100*time.Millisecond)
+			So(task.Cancel(), ShouldBeTrue)
+
+			_, err = s.ScheduleCron("bad", func() {})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("invalid parameters", func() {
+			_, err := s.Schedule(time.Millisecond, nil)
+			So(err, ShouldNotBeNil)
+			_, err = s.ScheduleAtFixedRate(0, 0, func() {})
+			So(err, ShouldNotBeNil)
+			_, err = s.ScheduleWithFixedDelay(0, -1, func() {})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("TestScheduler stop", t, func() {
+		tw, err := concurrent.NewTimingWheel(5*time.Millisecond, 16)
+		So(err, ShouldBeNil)
+		tw.Start()
+		defer tw.Stop()
+
+		s := concurrent.NewSchedulerWithTimingWheel(tw)
+		var count atomic.Int32
+		s.ScheduleAtFixedRate(50*time.Millisecond, 10*time.Millisecond, func() {
+			count.Add(1)
+		})
+		s.Stop()
+		_, err = s.Schedule(time.Millisecond, func() {})
+		So(err, ShouldNotBeNil)
+
+		// shared timing wheel is still working
+		ch := make(chan bool, 1)
+		_, err = tw.AfterFunc(10*time.Millisecond, func() { ch <- true })
+		So(err, ShouldBeNil)
+		So(<-ch, ShouldBeTrue)
+		time.Sleep(60 * time.Millisecond)
+		So(count.Load(), ShouldEqual, 0)
+	})
+}
+
+func ExampleScheduler() {
+	s, err := concurrent.NewScheduler(10*time.Millisecond, 64)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer s.Stop()
+
+	done := make(chan bool)
+	s.Schedule(50*time.Millisecond, func() {
+		fmt.Println("run once")
+		done <- true
+	})
+	<-done
+
+	var count atomic.Int32
+	task, _ := s.ScheduleAtFixedRate(0, 10*time.Millisecond, func() {
+		if count.Add(1) == 3 {
+			done <- true
+		}
+	})
+	<-done
+	task.Cancel()
+	fmt.Println(task.IsCancelled())
+
+	// Output:
+	// run once
+	// true
+}
@@ -0,0 +1,72 @@
+package atomicx
+
+import (
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+)
+
+const cacheLineSize = 64
+
+// paddedCell is a counter cell padded to a cache line to avoid false sharing
+type paddedCell struct {
+	v atomic.Int64
+	_ [cacheLineSize - 8]byte
+}
+
+// LongAdder is a int64 counter striped into multiple cells to reduce contention of concurrent updates.
+// it is preferable to AtomicInt when many goroutines update a common sum that is used for purposes such as
+// collecting statistics, but not for fine-grained synchronization control.
+type LongAdder struct {
+	cells []paddedCell
+	mask  uint32
+}
+
+// NewLongAdder return a LongAdder object, cells count is the power of two not less than GOMAXPROCS
+func NewLongAdder() *LongAdder {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	return &LongAdder{cells: make([]paddedCell, n), mask: uint32(n - 1)}
+}
+
+// Add adds the given value
+func (la *LongAdder) Add(x int64) {
+	la.cells[rand.Uint32()&la.mask].v.Add(x)
+}
+
+// Increment equivalent to Add(1)
+func (la *LongAdder) Increment() {
+	la.Add(1)
+}
+
+// Decrement equivalent to Add(-1)
+func (la *LongAdder) Decrement() {
+	la.Add(-1)
+}
+
+// Sum return the current sum. concurrent updates while the sum is calculating might not be incorporated
+func (la *LongAdder) Sum() int64 {
+	var sum int64
+	for i := range la.cells {
+		sum += la.cells[i].v.Load()
+	}
+	return sum
+}
+
+// Reset resets cells to zero. it is only effective if there are no concurrent updates
+func (la *LongAdder) Reset() {
+	for i := range la.cells {
+		la.cells[i].v.Store(0)
+	}
+}
+
+// SumThenReset return the current sum and reset cells to zero. updates in process may be counted to the next sum
+func (la *LongAdder) SumThenReset() int64 {
+	var sum int64
+	for i := range la.cells {
+		sum += la.cells[i].v.Swap(0)
+	}
+	return sum
+}
@@ -0,0 +1,45 @@
+package atomicx_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/jhunters/goassist/concurrent/syncx/atomicx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLongAdder(t *testing.T) {
+	Convey("TestLongAdder", t, func() {
+		la := atomicx.NewLongAdder()
+		So(la.Sum(), ShouldEqual, 0)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					la.Increment()
+				}
+				la.Add(10)
+				la.Decrement()
+			}()
+		}
+		wg.Wait()
+		So(la.Sum(), ShouldEqual, 16*1009)
+		So(la.SumThenReset(), ShouldEqual, 16*1009)
+		So(la.Sum(), ShouldEqual, 0)
+		la.Add(5)
+		la.Reset()
+		So(la.Sum(), ShouldEqual, 0)
+	})
+}
+
+func BenchmarkLongAdder(b *testing.B) {
+	la := atomicx.NewLongAdder()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			la.Increment()
+		}
+	})
+}
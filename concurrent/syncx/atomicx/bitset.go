@@ -0,0 +1,117 @@
+package atomicx
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// AtomicBitSet a fixed size bit set that each bit may be updated atomically
+type AtomicBitSet struct {
+	size  int
+	words []atomic.Uint64
+}
+
+// NewAtomicBitSet return a AtomicBitSet object with size bits, all bits are cleared
+func NewAtomicBitSet(size int) *AtomicBitSet {
+	if size < 0 {
+		size = 0
+	}
+	return &AtomicBitSet{size: size, words: make([]atomic.Uint64, (size+63)/64)}
+}
+
+// Size return count of bits
+func (bs *AtomicBitSet) Size() int {
+	return bs.size
+}
+
+func (bs *AtomicBitSet) check(i int) {
+	if i < 0 || i >= bs.size {
+		panic("atomicx: bit index out of range")
+	}
+}
+
+// Set sets bit i to one and return the old value. it panics if i is out of range
+func (bs *AtomicBitSet) Set(i int) bool {
+	bs.check(i)
+	w := &bs.words[i/64]
+	mask := uint64(1) << (uint(i) % 64)
+	for {
+		old := w.Load()
+		if old&mask != 0 {
+			return true
+		}
+		if w.CompareAndSwap(old, old|mask) {
+			return false
+		}
+	}
+}
+
+// Clear sets bit i to zero and return the old value. it panics if i is out of range
+func (bs *AtomicBitSet) Clear(i int) bool {
+	bs.check(i)
+	w := &bs.words[i/64]
+	mask := uint64(1) << (uint(i) % 64)
+	for {
+		old := w.Load()
+		if old&mask == 0 {
+			return false
+		}
+		if w.CompareAndSwap(old, old&^mask) {
+			return true
+		}
+	}
+}
+
+// Flip flips bit i and return the old value. it panics if i is out of range
+func (bs *AtomicBitSet) Flip(i int) bool {
+	bs.check(i)
+	w := &bs.words[i/64]
+	mask := uint64(1) << (uint(i) % 64)
+	for {
+		old := w.Load()
+		if w.CompareAndSwap(old, old^mask) {
+			return old&mask != 0
+		}
+	}
+}
+
+// Test return true if bit i is set. it panics if i is out of range
+func (bs *AtomicBitSet) Test(i int) bool {
+	bs.check(i)
+	return bs.words[i/64].Load()&(uint64(1)<<(uint(i)%64)) != 0
+}
+
+// Count return count of set bits
+func (bs *AtomicBitSet) Count() int {
+	count := 0
+	for i := range bs.words {
+		count += bits.OnesCount64(bs.words[i].Load())
+	}
+	return count
+}
+
+// ClearAll sets all bits to zero
+func (bs *AtomicBitSet) ClearAll() {
+	for i := range bs.words {
+		bs.words[i].Store(0)
+	}
+}
+
+// NextSet return index of the first set bit from i(inclusive), or -1 if not found
+func (bs *AtomicBitSet) NextSet(i int) int {
+	if i < 0 {
+		i = 0
+	}
+	for i < bs.size {
+		w := bs.words[i/64].Load() >> (uint(i) % 64)
+		if w != 0 {
+			next := i + bits.TrailingZeros64(w)
+			if next < bs.size {
+				return next
+			}
+			return -1
+		}
+		i = (i/64 + 1) * 64
+	}
+	return -1
+}
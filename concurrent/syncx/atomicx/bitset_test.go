@@ -0,0 +1,52 @@
+package atomicx_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/jhunters/goassist/concurrent/syncx/atomicx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAtomicBitSet(t *testing.T) {
+	Convey("TestAtomicBitSet", t, func() {
+		bs := atomicx.NewAtomicBitSet(130)
+		So(bs.Size(), ShouldEqual, 130)
+		So(bs.Count(), ShouldEqual, 0)
+
+		So(bs.Set(3), ShouldBeFalse)
+		So(bs.Set(3), ShouldBeTrue)
+		So(bs.Set(129), ShouldBeFalse)
+		So(bs.Test(3), ShouldBeTrue)
+		So(bs.Test(4), ShouldBeFalse)
+		So(bs.Count(), ShouldEqual, 2)
+		So(bs.NextSet(0), ShouldEqual, 3)
+		So(bs.NextSet(4), ShouldEqual, 129)
+		So(bs.Flip(64), ShouldBeFalse)
+		So(bs.NextSet(4), ShouldEqual, 64)
+		So(bs.Clear(3), ShouldBeTrue)
+		So(bs.Clear(3), ShouldBeFalse)
+		So(bs.Count(), ShouldEqual, 2)
+		bs.ClearAll()
+		So(bs.Count(), ShouldEqual, 0)
+		So(bs.NextSet(0), ShouldEqual, -1)
+
+		So(func() { bs.Set(130) }, ShouldPanic)
+		So(func() { bs.Test(-1) }, ShouldPanic)
+
+		Convey("concurrent set", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(offset int) {
+					defer wg.Done()
+					for j := offset; j < 130; j += 10 {
+						bs.Set(j)
+					}
+				}(i)
+			}
+			wg.Wait()
+			So(bs.Count(), ShouldEqual, 130)
+		})
+	})
+}
@@ -0,0 +1,62 @@
+package atomicx
+
+import "sync/atomic"
+
+// AtomicBool a boolean value that may be updated atomically. The zero value is false.
+type AtomicBool struct {
+	value uint32
+}
+
+// NewAtomicBool return a AtomicBool object with initial value
+func NewAtomicBool(initial bool) *AtomicBool {
+	ab := &AtomicBool{}
+	ab.Store(initial)
+	return ab
+}
+
+// Get the current value.
+func (ab *AtomicBool) Get() bool {
+	return ab.Load()
+}
+
+// Load the current value
+func (ab *AtomicBool) Load() bool {
+	return atomic.LoadUint32(&ab.value) != 0
+}
+
+// Set the value
+func (ab *AtomicBool) Set(value bool) {
+	ab.Store(value)
+}
+
+// Store the value
+func (ab *AtomicBool) Store(value bool) {
+	atomic.StoreUint32(&ab.value, b32(value))
+}
+
+// CompareAndSet executes the compare-and-swap operation for an new value.
+func (ab *AtomicBool) CompareAndSet(expect, update bool) bool {
+	return atomic.CompareAndSwapUint32(&ab.value, b32(expect), b32(update))
+}
+
+// GetAndSet set new value and return the old value
+func (ab *AtomicBool) GetAndSet(update bool) bool {
+	return atomic.SwapUint32(&ab.value, b32(update)) != 0
+}
+
+// Toggle flip the value and return the old value
+func (ab *AtomicBool) Toggle() bool {
+	for {
+		old := ab.Load()
+		if ab.CompareAndSet(old, !old) {
+			return old
+		}
+	}
+}
+
+func b32(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package atomicx_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jhunters/goassist/concurrent/syncx/atomicx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAtomicBool(t *testing.T) {
+	Convey("TestAtomicBool", t, func() {
+		var zero atomicx.AtomicBool
+		So(zero.Get(), ShouldBeFalse)
+
+		ab := atomicx.NewAtomicBool(true)
+		So(ab.Load(), ShouldBeTrue)
+		So(ab.CompareAndSet(false, true), ShouldBeFalse)
+		So(ab.CompareAndSet(true, false), ShouldBeTrue)
+		So(ab.GetAndSet(true), ShouldBeFalse)
+		So(ab.Toggle(), ShouldBeTrue)
+		So(ab.Get(), ShouldBeFalse)
+		ab.Set(true)
+		So(ab.Get(), ShouldBeTrue)
+
+		Convey("only one winner", func() {
+			ab.Set(false)
+			var winners atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if ab.CompareAndSet(false, true) {
+						winners.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			So(winners.Load(), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,60 @@
+package atomicx
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/jhunters/goassist/unsafex"
+)
+
+// AtomicFloat64 a float64 value that may be updated atomically
+type AtomicFloat64 struct {
+	value *uint64
+}
+
+// NewAtomicFloat64 return a AtomicFloat64 object
+func NewAtomicFloat64(v *float64) *AtomicFloat64 {
+	return &AtomicFloat64{unsafex.As[float64, uint64](v)}
+}
+
+// Get the current value.
+func (af *AtomicFloat64) Get() float64 {
+	return af.Load()
+}
+
+// Load the current value
+func (af *AtomicFloat64) Load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(af.value))
+}
+
+// Set the value
+func (af *AtomicFloat64) Set(value float64) {
+	af.Store(value)
+}
+
+// Store the value
+func (af *AtomicFloat64) Store(value float64) {
+	atomic.StoreUint64(af.value, math.Float64bits(value))
+}
+
+// AddandGet add value by compare-and-swap loop and return added value
+func (af *AtomicFloat64) AddandGet(delta float64) float64 {
+	for {
+		old := atomic.LoadUint64(af.value)
+		v := math.Float64frombits(old) + delta
+		if atomic.CompareAndSwapUint64(af.value, old, math.Float64bits(v)) {
+			return v
+		}
+	}
+}
+
+// CompareAndSet executes the compare-and-swap operation for an new value.
+// values are compared by bits, so NaN could be compared and 0 is not equal to -0
+func (af *AtomicFloat64) CompareAndSet(expect, update float64) bool {
+	return atomic.CompareAndSwapUint64(af.value, math.Float64bits(expect), math.Float64bits(update))
+}
+
+// GetAndSet set new value and return the old value
+func (af *AtomicFloat64) GetAndSet(update float64) float64 {
+	return math.Float64frombits(atomic.SwapUint64(af.value, math.Float64bits(update)))
+}
@@ -0,0 +1,42 @@
+package atomicx_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/jhunters/goassist/concurrent/syncx/atomicx"
+	"github.com/jhunters/goassist/conv"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAtomicFloat64(t *testing.T) {
+	Convey("TestAtomicFloat64", t, func() {
+		f := conv.ToPtr(1.5)
+		af := atomicx.NewAtomicFloat64(f)
+		So(af.Get(), ShouldEqual, 1.5)
+
+		So(af.AddandGet(1.25), ShouldEqual, 2.75)
+		So(*f, ShouldEqual, 2.75)
+
+		So(af.CompareAndSet(1, 2), ShouldBeFalse)
+		So(af.CompareAndSet(2.75, -1), ShouldBeTrue)
+		So(af.GetAndSet(3), ShouldEqual, -1)
+		af.Set(0)
+		So(af.Load(), ShouldEqual, 0)
+
+		Convey("concurrent add", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						af.AddandGet(0.5)
+					}
+				}()
+			}
+			wg.Wait()
+			So(af.Get(), ShouldEqual, 500)
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package atomicx
+
+import (
+	"sync/atomic"
+
+	"github.com/jhunters/goassist/base"
+)
+
+// AtomicPointer a pointer of type *T that may be updated atomically. The zero value is a nil *T.
+type AtomicPointer[T any] struct {
+	p atomic.Pointer[T]
+}
+
+// NewAtomicPointer return a AtomicPointer object with initial pointer
+func NewAtomicPointer[T any](v *T) *AtomicPointer[T] {
+	ap := &AtomicPointer[T]{}
+	ap.p.Store(v)
+	return ap
+}
+
+// Load the current pointer
+func (ap *AtomicPointer[T]) Load() *T {
+	return ap.p.Load()
+}
+
+// Store the pointer
+func (ap *AtomicPointer[T]) Store(v *T) {
+	ap.p.Store(v)
+}
+
+// Swap store new pointer and return the old one
+func (ap *AtomicPointer[T]) Swap(v *T) *T {
+	return ap.p.Swap(v)
+}
+
+// CompareAndSwap executes the compare-and-swap operation, pointers are compared by address
+func (ap *AtomicPointer[T]) CompareAndSwap(old, new *T) bool {
+	return ap.p.CompareAndSwap(old, new)
+}
+
+// Update replace pointer with the result of f by compare-and-swap loop and return the new pointer.
+// f may be called more than once under contention, so it should be free of side effects
+func (ap *AtomicPointer[T]) Update(f base.Func[*T, *T]) *T {
+	for {
+		old := ap.p.Load()
+		v := f(old)
+		if ap.p.CompareAndSwap(old, v) {
+			return v
+		}
+	}
+}
+
+// AtomicValue a value of type T that may be updated atomically. The zero value holds zero value of T.
+type AtomicValue[T comparable] struct {
+	p atomic.Pointer[T]
+}
+
+// NewAtomicValue return a AtomicValue object with initial value
+func NewAtomicValue[T comparable](v T) *AtomicValue[T] {
+	av := &AtomicValue[T]{}
+	av.p.Store(&v)
+	return av
+}
+
+// Load the current value
+func (av *AtomicValue[T]) Load() T {
+	p := av.p.Load()
+	if p == nil {
+		var empty T
+		return empty
+	}
+	return *p
+}
+
+// Store the value
+func (av *AtomicValue[T]) Store(v T) {
+	av.p.Store(&v)
+}
+
+// Swap store new value and return the old one
+func (av *AtomicValue[T]) Swap(v T) T {
+	p := av.p.Swap(&v)
+	if p == nil {
+		var empty T
+		return empty
+	}
+	return *p
+}
+
+// CompareAndSwap executes the compare-and-swap operation, values are compared by ==
+func (av *AtomicValue[T]) CompareAndSwap(old, new T) bool {
+	for {
+		p := av.p.Load()
+		var cur T
+		if p != nil {
+			cur = *p
+		}
+		if cur != old {
+			return false
+		}
+		if av.p.CompareAndSwap(p, &new) {
+			return true
+		}
+	}
+}
+
+// Update replace value with the result of f by compare-and-swap loop and return the new value.
+// f may be called more than once under contention, so it should be free of side effects
+func (av *AtomicValue[T]) Update(f base.Func[T, T]) T {
+	for {
+		p := av.p.Load()
+		var cur T
+		if p != nil {
+			cur = *p
+		}
+		v := f(cur)
+		if av.p.CompareAndSwap(p, &v) {
+			return v
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package atomicx_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/jhunters/goassist/concurrent/syncx/atomicx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type config struct {
+	name    string
+	version int
+}
+
+func TestAtomicPointer(t *testing.T) {
+	Convey("TestAtomicPointer", t, func() {
+		c1 := &config{"a", 1}
+		c2 := &config{"b", 2}
+		ap := atomicx.NewAtomicPointer(c1)
+		So(ap.Load(), ShouldEqual, c1)
+		So(ap.CompareAndSwap(c2, c1), ShouldBeFalse)
+		So(ap.CompareAndSwap(c1, c2), ShouldBeTrue)
+		So(ap.Swap(c1), ShouldEqual, c2)
+
+		Convey("concurrent update", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						ap.Update(func(old *config) *config {
+							return &config{old.name, old.version + 1}
+						})
+					}
+				}()
+			}
+			wg.Wait()
+			So(ap.Load().version, ShouldEqual, 1001)
+		})
+
+		Convey("zero value", func() {
+			var p atomicx.AtomicPointer[config]
+			So(p.Load(), ShouldBeNil)
+			p.Store(c1)
+			So(p.Load(), ShouldEqual, c1)
+		})
+	})
+}
+
+func TestAtomicValue(t *testing.T) {
+	Convey("TestAtomicValue", t, func() {
+		av := atomicx.NewAtomicValue("hello")
+		So(av.Load(), ShouldEqual, "hello")
+		So(av.CompareAndSwap("world", "x"), ShouldBeFalse)
+		So(av.CompareAndSwap("hello", "world"), ShouldBeTrue)
+		So(av.Swap("hello"), ShouldEqual, "world")
+		av.Store("matt")
+		So(av.Load(), ShouldEqual, "matt")
+
+		Convey("zero value", func() {
+			var v atomicx.AtomicValue[int]
+			So(v.Load(), ShouldEqual, 0)
+			So(v.CompareAndSwap(0, 1), ShouldBeTrue)
+			So(v.Load(), ShouldEqual, 1)
+		})
+
+		Convey("concurrent update", func() {
+			v := atomicx.NewAtomicValue(config{"a", 0})
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						v.Update(func(old config) config {
+							old.version++
+							return old
+						})
+					}
+				}()
+			}
+			wg.Wait()
+			So(v.Load().version, ShouldEqual, 1000)
+		})
+	})
+}
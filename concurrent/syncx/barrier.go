@@ -0,0 +1,142 @@
+package syncx
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/jhunters/goassist/base"
+)
+
+// ErrBrokenBarrier is returned by Barrier.Await if barrier is broken by a waiting party cancelled or Reset
+var ErrBrokenBarrier = errors.New("syncx: barrier is broken")
+
+type generation struct {
+	trip   chan struct{}
+	broken bool
+}
+
+// Barrier is a cyclic barrier that allows a set of goroutines to all wait for each other to reach a common barrier point.
+// The barrier is called cyclic because it can be re-used after the waiting goroutines are released.
+type Barrier struct {
+	parties int
+	action  base.Call
+
+	mu    sync.Mutex
+	count int // parties still waiting for
+	gen   *generation
+}
+
+// NewBarrier create a new Barrier that will trip when the given number of parties are waiting upon it,
+// and which will execute the given barrier action(could be nil) when the barrier is tripped, performed by the last goroutine entering the barrier.
+// waiting parties are released after the action returns. the action runs without holding the barrier lock so it may call methods of the barrier,
+// if it panics the barrier is broken and the panic is propagated to the last goroutine
+func NewBarrier(parties int, action base.Call) *Barrier {
+	if parties <= 0 {
+		parties = 1
+	}
+	return &Barrier{parties: parties, action: action, count: parties, gen: newGeneration()}
+}
+
+func newGeneration() *generation {
+	return &generation{trip: make(chan struct{})}
+}
+
+// Await waits until all parties have invoked Await on this barrier or ctx is done.
+// return arrival index of the current goroutine, where index parties-1 indicates the first to arrive and zero indicates the last to arrive.
+// if ctx is done the barrier is broken and other waiting parties get ErrBrokenBarrier.
+func (b *Barrier) Await(ctx context.Context) (int, error) {
+	b.mu.Lock()
+	g := b.gen
+	if g.broken {
+		b.mu.Unlock()
+		return 0, ErrBrokenBarrier
+	}
+	b.count--
+	index := b.count
+	if index == 0 {
+		// tripped, later parties wait on the next generation while the action is running
+		b.count = b.parties
+		b.gen = newGeneration()
+		b.mu.Unlock()
+		b.trip(g)
+		return 0, nil
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-g.trip:
+	case <-ctx.Done():
+		b.mu.Lock()
+		if g == b.gen && !g.broken {
+			b.breakBarrier()
+			b.mu.Unlock()
+			return index, ctx.Err()
+		}
+		// tripped at the same time, wait for the barrier action
+		b.mu.Unlock()
+		<-g.trip
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if g.broken {
+		return index, ErrBrokenBarrier
+	}
+	return index, nil
+}
+
+// trip run the barrier action and release parties waiting on generation g
+func (b *Barrier) trip(g *generation) {
+	done := false
+	defer func() {
+		if !done {
+			// action panicked
+			b.mu.Lock()
+			g.broken = true
+			b.breakBarrier()
+			b.mu.Unlock()
+		}
+		close(g.trip)
+	}()
+	if b.action != nil {
+		b.action()
+	}
+	done = true
+}
+
+// Reset resets the barrier to its initial state. If any parties are currently waiting at the barrier, they will return with ErrBrokenBarrier
+func (b *Barrier) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.breakBarrier()
+	b.count = b.parties
+	b.gen = newGeneration()
+}
+
+// IsBroken return true if the barrier is broken
+func (b *Barrier) IsBroken() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.gen.broken
+}
+
+// Parties return the number of parties required to trip this barrier
+func (b *Barrier) Parties() int {
+	return b.parties
+}
+
+// Waiting return the number of parties currently waiting at the barrier
+func (b *Barrier) Waiting() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.parties - b.count
+}
+
+func (b *Barrier) breakBarrier() {
+	if b.gen.broken {
+		return
+	}
+	b.gen.broken = true
+	b.count = b.parties
+	close(b.gen.trip)
+}
@@ -0,0 +1,124 @@
+package syncx_test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/concurrent/syncx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBarrier(t *testing.T) {
+	Convey("TestBarrier", t, func() {
+		var tripped atomic.Int32
+		b := syncx.NewBarrier(3, func() {
+			tripped.Add(1)
+		})
+		So(b.Parties(), ShouldEqual, 3)
+
+		Convey("cyclic await", func() {
+			for round := 1; round <= 3; round++ {
+				var wg sync.WaitGroup
+				var mu sync.Mutex
+				indexes := make([]int, 0)
+				var errs atomic.Int32
+				for i := 0; i < 3; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						index, err := b.Await(context.Background())
+						if err != nil {
+							errs.Add(1)
+						}
+						mu.Lock()
+						indexes = append(indexes, index)
+						mu.Unlock()
+					}()
+				}
+				wg.Wait()
+				So(errs.Load(), ShouldEqual, 0)
+				sort.Ints(indexes)
+				So(indexes, ShouldResemble, []int{0, 1, 2})
+				So(tripped.Load(), ShouldEqual, round)
+			}
+		})
+
+		Convey("broken by context", func() {
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := b.Await(context.Background())
+				errCh <- err
+			}()
+			for b.Waiting() != 1 {
+				time.Sleep(time.Millisecond)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err := b.Await(ctx)
+			So(err, ShouldResemble, context.DeadlineExceeded)
+			So(<-errCh, ShouldEqual, syncx.ErrBrokenBarrier)
+			So(b.IsBroken(), ShouldBeTrue)
+			_, err = b.Await(context.Background())
+			So(err, ShouldEqual, syncx.ErrBrokenBarrier)
+
+			b.Reset()
+			So(b.IsBroken(), ShouldBeFalse)
+			So(b.Waiting(), ShouldEqual, 0)
+		})
+
+		Convey("reset with waiting parties", func() {
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := b.Await(context.Background())
+				errCh <- err
+			}()
+			for b.Waiting() != 1 {
+				time.Sleep(time.Millisecond)
+			}
+			b.Reset()
+			So(<-errCh, ShouldEqual, syncx.ErrBrokenBarrier)
+			So(b.IsBroken(), ShouldBeFalse)
+			So(tripped.Load(), ShouldEqual, 0)
+		})
+
+		Convey("action uses the barrier", func() {
+			var waiting atomic.Int32
+			var b *syncx.Barrier
+			b = syncx.NewBarrier(2, func() {
+				waiting.Store(int32(b.Waiting()))
+			})
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := b.Await(context.Background())
+				errCh <- err
+			}()
+			_, err := b.Await(context.Background())
+			So(err, ShouldBeNil)
+			So(<-errCh, ShouldBeNil)
+			So(waiting.Load(), ShouldEqual, 0)
+		})
+
+		Convey("action panics", func() {
+			b := syncx.NewBarrier(2, func() {
+				panic("action failed")
+			})
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := b.Await(context.Background())
+				errCh <- err
+			}()
+			for b.Waiting() != 1 {
+				time.Sleep(time.Millisecond)
+			}
+			So(func() { b.Await(context.Background()) }, ShouldPanicWith, "action failed")
+			So(<-errCh, ShouldEqual, syncx.ErrBrokenBarrier)
+			So(b.IsBroken(), ShouldBeTrue)
+			b.Reset()
+			So(b.IsBroken(), ShouldBeFalse)
+		})
+	})
+}
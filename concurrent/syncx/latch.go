@@ -0,0 +1,79 @@
+package syncx
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CountDownLatch allows one or more goroutines to wait until a set of operations being performed in other goroutines completes.
+// A CountDownLatch is initialized with a given count. Await methods block until the current count reaches zero due to invocations of CountDown,
+// after which all waiting goroutines are released. the count cannot be reset.
+type CountDownLatch struct {
+	mu    sync.Mutex
+	count int
+	done  chan struct{}
+}
+
+// NewCountDownLatch create a new CountDownLatch with count
+func NewCountDownLatch(count int) *CountDownLatch {
+	l := &CountDownLatch{count: count, done: make(chan struct{})}
+	if count <= 0 {
+		l.count = 0
+		close(l.done)
+	}
+	return l
+}
+
+// CountDown decrements the count of the latch, releasing all waiting goroutines if the count reaches zero.
+// If the current count equals zero then nothing happens.
+func (l *CountDownLatch) CountDown() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count == 0 {
+		return
+	}
+	l.count--
+	if l.count == 0 {
+		close(l.done)
+	}
+}
+
+// Count return the current count
+func (l *CountDownLatch) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// Await causes the current goroutine to wait until the latch has counted down to zero
+func (l *CountDownLatch) Await() {
+	<-l.done
+}
+
+// AwaitContext wait until the latch has counted down to zero or ctx is done, return ctx.Err() if ctx is done first
+func (l *CountDownLatch) AwaitContext(ctx context.Context) error {
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AwaitTimeout wait until the latch has counted down to zero or timeout, return false if timeout
+func (l *CountDownLatch) AwaitTimeout(timeout time.Duration) bool {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-l.done:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// Done return a channel closed when count reaches zero
+func (l *CountDownLatch) Done() <-chan struct{} {
+	return l.done
+}
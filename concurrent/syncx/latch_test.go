@@ -0,0 +1,43 @@
+package syncx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/concurrent/syncx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCountDownLatch(t *testing.T) {
+	Convey("TestCountDownLatch", t, func() {
+		latch := syncx.NewCountDownLatch(3)
+		So(latch.Count(), ShouldEqual, 3)
+
+		Convey("await all count down", func() {
+			for i := 0; i < 3; i++ {
+				go latch.CountDown()
+			}
+			latch.Await()
+			So(latch.Count(), ShouldEqual, 0)
+			latch.CountDown() // no effect
+			So(latch.Count(), ShouldEqual, 0)
+			So(latch.AwaitTimeout(time.Millisecond), ShouldBeTrue)
+		})
+
+		Convey("await timeout", func() {
+			latch.CountDown()
+			So(latch.AwaitTimeout(20*time.Millisecond), ShouldBeFalse)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			So(latch.AwaitContext(ctx), ShouldResemble, context.DeadlineExceeded)
+			So(latch.Count(), ShouldEqual, 2)
+		})
+
+		Convey("zero count", func() {
+			l := syncx.NewCountDownLatch(0)
+			<-l.Done()
+			So(l.Count(), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,193 @@
+package syncx
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Mutex is a mutual exclusion lock which supports lock with context or timeout.
+// The zero Mutex is an unlocked mutex and ready for use. A Mutex must not be copied after first use.
+type Mutex struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+// NewMutex create a new Mutex
+func NewMutex() *Mutex {
+	return &Mutex{}
+}
+
+func (m *Mutex) init() {
+	m.once.Do(func() {
+		m.ch = make(chan struct{}, 1)
+	})
+}
+
+// Lock locks m. If the lock is already in use, the calling goroutine blocks until the mutex is available.
+func (m *Mutex) Lock() {
+	m.init()
+	m.ch <- struct{}{}
+}
+
+// TryLock tries to lock m and reports whether it succeeded.
+func (m *Mutex) TryLock() bool {
+	m.init()
+	select {
+	case m.ch <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// LockContext locks m or return ctx.Err() if ctx is done before the lock is acquired
+func (m *Mutex) LockContext(ctx context.Context) error {
+	m.init()
+	select {
+	case m.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TryLockTimeout tries to lock m within timeout and reports whether it succeeded.
+func (m *Mutex) TryLockTimeout(timeout time.Duration) bool {
+	if timeout <= 0 {
+		return m.TryLock()
+	}
+	m.init()
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case m.ch <- struct{}{}:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// Unlock unlocks m. It is a run-time error if m is not locked on entry to Unlock.
+func (m *Mutex) Unlock() {
+	m.init()
+	select {
+	case <-m.ch:
+	default:
+		panic("syncx: unlock of unlocked mutex")
+	}
+}
+
+type keyedEntry struct {
+	mu     Mutex
+	ref    int
+	locked bool // guarded by KeyedMutex.mu, set after mu is acquired
+}
+
+// KeyedMutex holds a lock for each key, goroutines locking different keys never block each other.
+// lock entry is removed once no goroutine holds or waits it, so the number of keys is unbounded.
+// The zero KeyedMutex is ready for use.
+type KeyedMutex[K comparable] struct {
+	mu      sync.Mutex
+	entries map[K]*keyedEntry
+}
+
+// NewKeyedMutex create a new KeyedMutex
+func NewKeyedMutex[K comparable]() *KeyedMutex[K] {
+	return &KeyedMutex[K]{entries: make(map[K]*keyedEntry)}
+}
+
+// acquire entry of key and increase reference
+func (km *KeyedMutex[K]) acquire(key K) *keyedEntry {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	if km.entries == nil {
+		km.entries = make(map[K]*keyedEntry)
+	}
+	e, ok := km.entries[key]
+	if !ok {
+		e = &keyedEntry{}
+		km.entries[key] = e
+	}
+	e.ref++
+	return e
+}
+
+// release decrease reference of entry and remove it if no reference
+func (km *KeyedMutex[K]) release(key K, e *keyedEntry) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	e.ref--
+	if e.ref == 0 {
+		delete(km.entries, key)
+	}
+}
+
+// markLocked mark entry as locked after its mutex is acquired
+func (km *KeyedMutex[K]) markLocked(e *keyedEntry) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	e.locked = true
+}
+
+// Lock locks the key
+func (km *KeyedMutex[K]) Lock(key K) {
+	e := km.acquire(key)
+	e.mu.Lock()
+	km.markLocked(e)
+}
+
+// TryLock tries to lock the key and reports whether it succeeded.
+func (km *KeyedMutex[K]) TryLock(key K) bool {
+	e := km.acquire(key)
+	if e.mu.TryLock() {
+		km.markLocked(e)
+		return true
+	}
+	km.release(key, e)
+	return false
+}
+
+// LockContext locks the key or return ctx.Err() if ctx is done before the lock is acquired
+func (km *KeyedMutex[K]) LockContext(ctx context.Context, key K) error {
+	e := km.acquire(key)
+	if err := e.mu.LockContext(ctx); err != nil {
+		km.release(key, e)
+		return err
+	}
+	km.markLocked(e)
+	return nil
+}
+
+// TryLockTimeout tries to lock the key within timeout and reports whether it succeeded.
+func (km *KeyedMutex[K]) TryLockTimeout(key K, timeout time.Duration) bool {
+	e := km.acquire(key)
+	if e.mu.TryLockTimeout(timeout) {
+		km.markLocked(e)
+		return true
+	}
+	km.release(key, e)
+	return false
+}
+
+// Unlock unlocks the key. It is a run-time error if key is not locked,
+// including a key that is only waited by other goroutines.
+func (km *KeyedMutex[K]) Unlock(key K) {
+	km.mu.Lock()
+	e, ok := km.entries[key]
+	if !ok || !e.locked {
+		km.mu.Unlock()
+		panic("syncx: unlock of unlocked key")
+	}
+	e.locked = false
+	km.mu.Unlock()
+	e.mu.Unlock()
+	km.release(key, e)
+}
+
+// Size return count of keys locked or waited
+func (km *KeyedMutex[K]) Size() int {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	return len(km.entries)
+}
@@ -0,0 +1,126 @@
+package syncx_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/concurrent/syncx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMutex(t *testing.T) {
+	Convey("TestMutex", t, func() {
+		var m syncx.Mutex
+
+		Convey("lock and unlock", func() {
+			m.Lock()
+			So(m.TryLock(), ShouldBeFalse)
+			So(m.TryLockTimeout(20*time.Millisecond), ShouldBeFalse)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			So(m.LockContext(ctx), ShouldResemble, context.DeadlineExceeded)
+			m.Unlock()
+			So(m.TryLock(), ShouldBeTrue)
+			m.Unlock()
+			So(func() { m.Unlock() }, ShouldPanic)
+		})
+
+		Convey("lock with timeout after released", func() {
+			m.Lock()
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				m.Unlock()
+			}()
+			So(m.TryLockTimeout(time.Second), ShouldBeTrue)
+			m.Unlock()
+		})
+
+		Convey("concurrent lock", func() {
+			count := 0
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					m.Lock()
+					defer m.Unlock()
+					count++
+				}()
+			}
+			wg.Wait()
+			So(count, ShouldEqual, 50)
+		})
+	})
+}
+
+func TestKeyedMutex(t *testing.T) {
+	Convey("TestKeyedMutex", t, func() {
+		km := syncx.NewKeyedMutex[string]()
+
+		Convey("lock different keys", func() {
+			km.Lock("a")
+			So(km.TryLock("b"), ShouldBeTrue)
+			So(km.TryLock("a"), ShouldBeFalse)
+			So(km.TryLockTimeout("a", 10*time.Millisecond), ShouldBeFalse)
+			So(km.Size(), ShouldEqual, 2)
+			km.Unlock("a")
+			km.Unlock("b")
+			So(km.Size(), ShouldEqual, 0)
+			So(func() { km.Unlock("a") }, ShouldPanicWith, "syncx: unlock of unlocked key")
+		})
+
+		Convey("unlock key only waited", func() {
+			km.Lock("a")
+			locked := make(chan struct{})
+			go func() {
+				km.Lock("a")
+				close(locked)
+			}()
+			for km.Size() != 1 {
+				time.Sleep(time.Millisecond)
+			}
+			km.Unlock("a")
+			<-locked
+			km.Unlock("a")
+			So(func() { km.Unlock("a") }, ShouldPanicWith, "syncx: unlock of unlocked key")
+			So(km.Size(), ShouldEqual, 0)
+			So(km.TryLock("a"), ShouldBeTrue)
+			km.Unlock("a")
+		})
+
+		Convey("lock with context", func() {
+			km.Lock("a")
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			So(km.LockContext(ctx, "a"), ShouldResemble, context.DeadlineExceeded)
+			So(km.Size(), ShouldEqual, 1)
+			km.Unlock("a")
+			So(km.LockContext(context.Background(), "a"), ShouldBeNil)
+			km.Unlock("a")
+			So(km.Size(), ShouldEqual, 0)
+		})
+
+		Convey("concurrent lock", func() {
+			counts := make(map[int]int)
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func(k int) {
+					defer wg.Done()
+					key := k % 5
+					km.Lock(string(rune('a' + key)))
+					defer km.Unlock(string(rune('a' + key)))
+					mu.Lock()
+					counts[key]++
+					mu.Unlock()
+				}(i)
+			}
+			wg.Wait()
+			So(len(counts), ShouldEqual, 5)
+			So(km.Size(), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,80 @@
+package syncx_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/concurrent/syncx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSemaphore(t *testing.T) {
+	Convey("TestSemaphore", t, func() {
+		sem := syncx.NewSemaphore(3)
+
+		Convey("acquire and release", func() {
+			So(sem.Acquire(context.Background(), 2), ShouldBeNil)
+			So(sem.Available(), ShouldEqual, 1)
+			So(sem.TryAcquire(2), ShouldBeFalse)
+			So(sem.TryAcquire(1), ShouldBeTrue)
+			sem.Release(3)
+			So(sem.Available(), ShouldEqual, 3)
+			So(func() { sem.Release(1) }, ShouldPanic)
+		})
+
+		Convey("acquire with context", func() {
+			So(sem.Acquire(context.Background(), 3), ShouldBeNil)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			So(sem.Acquire(ctx, 1), ShouldResemble, context.DeadlineExceeded)
+			sem.Release(3)
+			So(sem.Available(), ShouldEqual, 3)
+
+			ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			So(sem.Acquire(ctx, 4), ShouldResemble, context.DeadlineExceeded)
+		})
+
+		Convey("limit concurrent access", func() {
+			var running, max atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					sem.Acquire(context.Background(), 1)
+					defer sem.Release(1)
+					n := running.Add(1)
+					for {
+						m := max.Load()
+						if n <= m || max.CompareAndSwap(m, n) {
+							break
+						}
+					}
+					time.Sleep(5 * time.Millisecond)
+					running.Add(-1)
+				}()
+			}
+			wg.Wait()
+			So(max.Load(), ShouldBeLessThanOrEqualTo, 3)
+			So(sem.Available(), ShouldEqual, 3)
+		})
+
+		Convey("FIFO waiters", func() {
+			So(sem.Acquire(context.Background(), 3), ShouldBeNil)
+			done := make(chan bool)
+			go func() {
+				sem.Acquire(context.Background(), 3) // large waiter first
+				done <- true
+			}()
+			time.Sleep(20 * time.Millisecond)
+			So(sem.TryAcquire(1), ShouldBeFalse) // blocked by large waiter
+			sem.Release(3)
+			So(<-done, ShouldBeTrue)
+			sem.Release(3)
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package syncx
+
+import (
+	"fmt"
+	"sync"
+)
+
+// call is an in-flight or completed Group.Do call
+type call[V any] struct {
+	wg    sync.WaitGroup
+	val   V
+	err   error
+	dups  int
+	chans []chan<- Result[V]
+}
+
+// Result holds the results of Group.DoChan, so they can be passed on a channel.
+type Result[V any] struct {
+	Val    V
+	Err    error
+	Shared bool
+}
+
+// Group represents a class of work and forms a namespace in which units of work can be executed with duplicate suppression.
+// it collapses concurrent requests of same key into one execution.
+// The zero Group is ready for use.
+type Group[K comparable, V any] struct {
+	mu sync.Mutex
+	m  map[K]*call[V]
+}
+
+// NewGroup create a new singleflight Group
+func NewGroup[K comparable, V any]() *Group[K, V] {
+	return &Group[K, V]{m: make(map[K]*call[V])}
+}
+
+// Do executes and returns the results of the given function, making sure that only one execution is in-flight for a given key at a time.
+// If a duplicate comes in, the duplicate caller waits for the original to complete and receives the same results.
+// The return value shared reports whether v was given to multiple callers.
+// panic in fn is recovered and returned as error to all callers.
+func (g *Group[K, V]) Do(key K, fn func() (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[K]*call[V])
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := new(call[V])
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	g.doCall(c, key, fn)
+	return c.val, c.err, c.dups > 0
+}
+
+// DoChan is like Do but returns a channel that will receive the results when they are ready.
+func (g *Group[K, V]) DoChan(key K, fn func() (V, error)) <-chan Result[V] {
+	ch := make(chan Result[V], 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[K]*call[V])
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := &call[V]{chans: []chan<- Result[V]{ch}}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// doCall handles the single call for a key.
+func (g *Group[K, V]) doCall(c *call[V], key K, fn func() (V, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				e = fmt.Errorf("%v", r)
+			}
+			c.err = e
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		c.wg.Done()
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+		for _, ch := range c.chans {
+			ch <- Result[V]{c.val, c.err, c.dups > 0}
+		}
+	}()
+	c.val, c.err = fn()
+}
+
+// Forget tells the Group to forget about a key. Future calls to Do for this key will call the function rather than waiting for an earlier call to complete.
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.m, key)
+}
@@ -0,0 +1,88 @@
+package syncx_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/concurrent/syncx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroup(t *testing.T) {
+	Convey("TestGroup", t, func() {
+		g := syncx.NewGroup[string, int]()
+
+		Convey("Do", func() {
+			v, err, shared := g.Do("key", func() (int, error) {
+				return 100, nil
+			})
+			So(v, ShouldEqual, 100)
+			So(err, ShouldBeNil)
+			So(shared, ShouldBeFalse)
+
+			_, err, _ = g.Do("key", func() (int, error) {
+				return 0, errors.New("failed")
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Do with panic", func() {
+			_, err, _ := g.Do("key", func() (int, error) {
+				panic("surprise")
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "surprise")
+		})
+
+		Convey("duplicate suppression", func() {
+			var calls atomic.Int32
+			release := make(chan bool)
+			fn := func() (int, error) {
+				calls.Add(1)
+				<-release
+				return 1, nil
+			}
+			var wg sync.WaitGroup
+			var sharedCount atomic.Int32
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					v, err, shared := g.Do("key", fn)
+					if err == nil && v == 1 && shared {
+						sharedCount.Add(1)
+					}
+				}()
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			So(calls.Load(), ShouldEqual, 1)
+			So(sharedCount.Load(), ShouldEqual, 10)
+		})
+
+		Convey("DoChan and Forget", func() {
+			release := make(chan bool)
+			ch1 := g.DoChan("key", func() (int, error) {
+				<-release
+				return 1, nil
+			})
+			ch2 := g.DoChan("key", func() (int, error) {
+				return 2, nil
+			})
+			g.Forget("key")
+			v, _, _ := g.Do("key", func() (int, error) {
+				return 3, nil
+			})
+			So(v, ShouldEqual, 3)
+			close(release)
+			r1, r2 := <-ch1, <-ch2
+			So(r1.Val, ShouldEqual, 1)
+			So(r2.Val, ShouldEqual, 1)
+			So(r1.Shared, ShouldBeTrue)
+		})
+	})
+}
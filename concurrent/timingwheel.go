@@ -0,0 +1,235 @@
+package concurrent
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jhunters/goassist/base"
+)
+
+const (
+	defaultWheelSize = 64
+	maxWheelLevels   = 8
+)
+
+// TimingWheel is a hierarchical timing wheel. level 0 advances one bucket per tick, each upper level
+// covers wheelSize times the span of the level below. timers on upper levels cascade down to lower levels
+// as the wheel turns, so adding and removing a timer is O(1) no matter how long the delay is.
+// a TimingWheel is independent of the package level time wheel used by AsyncGo and could be created and stopped freely.
+type TimingWheel struct {
+	tick      time.Duration
+	wheelSize int64
+
+	mu      sync.Mutex
+	levels  [][]*list.List
+	current int64 // ticks elapsed since start
+	start   time.Time
+
+	started bool
+	stopped bool
+	stopC   chan struct{}
+	doneC   chan struct{}
+}
+
+// WheelTimer is a timer added to TimingWheel
+type WheelTimer struct {
+	tw         *TimingWheel
+	expiration int64 // absolute tick to fire
+	fn         base.Call
+	bucket     *list.List
+	elem       *list.Element
+}
+
+// NewTimingWheel create a new hierarchical timing wheel with tick duration and bucket size of each level
+func NewTimingWheel(tick time.Duration, wheelSize int) (*TimingWheel, error) {
+	if tick <= 0 {
+		return nil, fmt.Errorf("invalid tick %v, must be large than zero", tick)
+	}
+	if wheelSize <= 1 {
+		return nil, fmt.Errorf("invalid wheel size %d, must be large than one", wheelSize)
+	}
+	tw := &TimingWheel{
+		tick:      tick,
+		wheelSize: int64(wheelSize),
+		stopC:     make(chan struct{}),
+		doneC:     make(chan struct{}),
+		start:     time.Now(),
+	}
+	tw.levels = append(tw.levels, tw.newLevel())
+	return tw, nil
+}
+
+func (tw *TimingWheel) newLevel() []*list.List {
+	buckets := make([]*list.List, tw.wheelSize)
+	for i := range buckets {
+		buckets[i] = list.New()
+	}
+	return buckets
+}
+
+// Tick return tick duration of the lowest level
+func (tw *TimingWheel) Tick() time.Duration {
+	return tw.tick
+}
+
+// Start start the timing wheel in a new goroutine. start a started or stopped wheel has no effect
+func (tw *TimingWheel) Start() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.started || tw.stopped {
+		return
+	}
+	tw.started = true
+	go tw.run()
+}
+
+// Stop stop the timing wheel and discard all pending timers. it is safe to call Stop more than once
+func (tw *TimingWheel) Stop() {
+	tw.mu.Lock()
+	if tw.stopped {
+		tw.mu.Unlock()
+		return
+	}
+	tw.stopped = true
+	started := tw.started
+	for _, level := range tw.levels {
+		for _, bucket := range level {
+			for e := bucket.Front(); e != nil; e = e.Next() {
+				t := e.Value.(*WheelTimer)
+				t.bucket, t.elem = nil, nil
+			}
+			bucket.Init()
+		}
+	}
+	tw.mu.Unlock()
+
+	close(tw.stopC)
+	if started {
+		<-tw.doneC
+	}
+}
+
+// AfterFunc waits for the duration to elapse and then calls f in its own goroutine.
+// It returns a WheelTimer that can be used to cancel the call using its Stop method.
+func (tw *TimingWheel) AfterFunc(d time.Duration, f base.Call) (*WheelTimer, error) {
+	if f == nil {
+		return nil, fmt.Errorf("timer function is nil")
+	}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.stopped {
+		return nil, fmt.Errorf("timing wheel is stopped")
+	}
+	if d < 0 {
+		d = 0
+	}
+	// round up to make sure timer never fires before d elapsed
+	expiration := int64((time.Since(tw.start) + d + tw.tick - 1) / tw.tick)
+	if expiration <= tw.current {
+		// bucket of current tick is already fired, move to next tick
+		expiration = tw.current + 1
+	}
+	t := &WheelTimer{tw: tw, expiration: expiration, fn: f}
+	tw.add(t)
+	return t, nil
+}
+
+// Stop prevents the timer from firing. It returns true if the call stops the timer,
+// false if the timer has already expired or been stopped.
+func (t *WheelTimer) Stop() bool {
+	tw := t.tw
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if t.bucket == nil {
+		return false
+	}
+	t.bucket.Remove(t.elem)
+	t.bucket, t.elem = nil, nil
+	return true
+}
+
+// add put timer to the right bucket, must be called with lock held
+func (tw *TimingWheel) add(t *WheelTimer) {
+	delta := t.expiration - tw.current
+	if delta < 0 {
+		delta = 0
+	}
+	level := 0
+	span := tw.wheelSize // span covered by level
+	unit := int64(1)     // ticks of one bucket in level
+	for delta >= span && level < maxWheelLevels-1 {
+		level++
+		unit = span
+		span *= tw.wheelSize
+	}
+	for len(tw.levels) <= level {
+		tw.levels = append(tw.levels, tw.newLevel())
+	}
+	if delta >= span {
+		// beyond max levels, park at the farthest bucket and cascade again later
+		t.bucket = tw.levels[level][(tw.current/unit+tw.wheelSize-1)%tw.wheelSize]
+	} else {
+		t.bucket = tw.levels[level][((tw.current+delta)/unit)%tw.wheelSize]
+	}
+	t.elem = t.bucket.PushBack(t)
+}
+
+func (tw *TimingWheel) run() {
+	defer close(tw.doneC)
+	ticker := time.NewTicker(tw.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tw.advance(int64(time.Since(tw.start) / tw.tick))
+		case <-tw.stopC:
+			return
+		}
+	}
+}
+
+// advance move the wheel forward until target tick and fire all expired timers
+func (tw *TimingWheel) advance(target int64) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	for tw.current < target && !tw.stopped {
+		tw.current++
+		// cascade from higher levels first so timers could drop into lower buckets handled in the same tick
+		for level := len(tw.levels) - 1; level > 0; level-- {
+			unit := ipow(tw.wheelSize, level)
+			if tw.current%unit != 0 {
+				continue
+			}
+			bucket := tw.levels[level][(tw.current/unit)%tw.wheelSize]
+			tw.cascade(bucket)
+		}
+		bucket := tw.levels[0][tw.current%tw.wheelSize]
+		for e := bucket.Front(); e != nil; e = e.Next() {
+			t := e.Value.(*WheelTimer)
+			t.bucket, t.elem = nil, nil
+			go base.SafetyCall(t.fn)
+		}
+		bucket.Init()
+	}
+}
+
+func (tw *TimingWheel) cascade(bucket *list.List) {
+	timers := make([]*WheelTimer, 0, bucket.Len())
+	for e := bucket.Front(); e != nil; e = e.Next() {
+		timers = append(timers, e.Value.(*WheelTimer))
+	}
+	bucket.Init()
+	for _, t := range timers {
+		tw.add(t)
+	}
+}
+
+func ipow(b int64, exp int) int64 {
+	ret := int64(1)
+	for i := 0; i < exp; i++ {
+		ret *= b
+	}
+	return ret
+}
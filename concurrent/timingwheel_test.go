@@ -0,0 +1,93 @@
+package concurrent_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/concurrent"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTimingWheel(t *testing.T) {
+	Convey("TestTimingWheel", t, func() {
+
+		Convey("invalid parameters", func() {
+			_, err := concurrent.NewTimingWheel(0, 10)
+			So(err, ShouldNotBeNil)
+			_, err = concurrent.NewTimingWheel(time.Millisecond, 1)
+			So(err, ShouldNotBeNil)
+		})
+
+		tw, err := concurrent.NewTimingWheel(5*time.Millisecond, 4)
+		So(err, ShouldBeNil)
+		tw.Start()
+		defer tw.Stop()
+
+		Convey("fire in time", func() {
+			ch := make(chan time.Time, 1)
+			now := time.Now()
+			_, err := tw.AfterFunc(30*time.Millisecond, func() {
+				ch <- time.Now()
+			})
+			So(err, ShouldBeNil)
+			fired := <-ch
+			So(fired.Sub(now), ShouldBeGreaterThanOrEqualTo, 30*time.Millisecond)
+			So(fired.Sub(now), ShouldBeLessThan, 200*time.Millisecond)
+		})
+
+		Convey("fire across multiple levels", func() {
+			// wheel size 4 with 5ms tick, 200ms needs three levels
+			ch := make(chan time.Time, 1)
+			now := time.Now()
+			_, err := tw.AfterFunc(200*time.Millisecond, func() {
+				ch <- time.Now()
+			})
+			So(err, ShouldBeNil)
+			fired := <-ch
+			So(fired.Sub(now), ShouldBeGreaterThanOrEqualTo, 200*time.Millisecond)
+			So(fired.Sub(now), ShouldBeLessThan, 400*time.Millisecond)
+		})
+
+		Convey("fire in order", func() {
+			ch := make(chan int, 3)
+			for _, i := range []int{3, 1, 2} {
+				v := i
+				tw.AfterFunc(time.Duration(v)*40*time.Millisecond, func() {
+					ch <- v
+				})
+			}
+			So(<-ch, ShouldEqual, 1)
+			So(<-ch, ShouldEqual, 2)
+			So(<-ch, ShouldEqual, 3)
+		})
+
+		Convey("stop timer", func() {
+			var count atomic.Int32
+			timer, err := tw.AfterFunc(50*time.Millisecond, func() {
+				count.Add(1)
+			})
+			So(err, ShouldBeNil)
+			So(timer.Stop(), ShouldBeTrue)
+			So(timer.Stop(), ShouldBeFalse)
+			time.Sleep(100 * time.Millisecond)
+			So(count.Load(), ShouldEqual, 0)
+		})
+	})
+
+	Convey("TestTimingWheel stopped", t, func() {
+		tw, err := concurrent.NewTimingWheel(5*time.Millisecond, 8)
+		So(err, ShouldBeNil)
+		tw.Start()
+		var count atomic.Int32
+		tw.AfterFunc(50*time.Millisecond, func() {
+			count.Add(1)
+		})
+		tw.Stop()
+		tw.Stop() // stop twice
+		_, err = tw.AfterFunc(time.Millisecond, func() {})
+		So(err, ShouldNotBeNil)
+		time.Sleep(100 * time.Millisecond)
+		So(count.Load(), ShouldEqual, 0)
+	})
+}
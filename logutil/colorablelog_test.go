@@ -3,6 +3,7 @@ package logutil_test
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -13,11 +14,12 @@ func TestLog(t *testing.T) {
 	log := logutil.CreateLogger("info", logutil.GREEN)
 	fmt.Fprintf(log, "Hello %s", "World")
 
-	f, err := os.Create("log.txt")
+	f, err := os.Create(filepath.Join(t.TempDir(), "log.txt"))
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
+	defer f.Close()
 	log2 := logutil.CreateLoggerToFile("logfile", f, logutil.GREEN)
 	log2.Write([]byte("hello world\n"))
 
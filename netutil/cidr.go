@@ -0,0 +1,291 @@
+package netutil
+
+import (
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// IPRange is an inclusive range of addresses in same family
+type IPRange struct {
+	From netip.Addr
+	To   netip.Addr
+}
+
+// NewIPRange create IPRange from two addresses, return error if they are invalid, in different family or from is after to
+func NewIPRange(from, to netip.Addr) (IPRange, error) {
+	from, to = from.Unmap(), to.Unmap()
+	if !from.IsValid() || !to.IsValid() {
+		return IPRange{}, fmt.Errorf("invalid ip range %v-%v", from, to)
+	}
+	if from.Is4() != to.Is4() {
+		return IPRange{}, fmt.Errorf("ip range %v-%v in different family", from, to)
+	}
+	if from.Compare(to) > 0 {
+		return IPRange{}, fmt.Errorf("invalid ip range %v-%v, start is after end", from, to)
+	}
+	return IPRange{from.WithZone(""), to.WithZone("")}, nil
+}
+
+// ParseIPRange parse range like "10.0.0.1-10.0.0.9", cidr like "10.0.0.0/24" or single ip
+func ParseIPRange(s string) (IPRange, error) {
+	s = strings.TrimSpace(s)
+	if from, to, ok := strings.Cut(s, "-"); ok {
+		a, err := netip.ParseAddr(strings.TrimSpace(from))
+		if err != nil {
+			return IPRange{}, err
+		}
+		b, err := netip.ParseAddr(strings.TrimSpace(to))
+		if err != nil {
+			return IPRange{}, err
+		}
+		return NewIPRange(a, b)
+	}
+	p, err := ParseCIDR(s)
+	if err != nil {
+		return IPRange{}, err
+	}
+	return CIDRToRange(p), nil
+}
+
+// Contains return true if ip is in the range
+func (r IPRange) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.Is4() == r.From.Is4() && r.From.Compare(ip) <= 0 && ip.Compare(r.To) <= 0
+}
+
+// String return range like "10.0.0.1-10.0.0.9"
+func (r IPRange) String() string {
+	return r.From.String() + "-" + r.To.String()
+}
+
+// Prefixes split the range into minimal cidr list
+func (r IPRange) Prefixes() []netip.Prefix {
+	ret, _ := RangeToCIDRs(r.From, r.To)
+	return ret
+}
+
+// ParseCIDR parse cidr like "10.0.0.0/8" or "2001:db8::/32", single ip is parsed as /32 or /128 prefix.
+// ipv4-mapped ipv6 address is converted to ipv4, host bits are masked
+func ParseCIDR(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap().WithZone("")
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr, b := p.Addr(), p.Bits()
+	if addr.Is4In6() {
+		if b < 96 {
+			return netip.Prefix{}, fmt.Errorf("invalid ipv4-mapped cidr %s", s)
+		}
+		addr, b = addr.Unmap(), b-96
+	}
+	return netip.PrefixFrom(addr, b).Masked(), nil
+}
+
+// CIDRContains return true if ip is in cidr, both are strings
+func CIDRContains(cidr, ip string) (bool, error) {
+	p, err := ParseCIDR(cidr)
+	if err != nil {
+		return false, err
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false, err
+	}
+	return p.Contains(addr.Unmap().WithZone("")), nil
+}
+
+// PrefixContains return true if prefix outer contains all addresses of inner
+func PrefixContains(outer, inner netip.Prefix) bool {
+	return outer.Bits() <= inner.Bits() && outer.Contains(inner.Addr())
+}
+
+// CIDRToRange return first and last addresses of prefix
+func CIDRToRange(p netip.Prefix) IPRange {
+	p = p.Masked()
+	return IPRange{From: p.Addr(), To: lastAddr(p)}
+}
+
+// RangeToCIDRs split inclusive address range into minimal cidr list
+func RangeToCIDRs(from, to netip.Addr) ([]netip.Prefix, error) {
+	r, err := NewIPRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	bitLen := r.From.BitLen()
+	cur, end := addrToU128(r.From), addrToU128(r.To)
+	var ret []netip.Prefix
+	for {
+		// host bits limited by alignment of cur and size of remaining range
+		host := cur.trailingZeros()
+		if host > bitLen {
+			host = bitLen
+		}
+		for host > 0 && cur.or(u128Mask(host)).cmp(end) > 0 {
+			host--
+		}
+		ret = append(ret, netip.PrefixFrom(u128ToAddr(cur, r.From.Is4()), bitLen-host))
+		last := cur.or(u128Mask(host))
+		if last.cmp(end) >= 0 {
+			return ret, nil
+		}
+		cur = last.addOne()
+	}
+}
+
+// ForEachAddr call fn for each address in prefix in order, stop if fn returns false
+func ForEachAddr(p netip.Prefix, fn func(addr netip.Addr) bool) {
+	p = p.Masked()
+	for addr := p.Addr(); addr.IsValid() && p.Contains(addr); addr = addr.Next() {
+		if !fn(addr) {
+			return
+		}
+	}
+}
+
+// ForEachSubnet split prefix into subnets with newBits prefix length and call fn in order, stop if fn returns false
+func ForEachSubnet(p netip.Prefix, newBits int, fn func(subnet netip.Prefix) bool) error {
+	p = p.Masked()
+	if newBits < p.Bits() || newBits > p.Addr().BitLen() {
+		return fmt.Errorf("invalid subnet bits %d for prefix %v", newBits, p)
+	}
+	is4 := p.Addr().Is4()
+	last := addrToU128(lastAddr(p))
+	host := p.Addr().BitLen() - newBits
+	for cur := addrToU128(p.Addr()); ; {
+		if !fn(netip.PrefixFrom(u128ToAddr(cur, is4), newBits)) {
+			return nil
+		}
+		end := cur.or(u128Mask(host))
+		if end.cmp(last) >= 0 {
+			return nil
+		}
+		cur = end.addOne()
+	}
+}
+
+// MergeRanges merge overlapping and adjacent ranges, return sorted ranges. ipv4 ranges are placed before ipv6 ranges
+func MergeRanges(ranges []IPRange) []IPRange {
+	sorted := make([]IPRange, 0, len(ranges))
+	for _, r := range ranges {
+		if r, err := NewIPRange(r.From, r.To); err == nil {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].From.Compare(sorted[j].From) < 0
+	})
+
+	var ret []IPRange
+	for _, r := range sorted {
+		if n := len(ret); n > 0 {
+			prev := &ret[n-1]
+			next := prev.To.Next()
+			// overlapped or adjacent in same family
+			if prev.From.Is4() == r.From.Is4() && (r.From.Compare(prev.To) <= 0 || (next.IsValid() && next == r.From)) {
+				if r.To.Compare(prev.To) > 0 {
+					prev.To = r.To
+				}
+				continue
+			}
+		}
+		ret = append(ret, r)
+	}
+	return ret
+}
+
+// MergeCIDRs merge overlapping and adjacent prefixes into minimal cidr list
+func MergeCIDRs(prefixes []netip.Prefix) []netip.Prefix {
+	ranges := make([]IPRange, len(prefixes))
+	for i, p := range prefixes {
+		ranges[i] = CIDRToRange(p)
+	}
+	var ret []netip.Prefix
+	for _, r := range MergeRanges(ranges) {
+		ret = append(ret, r.Prefixes()...)
+	}
+	return ret
+}
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	addr := p.Addr()
+	host := addr.BitLen() - p.Bits()
+	return u128ToAddr(addrToU128(addr).or(u128Mask(host)), addr.Is4())
+}
+
+// u128 unsigned 128-bit integer for address arithmetic, ipv4 address uses low 32 bits
+type u128 struct {
+	hi, lo uint64
+}
+
+func addrToU128(addr netip.Addr) u128 {
+	if addr.Is4() {
+		b := addr.As4()
+		return u128{lo: uint64(b[0])<<24 | uint64(b[1])<<16 | uint64(b[2])<<8 | uint64(b[3])}
+	}
+	hi, lo := IPv6ToUint128(addr.AsSlice())
+	return u128{hi, lo}
+}
+
+func u128ToAddr(u u128, is4 bool) netip.Addr {
+	if is4 {
+		return netip.AddrFrom4([4]byte{byte(u.lo >> 24), byte(u.lo >> 16), byte(u.lo >> 8), byte(u.lo)})
+	}
+	addr, _ := netip.AddrFromSlice(Uint128ToIPv6(u.hi, u.lo))
+	return addr
+}
+
+// u128Mask return integer with low n bits set
+func u128Mask(n int) u128 {
+	switch {
+	case n <= 0:
+		return u128{}
+	case n < 64:
+		return u128{lo: 1<<uint(n) - 1}
+	case n < 128:
+		return u128{hi: 1<<uint(n-64) - 1, lo: ^uint64(0)}
+	default:
+		return u128{^uint64(0), ^uint64(0)}
+	}
+}
+
+func (u u128) or(o u128) u128 {
+	return u128{u.hi | o.hi, u.lo | o.lo}
+}
+
+func (u u128) cmp(o u128) int {
+	switch {
+	case u.hi < o.hi:
+		return -1
+	case u.hi > o.hi:
+		return 1
+	case u.lo < o.lo:
+		return -1
+	case u.lo > o.lo:
+		return 1
+	}
+	return 0
+}
+
+func (u u128) addOne() u128 {
+	lo, carry := bits.Add64(u.lo, 1, 0)
+	return u128{u.hi + carry, lo}
+}
+
+func (u u128) trailingZeros() int {
+	if u.lo != 0 {
+		return bits.TrailingZeros64(u.lo)
+	}
+	return 64 + bits.TrailingZeros64(u.hi)
+}
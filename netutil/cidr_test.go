@@ -0,0 +1,136 @@
+package netutil_test
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/jhunters/goassist/netutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	ret := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		ret[i] = p.String()
+	}
+	return ret
+}
+
+func TestParseCIDR(t *testing.T) {
+	Convey("TestParseCIDR", t, func() {
+		p, err := netutil.ParseCIDR("10.1.2.3/8")
+		So(err, ShouldBeNil)
+		So(p.String(), ShouldEqual, "10.0.0.0/8")
+
+		p, err = netutil.ParseCIDR("2001:db8::1")
+		So(err, ShouldBeNil)
+		So(p.String(), ShouldEqual, "2001:db8::1/128")
+
+		p, err = netutil.ParseCIDR("::ffff:192.168.0.0/112")
+		So(err, ShouldBeNil)
+		So(p.String(), ShouldEqual, "192.168.0.0/16")
+
+		_, err = netutil.ParseCIDR("10.0.0.0/33")
+		So(err, ShouldNotBeNil)
+
+		ok, err := netutil.CIDRContains("192.168.0.0/16", "192.168.10.1")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		ok, err = netutil.CIDRContains("2001:db8::/32", "2001:db9::1")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+
+		So(netutil.PrefixContains(netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("10.1.0.0/16")), ShouldBeTrue)
+		So(netutil.PrefixContains(netip.MustParsePrefix("10.1.0.0/16"), netip.MustParsePrefix("10.0.0.0/8")), ShouldBeFalse)
+	})
+}
+
+func TestRangeToCIDRs(t *testing.T) {
+	Convey("TestRangeToCIDRs", t, func() {
+		prefixes, err := netutil.RangeToCIDRs(netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.10"))
+		So(err, ShouldBeNil)
+		So(prefixStrings(prefixes), ShouldResemble, []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/31", "10.0.0.10/32"})
+
+		prefixes, err = netutil.RangeToCIDRs(netip.MustParseAddr("0.0.0.0"), netip.MustParseAddr("255.255.255.255"))
+		So(err, ShouldBeNil)
+		So(prefixStrings(prefixes), ShouldResemble, []string{"0.0.0.0/0"})
+
+		prefixes, err = netutil.RangeToCIDRs(netip.MustParseAddr("2001:db8::"), netip.MustParseAddr("2001:db8::1:ffff"))
+		So(err, ShouldBeNil)
+		So(prefixStrings(prefixes), ShouldResemble, []string{"2001:db8::/111"})
+
+		_, err = netutil.RangeToCIDRs(netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.0.1"))
+		So(err, ShouldNotBeNil)
+		_, err = netutil.RangeToCIDRs(netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("::1"))
+		So(err, ShouldNotBeNil)
+
+		r := netutil.CIDRToRange(netip.MustParsePrefix("192.168.1.0/24"))
+		So(r.String(), ShouldEqual, "192.168.1.0-192.168.1.255")
+		So(r.Contains(netip.MustParseAddr("192.168.1.100")), ShouldBeTrue)
+		So(r.Contains(netip.MustParseAddr("::ffff:192.168.1.100")), ShouldBeTrue)
+
+		r, err = netutil.ParseIPRange("10.0.0.1 - 10.0.0.3")
+		So(err, ShouldBeNil)
+		So(prefixStrings(r.Prefixes()), ShouldResemble, []string{"10.0.0.1/32", "10.0.0.2/31"})
+	})
+}
+
+func TestForEachSubnet(t *testing.T) {
+	Convey("TestForEachSubnet", t, func() {
+		var subnets []string
+		err := netutil.ForEachSubnet(netip.MustParsePrefix("10.0.0.0/22"), 24, func(p netip.Prefix) bool {
+			subnets = append(subnets, p.String())
+			return true
+		})
+		So(err, ShouldBeNil)
+		So(subnets, ShouldResemble, []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"})
+
+		subnets = nil
+		netutil.ForEachSubnet(netip.MustParsePrefix("2001:db8::/32"), 48, func(p netip.Prefix) bool {
+			subnets = append(subnets, p.String())
+			return len(subnets) < 2
+		})
+		So(subnets, ShouldResemble, []string{"2001:db8::/48", "2001:db8:1::/48"})
+
+		So(netutil.ForEachSubnet(netip.MustParsePrefix("10.0.0.0/24"), 16, nil), ShouldNotBeNil)
+
+		var addrs []string
+		netutil.ForEachAddr(netip.MustParsePrefix("255.255.255.252/30"), func(a netip.Addr) bool {
+			addrs = append(addrs, a.String())
+			return true
+		})
+		So(addrs, ShouldResemble, []string{"255.255.255.252", "255.255.255.253", "255.255.255.254", "255.255.255.255"})
+	})
+}
+
+func TestMergeCIDRs(t *testing.T) {
+	Convey("TestMergeCIDRs", t, func() {
+		prefixes := []netip.Prefix{
+			netip.MustParsePrefix("10.0.1.0/24"),
+			netip.MustParsePrefix("10.0.0.0/24"),
+			netip.MustParsePrefix("10.0.0.128/25"),
+			netip.MustParsePrefix("2001:db8::/33"),
+			netip.MustParsePrefix("2001:db8:8000::/33"),
+			netip.MustParsePrefix("192.168.0.0/16"),
+		}
+		So(prefixStrings(netutil.MergeCIDRs(prefixes)), ShouldResemble, []string{"10.0.0.0/23", "192.168.0.0/16", "2001:db8::/32"})
+
+		ranges := netutil.MergeRanges([]netutil.IPRange{
+			{From: netip.MustParseAddr("10.0.0.5"), To: netip.MustParseAddr("10.0.0.9")},
+			{From: netip.MustParseAddr("10.0.0.1"), To: netip.MustParseAddr("10.0.0.6")},
+			{From: netip.MustParseAddr("10.0.0.20"), To: netip.MustParseAddr("10.0.0.10")}, // invalid
+			{From: netip.MustParseAddr("255.255.255.255"), To: netip.MustParseAddr("255.255.255.255")},
+			{From: netip.MustParseAddr("::"), To: netip.MustParseAddr("::1")},
+		})
+		So(fmt.Sprint(ranges), ShouldEqual, "[10.0.0.1-10.0.0.9 255.255.255.255-255.255.255.255 ::-::1]")
+	})
+}
+
+func ExampleRangeToCIDRs() {
+	prefixes, _ := netutil.RangeToCIDRs(netip.MustParseAddr("192.168.0.10"), netip.MustParseAddr("192.168.0.20"))
+	fmt.Println(prefixes)
+
+	// Output:
+	// [192.168.0.10/31 192.168.0.12/30 192.168.0.16/30 192.168.0.20/32]
+}
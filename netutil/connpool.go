@@ -0,0 +1,361 @@
+package netutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jhunters/goassist/concurrent/syncx"
+)
+
+var (
+	// ErrPoolClosed is returned by Get after the pool is closed
+	ErrPoolClosed = errors.New("netutil: connection pool closed")
+)
+
+// DialFunc dial a new connection
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+// ConnPoolConfig configuration of ConnPool
+type ConnPoolConfig struct {
+	MaxIdle     int           // max idle connections kept in pool, zero means no idle connection is kept
+	MaxActive   int           // max connections allocated by pool at a time, zero means no limit
+	IdleTimeout time.Duration // idle connections longer than the timeout are closed, zero means never timeout
+
+	DialTimeout   time.Duration // timeout of each dial, zero means no timeout except the context deadline
+	DialRetries   int           // retry times if dial failed
+	RetryInterval time.Duration // wait interval before first retry, doubled for each subsequent retry
+
+	// MagicHeader is written to each fresh connection after dialed,
+	// so the connection could be routed by magic code of CustomListenerSelector on server side
+	MagicHeader []byte
+
+	// HealthCheck checks idle connection before it is returned by Get, broken connections are closed and discarded.
+	// see CheckConnAlive
+	HealthCheck func(conn net.Conn) error
+	// HealthCheckInterval only check connections idle longer than the interval, zero means always check
+	HealthCheckInterval time.Duration
+}
+
+// ConnPoolStats statistics of ConnPool
+type ConnPoolStats struct {
+	Active    int   // connections allocated by pool include idle ones
+	Idle      int   // idle connections in pool
+	Dials     int64 // total dial count include retries
+	DialFails int64 // failed dial count
+	Hits      int64 // count of Get served by idle connections
+	Discards  int64 // count of connections closed by health check or idle timeout
+}
+
+// ConnPool is a pool of net.Conn to reuse connections
+type ConnPool struct {
+	dial   DialFunc
+	config ConnPoolConfig
+
+	sem *syncx.Semaphore // limit of active connections, nil if no limit
+
+	mu     sync.Mutex
+	idle   []*idleConn // idle connections, most recently used at tail
+	active int
+	closed bool
+
+	dials, dialFails, hits, discards atomic.Int64
+}
+
+type idleConn struct {
+	conn  net.Conn
+	since time.Time
+}
+
+// NewConnPool create a connection pool with dial function
+func NewConnPool(dial DialFunc, config ConnPoolConfig) (*ConnPool, error) {
+	if dial == nil {
+		return nil, fmt.Errorf("dial function is nil")
+	}
+	if config.MaxIdle < 0 || config.MaxActive < 0 || config.DialRetries < 0 {
+		return nil, fmt.Errorf("invalid connection pool config %+v", config)
+	}
+	if config.MaxActive > 0 && config.MaxIdle > config.MaxActive {
+		config.MaxIdle = config.MaxActive
+	}
+	pool := &ConnPool{dial: dial, config: config}
+	if config.MaxActive > 0 {
+		pool.sem = syncx.NewSemaphore(int64(config.MaxActive))
+	}
+	return pool, nil
+}
+
+// NewTCPConnPool create a connection pool dials to tcp address
+func NewTCPConnPool(addr string, config ConnPoolConfig) (*ConnPool, error) {
+	return NewConnPool(func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	}, config)
+}
+
+// Get get a connection from pool, see GetContext
+func (p *ConnPool) Get() (*PooledConn, error) {
+	return p.GetContext(context.Background())
+}
+
+// GetContext get an idle connection from pool or dial a new one. if MaxActive is reached it waits until
+// a connection is returned or ctx is done. Close the returned connection to put it back to pool
+func (p *ConnPool) GetContext(ctx context.Context) (*PooledConn, error) {
+	if p.sem != nil {
+		if err := p.sem.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+	}
+	pc, err := p.get(ctx)
+	if err != nil && p.sem != nil {
+		p.sem.Release(1)
+	}
+	return pc, err
+}
+
+func (p *ConnPool) get(ctx context.Context) (*PooledConn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		p.pruneLocked()
+		n := len(p.idle)
+		if n == 0 {
+			p.active++
+			p.mu.Unlock()
+			break
+		}
+		ic := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+
+		if p.config.HealthCheck != nil && time.Since(ic.since) >= p.config.HealthCheckInterval {
+			if err := p.config.HealthCheck(ic.conn); err != nil {
+				p.discard(ic.conn)
+				continue
+			}
+		}
+		p.hits.Add(1)
+		return &PooledConn{Conn: ic.conn, pool: p}, nil
+	}
+
+	conn, err := p.dialWithRetry(ctx)
+	if err != nil {
+		p.mu.Lock()
+		p.active--
+		p.mu.Unlock()
+		return nil, err
+	}
+	return &PooledConn{Conn: conn, pool: p}, nil
+}
+
+// dialWithRetry dial new connection and write magic header
+func (p *ConnPool) dialWithRetry(ctx context.Context) (net.Conn, error) {
+	interval := p.config.RetryInterval
+	var lastErr error
+	for i := 0; i <= p.config.DialRetries; i++ {
+		if i > 0 && interval > 0 {
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, fmt.Errorf("dial failed: %w, last error: %v", ctx.Err(), lastErr)
+			case <-timer.C:
+			}
+			interval *= 2
+		}
+		conn, err := p.dialOnce(ctx)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (p *ConnPool) dialOnce(ctx context.Context) (net.Conn, error) {
+	p.dials.Add(1)
+	dialCtx := ctx
+	if p.config.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, p.config.DialTimeout)
+		defer cancel()
+	}
+	conn, err := p.dial(dialCtx)
+	if err != nil {
+		p.dialFails.Add(1)
+		return nil, err
+	}
+	if len(p.config.MagicHeader) > 0 {
+		if deadline, ok := dialCtx.Deadline(); ok {
+			conn.SetWriteDeadline(deadline)
+		}
+		_, err = conn.Write(p.config.MagicHeader)
+		conn.SetWriteDeadline(time.Time{})
+		if err != nil {
+			p.dialFails.Add(1)
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// pruneLocked close idle connections exceeded idle timeout, must be called with lock held
+func (p *ConnPool) pruneLocked() {
+	if p.config.IdleTimeout <= 0 {
+		return
+	}
+	expired := 0
+	for expired < len(p.idle) && time.Since(p.idle[expired].since) > p.config.IdleTimeout {
+		p.idle[expired].conn.Close()
+		expired++
+	}
+	if expired > 0 {
+		p.idle = append(p.idle[:0], p.idle[expired:]...)
+		p.active -= expired
+		p.discards.Add(int64(expired))
+	}
+}
+
+func (p *ConnPool) discard(conn net.Conn) {
+	conn.Close()
+	p.discards.Add(1)
+	p.mu.Lock()
+	p.active--
+	p.mu.Unlock()
+}
+
+// put return connection to pool, or close it if broken, pool closed or idle is full
+func (p *ConnPool) put(conn net.Conn, broken bool) error {
+	if p.sem != nil {
+		defer p.sem.Release(1)
+	}
+	p.mu.Lock()
+	if broken || p.closed || len(p.idle) >= p.config.MaxIdle {
+		p.active--
+		p.mu.Unlock()
+		return conn.Close()
+	}
+	p.idle = append(p.idle, &idleConn{conn: conn, since: time.Now()})
+	p.pruneLocked()
+	p.mu.Unlock()
+	return nil
+}
+
+// Stats return statistics of pool
+func (p *ConnPool) Stats() ConnPoolStats {
+	p.mu.Lock()
+	active, idle := p.active, len(p.idle)
+	p.mu.Unlock()
+	return ConnPoolStats{
+		Active:    active,
+		Idle:      idle,
+		Dials:     p.dials.Load(),
+		DialFails: p.dialFails.Load(),
+		Hits:      p.hits.Load(),
+		Discards:  p.discards.Load(),
+	}
+}
+
+// Close close all idle connections and the pool. connections in use are closed when they are returned
+func (p *ConnPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.active -= len(idle)
+	p.mu.Unlock()
+
+	var errRet error
+	for _, ic := range idle {
+		if err := ic.conn.Close(); err != nil {
+			errRet = err
+		}
+	}
+	return errRet
+}
+
+// PooledConn is a connection got from ConnPool, Close returns it to the pool
+type PooledConn struct {
+	net.Conn
+	pool *ConnPool
+
+	once   sync.Once
+	broken atomic.Bool
+}
+
+// Read reads data from the connection, connection is marked unusable if any error returned
+func (pc *PooledConn) Read(b []byte) (int, error) {
+	n, err := pc.Conn.Read(b)
+	pc.checkError(err)
+	return n, err
+}
+
+// Write writes data to the connection, connection is marked unusable if any error returned
+func (pc *PooledConn) Write(b []byte) (int, error) {
+	n, err := pc.Conn.Write(b)
+	pc.checkError(err)
+	return n, err
+}
+
+// checkError mark the connection unusable on error. timeout errors are included,
+// as a request or response may be partially transferred and the stream is out of sync
+func (pc *PooledConn) checkError(err error) {
+	if err != nil {
+		pc.broken.Store(true)
+	}
+}
+
+// MarkUnusable mark the connection unusable, it will be closed instead of returned to pool
+func (pc *PooledConn) MarkUnusable() {
+	pc.broken.Store(true)
+}
+
+// Close return the connection to pool, or close it if it is unusable. it is safe to call Close more than once
+func (pc *PooledConn) Close() error {
+	var err error
+	pc.once.Do(func() {
+		// clear deadlines set by user before reuse
+		if !pc.broken.Load() && pc.Conn.SetDeadline(time.Time{}) != nil {
+			pc.broken.Store(true)
+		}
+		err = pc.pool.put(pc.Conn, pc.broken.Load())
+	})
+	return err
+}
+
+// CheckConnAlive check if connection is closed by peer or has unexpected data by a non-blocking read,
+// could be used as ConnPoolConfig.HealthCheck
+func CheckConnAlive(conn net.Conn) error {
+	if err := conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return err
+	}
+	defer conn.SetReadDeadline(time.Time{})
+	var b [1]byte
+	n, err := conn.Read(b[:])
+	if n > 0 {
+		return fmt.Errorf("unexpected data read from idle connection")
+	}
+	if err == nil || isTimeout(err) {
+		return nil
+	}
+	if err == io.EOF {
+		return fmt.Errorf("connection closed by peer")
+	}
+	return err
+}
@@ -0,0 +1,203 @@
+package netutil_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/netutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// startEchoSelector start a selector routes magic code "PRPC" to an echo server, return address and accepted count
+func startEchoSelector() (*netutil.CustomListenerSelector, string, *atomic.Int64) {
+	selector, err := netutil.NewCustomListenerSelector("tcp", "127.0.0.1", 0, 4, netutil.Equal_Mode)
+	So(err, ShouldBeNil)
+	l, err := selector.RegisterListener("PRPC")
+	So(err, ShouldBeNil)
+	go selector.Serve()
+
+	accepted := &atomic.Int64{}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				// skip magic code
+				head := make([]byte, 4)
+				if _, err := io.ReadFull(conn, head); err != nil {
+					return
+				}
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return selector, l.Addr().String(), accepted
+}
+
+func echo(conn net.Conn, data string) string {
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte(data)); err != nil {
+		return err.Error()
+	}
+	buf := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err.Error()
+	}
+	return string(buf)
+}
+
+func TestConnPool(t *testing.T) {
+	Convey("Test connection pool", t, func() {
+		selector, addr, accepted := startEchoSelector()
+		defer selector.Close()
+
+		Convey("reuse connection with magic header", func() {
+			pool, err := netutil.NewTCPConnPool(addr, netutil.ConnPoolConfig{MaxIdle: 2, MagicHeader: []byte("PRPC")})
+			So(err, ShouldBeNil)
+			defer pool.Close()
+
+			for i := 0; i < 3; i++ {
+				conn, err := pool.Get()
+				So(err, ShouldBeNil)
+				So(echo(conn, "hello"), ShouldEqual, "hello")
+				So(conn.Close(), ShouldBeNil)
+				So(conn.Close(), ShouldBeNil)
+			}
+			stats := pool.Stats()
+			So(stats.Dials, ShouldEqual, 1)
+			So(stats.Hits, ShouldEqual, 2)
+			So(stats.Idle, ShouldEqual, 1)
+			So(stats.Active, ShouldEqual, 1)
+			So(accepted.Load(), ShouldEqual, 1)
+
+			// broken connection is not returned to pool
+			conn, err := pool.Get()
+			So(err, ShouldBeNil)
+			conn.MarkUnusable()
+			conn.Close()
+			So(pool.Stats().Idle, ShouldEqual, 0)
+			So(pool.Stats().Active, ShouldEqual, 0)
+
+			// connection timed out while reading is not returned to pool
+			conn, err = pool.Get()
+			So(err, ShouldBeNil)
+			conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+			_, err = conn.Read(make([]byte, 1))
+			So(err, ShouldNotBeNil)
+			conn.Close()
+			So(pool.Stats().Idle, ShouldEqual, 0)
+		})
+
+		Convey("max active connections", func() {
+			pool, err := netutil.NewTCPConnPool(addr, netutil.ConnPoolConfig{MaxIdle: 1, MaxActive: 1, MagicHeader: []byte("PRPC")})
+			So(err, ShouldBeNil)
+			defer pool.Close()
+
+			conn, err := pool.Get()
+			So(err, ShouldBeNil)
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			_, err = pool.GetContext(ctx)
+			So(err, ShouldResemble, context.DeadlineExceeded)
+
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				conn.Close()
+			}()
+			conn2, err := pool.Get()
+			So(err, ShouldBeNil)
+			So(echo(conn2, "again"), ShouldEqual, "again")
+			conn2.Close()
+			So(pool.Stats().Dials, ShouldEqual, 1)
+		})
+
+		Convey("health check and idle timeout", func() {
+			pool, err := netutil.NewTCPConnPool(addr, netutil.ConnPoolConfig{
+				MaxIdle: 2, MagicHeader: []byte("PRPC"), HealthCheck: netutil.CheckConnAlive, IdleTimeout: 100 * time.Millisecond,
+			})
+			So(err, ShouldBeNil)
+			defer pool.Close()
+
+			conn, err := pool.Get()
+			So(err, ShouldBeNil)
+			So(echo(conn, "a"), ShouldEqual, "a")
+			// server closes connection after client half closed
+			conn.Conn.(*net.TCPConn).CloseWrite()
+			time.Sleep(50 * time.Millisecond)
+			conn.Close()
+
+			conn, err = pool.Get()
+			So(err, ShouldBeNil)
+			So(echo(conn, "b"), ShouldEqual, "b")
+			conn.Close()
+			So(pool.Stats().Discards, ShouldEqual, 1)
+			So(pool.Stats().Dials, ShouldEqual, 2)
+
+			time.Sleep(150 * time.Millisecond)
+			conn, err = pool.Get()
+			So(err, ShouldBeNil)
+			conn.Close()
+			So(pool.Stats().Discards, ShouldEqual, 2)
+			So(pool.Stats().Dials, ShouldEqual, 3)
+		})
+
+		Convey("close pool", func() {
+			pool, err := netutil.NewTCPConnPool(addr, netutil.ConnPoolConfig{MaxIdle: 2, MagicHeader: []byte("PRPC")})
+			So(err, ShouldBeNil)
+			conn1, err := pool.Get()
+			So(err, ShouldBeNil)
+			conn2, err := pool.Get()
+			So(err, ShouldBeNil)
+			conn1.Close()
+
+			So(pool.Close(), ShouldBeNil)
+			_, err = pool.Get()
+			So(err, ShouldEqual, netutil.ErrPoolClosed)
+			conn2.Close()
+			So(pool.Stats().Active, ShouldEqual, 0)
+		})
+	})
+}
+
+func TestConnPoolDialRetry(t *testing.T) {
+	Convey("Test dial with retry", t, func() {
+		var dials atomic.Int64
+		client, server := net.Pipe()
+		defer server.Close()
+		dial := func(ctx context.Context) (net.Conn, error) {
+			if dials.Add(1) < 3 {
+				return nil, errors.New("refused")
+			}
+			return client, nil
+		}
+
+		pool, err := netutil.NewConnPool(dial, netutil.ConnPoolConfig{DialRetries: 1, RetryInterval: time.Millisecond})
+		So(err, ShouldBeNil)
+		_, err = pool.Get()
+		So(err, ShouldNotBeNil)
+
+		dials.Store(0)
+		pool, err = netutil.NewConnPool(dial, netutil.ConnPoolConfig{DialRetries: 2, RetryInterval: time.Millisecond})
+		So(err, ShouldBeNil)
+		conn, err := pool.Get()
+		So(err, ShouldBeNil)
+		So(conn, ShouldNotBeNil)
+		stats := pool.Stats()
+		So(stats.Dials, ShouldEqual, 3)
+		So(stats.DialFails, ShouldEqual, 2)
+
+		_, err = netutil.NewConnPool(nil, netutil.ConnPoolConfig{})
+		So(err, ShouldNotBeNil)
+		_, err = netutil.NewConnPool(dial, netutil.ConnPoolConfig{MaxIdle: -1})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -2,20 +2,30 @@
 package netutil
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	Equal_Mode     = 1
 	StartWith_Mode = 2
+
+	// interval to check if selector is drained in Shutdown
+	shutdownPollInterval = 10 * time.Millisecond
 )
 
+// ErrSelectorClosed is returned by Serve after Close or Shutdown called, it wraps net.ErrClosed
+var ErrSelectorClosed = fmt.Errorf("netutil: listener selector closed: %w", net.ErrClosed)
+
 type NetInfo struct {
 	conn net.Conn
 	err  error
@@ -26,17 +36,42 @@ type CustomListener struct {
 	listenerProxy net.Listener
 
 	sessionChan chan NetInfo
+
+	mu     sync.Mutex
+	closed bool
+	closeC chan struct{}
+	err    error
+
+	routed atomic.Int64 // count of connections routed to the listener
+}
+
+func newCustomListener(l net.Listener, backlog int) *CustomListener {
+	if backlog < 0 {
+		backlog = 0
+	}
+	return &CustomListener{listenerProxy: l, sessionChan: make(chan NetInfo, backlog), closeC: make(chan struct{})}
 }
 
 // Accept to get net.Conn from listener proxy or block if no connection
 func (l *CustomListener) Accept() (net.Conn, error) {
-	conn := <-l.sessionChan
-	return conn.conn, conn.err
+	// take queued connection first
+	select {
+	case conn := <-l.sessionChan:
+		return conn.conn, conn.err
+	default:
+	}
+	select {
+	case conn := <-l.sessionChan:
+		return conn.conn, conn.err
+	case <-l.closeC:
+		return nil, l.err
+	}
 }
 
-// Close close listener proxy
+// Close stop accepting on this listener, blocked Accept calls return net.ErrClosed and connections
+// routed to it afterwards are closed. the listener proxy is still owned and closed by CustomListenerSelector
 func (l *CustomListener) Close() error {
-	//  should do nothing and do close action by CustomListenerSelector
+	l.shutdown(net.ErrClosed)
 	return nil
 }
 
@@ -45,14 +80,90 @@ func (l *CustomListener) Addr() net.Addr {
 	return l.listenerProxy.Addr()
 }
 
-// CustomListenerSelector a selector CustomListener by head value
+// offer send connection to listener. if backlog is set, connection is dropped when backlog is full,
+// otherwise it blocks until connection is accepted. return false if connection is not delivered
+func (l *CustomListener) offer(conn net.Conn) bool {
+	if cap(l.sessionChan) > 0 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.closed {
+			return false
+		}
+		select {
+		case l.sessionChan <- NetInfo{conn, nil}:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case l.sessionChan <- NetInfo{conn, nil}:
+		return true
+	case <-l.closeC:
+		return false
+	}
+}
+
+// shutdown unblock all Accept calls with err and close queued connections which are not accepted
+func (l *CustomListener) shutdown(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.closed = true
+	l.err = err
+	close(l.closeC)
+	for {
+		select {
+		case conn := <-l.sessionChan:
+			conn.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// queued return count of connections waiting in backlog
+func (l *CustomListener) queued() int {
+	return len(l.sessionChan)
+}
+
+// SelectorStats statistics of CustomListenerSelector
+type SelectorStats struct {
+	Accepted   int64 // connections accepted from listener proxy
+	Active     int64 // connections not closed yet, include those still being matched
+	Rejected   int64 // connections rejected by max connections limit
+	Dropped    int64 // connections closed by selector as backlog is full, client closed before sending data or selector closed
+	Timeouts   int64 // connections exceeded header read timeout
+	ShortReads int64 // connections sent less bytes than head size of magic code
+
+	Routed          map[string]int64 // connections routed by magic code
+	RoutedByMatcher []int64          // connections routed to matcher listeners in register order
+	RoutedToDefault int64            // connections routed to default listener
+}
+
+// CustomListenerSelector a selector CustomListener by head value or protocol matchers
 type CustomListenerSelector struct {
-	headSize        uint8
-	defaultListener *CustomListener
-	listeners       map[string]*CustomListener
+	headSize          uint8
+	defaultListener   *CustomListener
+	defaultRegistered atomic.Bool
+	dropUnmatched     bool
+	listeners         map[string]*CustomListener
+	matcherListeners  []*matcherListener
 
 	listenerProxy net.Listener
 	matchMode     int
+
+	headerReadTimeout time.Duration
+	maxConns          int64
+	backlog           int
+
+	mu       sync.Mutex
+	inflight map[*ConnWrapper]struct{} // connections being matched or waiting in backlog
+	closing  atomic.Bool
+
+	accepted, active, rejected, dropped, timeouts, shortReads atomic.Int64
 }
 
 // NewCustomListenerSelector new a CustomListenerSelector
@@ -78,91 +189,302 @@ func NewCustomListenerSelectorByListener(l net.Listener, headsize uint8, matchMo
 
 	selector := &CustomListenerSelector{listenerProxy: l, headSize: headsize, matchMode: matchMode}
 	selector.listeners = make(map[string]*CustomListener)
+	selector.inflight = make(map[*ConnWrapper]struct{})
 
-	selector.defaultListener = &CustomListener{listenerProxy: l, sessionChan: make(chan NetInfo)}
+	selector.defaultListener = newCustomListener(l, 0)
 
 	return selector, nil
 }
 
+// SetHeaderReadTimeout set max duration to wait for client sending data to select listener, zero means no timeout.
+// connection timed out is routed to default listener with bytes already received, or closed if SetDropUnmatched is enabled.
+func (server *CustomListenerSelector) SetHeaderReadTimeout(timeout time.Duration) {
+	server.headerReadTimeout = timeout
+}
+
+// SetMaxConnections set max count of connections not closed, new connections are closed immediately once limit reached.
+// zero means no limit
+func (server *CustomListenerSelector) SetMaxConnections(max int) {
+	server.maxConns = int64(max)
+}
+
+// SetAcceptBacklog set default accept backlog of listeners registered later, see SetListenerBacklog.
+// it should be called before register listeners
+func (server *CustomListenerSelector) SetAcceptBacklog(backlog int) {
+	server.backlog = backlog
+	if !server.defaultRegistered.Load() {
+		server.defaultListener = newCustomListener(server.listenerProxy, backlog)
+	}
+}
+
+// SetListenerBacklog set accept backlog of a registered listener, it should be called before Serve.
+// if backlog is zero, routing a connection blocks until listener accepts it. otherwise up to backlog connections
+// are queued and new connections are closed if the queue is full.
+func (server *CustomListenerSelector) SetListenerBacklog(l net.Listener, backlog int) error {
+	cl, ok := l.(*CustomListener)
+	if !ok || !server.owns(cl) {
+		return fmt.Errorf("listener is not registered by the selector")
+	}
+	if backlog < 0 {
+		backlog = 0
+	}
+	cl.sessionChan = make(chan NetInfo, backlog)
+	return nil
+}
+
+func (server *CustomListenerSelector) owns(l *CustomListener) bool {
+	if l == server.defaultListener {
+		return true
+	}
+	for _, listener := range server.allListeners() {
+		if listener == l {
+			return true
+		}
+	}
+	return false
+}
+
 // RegisterListener register a listener by magic code
 func (server *CustomListenerSelector) RegisterListener(headMagiccode string) (net.Listener, error) {
 	if len(headMagiccode) != int(server.headSize) && server.matchMode == Equal_Mode {
 		return nil, fmt.Errorf("error head magic code '%s', size should be '%d'", headMagiccode, server.headSize)
 	}
-	listener := &CustomListener{listenerProxy: server.listenerProxy, sessionChan: make(chan NetInfo)}
+	listener := newCustomListener(server.listenerProxy, server.backlog)
 	server.listeners[headMagiccode] = listener
 	return listener, nil
 }
 
+// matcherListener a listener with matchers
+type matcherListener struct {
+	matchers []WriteMatcher
+	listener *CustomListener
+}
+
+// RegisterMatcherListener register a listener which accepts connection matched by any of matchers.
+// connections are dispatched by magic code listeners first, then by matcher listeners in register order,
+// and to default listener if nothing matched.
+func (server *CustomListenerSelector) RegisterMatcherListener(matchers ...Matcher) (net.Listener, error) {
+	writeMatchers := make([]WriteMatcher, len(matchers))
+	for i, m := range matchers {
+		if m == nil {
+			return nil, fmt.Errorf("matcher is nil")
+		}
+		matcher := m
+		writeMatchers[i] = func(w io.Writer, r io.Reader) bool {
+			return matcher(r)
+		}
+	}
+	return server.RegisterWriteMatcherListener(writeMatchers...)
+}
+
+// RegisterWriteMatcherListener register a listener which accepts connection matched by any of write matchers
+func (server *CustomListenerSelector) RegisterWriteMatcherListener(matchers ...WriteMatcher) (net.Listener, error) {
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("no matcher found")
+	}
+	for _, m := range matchers {
+		if m == nil {
+			return nil, fmt.Errorf("matcher is nil")
+		}
+	}
+	listener := newCustomListener(server.listenerProxy, server.backlog)
+	server.matcherListeners = append(server.matcherListeners, &matcherListener{matchers: matchers, listener: listener})
+	return listener, nil
+}
+
 // RegisterDefaultListener to return default listener
 func (server *CustomListenerSelector) RegisterDefaultListener() net.Listener {
+	server.defaultRegistered.Store(true)
 	return server.defaultListener
 }
 
+// SetDropUnmatched close connections matching no listener instead of routing them to default listener.
+// it should be called before Serve
+func (server *CustomListenerSelector) SetDropUnmatched(drop bool) {
+	server.dropUnmatched = drop
+}
+
 // Serve do listening from net trasport
 func (server *CustomListenerSelector) Serve() error {
 	for {
 		conn, err := server.listenerProxy.Accept()
 		if err != nil {
+			if server.closing.Load() {
+				return ErrSelectorClosed
+			}
 			log.Println("CustomListenerSelector started failed.", err)
 			// if met error broadcast to all listeners
-			netinfo := NetInfo{conn, err}
-			for _, server := range server.listeners {
-				s := server
-				go func() {
-					s.sessionChan <- netinfo
-				}()
-			}
+			server.closeListeners(err)
 			return err
 		}
+		server.accepted.Add(1)
 
-		go func() {
-			r := conn.(io.Reader)
-
-			// read Head
-			head := make([]byte, server.headSize)
-			io.ReadFull(r, head)
-			cw := &ConnWrapper{conn, head, 0, server.headSize}
-			netinfo := NetInfo{cw, nil}
-
-			if server.matchMode == Equal_Mode {
-				serverListener, ok := server.listeners[string(head)]
-				if !ok { // not exist, use default listener
-					server.defaultListener.sessionChan <- netinfo
-				} else {
-					serverListener.sessionChan <- netinfo
-				}
-			} else { // start with mode
-				var matched bool = false
-				for magicCode, listener := range server.listeners {
-					if strings.HasPrefix(string(head), magicCode) {
-						listener.sessionChan <- netinfo
-						matched = true
-						break
-					}
-				}
-				if !matched { // not matched use default listener
-					server.defaultListener.sessionChan <- netinfo
+		if server.maxConns > 0 && server.active.Load() >= server.maxConns {
+			server.rejected.Add(1)
+			conn.Close()
+			continue
+		}
+		server.active.Add(1)
+		cw := &ConnWrapper{conn: conn}
+		cw.onClose = func() {
+			server.active.Add(-1)
+		}
+		server.mu.Lock()
+		server.inflight[cw] = struct{}{}
+		server.mu.Unlock()
+
+		go server.dispatch(cw)
+	}
+
+}
+
+// dispatch select listener for the connection and send it to the listener
+func (server *CustomListenerSelector) dispatch(cw *ConnWrapper) {
+	defer func() {
+		server.mu.Lock()
+		delete(server.inflight, cw)
+		server.mu.Unlock()
+	}()
+
+	conn := cw.conn
+	if server.headerReadTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(server.headerReadTimeout))
+	}
+	sniff := newSniffReader(conn)
+	listener, byMatcher := server.match(conn, sniff)
+	if server.headerReadTimeout > 0 {
+		conn.SetReadDeadline(time.Time{})
+	}
+
+	timeout := isTimeout(sniff.err)
+	if timeout {
+		server.timeouts.Add(1)
+	}
+	if listener == nil {
+		// nothing received and client closed, or unmatched connection is not wanted
+		if (len(sniff.buf) == 0 && sniff.err != nil && !timeout) || server.dropUnmatched {
+			server.dropped.Add(1)
+			cw.Close()
+			return
+		}
+		listener = server.defaultListener
+	}
+
+	// replay all bytes read during matching
+	cw.head = sniff.buf
+	// client may stop sending if head is not complete
+	cw.readThrough = !byMatcher && sniff.err == nil
+	if !listener.offer(cw) {
+		server.dropped.Add(1)
+		cw.Close()
+		return
+	}
+	listener.routed.Add(1)
+}
+
+// match return the listener for the connection, nil returned if nothing matched.
+// byMatcher is true if any matcher has read from the connection
+func (server *CustomListenerSelector) match(conn net.Conn, sniff *sniffReader) (listener *CustomListener, byMatcher bool) {
+	if server.headSize > 0 && len(server.listeners) > 0 {
+		// read Head
+		head := make([]byte, server.headSize)
+		n, _ := io.ReadFull(sniff, head)
+		if n < len(head) {
+			server.shortReads.Add(1)
+		}
+		head = head[:n]
+
+		if server.matchMode == Equal_Mode {
+			if listener, ok := server.listeners[string(head)]; ok {
+				return listener, false
+			}
+		} else { // start with mode
+			for magicCode, listener := range server.listeners {
+				if strings.HasPrefix(string(head), magicCode) {
+					return listener, false
 				}
 			}
+		}
+	}
+
+	for _, ml := range server.matcherListeners {
+		for _, m := range ml.matchers {
+			sniff.reset()
+			if m(conn, sniff) {
+				return ml.listener, true
+			}
+		}
+	}
+	return nil, len(server.matcherListeners) > 0
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
 
-		}()
+// allListeners return all registered listeners except default listener
+func (server *CustomListenerSelector) allListeners() []*CustomListener {
+	ret := make([]*CustomListener, 0, len(server.listeners)+len(server.matcherListeners))
+	for _, listener := range server.listeners {
+		ret = append(ret, listener)
+	}
+	for _, ml := range server.matcherListeners {
+		ret = append(ret, ml.listener)
+	}
+	return ret
+}
+
+func (server *CustomListenerSelector) closeListeners(err error) {
+	for _, listener := range server.allListeners() {
+		listener.shutdown(err)
+	}
+	server.defaultListener.shutdown(err)
+}
 
+// closeInflight close connections which are not delivered to listeners
+func (server *CustomListenerSelector) closeInflight() {
+	server.mu.Lock()
+	conns := make([]*ConnWrapper, 0, len(server.inflight))
+	for cw := range server.inflight {
+		conns = append(conns, cw)
 	}
+	server.mu.Unlock()
+	for _, cw := range conns {
+		cw.Close()
+	}
+}
 
+// drained return true if no connection is being matched or waiting in backlog
+func (server *CustomListenerSelector) drained() bool {
+	server.mu.Lock()
+	n := len(server.inflight)
+	server.mu.Unlock()
+	if n > 0 {
+		return false
+	}
+	for _, listener := range server.allListeners() {
+		if listener.queued() > 0 {
+			return false
+		}
+	}
+	return server.defaultListener.queued() == 0
 }
 
 // Close do close all listeners
 func (server *CustomListenerSelector) Close() error {
+	server.closing.Store(true)
 
 	var errRet error
 	errRet = server.listenerProxy.Close()
+	server.closeListeners(net.ErrClosed)
+	server.closeInflight()
 	if errRet != nil {
 		return errRet
 	}
 
-	for _, server := range server.listeners {
-		err := server.Close()
+	for _, listener := range server.allListeners() {
+		err := listener.Close()
 		if err != nil {
 			errRet = err
 		}
@@ -171,48 +493,87 @@ func (server *CustomListenerSelector) Close() error {
 	return errRet
 }
 
-// net.Conn  proxy
+// Shutdown gracefully shuts down the selector. it stops accepting new connections, waits for connections
+// being matched or queued in backlogs to be accepted by listeners, and then closes all listeners.
+// connections already accepted by listeners are owned by their servers and not closed.
+// if ctx is done before that, remaining connections are closed and ctx.Err() is returned.
+func (server *CustomListenerSelector) Shutdown(ctx context.Context) error {
+	server.closing.Store(true)
+	err := server.listenerProxy.Close()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for !server.drained() {
+		select {
+		case <-ctx.Done():
+			server.closeListeners(net.ErrClosed)
+			server.closeInflight()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	server.closeListeners(net.ErrClosed)
+	if errors.Is(err, net.ErrClosed) {
+		// already closed
+		return nil
+	}
+	return err
+}
+
+// Stats return statistics of the selector
+func (server *CustomListenerSelector) Stats() SelectorStats {
+	stats := SelectorStats{
+		Accepted:        server.accepted.Load(),
+		Active:          server.active.Load(),
+		Rejected:        server.rejected.Load(),
+		Dropped:         server.dropped.Load(),
+		Timeouts:        server.timeouts.Load(),
+		ShortReads:      server.shortReads.Load(),
+		Routed:          make(map[string]int64, len(server.listeners)),
+		RoutedByMatcher: make([]int64, len(server.matcherListeners)),
+		RoutedToDefault: server.defaultListener.routed.Load(),
+	}
+	for magicCode, listener := range server.listeners {
+		stats.Routed[magicCode] = listener.routed.Load()
+	}
+	for i, ml := range server.matcherListeners {
+		stats.RoutedByMatcher[i] = ml.listener.routed.Load()
+	}
+	return stats
+}
+
+// net.Conn  proxy, replays head bytes read by selector before reading from the connection
 type ConnWrapper struct {
-	conn     net.Conn
-	head     []byte
-	n        int
-	headsize uint8
+	conn net.Conn
+	head []byte
+	n    int
+
+	// readThrough continue reading from connection in the same Read call once head is exhausted.
+	// it is disabled for connections sniffed by matchers, as client may wait for response after sending all sniffed bytes
+	readThrough bool
+
+	closeOnce sync.Once
+	onClose   func()
 }
 
 // Read reads data from the connection.
 // Read can be made to time out and return an error after a fixed
 // time limit; see SetDeadline and SetReadDeadline.
 func (cw *ConnWrapper) Read(b []byte) (n int, err error) {
-	size := len(b)
-
-	count := 0
 	// if still could read from head
-	if cw.n < int(cw.headsize) {
-		for i := cw.n; i < int(cw.headsize); i++ {
-			b[count] = cw.head[i]
-			count++
-			cw.n++
-			if count >= size { // if read finish
-				break
-			}
-		}
-
-		// if read all from head
-		if count >= size {
-			return size, nil
+	if cw.n < len(cw.head) {
+		count := copy(b, cw.head[cw.n:])
+		cw.n += count
+		// if read finish
+		if count >= len(b) || !cw.readThrough {
+			return count, nil
 		}
 		// otherwise read left
 		nn, err := cw.conn.Read(b[count:])
-		count = count + nn
-		if err != nil {
-			return count, err
-		}
-		return count, nil
-	} else {
-		// otherwize read directly
-		count, err := cw.conn.Read(b)
-		return count, err
+		return count + nn, err
 	}
+	// otherwize read directly
+	return cw.conn.Read(b)
 }
 
 // Write writes data to the connection.
@@ -225,6 +586,11 @@ func (cw *ConnWrapper) Write(b []byte) (n int, err error) {
 // Close closes the connection.
 // Any blocked Read or Write operations will be unblocked and return errors.
 func (cw *ConnWrapper) Close() error {
+	cw.closeOnce.Do(func() {
+		if cw.onClose != nil {
+			cw.onClose()
+		}
+	})
 	return cw.conn.Close()
 }
 
@@ -2,9 +2,12 @@ package netutil_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -113,3 +116,257 @@ func handleConn(conn net.Conn, quitString string) {
 		result.Reset()
 	}
 }
+
+// startSelector create a selector on random port with magic code listener "PRPC"
+func startSelector(setup func(s *netutil.CustomListenerSelector)) (*netutil.CustomListenerSelector, net.Listener, string) {
+	selector, err := netutil.NewCustomListenerSelector("tcp", "127.0.0.1", 0, 4, netutil.Equal_Mode)
+	So(err, ShouldBeNil)
+	if setup != nil {
+		setup(selector)
+	}
+	rpcListener, err := selector.RegisterListener("PRPC")
+	So(err, ShouldBeNil)
+	go selector.Serve()
+	return selector, rpcListener, rpcListener.Addr().String()
+}
+
+// dialAndSend dial to addr and send data
+func dialAndSend(addr, data string) net.Conn {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	So(err, ShouldBeNil)
+	_, err = conn.Write([]byte(data))
+	So(err, ShouldBeNil)
+	return conn
+}
+
+// isClosedByPeer return true if conn is closed by remote side in timeout
+func isClosedByPeer(conn net.Conn, timeout time.Duration) bool {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err := conn.Read(make([]byte, 1))
+	return err == io.EOF || (err != nil && !os.IsTimeout(err))
+}
+
+func acceptTimeout(l net.Listener, timeout time.Duration) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := l.Accept()
+		ch <- result{conn, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.conn, r.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("accept timeout")
+	}
+}
+
+func TestSelectorHeaderReadTimeout(t *testing.T) {
+	Convey("Test header read timeout", t, func() {
+		Convey("slow client is routed to default listener", func() {
+			var defaultListener net.Listener
+			selector, _, addr := startSelector(func(s *netutil.CustomListenerSelector) {
+				s.SetHeaderReadTimeout(200 * time.Millisecond)
+				defaultListener = s.RegisterDefaultListener()
+			})
+			defer selector.Close()
+
+			client := dialAndSend(addr, "PR")
+			defer client.Close()
+
+			conn, err := acceptTimeout(defaultListener, 2*time.Second)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			buf := make([]byte, 8)
+			n, err := conn.Read(buf)
+			So(err, ShouldBeNil)
+			So(string(buf[:n]), ShouldEqual, "PR")
+
+			stats := selector.Stats()
+			So(stats.Timeouts, ShouldEqual, 1)
+			So(stats.ShortReads, ShouldEqual, 1)
+			So(stats.RoutedToDefault, ShouldEqual, 1)
+		})
+
+		Convey("slow client is closed when dropping unmatched", func() {
+			selector, _, addr := startSelector(func(s *netutil.CustomListenerSelector) {
+				s.SetHeaderReadTimeout(200 * time.Millisecond)
+				s.SetDropUnmatched(true)
+			})
+			defer selector.Close()
+
+			client := dialAndSend(addr, "PR")
+			defer client.Close()
+			So(isClosedByPeer(client, 2*time.Second), ShouldBeTrue)
+			So(selector.Stats().Dropped, ShouldEqual, 1)
+		})
+
+		Convey("unmatched client is routed to default listener registered later", func() {
+			selector, _, addr := startSelector(nil)
+			defer selector.Close()
+
+			client := dialAndSend(addr, "HTTP")
+			defer client.Close()
+			conn, err := acceptTimeout(selector.RegisterDefaultListener(), 2*time.Second)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			buf := make([]byte, 4)
+			_, err = io.ReadFull(conn, buf)
+			So(err, ShouldBeNil)
+			So(string(buf), ShouldEqual, "HTTP")
+		})
+
+		Convey("client closed before sending data", func() {
+			selector, _, addr := startSelector(nil)
+			defer selector.Close()
+
+			client := dialAndSend(addr, "")
+			client.Close()
+			for i := 0; i < 100 && selector.Stats().Active > 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			stats := selector.Stats()
+			So(stats.Active, ShouldEqual, 0)
+			So(stats.ShortReads, ShouldEqual, 1)
+			So(stats.Dropped, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestSelectorMaxConnections(t *testing.T) {
+	Convey("Test max connections", t, func() {
+		selector, rpcListener, addr := startSelector(func(s *netutil.CustomListenerSelector) {
+			s.SetMaxConnections(1)
+		})
+		defer selector.Close()
+
+		client1 := dialAndSend(addr, "PRPC1")
+		defer client1.Close()
+		conn1, err := acceptTimeout(rpcListener, 2*time.Second)
+		So(err, ShouldBeNil)
+
+		client2 := dialAndSend(addr, "PRPC2")
+		defer client2.Close()
+		So(isClosedByPeer(client2, 2*time.Second), ShouldBeTrue)
+		So(selector.Stats().Rejected, ShouldEqual, 1)
+
+		// release one connection
+		conn1.Close()
+		So(selector.Stats().Active, ShouldEqual, 0)
+		client3 := dialAndSend(addr, "PRPC3")
+		defer client3.Close()
+		conn3, err := acceptTimeout(rpcListener, 2*time.Second)
+		So(err, ShouldBeNil)
+		defer conn3.Close()
+
+		stats := selector.Stats()
+		So(stats.Accepted, ShouldEqual, 3)
+		So(stats.Routed["PRPC"], ShouldEqual, 2)
+	})
+}
+
+func TestSelectorAcceptBacklog(t *testing.T) {
+	Convey("Test accept backlog", t, func() {
+		selector, rpcListener, addr := startSelector(func(s *netutil.CustomListenerSelector) {
+			s.SetAcceptBacklog(1)
+			xmlListener, err := s.RegisterListener("XMLS")
+			So(err, ShouldBeNil)
+			So(s.SetListenerBacklog(xmlListener, 0), ShouldBeNil)
+			So(s.SetListenerBacklog(&netutil.CustomListener{}, 1), ShouldNotBeNil)
+		})
+		defer selector.Close()
+
+		client1 := dialAndSend(addr, "PRPC1")
+		defer client1.Close()
+		for i := 0; i < 100 && selector.Stats().Routed["PRPC"] == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		// backlog is full
+		client2 := dialAndSend(addr, "PRPC2")
+		defer client2.Close()
+		So(isClosedByPeer(client2, 2*time.Second), ShouldBeTrue)
+		So(selector.Stats().Dropped, ShouldEqual, 1)
+
+		conn, err := acceptTimeout(rpcListener, time.Second)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(conn, buf)
+		So(err, ShouldBeNil)
+		So(string(buf), ShouldEqual, "PRPC1")
+	})
+}
+
+func TestSelectorShutdown(t *testing.T) {
+	Convey("Test graceful shutdown", t, func() {
+		Convey("queued connection is drained", func() {
+			selector, err := netutil.NewCustomListenerSelector("tcp", "127.0.0.1", 0, 4, netutil.Equal_Mode)
+			So(err, ShouldBeNil)
+			selector.SetAcceptBacklog(4)
+			rpcListener, err := selector.RegisterListener("PRPC")
+			So(err, ShouldBeNil)
+			serveErr := make(chan error, 1)
+			go func() {
+				serveErr <- selector.Serve()
+			}()
+
+			client := dialAndSend(rpcListener.Addr().String(), "PRPC1")
+			defer client.Close()
+			for i := 0; i < 100 && selector.Stats().Routed["PRPC"] == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			shutdownErr := make(chan error, 1)
+			go func() {
+				shutdownErr <- selector.Shutdown(context.Background())
+			}()
+			err = <-serveErr
+			So(err, ShouldEqual, netutil.ErrSelectorClosed)
+			So(errors.Is(err, net.ErrClosed), ShouldBeTrue)
+
+			conn, err := acceptTimeout(rpcListener, time.Second)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			So(<-shutdownErr, ShouldBeNil)
+
+			_, err = rpcListener.Accept()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("closed listener returns net.ErrClosed", func() {
+			selector, rpcListener, addr := startSelector(nil)
+			defer selector.Close()
+			acceptErr := make(chan error, 1)
+			go func() {
+				_, err := rpcListener.Accept()
+				acceptErr <- err
+			}()
+			So(rpcListener.Close(), ShouldBeNil)
+			So(errors.Is(<-acceptErr, net.ErrClosed), ShouldBeTrue)
+
+			client := dialAndSend(addr, "PRPC1")
+			defer client.Close()
+			So(isClosedByPeer(client, 2*time.Second), ShouldBeTrue)
+		})
+
+		Convey("shutdown timeout closes pending connections", func() {
+			selector, rpcListener, addr := startSelector(nil)
+			client := dialAndSend(addr, "PRPC1")
+			defer client.Close()
+			for i := 0; i < 100 && selector.Stats().Active == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			So(selector.Shutdown(ctx), ShouldResemble, context.DeadlineExceeded)
+			So(isClosedByPeer(client, 2*time.Second), ShouldBeTrue)
+			_, err := rpcListener.Accept()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,440 @@
+package netutil
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInjectedDisconnect is returned when connection is closed by FaultInjector
+	ErrInjectedDisconnect = errors.New("netutil: connection closed by fault injector")
+	// ErrInjectedPartition is returned when dial to a partitioned address
+	ErrInjectedPartition = errors.New("netutil: network partitioned by fault injector")
+)
+
+// FaultInjector injects network faults into wrapped listeners and connections to simulate bad networks in tests.
+// all faults could be changed at runtime and take effect on existing connections immediately.
+type FaultInjector struct {
+	mu             sync.Mutex
+	latency        time.Duration
+	jitter         time.Duration
+	bandwidth      int // bytes per second of each connection
+	truncateRate   float64
+	disconnectRate float64
+	partitionAll   bool
+	partitioned    map[string]bool
+	rnd            *rand.Rand
+
+	conns   map[*FaultConn]struct{}
+	changed chan struct{} // closed and replaced when partition state changed
+}
+
+// NewFaultInjector create a FaultInjector without any fault
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{
+		partitioned: make(map[string]bool),
+		rnd:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		conns:       make(map[*FaultConn]struct{}),
+		changed:     make(chan struct{}),
+	}
+}
+
+// SetSeed set seed of random source to make random faults reproducible
+func (fi *FaultInjector) SetSeed(seed int64) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.rnd = rand.New(rand.NewSource(seed))
+}
+
+// SetLatency delay each write by latency plus a random duration in [0, jitter)
+func (fi *FaultInjector) SetLatency(latency, jitter time.Duration) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.latency, fi.jitter = latency, jitter
+}
+
+// SetBandwidth limit write speed of each connection in bytes per second, zero means no limit
+func (fi *FaultInjector) SetBandwidth(bytesPerSecond int) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.bandwidth = bytesPerSecond
+}
+
+// SetTruncateRate set probability in [0, 1] that a write only sends part of data and then the connection is closed
+func (fi *FaultInjector) SetTruncateRate(rate float64) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.truncateRate = rate
+}
+
+// SetDisconnectRate set probability in [0, 1] that a read or write closes the connection
+func (fi *FaultInjector) SetDisconnectRate(rate float64) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.disconnectRate = rate
+}
+
+// Partition partition connections whose local, remote or dialed address is in addrs, or all connections if addrs is empty.
+// reads and writes on partitioned connections block until healed, closed or deadline exceeded, dials fail with ErrInjectedPartition
+func (fi *FaultInjector) Partition(addrs ...string) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if len(addrs) == 0 {
+		fi.partitionAll = true
+	}
+	for _, addr := range addrs {
+		fi.partitioned[addr] = true
+	}
+	fi.notifyLocked()
+}
+
+// Heal heal partition of addrs, or all partitions if addrs is empty
+func (fi *FaultInjector) Heal(addrs ...string) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if len(addrs) == 0 {
+		fi.partitionAll = false
+		fi.partitioned = make(map[string]bool)
+	}
+	for _, addr := range addrs {
+		delete(fi.partitioned, addr)
+	}
+	fi.notifyLocked()
+}
+
+// Reset remove all faults
+func (fi *FaultInjector) Reset() {
+	fi.mu.Lock()
+	fi.latency, fi.jitter, fi.bandwidth = 0, 0, 0
+	fi.truncateRate, fi.disconnectRate = 0, 0
+	fi.mu.Unlock()
+	fi.Heal()
+}
+
+// DisconnectAll close all connections wrapped by the injector
+func (fi *FaultInjector) DisconnectAll() {
+	fi.mu.Lock()
+	conns := make([]*FaultConn, 0, len(fi.conns))
+	for c := range fi.conns {
+		conns = append(conns, c)
+	}
+	fi.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// Conns return count of connections wrapped by the injector and not closed
+func (fi *FaultInjector) Conns() int {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return len(fi.conns)
+}
+
+func (fi *FaultInjector) notifyLocked() {
+	close(fi.changed)
+	fi.changed = make(chan struct{})
+}
+
+// WrapConn wrap conn with faults
+func (fi *FaultInjector) WrapConn(conn net.Conn) net.Conn {
+	return fi.wrap(conn, "")
+}
+
+func (fi *FaultInjector) wrap(conn net.Conn, target string) *FaultConn {
+	fc := &FaultConn{Conn: conn, fi: fi, target: target, closeC: make(chan struct{})}
+	fi.mu.Lock()
+	fi.conns[fc] = struct{}{}
+	fi.mu.Unlock()
+	return fc
+}
+
+// WrapListener wrap listener so that all accepted connections are injected with faults
+func (fi *FaultInjector) WrapListener(l net.Listener) net.Listener {
+	return &faultListener{Listener: l, fi: fi}
+}
+
+// Dialer wrap dial function so that dialed connections are injected with faults
+func (fi *FaultInjector) Dialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if fi.isPartitioned(addr) {
+			return nil, ErrInjectedPartition
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return fi.wrap(conn, addr), nil
+	}
+}
+
+// DialContext dial with net.Dialer and inject faults to the connection
+func (fi *FaultInjector) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return fi.Dialer(d.DialContext)(ctx, network, addr)
+}
+
+func (fi *FaultInjector) isPartitioned(addrs ...string) bool {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if fi.partitionAll {
+		return true
+	}
+	for _, addr := range addrs {
+		if addr != "" && fi.partitioned[addr] {
+			return true
+		}
+	}
+	return false
+}
+
+// chance return true with probability rate
+func (fi *FaultInjector) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	return fi.rnd.Float64() < rate
+}
+
+type faultListener struct {
+	net.Listener
+	fi *FaultInjector
+}
+
+// Accept accept connection and inject faults to it
+func (l *faultListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.fi.wrap(conn, ""), nil
+}
+
+// FaultConn is a connection injected with faults by FaultInjector
+type FaultConn struct {
+	net.Conn
+	fi     *FaultInjector
+	target string // dialed address
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	closeOnce sync.Once
+	closeC    chan struct{}
+}
+
+// Read reads data from the connection, it blocks if connection is partitioned
+func (c *FaultConn) Read(b []byte) (int, error) {
+	if err := c.before(false); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		// data arrived during partition is held until healed, the bytes already read are
+		// returned with the error so they are not lost
+		if perr := c.waitPartition(false); perr != nil {
+			return n, perr
+		}
+	}
+	return n, err
+}
+
+// Write writes data to the connection with latency, bandwidth limit and truncation
+func (c *FaultConn) Write(b []byte) (int, error) {
+	if err := c.before(true); err != nil {
+		return 0, err
+	}
+
+	fi := c.fi
+	fi.mu.Lock()
+	delay := fi.latency
+	if fi.jitter > 0 {
+		delay += time.Duration(fi.rnd.Int63n(int64(fi.jitter)))
+	}
+	bandwidth := fi.bandwidth
+	truncate := len(b) > 0 && fi.chance(fi.truncateRate)
+	truncateAt := 0
+	if truncate {
+		truncateAt = fi.rnd.Intn(len(b))
+	}
+	fi.mu.Unlock()
+
+	if delay > 0 {
+		if err := c.sleep(delay, true); err != nil {
+			return 0, err
+		}
+	}
+	data := b
+	if truncate {
+		data = b[:truncateAt]
+	}
+	n, err := c.writeLimited(data, bandwidth)
+	if err != nil {
+		return n, err
+	}
+	if truncate {
+		c.Close()
+		return n, ErrInjectedDisconnect
+	}
+	return n, nil
+}
+
+// writeLimited write data in chunks to limit bandwidth
+func (c *FaultConn) writeLimited(data []byte, bandwidth int) (int, error) {
+	if bandwidth <= 0 {
+		return c.Conn.Write(data)
+	}
+	// about 100 chunks per second
+	chunk := bandwidth / 100
+	if chunk <= 0 {
+		chunk = 1
+	}
+	written := 0
+	for written < len(data) {
+		end := written + chunk
+		if end > len(data) {
+			end = len(data)
+		}
+		n, err := c.Conn.Write(data[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if err := c.sleep(time.Duration(n)*time.Second/time.Duration(bandwidth), true); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// before check disconnect and partition faults before read or write
+func (c *FaultConn) before(write bool) error {
+	select {
+	case <-c.closeC:
+		return net.ErrClosed
+	default:
+	}
+	fi := c.fi
+	fi.mu.Lock()
+	disconnect := fi.chance(fi.disconnectRate)
+	fi.mu.Unlock()
+	if disconnect {
+		c.Close()
+		return ErrInjectedDisconnect
+	}
+	return c.waitPartition(write)
+}
+
+// waitPartition block until partition healed, connection closed or deadline exceeded
+func (c *FaultConn) waitPartition(write bool) error {
+	for {
+		c.fi.mu.Lock()
+		changed := c.fi.changed
+		c.fi.mu.Unlock()
+		if !c.fi.isPartitioned(c.addrs()...) {
+			return nil
+		}
+		deadline := c.deadline(write)
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+		var err error
+		select {
+		case <-changed:
+		case <-c.closeC:
+			err = net.ErrClosed
+		case <-timeout:
+			err = os.ErrDeadlineExceeded
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sleep wait for d unless connection closed or deadline exceeded
+func (c *FaultConn) sleep(d time.Duration, write bool) error {
+	var err error
+	if deadline := c.deadline(write); !deadline.IsZero() && time.Until(deadline) < d {
+		d, err = time.Until(deadline), os.ErrDeadlineExceeded
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return err
+	case <-c.closeC:
+		return net.ErrClosed
+	}
+}
+
+func (c *FaultConn) addrs() []string {
+	ret := []string{c.target}
+	if a := c.Conn.LocalAddr(); a != nil {
+		ret = append(ret, a.String())
+	}
+	if a := c.Conn.RemoteAddr(); a != nil {
+		ret = append(ret, a.String())
+	}
+	return ret
+}
+
+func (c *FaultConn) deadline(write bool) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if write {
+		return c.writeDeadline
+	}
+	return c.readDeadline
+}
+
+// Close closes the connection
+func (c *FaultConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closeC)
+		c.fi.mu.Lock()
+		delete(c.fi.conns, c)
+		c.fi.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// SetDeadline sets the read and write deadlines associated with the connection
+func (c *FaultConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future Read calls
+func (c *FaultConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future Write calls
+func (c *FaultConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,138 @@
+package netutil_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/netutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// startFaultEchoServer start an echo server with listener wrapped by fi
+func startFaultEchoServer(fi *netutil.FaultInjector) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	So(err, ShouldBeNil)
+	fl := fi.WrapListener(l)
+	go func() {
+		for {
+			conn, err := fl.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return fl
+}
+
+func TestFaultInjector(t *testing.T) {
+	Convey("Test network fault injection", t, func() {
+		serverFaults := netutil.NewFaultInjector()
+		clientFaults := netutil.NewFaultInjector()
+		l := startFaultEchoServer(serverFaults)
+		defer l.Close()
+		addr := l.Addr().String()
+
+		conn, err := clientFaults.DialContext(context.Background(), "tcp", addr)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		So(echo(conn, "hello"), ShouldEqual, "hello")
+
+		Convey("latency", func() {
+			clientFaults.SetLatency(50*time.Millisecond, 10*time.Millisecond)
+			start := time.Now()
+			So(echo(conn, "slow"), ShouldEqual, "slow")
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+
+			clientFaults.Reset()
+			start = time.Now()
+			So(echo(conn, "fast"), ShouldEqual, "fast")
+			So(time.Since(start), ShouldBeLessThan, 50*time.Millisecond)
+		})
+
+		Convey("bandwidth", func() {
+			clientFaults.SetBandwidth(10000)
+			start := time.Now()
+			data := string(make([]byte, 1000))
+			So(echo(conn, data), ShouldEqual, data)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 90*time.Millisecond)
+		})
+
+		Convey("partition and heal", func() {
+			serverFaults.Partition()
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			_, err := conn.Write([]byte("lost"))
+			So(err, ShouldBeNil)
+			_, err = conn.Read(make([]byte, 4))
+			So(os.IsTimeout(err), ShouldBeTrue)
+
+			// data is delivered after healed
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				serverFaults.Heal()
+			}()
+			buf := make([]byte, 4)
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, err = io.ReadFull(conn, buf)
+			So(err, ShouldBeNil)
+			So(string(buf), ShouldEqual, "lost")
+
+			clientFaults.Partition(addr)
+			_, err = clientFaults.DialContext(context.Background(), "tcp", addr)
+			So(err, ShouldEqual, netutil.ErrInjectedPartition)
+			conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+			_, err = conn.Write([]byte("x"))
+			So(os.IsTimeout(err), ShouldBeTrue)
+			clientFaults.Heal(addr)
+			So(echo(conn, "back"), ShouldEqual, "back")
+		})
+
+		Convey("data read before partition timeout is returned", func() {
+			serverFaults.SetLatency(100*time.Millisecond, 0)
+			_, err := conn.Write([]byte("late"))
+			So(err, ShouldBeNil)
+			go func() {
+				time.Sleep(30 * time.Millisecond)
+				clientFaults.Partition(addr)
+			}()
+			conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+			buf := make([]byte, 4)
+			n, err := conn.Read(buf)
+			So(os.IsTimeout(err), ShouldBeTrue)
+			So(string(buf[:n]), ShouldEqual, "late")
+		})
+
+		Convey("random disconnect and truncation", func() {
+			clientFaults.SetSeed(1)
+			clientFaults.SetDisconnectRate(1)
+			_, err := conn.Write([]byte("x"))
+			So(err, ShouldEqual, netutil.ErrInjectedDisconnect)
+			So(clientFaults.Conns(), ShouldEqual, 0)
+			clientFaults.SetDisconnectRate(0)
+
+			conn2, err := clientFaults.DialContext(context.Background(), "tcp", addr)
+			So(err, ShouldBeNil)
+			defer conn2.Close()
+			clientFaults.SetTruncateRate(1)
+			n, err := conn2.Write([]byte("truncated message"))
+			So(err, ShouldEqual, netutil.ErrInjectedDisconnect)
+			So(n, ShouldBeLessThan, len("truncated message"))
+		})
+
+		Convey("disconnect all", func() {
+			So(serverFaults.Conns(), ShouldEqual, 1)
+			serverFaults.DisconnectAll()
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, err := conn.Read(make([]byte, 1))
+			So(err, ShouldNotBeNil)
+			So(serverFaults.Conns(), ShouldEqual, 0)
+		})
+	})
+}
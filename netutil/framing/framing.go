@@ -0,0 +1,402 @@
+package framing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/jhunters/goassist/bytex"
+	"github.com/jhunters/goassist/compress"
+)
+
+const (
+	// Default_Max_Frame_Size default max frame size if not set
+	Default_Max_Frame_Size = 16 * 1024 * 1024
+
+	// length field types of length-prefixed frame
+	Length_Uint16 = 1
+	Length_Uint32 = 2
+	Length_Uint64 = 3
+	Length_Varint = 4 // base 128 varint encoded by compress.CompressUint64
+
+	maxVarintLen = 10
+)
+
+var (
+	// ErrFrameTooLarge is returned if frame size exceeds max frame size or length field range
+	ErrFrameTooLarge = errors.New("framing: frame size exceeds limit")
+	// ErrInvalidFrame is returned if frame is malformed
+	ErrInvalidFrame = errors.New("framing: invalid frame")
+)
+
+// Reader reads frames from underlying stream. the returned frame is only valid until next ReadFrame call
+// as the buffer is reused, copy it if need to keep it. a Reader is not safe for concurrent use.
+type Reader interface {
+	ReadFrame() ([]byte, error)
+}
+
+// Writer writes frames to underlying stream, each frame is written by one Write call of the stream.
+// a Writer is safe for concurrent use.
+type Writer interface {
+	WriteFrame(frame []byte) error
+}
+
+// LengthFieldConfig configuration of length-prefixed frames
+type LengthFieldConfig struct {
+	LengthType   int              // one of Length_Uint16, Length_Uint32, Length_Uint64 and Length_Varint, default is Length_Uint32
+	ByteOrder    binary.ByteOrder // byte order of fixed length field, default is big endian
+	MaxFrameSize int              // max payload size of frame, default is Default_Max_Frame_Size
+}
+
+func (c LengthFieldConfig) normalize() (LengthFieldConfig, error) {
+	if c.LengthType == 0 {
+		c.LengthType = Length_Uint32
+	}
+	if c.LengthType < Length_Uint16 || c.LengthType > Length_Varint {
+		return c, fmt.Errorf("invalid length type %d", c.LengthType)
+	}
+	if c.ByteOrder == nil {
+		c.ByteOrder = binary.BigEndian
+	}
+	if c.MaxFrameSize <= 0 {
+		c.MaxFrameSize = Default_Max_Frame_Size
+	}
+	return c, nil
+}
+
+// maxLength return max value of length field
+func (c LengthFieldConfig) maxLength() uint64 {
+	switch c.LengthType {
+	case Length_Uint16:
+		return 1<<16 - 1
+	case Length_Uint32:
+		return 1<<32 - 1
+	}
+	return 1<<64 - 1
+}
+
+// LengthFieldReader reads length-prefixed frames
+type LengthFieldReader struct {
+	r      io.Reader
+	config LengthFieldConfig
+	head   [8]byte
+	buf    *bytex.ByteBuffer
+}
+
+// NewLengthFieldReader create a reader of length-prefixed frames
+func NewLengthFieldReader(r io.Reader, config LengthFieldConfig) (*LengthFieldReader, error) {
+	config, err := config.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return &LengthFieldReader{r: r, config: config, buf: bytex.NewByteBuffer(nil)}, nil
+}
+
+// ReadFrame read next frame. io.EOF is returned if stream ends at frame boundary, io.ErrUnexpectedEOF if in the middle of frame.
+func (fr *LengthFieldReader) ReadFrame() ([]byte, error) {
+	size, err := fr.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(fr.config.MaxFrameSize) {
+		return nil, ErrFrameTooLarge
+	}
+	frame := reuse(fr.buf, int(size))
+	if _, err := io.ReadFull(fr.r, frame); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return frame, nil
+}
+
+func (fr *LengthFieldReader) readLength() (uint64, error) {
+	c := fr.config
+	switch c.LengthType {
+	case Length_Uint16:
+		if _, err := io.ReadFull(fr.r, fr.head[:2]); err != nil {
+			return 0, err
+		}
+		return uint64(c.ByteOrder.Uint16(fr.head[:2])), nil
+	case Length_Uint32:
+		if _, err := io.ReadFull(fr.r, fr.head[:4]); err != nil {
+			return 0, err
+		}
+		return uint64(c.ByteOrder.Uint32(fr.head[:4])), nil
+	case Length_Uint64:
+		if _, err := io.ReadFull(fr.r, fr.head[:8]); err != nil {
+			return 0, err
+		}
+		return c.ByteOrder.Uint64(fr.head[:8]), nil
+	}
+
+	// varint, read until the byte without continuation bit
+	var b [maxVarintLen]byte
+	for i := 0; i < maxVarintLen; i++ {
+		if _, err := io.ReadFull(fr.r, b[i:i+1]); err != nil {
+			if i > 0 {
+				return 0, unexpectedEOF(err)
+			}
+			return 0, err
+		}
+		if b[i] < 0x80 {
+			v, n := compress.DecompressUint6(b[:i+1])
+			if n != i+1 {
+				return 0, ErrInvalidFrame
+			}
+			return v, nil
+		}
+	}
+	return 0, ErrInvalidFrame
+}
+
+// LengthFieldWriter writes length-prefixed frames
+type LengthFieldWriter struct {
+	w      io.Writer
+	config LengthFieldConfig
+	mu     sync.Mutex
+	buf    *bytex.ByteBuffer
+}
+
+// NewLengthFieldWriter create a writer of length-prefixed frames
+func NewLengthFieldWriter(w io.Writer, config LengthFieldConfig) (*LengthFieldWriter, error) {
+	config, err := config.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return &LengthFieldWriter{w: w, config: config, buf: bytex.NewByteBuffer(nil)}, nil
+}
+
+// WriteFrame write length field and frame in one Write call
+func (fw *LengthFieldWriter) WriteFrame(frame []byte) error {
+	c := fw.config
+	size := uint64(len(frame))
+	if size > uint64(c.MaxFrameSize) || size > c.maxLength() {
+		return ErrFrameTooLarge
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.buf.Reset()
+	var head [8]byte
+	switch c.LengthType {
+	case Length_Uint16:
+		c.ByteOrder.PutUint16(head[:2], uint16(size))
+		fw.buf.Write(head[:2])
+	case Length_Uint32:
+		c.ByteOrder.PutUint32(head[:4], uint32(size))
+		fw.buf.Write(head[:4])
+	case Length_Uint64:
+		c.ByteOrder.PutUint64(head[:8], size)
+		fw.buf.Write(head[:8])
+	default:
+		fw.buf.Write(compress.CompressUint64(size))
+	}
+	fw.buf.Write(frame)
+	_, err := fw.w.Write(fw.buf.Bytes())
+	return err
+}
+
+// DelimiterReader reads frames separated by delimiter, the delimiter is not included in frame
+type DelimiterReader struct {
+	r            io.Reader
+	delim        []byte
+	maxFrameSize int
+
+	data       []byte // buffered bytes in data[start:end]
+	start, end int
+	err        error // error of underlying reader, returned after buffered frames are consumed
+}
+
+// NewDelimiterReader create a reader of frames separated by delimiter, Default_Max_Frame_Size is used if maxFrameSize is not positive
+func NewDelimiterReader(r io.Reader, delim []byte, maxFrameSize int) (*DelimiterReader, error) {
+	if len(delim) == 0 {
+		return nil, fmt.Errorf("delimiter is empty")
+	}
+	if maxFrameSize <= 0 {
+		maxFrameSize = Default_Max_Frame_Size
+	}
+	return &DelimiterReader{r: r, delim: append([]byte(nil), delim...), maxFrameSize: maxFrameSize}, nil
+}
+
+// ReadFrame read next frame. the remaining bytes without delimiter at end of stream are returned as the last frame
+func (dr *DelimiterReader) ReadFrame() ([]byte, error) {
+	searched := 0 // bytes searched without delimiter found
+	for {
+		buffered := dr.data[dr.start:dr.end]
+		if i := bytes.Index(buffered[searched:], dr.delim); i >= 0 {
+			i += searched
+			if i > dr.maxFrameSize {
+				return nil, ErrFrameTooLarge
+			}
+			dr.start += i + len(dr.delim)
+			return buffered[:i:i], nil
+		}
+		if len(buffered) > dr.maxFrameSize+len(dr.delim) {
+			return nil, ErrFrameTooLarge
+		}
+		if dr.err != nil {
+			if len(buffered) > 0 {
+				dr.start = dr.end
+				return buffered, nil
+			}
+			return nil, dr.err
+		}
+		// delimiter may cross the boundary of buffered bytes
+		if searched = len(buffered) - len(dr.delim) + 1; searched < 0 {
+			searched = 0
+		}
+		dr.fill()
+	}
+}
+
+// fill read more bytes into buffer
+func (dr *DelimiterReader) fill() {
+	// move buffered bytes to the beginning, or grow buffer if it is full
+	if dr.start > 0 {
+		n := copy(dr.data, dr.data[dr.start:dr.end])
+		dr.start, dr.end = 0, n
+	}
+	if dr.end == len(dr.data) {
+		size := 2 * len(dr.data)
+		if size < 4096 {
+			size = 4096
+		}
+		if limit := dr.maxFrameSize + 2*len(dr.delim); size > limit && limit > len(dr.data) {
+			size = limit
+		}
+		data := make([]byte, size)
+		copy(data, dr.data[:dr.end])
+		dr.data = data
+	}
+	n, err := dr.r.Read(dr.data[dr.end:])
+	dr.end += n
+	if err != nil {
+		dr.err = err
+	}
+}
+
+// DelimiterWriter writes frames followed by delimiter
+type DelimiterWriter struct {
+	w     io.Writer
+	delim []byte
+	mu    sync.Mutex
+	buf   *bytex.ByteBuffer
+}
+
+// NewDelimiterWriter create a writer of frames separated by delimiter
+func NewDelimiterWriter(w io.Writer, delim []byte) (*DelimiterWriter, error) {
+	if len(delim) == 0 {
+		return nil, fmt.Errorf("delimiter is empty")
+	}
+	return &DelimiterWriter{w: w, delim: append([]byte(nil), delim...), buf: bytex.NewByteBuffer(nil)}, nil
+}
+
+// WriteFrame write frame and delimiter in one Write call, return ErrInvalidFrame if frame contains the delimiter
+func (dw *DelimiterWriter) WriteFrame(frame []byte) error {
+	if bytes.Contains(frame, dw.delim) {
+		return ErrInvalidFrame
+	}
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	dw.buf.Reset()
+	dw.buf.Write(frame)
+	dw.buf.Write(dw.delim)
+	_, err := dw.w.Write(dw.buf.Bytes())
+	return err
+}
+
+// FixedSizeReader reads frames of fixed size
+type FixedSizeReader struct {
+	r    io.Reader
+	size int
+	buf  *bytex.ByteBuffer
+}
+
+// NewFixedSizeReader create a reader of fixed size frames
+func NewFixedSizeReader(r io.Reader, size int) (*FixedSizeReader, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid frame size %d", size)
+	}
+	return &FixedSizeReader{r: r, size: size, buf: bytex.NewByteBuffer(nil)}, nil
+}
+
+// ReadFrame read next frame
+func (fr *FixedSizeReader) ReadFrame() ([]byte, error) {
+	frame := reuse(fr.buf, fr.size)
+	n, err := io.ReadFull(fr.r, frame)
+	if err != nil {
+		if n > 0 {
+			return nil, unexpectedEOF(err)
+		}
+		return nil, err
+	}
+	return frame, nil
+}
+
+// FixedSizeWriter writes frames of fixed size
+type FixedSizeWriter struct {
+	w    io.Writer
+	size int
+	mu   sync.Mutex
+}
+
+// NewFixedSizeWriter create a writer of fixed size frames
+func NewFixedSizeWriter(w io.Writer, size int) (*FixedSizeWriter, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid frame size %d", size)
+	}
+	return &FixedSizeWriter{w: w, size: size}, nil
+}
+
+// WriteFrame write frame, return ErrInvalidFrame if frame size is not the fixed size
+func (fw *FixedSizeWriter) WriteFrame(frame []byte) error {
+	if len(frame) != fw.size {
+		return ErrInvalidFrame
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	_, err := fw.w.Write(frame)
+	return err
+}
+
+// FrameConn is a net.Conn reads and writes frames
+type FrameConn struct {
+	net.Conn
+	Reader
+	Writer
+}
+
+// NewFrameConn create a FrameConn with frame reader and writer on conn
+func NewFrameConn(conn net.Conn, r Reader, w Writer) *FrameConn {
+	return &FrameConn{Conn: conn, Reader: r, Writer: w}
+}
+
+// NewLengthFieldConn create a FrameConn reads and writes length-prefixed frames
+func NewLengthFieldConn(conn net.Conn, config LengthFieldConfig) (*FrameConn, error) {
+	r, err := NewLengthFieldReader(conn, config)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewLengthFieldWriter(conn, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewFrameConn(conn, r, w), nil
+}
+
+// reuse return a slice with size n backed by buffer, buffer grows only if its capacity is not enough
+func reuse(buf *bytex.ByteBuffer, n int) []byte {
+	buf.Reset()
+	buf.Grow(n)
+	return buf.Bytes()[:n]
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
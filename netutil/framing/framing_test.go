@@ -0,0 +1,199 @@
+package framing_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jhunters/goassist/netutil/framing"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// oneByteReader returns one byte each Read call to test frames split across reads
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (o *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return o.r.Read(p[:1])
+}
+
+func readAll(r framing.Reader) ([]string, error) {
+	var ret []string
+	for {
+		frame, err := r.ReadFrame()
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, string(frame))
+	}
+}
+
+func TestLengthField(t *testing.T) {
+	Convey("Test length-prefixed frames", t, func() {
+		frames := []string{"", "a", "hello world", strings.Repeat("x", 300)}
+		for _, lengthType := range []int{framing.Length_Uint16, framing.Length_Uint32, framing.Length_Uint64, framing.Length_Varint} {
+			for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+				config := framing.LengthFieldConfig{LengthType: lengthType, ByteOrder: order}
+				buf := bytes.NewBuffer(nil)
+				w, err := framing.NewLengthFieldWriter(buf, config)
+				So(err, ShouldBeNil)
+				for _, f := range frames {
+					So(w.WriteFrame([]byte(f)), ShouldBeNil)
+				}
+
+				r, err := framing.NewLengthFieldReader(&oneByteReader{buf}, config)
+				So(err, ShouldBeNil)
+				got, err := readAll(r)
+				So(err, ShouldEqual, io.EOF)
+				So(got, ShouldResemble, frames)
+			}
+		}
+
+		Convey("varint length uses compress.CompressUint64", func() {
+			buf := bytes.NewBuffer(nil)
+			w, _ := framing.NewLengthFieldWriter(buf, framing.LengthFieldConfig{LengthType: framing.Length_Varint})
+			w.WriteFrame(make([]byte, 300))
+			So(buf.Bytes()[:2], ShouldResemble, []byte{0xAC, 0x02})
+			So(buf.Len(), ShouldEqual, 302)
+		})
+
+		Convey("max frame size", func() {
+			buf := bytes.NewBuffer(nil)
+			w, _ := framing.NewLengthFieldWriter(buf, framing.LengthFieldConfig{MaxFrameSize: 4})
+			So(w.WriteFrame([]byte("12345")), ShouldEqual, framing.ErrFrameTooLarge)
+			w16, _ := framing.NewLengthFieldWriter(buf, framing.LengthFieldConfig{LengthType: framing.Length_Uint16})
+			So(w16.WriteFrame(make([]byte, 1<<16)), ShouldEqual, framing.ErrFrameTooLarge)
+
+			w, _ = framing.NewLengthFieldWriter(buf, framing.LengthFieldConfig{})
+			w.WriteFrame([]byte("12345"))
+			r, _ := framing.NewLengthFieldReader(buf, framing.LengthFieldConfig{MaxFrameSize: 4})
+			_, err := r.ReadFrame()
+			So(err, ShouldEqual, framing.ErrFrameTooLarge)
+
+			_, err = framing.NewLengthFieldReader(buf, framing.LengthFieldConfig{LengthType: 9})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("truncated frame", func() {
+			r, _ := framing.NewLengthFieldReader(bytes.NewReader([]byte{0, 0, 0, 5, 'a', 'b'}), framing.LengthFieldConfig{})
+			_, err := r.ReadFrame()
+			So(err, ShouldEqual, io.ErrUnexpectedEOF)
+
+			r, _ = framing.NewLengthFieldReader(bytes.NewReader([]byte{0x80}), framing.LengthFieldConfig{LengthType: framing.Length_Varint})
+			_, err = r.ReadFrame()
+			So(err, ShouldEqual, io.ErrUnexpectedEOF)
+		})
+	})
+}
+
+func TestDelimiter(t *testing.T) {
+	Convey("Test delimiter frames", t, func() {
+		buf := bytes.NewBuffer(nil)
+		w, err := framing.NewDelimiterWriter(buf, []byte("\r\n"))
+		So(err, ShouldBeNil)
+		frames := []string{"first", "", strings.Repeat("y", 5000), "last"}
+		for _, f := range frames {
+			So(w.WriteFrame([]byte(f)), ShouldBeNil)
+		}
+		So(w.WriteFrame([]byte("a\r\nb")), ShouldEqual, framing.ErrInvalidFrame)
+		buf.WriteString("tail")
+
+		r, err := framing.NewDelimiterReader(&oneByteReader{buf}, []byte("\r\n"), 0)
+		So(err, ShouldBeNil)
+		got, err := readAll(r)
+		So(err, ShouldEqual, io.EOF)
+		So(got, ShouldResemble, append(frames, "tail"))
+
+		r, _ = framing.NewDelimiterReader(strings.NewReader("short\nvery long frame\n"), []byte("\n"), 5)
+		frame, err := r.ReadFrame()
+		So(err, ShouldBeNil)
+		So(string(frame), ShouldEqual, "short")
+		_, err = r.ReadFrame()
+		So(err, ShouldEqual, framing.ErrFrameTooLarge)
+
+		_, err = framing.NewDelimiterReader(buf, nil, 0)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestFixedSize(t *testing.T) {
+	Convey("Test fixed size frames", t, func() {
+		buf := bytes.NewBuffer(nil)
+		w, err := framing.NewFixedSizeWriter(buf, 4)
+		So(err, ShouldBeNil)
+		So(w.WriteFrame([]byte("abcd")), ShouldBeNil)
+		So(w.WriteFrame([]byte("efgh")), ShouldBeNil)
+		So(w.WriteFrame([]byte("ijk")), ShouldEqual, framing.ErrInvalidFrame)
+
+		r, err := framing.NewFixedSizeReader(&oneByteReader{buf}, 4)
+		So(err, ShouldBeNil)
+		got, err := readAll(r)
+		So(err, ShouldEqual, io.EOF)
+		So(got, ShouldResemble, []string{"abcd", "efgh"})
+
+		r, _ = framing.NewFixedSizeReader(strings.NewReader("abcdef"), 4)
+		r.ReadFrame()
+		_, err = r.ReadFrame()
+		So(err, ShouldEqual, io.ErrUnexpectedEOF)
+
+		_, err = framing.NewFixedSizeReader(buf, 0)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestFrameConn(t *testing.T) {
+	Convey("Test concurrent frames over net.Conn", t, func() {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		config := framing.LengthFieldConfig{LengthType: framing.Length_Varint}
+		cc, err := framing.NewLengthFieldConn(client, config)
+		So(err, ShouldBeNil)
+		sc, err := framing.NewLengthFieldConn(server, config)
+		So(err, ShouldBeNil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				cc.WriteFrame([]byte(fmt.Sprintf("message-%d", i)))
+			}(i)
+		}
+
+		received := make(map[string]bool)
+		for i := 0; i < 10; i++ {
+			frame, err := sc.ReadFrame()
+			So(err, ShouldBeNil)
+			received[string(frame)] = true
+		}
+		wg.Wait()
+		So(received, ShouldHaveLength, 10)
+		So(received["message-5"], ShouldBeTrue)
+	})
+}
+
+func ExampleNewLengthFieldWriter() {
+	buf := bytes.NewBuffer(nil)
+	w, _ := framing.NewLengthFieldWriter(buf, framing.LengthFieldConfig{LengthType: framing.Length_Uint16})
+	w.WriteFrame([]byte("hi"))
+	fmt.Println(buf.Bytes())
+
+	r, _ := framing.NewLengthFieldReader(buf, framing.LengthFieldConfig{LengthType: framing.Length_Uint16})
+	frame, _ := r.ReadFrame()
+	fmt.Println(string(frame))
+
+	// Output:
+	// [0 2 104 105]
+	// hi
+}
@@ -0,0 +1,5 @@
+/*
+ * Package framing provides message framing codecs over byte streams like net.Conn,
+ * including length-prefixed, delimiter-based and fixed-size frames
+ */
+package framing
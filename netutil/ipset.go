@@ -0,0 +1,161 @@
+package netutil
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+)
+
+// IPSet is a set of ip addresses stored as sorted, merged ranges. it is safe for concurrent use
+// and could be used as allow or deny list.
+type IPSet struct {
+	mu     sync.RWMutex
+	ranges []IPRange
+}
+
+// NewIPSet create an IPSet with items, each item could be a single ip, cidr or range like "10.0.0.1-10.0.0.9"
+func NewIPSet(items ...string) (*IPSet, error) {
+	s := &IPSet{}
+	for _, item := range items {
+		if err := s.Add(item); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add add a single ip, cidr or range like "10.0.0.1-10.0.0.9" to set
+func (s *IPSet) Add(item string) error {
+	r, err := ParseIPRange(item)
+	if err != nil {
+		return err
+	}
+	s.AddRange(r)
+	return nil
+}
+
+// AddPrefix add all addresses of prefix to set
+func (s *IPSet) AddPrefix(p netip.Prefix) {
+	s.AddRange(CIDRToRange(p))
+}
+
+// AddRange add all addresses of range to set
+func (s *IPSet) AddRange(r IPRange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ranges = MergeRanges(append(s.ranges, r))
+}
+
+// Remove remove a single ip, cidr or range like "10.0.0.1-10.0.0.9" from set
+func (s *IPSet) Remove(item string) error {
+	r, err := ParseIPRange(item)
+	if err != nil {
+		return err
+	}
+	s.RemoveRange(r)
+	return nil
+}
+
+// RemovePrefix remove all addresses of prefix from set
+func (s *IPSet) RemovePrefix(p netip.Prefix) {
+	s.RemoveRange(CIDRToRange(p))
+}
+
+// RemoveRange remove all addresses of range from set
+func (s *IPSet) RemoveRange(r IPRange) {
+	r, err := NewIPRange(r.From, r.To)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make([]IPRange, 0, len(s.ranges)+1)
+	for _, cur := range s.ranges {
+		// not overlapped
+		if cur.From.Is4() != r.From.Is4() || cur.To.Compare(r.From) < 0 || cur.From.Compare(r.To) > 0 {
+			ret = append(ret, cur)
+			continue
+		}
+		if cur.From.Compare(r.From) < 0 {
+			ret = append(ret, IPRange{cur.From, r.From.Prev()})
+		}
+		if cur.To.Compare(r.To) > 0 {
+			ret = append(ret, IPRange{r.To.Next(), cur.To})
+		}
+	}
+	s.ranges = ret
+}
+
+// Contains return true if ip is in set
+func (s *IPSet) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap().WithZone("")
+	if !ip.IsValid() {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// first range ends at or after ip
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return s.ranges[i].To.Compare(ip) >= 0
+	})
+	return i < len(s.ranges) && s.ranges[i].Contains(ip)
+}
+
+// ContainsIP return true if net.IP is in set
+func (s *IPSet) ContainsIP(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	return ok && s.Contains(addr)
+}
+
+// ContainsString return true if ip string is in set, return false if ip is invalid
+func (s *IPSet) ContainsString(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && s.Contains(addr)
+}
+
+// ContainsAddr return true if ip of net.Addr like *net.TCPAddr or "host:port" string is in set
+func (s *IPSet) ContainsAddr(addr net.Addr) bool {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return s.ContainsIP(a.IP)
+	case *net.UDPAddr:
+		return s.ContainsIP(a.IP)
+	case *net.IPAddr:
+		return s.ContainsIP(a.IP)
+	}
+	ap, err := netip.ParseAddrPort(addr.String())
+	return err == nil && s.Contains(ap.Addr())
+}
+
+// Ranges return sorted and merged ranges of set
+func (s *IPSet) Ranges() []IPRange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ret := make([]IPRange, len(s.ranges))
+	copy(ret, s.ranges)
+	return ret
+}
+
+// Prefixes return minimal cidr list of set
+func (s *IPSet) Prefixes() []netip.Prefix {
+	var ret []netip.Prefix
+	for _, r := range s.Ranges() {
+		ret = append(ret, r.Prefixes()...)
+	}
+	return ret
+}
+
+// IsEmpty return true if set has no address
+func (s *IPSet) IsEmpty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.ranges) == 0
+}
+
+// Clear remove all addresses from set
+func (s *IPSet) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ranges = nil
+}
@@ -0,0 +1,63 @@
+package netutil_test
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/jhunters/goassist/netutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIPSet(t *testing.T) {
+	Convey("TestIPSet", t, func() {
+		set, err := netutil.NewIPSet("10.0.0.0/8", "192.168.1.1", "172.16.0.1-172.16.0.20", "2001:db8::/32")
+		So(err, ShouldBeNil)
+		So(set.IsEmpty(), ShouldBeFalse)
+
+		So(set.ContainsString("10.20.30.40"), ShouldBeTrue)
+		So(set.ContainsString("192.168.1.1"), ShouldBeTrue)
+		So(set.ContainsString("192.168.1.2"), ShouldBeFalse)
+		So(set.ContainsString("172.16.0.20"), ShouldBeTrue)
+		So(set.ContainsString("172.16.0.21"), ShouldBeFalse)
+		So(set.ContainsString("2001:db8:1::1"), ShouldBeTrue)
+		So(set.ContainsString("::ffff:10.0.0.1"), ShouldBeTrue)
+		So(set.ContainsString("invalid"), ShouldBeFalse)
+		So(set.ContainsIP(net.ParseIP("10.1.1.1")), ShouldBeTrue)
+		So(set.ContainsAddr(&net.TCPAddr{IP: net.ParseIP("2001:db8::5"), Port: 80}), ShouldBeTrue)
+
+		_, err = netutil.NewIPSet("10.0.0.0/40")
+		So(err, ShouldNotBeNil)
+
+		Convey("remove addresses", func() {
+			So(set.Remove("10.128.0.0/9"), ShouldBeNil)
+			So(set.Remove("172.16.0.10"), ShouldBeNil)
+			So(set.ContainsString("10.127.255.255"), ShouldBeTrue)
+			So(set.ContainsString("10.128.0.0"), ShouldBeFalse)
+			So(set.ContainsString("172.16.0.10"), ShouldBeFalse)
+			So(set.ContainsString("172.16.0.11"), ShouldBeTrue)
+			So(fmt.Sprint(set.Prefixes()), ShouldEqual,
+				"[10.0.0.0/9 172.16.0.1/32 172.16.0.2/31 172.16.0.4/30 172.16.0.8/31 172.16.0.11/32 172.16.0.12/30 172.16.0.16/30 172.16.0.20/32 192.168.1.1/32 2001:db8::/32]")
+
+			set.Clear()
+			So(set.IsEmpty(), ShouldBeTrue)
+		})
+
+		Convey("merge adjacent addresses", func() {
+			set, _ := netutil.NewIPSet()
+			set.AddPrefix(netip.MustParsePrefix("10.0.0.0/25"))
+			set.AddPrefix(netip.MustParsePrefix("10.0.0.128/25"))
+			So(set.Ranges(), ShouldHaveLength, 1)
+			So(fmt.Sprint(set.Prefixes()), ShouldEqual, "[10.0.0.0/24]")
+		})
+	})
+}
+
+func ExampleIPSet() {
+	denyList, _ := netutil.NewIPSet("10.0.0.0/8", "2001:db8::/32")
+	fmt.Println(denyList.ContainsString("10.1.2.3"), denyList.ContainsString("192.168.0.1"))
+
+	// Output:
+	// true false
+}
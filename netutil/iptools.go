@@ -1,10 +1,14 @@
 package netutil
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math/big"
 	"net"
 )
 
+var maxUint128 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+
 // IPv4ToUInt32 convert to ipv4 as uint32
 func IPv4ToUInt32(ip net.IP) uint32 {
 	ipv4 := ip.To4()
@@ -40,3 +44,50 @@ func Uint32ToIPv4(v uint32) net.IP {
 	d := byte((v & 0xFF000000) >> 24)
 	return net.IPv4(a, b, c, d)
 }
+
+// IPv6ToBigInt convert ip to big integer in network byte order, ipv4 address is converted as ipv4-mapped ipv6 address.
+// return nil if ip is invalid
+func IPv6ToBigInt(ip net.IP) *big.Int {
+	ipv6 := ip.To16()
+	if ipv6 == nil {
+		return nil
+	}
+	return new(big.Int).SetBytes(ipv6)
+}
+
+// BigIntToIPv6 convert big integer to ipv6, return error if v is negative or exceeds 128 bits
+func BigIntToIPv6(v *big.Int) (net.IP, error) {
+	if v == nil || v.Sign() < 0 || v.Cmp(maxUint128) > 0 {
+		return nil, fmt.Errorf("invalid ipv6 integer: %v", v)
+	}
+	ip := make(net.IP, net.IPv6len)
+	v.FillBytes(ip)
+	return ip, nil
+}
+
+// IPv6StringToBigInt parse ip string and convert to big integer
+func IPv6StringToBigInt(ip string) (*big.Int, error) {
+	v := IPv6ToBigInt(net.ParseIP(ip))
+	if v == nil {
+		return nil, fmt.Errorf("invalid ip: %s", ip)
+	}
+	return v, nil
+}
+
+// IPv6ToUint128 convert ip to high and low 64 bits in network byte order,
+// ipv4 address is converted as ipv4-mapped ipv6 address. return zero if ip is invalid
+func IPv6ToUint128(ip net.IP) (hi, lo uint64) {
+	ipv6 := ip.To16()
+	if ipv6 == nil {
+		return 0, 0
+	}
+	return binary.BigEndian.Uint64(ipv6[:8]), binary.BigEndian.Uint64(ipv6[8:])
+}
+
+// Uint128ToIPv6 convert high and low 64 bits to ipv6
+func Uint128ToIPv6(hi, lo uint64) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	binary.BigEndian.PutUint64(ip[:8], hi)
+	binary.BigEndian.PutUint64(ip[8:], lo)
+	return ip
+}
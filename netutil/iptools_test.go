@@ -2,6 +2,7 @@ package netutil_test
 
 import (
 	"fmt"
+	"math/big"
 	"net"
 	"net/netip"
 	"testing"
@@ -70,3 +71,31 @@ func TestUint32ToIPv4_1(t *testing.T) {
 	})
 
 }
+
+func TestIPv6Integer(t *testing.T) {
+
+	Convey("TestIPv6Integer", t, func() {
+		ip := net.ParseIP("2001:db8::1")
+		v := netutil.IPv6ToBigInt(ip)
+		So(v.Text(16), ShouldEqual, "20010db8000000000000000000000001")
+		back, err := netutil.BigIntToIPv6(v)
+		So(err, ShouldBeNil)
+		So(back.String(), ShouldEqual, "2001:db8::1")
+
+		v, err = netutil.IPv6StringToBigInt("::ffff:1.2.3.4")
+		So(err, ShouldBeNil)
+		So(v.Text(16), ShouldEqual, "ffff01020304")
+		_, err = netutil.IPv6StringToBigInt("1.2.3")
+		So(err, ShouldNotBeNil)
+
+		_, err = netutil.BigIntToIPv6(new(big.Int).Lsh(big.NewInt(1), 128))
+		So(err, ShouldNotBeNil)
+		_, err = netutil.BigIntToIPv6(big.NewInt(-1))
+		So(err, ShouldNotBeNil)
+
+		hi, lo := netutil.IPv6ToUint128(ip)
+		So(hi, ShouldEqual, uint64(0x20010db800000000))
+		So(lo, ShouldEqual, uint64(1))
+		So(netutil.Uint128ToIPv6(hi, lo).String(), ShouldEqual, "2001:db8::1")
+	})
+}
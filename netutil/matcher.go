@@ -0,0 +1,490 @@
+package netutil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	// Max_Sniff_Size max bytes could be read by matchers from a connection
+	Max_Sniff_Size = 64 * 1024
+
+	// HTTP2_Preface client connection preface of HTTP/2
+	HTTP2_Preface = http2.ClientPreface
+
+	// max bytes of HTTP/1.x request line
+	maxRequestLineSize = 8192
+)
+
+var (
+	errSniffLimit = errors.New("sniff size exceeds limit")
+
+	http1Methods = []string{
+		"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS", "PATCH", "CONNECT", "TRACE",
+	}
+	http1MethodPrefixes = methodPrefixes(http1Methods)
+)
+
+// Matcher inspects the beginning of a connection and return true if it should be routed to the listener.
+// bytes read by matcher are not consumed, they are replayed to the listener which accepts the connection.
+type Matcher func(r io.Reader) bool
+
+// WriteMatcher is a Matcher which could also write to the connection, e.g. to finish a handshake before client sends data.
+// bytes written by matcher are sent to client directly and are invisible to the listener.
+type WriteMatcher func(w io.Writer, r io.Reader) bool
+
+// sniffReader records all bytes read from connection so that each matcher could read from the beginning
+type sniffReader struct {
+	r   io.Reader
+	buf []byte
+	pos int
+	err error // first error returned by r
+}
+
+func newSniffReader(r io.Reader) *sniffReader {
+	return &sniffReader{r: r}
+}
+
+// Read reads from recorded bytes first and then from the underlying reader
+func (s *sniffReader) Read(p []byte) (int, error) {
+	if s.pos < len(s.buf) {
+		n := copy(p, s.buf[s.pos:])
+		s.pos += n
+		return n, nil
+	}
+	if len(s.buf) >= Max_Sniff_Size {
+		return 0, errSniffLimit
+	}
+	if left := Max_Sniff_Size - len(s.buf); len(p) > left {
+		p = p[:left]
+	}
+	n, err := s.r.Read(p)
+	s.buf = append(s.buf, p[:n]...)
+	s.pos += n
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// reset move read position to the beginning
+func (s *sniffReader) reset() {
+	s.pos = 0
+}
+
+// MatchAny matches any connection
+func MatchAny() Matcher {
+	return func(r io.Reader) bool {
+		return true
+	}
+}
+
+// MatchPrefix matches connection starts with any of prefixes
+func MatchPrefix(prefixes ...string) Matcher {
+	return func(r io.Reader) bool {
+		return matchPrefix(r, prefixes)
+	}
+}
+
+func matchPrefix(r io.Reader, prefixes []string) bool {
+	maxLen := 0
+	for _, p := range prefixes {
+		if len(p) > maxLen {
+			maxLen = len(p)
+		}
+	}
+	buf := make([]byte, 0, maxLen)
+	candidates := prefixes
+	for len(candidates) > 0 {
+		// read one more byte and filter candidates
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return false
+		}
+		buf = append(buf, b[0])
+		next := candidates[:0:0]
+		for _, p := range candidates {
+			if !strings.HasPrefix(p, string(buf)) {
+				continue
+			}
+			if len(p) == len(buf) {
+				return true
+			}
+			next = append(next, p)
+		}
+		candidates = next
+	}
+	return false
+}
+
+// MatchPredicate matches connection by predicate on variable-length prefix. fn is called each time new bytes arrive
+// with all bytes read so far, it return matched and whether need more bytes to decide.
+// matching stops once fn doesn't need more bytes or maxLen bytes are read.
+func MatchPredicate(maxLen int, fn func(prefix []byte) (matched bool, needMore bool)) Matcher {
+	return func(r io.Reader) bool {
+		buf := make([]byte, 0, maxLen)
+		chunk := make([]byte, maxLen)
+		for len(buf) < maxLen {
+			n, err := r.Read(chunk[:maxLen-len(buf)])
+			buf = append(buf, chunk[:n]...)
+			if n > 0 {
+				matched, more := fn(buf)
+				if matched || !more {
+					return matched
+				}
+			}
+			if err != nil {
+				return false
+			}
+		}
+		return false
+	}
+}
+
+// MatchRegexp matches connection if the prefix read so far matches the regular expression. up to maxLen bytes are read.
+// note that regexp is tested each time new bytes arrive, anchor it with '^' to match the beginning of connection.
+func MatchRegexp(re *regexp.Regexp, maxLen int) Matcher {
+	return MatchPredicate(maxLen, func(prefix []byte) (bool, bool) {
+		return re.Match(prefix), true
+	})
+}
+
+// MatchHTTP1 matches HTTP/1.x request by parsing request line like "GET /index.html HTTP/1.1"
+func MatchHTTP1() Matcher {
+	return func(r io.Reader) bool {
+		// check method first to fail fast on other protocols
+		if !matchPrefix(r, http1MethodPrefixes) {
+			return false
+		}
+		line, ok := readRequestLine(r)
+		if !ok {
+			return false
+		}
+		// rest of request line is "uri version"
+		parts := strings.Split(line, " ")
+		return len(parts) == 2 && strings.HasPrefix(parts[1], "HTTP/1.")
+	}
+}
+
+// MatchHTTP1Fast matches HTTP/1.x request only by method prefix, use all standard methods if no methods given.
+// it is faster than MatchHTTP1 but may match non-http protocol begins with same text
+func MatchHTTP1Fast(methods ...string) Matcher {
+	if len(methods) == 0 {
+		return MatchPrefix(http1MethodPrefixes...)
+	}
+	return MatchPrefix(methodPrefixes(methods)...)
+}
+
+func methodPrefixes(methods []string) []string {
+	prefixes := make([]string, len(methods))
+	for i, m := range methods {
+		prefixes[i] = m + " "
+	}
+	return prefixes
+}
+
+// MatchHTTP1Header matches HTTP/1.x request with header name and value, header name is case insensitive
+func MatchHTTP1Header(name, value string) Matcher {
+	return func(r io.Reader) bool {
+		br := bufio.NewReaderSize(io.LimitReader(r, Max_Sniff_Size), 4096)
+		if _, err := br.ReadString('\n'); err != nil {
+			return false
+		}
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return false
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				return false // end of headers
+			}
+			k, v, ok := strings.Cut(line, ":")
+			if ok && strings.EqualFold(strings.TrimSpace(k), name) && strings.TrimSpace(v) == value {
+				return true
+			}
+		}
+	}
+}
+
+func readRequestLine(r io.Reader) (string, bool) {
+	buf := make([]byte, 0, 128)
+	b := make([]byte, 1)
+	for len(buf) < maxRequestLineSize {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", false
+		}
+		if b[0] == '\n' {
+			return strings.TrimSuffix(string(buf), "\r"), true
+		}
+		buf = append(buf, b[0])
+	}
+	return "", false
+}
+
+// MatchHTTP2 matches HTTP/2 connection by client preface
+func MatchHTTP2() Matcher {
+	return MatchPrefix(HTTP2_Preface)
+}
+
+// MatchHTTP2Header matches HTTP/2 connection which first request has header field with the value
+func MatchHTTP2Header(name, value string) Matcher {
+	return func(r io.Reader) bool {
+		return matchHTTP2Field(nil, r, func(f hpack.HeaderField) bool {
+			return f.Name == name && f.Value == value
+		})
+	}
+}
+
+// MatchHTTP2HeaderSendSettings is same as MatchHTTP2Header but writes an empty SETTINGS frame to client
+// after preface is received, for clients which wait for server SETTINGS before sending any request
+func MatchHTTP2HeaderSendSettings(name, value string) WriteMatcher {
+	return func(w io.Writer, r io.Reader) bool {
+		return matchHTTP2Field(w, r, func(f hpack.HeaderField) bool {
+			return f.Name == name && f.Value == value
+		})
+	}
+}
+
+// MatchGRPC matches gRPC connection by HTTP/2 request header 'content-type: application/grpc*'.
+// note that the matcher never writes to connection, use MatchGRPCSendSettings for clients like grpc-go
+// which wait for server SETTINGS frame before sending request
+func MatchGRPC() Matcher {
+	return func(r io.Reader) bool {
+		return matchHTTP2Field(nil, r, isGRPCContentType)
+	}
+}
+
+// MatchGRPCSendSettings matches gRPC connection and writes an empty SETTINGS frame to client after preface is received
+func MatchGRPCSendSettings() WriteMatcher {
+	return func(w io.Writer, r io.Reader) bool {
+		return matchHTTP2Field(w, r, isGRPCContentType)
+	}
+}
+
+func isGRPCContentType(f hpack.HeaderField) bool {
+	return f.Name == "content-type" && strings.HasPrefix(f.Value, "application/grpc")
+}
+
+// matchHTTP2Field reads frames until headers of first request end, write SETTINGS frame if w is not nil
+func matchHTTP2Field(w io.Writer, r io.Reader, match func(hpack.HeaderField) bool) bool {
+	if !matchPrefix(r, []string{HTTP2_Preface}) {
+		return false
+	}
+	if w == nil {
+		w = io.Discard
+	}
+
+	matched := false
+	decoder := hpack.NewDecoder(4096, func(f hpack.HeaderField) {
+		if match(f) {
+			matched = true
+		}
+	})
+	framer := http2.NewFramer(w, r)
+	if w != io.Discard {
+		if err := framer.WriteSettings(); err != nil {
+			return false
+		}
+	}
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			return false
+		}
+		var done bool
+		switch f := f.(type) {
+		case *http2.HeadersFrame:
+			if _, err := decoder.Write(f.HeaderBlockFragment()); err != nil {
+				return false
+			}
+			done = f.HeadersEnded()
+		case *http2.ContinuationFrame:
+			if _, err := decoder.Write(f.HeaderBlockFragment()); err != nil {
+				return false
+			}
+			done = f.HeadersEnded()
+		case *http2.GoAwayFrame:
+			return false
+		}
+		if matched || done {
+			return matched
+		}
+	}
+}
+
+// MatchTLS matches TLS connection by ClientHello handshake
+func MatchTLS() Matcher {
+	return func(r io.Reader) bool {
+		_, ok := readClientHello(r)
+		return ok
+	}
+}
+
+// MatchTLSServerName matches TLS connection with server name indication(SNI) in ClientHello.
+// server names are case insensitive and could start with "*." to match any sub domain in one level
+func MatchTLSServerName(serverNames ...string) Matcher {
+	return func(r io.Reader) bool {
+		sni, ok := readClientHello(r)
+		if !ok || sni == "" {
+			return false
+		}
+		for _, name := range serverNames {
+			if MatchServerName(name, sni) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchServerName return true if server name matches pattern, pattern could start with "*." to match any sub domain in one level
+func MatchServerName(pattern, serverName string) bool {
+	pattern = strings.ToLower(pattern)
+	serverName = strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if strings.HasPrefix(pattern, "*.") {
+		_, rest, ok := strings.Cut(serverName, ".")
+		return ok && rest == pattern[2:]
+	}
+	return pattern == serverName
+}
+
+// readClientHello reads the first TLS record and return server name in ClientHello
+func readClientHello(r io.Reader) (string, bool) {
+	// record header: type(1) version(2) length(2)
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", false
+	}
+	if header[0] != 0x16 || header[1] != 0x03 {
+		return "", false
+	}
+	length := int(binary.BigEndian.Uint16(header[3:]))
+	if length == 0 || length > 16384+2048 {
+		return "", false
+	}
+	record := make([]byte, length)
+	if _, err := io.ReadFull(r, record); err != nil {
+		return "", false
+	}
+	return parseClientHello(record)
+}
+
+// parseClientHello parse handshake message in record, return server name and true if it is a ClientHello
+func parseClientHello(data []byte) (string, bool) {
+	s := &byteScanner{b: data}
+	// handshake type(1) length(3)
+	if t, ok := s.uint8(); !ok || t != 0x01 {
+		return "", false
+	}
+	if _, ok := s.bytes(3); !ok {
+		return "", false
+	}
+	// client version(2) random(32)
+	if _, ok := s.bytes(34); !ok {
+		return "", false
+	}
+	// session id, cipher suites, compression methods
+	if _, ok := s.vector8(); !ok {
+		return "", false
+	}
+	if _, ok := s.vector16(); !ok {
+		return "", false
+	}
+	if _, ok := s.vector8(); !ok {
+		return "", false
+	}
+	if s.empty() {
+		// no extensions
+		return "", true
+	}
+	exts, ok := s.vector16()
+	if !ok {
+		return "", true
+	}
+	es := &byteScanner{b: exts}
+	for !es.empty() {
+		typ, ok1 := es.uint16()
+		data, ok2 := es.vector16()
+		if !ok1 || !ok2 {
+			break
+		}
+		if typ != 0 { // server_name extension
+			continue
+		}
+		ns := &byteScanner{b: data}
+		list, ok := ns.vector16()
+		if !ok {
+			break
+		}
+		ls := &byteScanner{b: list}
+		for !ls.empty() {
+			nameType, ok1 := ls.uint8()
+			name, ok2 := ls.vector16()
+			if !ok1 || !ok2 {
+				break
+			}
+			if nameType == 0 { // host_name
+				return string(name), true
+			}
+		}
+	}
+	return "", true
+}
+
+// byteScanner is a simple reader of TLS message
+type byteScanner struct {
+	b []byte
+}
+
+func (s *byteScanner) empty() bool {
+	return len(s.b) == 0
+}
+
+func (s *byteScanner) bytes(n int) ([]byte, bool) {
+	if len(s.b) < n {
+		return nil, false
+	}
+	ret := s.b[:n]
+	s.b = s.b[n:]
+	return ret, true
+}
+
+func (s *byteScanner) uint8() (uint8, bool) {
+	b, ok := s.bytes(1)
+	if !ok {
+		return 0, false
+	}
+	return b[0], true
+}
+
+func (s *byteScanner) uint16() (uint16, bool) {
+	b, ok := s.bytes(2)
+	if !ok {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(b), true
+}
+
+func (s *byteScanner) vector8() ([]byte, bool) {
+	n, ok := s.uint8()
+	if !ok {
+		return nil, false
+	}
+	return s.bytes(int(n))
+}
+
+func (s *byteScanner) vector16() ([]byte, bool) {
+	n, ok := s.uint16()
+	if !ok {
+		return nil, false
+	}
+	return s.bytes(int(n))
+}
@@ -0,0 +1,216 @@
+package netutil_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/netutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// captureClientHello return the first TLS record written by client with server name
+func captureClientHello(serverName string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+		client.Close()
+	}()
+	header := make([]byte, 5)
+	io.ReadFull(server, header)
+	body := make([]byte, int(header[3])<<8|int(header[4]))
+	io.ReadFull(server, body)
+	return append(header, body...)
+}
+
+func TestMatchers(t *testing.T) {
+	Convey("Test matchers", t, func() {
+		Convey("Test MatchPrefix", func() {
+			m := netutil.MatchPrefix("XML", "JSON")
+			So(m(bytes.NewBufferString("JSON{}")), ShouldBeTrue)
+			So(m(bytes.NewBufferString("XML<a/>")), ShouldBeTrue)
+			So(m(bytes.NewBufferString("YAML")), ShouldBeFalse)
+			So(m(bytes.NewBufferString("JS")), ShouldBeFalse)
+		})
+
+		Convey("Test MatchHTTP1", func() {
+			m := netutil.MatchHTTP1()
+			So(m(bytes.NewBufferString("GET /index.html HTTP/1.1\r\nHost: a\r\n\r\n")), ShouldBeTrue)
+			So(m(bytes.NewBufferString("POST / HTTP/1.0\r\n")), ShouldBeTrue)
+			So(m(bytes.NewBufferString("GET /index.html\r\n")), ShouldBeFalse)
+			So(m(bytes.NewBufferString("FOO / HTTP/1.1\r\n")), ShouldBeFalse)
+			So(m(bytes.NewBufferString(netutil.HTTP2_Preface)), ShouldBeFalse)
+
+			So(netutil.MatchHTTP1Fast()(bytes.NewBufferString("DELETE /a")), ShouldBeTrue)
+			So(netutil.MatchHTTP1Fast("GET")(bytes.NewBufferString("DELETE /a")), ShouldBeFalse)
+		})
+
+		Convey("Test MatchHTTP1Header", func() {
+			m := netutil.MatchHTTP1Header("upgrade", "websocket")
+			So(m(bytes.NewBufferString("GET / HTTP/1.1\r\nHost: a\r\nUpgrade: websocket\r\n\r\n")), ShouldBeTrue)
+			So(m(bytes.NewBufferString("GET / HTTP/1.1\r\nHost: a\r\n\r\nUpgrade: websocket\r\n")), ShouldBeFalse)
+		})
+
+		Convey("Test MatchHTTP2", func() {
+			m := netutil.MatchHTTP2()
+			So(m(bytes.NewBufferString(netutil.HTTP2_Preface)), ShouldBeTrue)
+			So(m(bytes.NewBufferString("PRI * HTTP/1.1\r\n")), ShouldBeFalse)
+		})
+
+		Convey("Test MatchRegexp and MatchPredicate", func() {
+			m := netutil.MatchRegexp(regexp.MustCompile(`^\d{3}-`), 16)
+			So(m(bytes.NewBufferString("123-abc")), ShouldBeTrue)
+			So(m(bytes.NewBufferString("12a-abc")), ShouldBeFalse)
+
+			m = netutil.MatchPredicate(8, func(prefix []byte) (bool, bool) {
+				if len(prefix) < 2 {
+					return false, true
+				}
+				return prefix[0] == 0xCA && prefix[1] == 0xFE, false
+			})
+			So(m(bytes.NewReader([]byte{0xCA, 0xFE, 0x01})), ShouldBeTrue)
+			So(m(bytes.NewReader([]byte{0xCA, 0xFF, 0x01})), ShouldBeFalse)
+			So(m(bytes.NewReader([]byte{0xCA})), ShouldBeFalse)
+		})
+
+		Convey("Test MatchTLS and MatchTLSServerName", func() {
+			hello := captureClientHello("api.example.com")
+			So(netutil.MatchTLS()(bytes.NewReader(hello)), ShouldBeTrue)
+			So(netutil.MatchTLS()(bytes.NewBufferString("GET / HTTP/1.1\r\n")), ShouldBeFalse)
+			So(netutil.MatchTLSServerName("api.example.com")(bytes.NewReader(hello)), ShouldBeTrue)
+			So(netutil.MatchTLSServerName("*.example.com")(bytes.NewReader(hello)), ShouldBeTrue)
+			So(netutil.MatchTLSServerName("www.example.com", "*.test.com")(bytes.NewReader(hello)), ShouldBeFalse)
+		})
+
+		Convey("Test MatchServerName", func() {
+			So(netutil.MatchServerName("*.example.com", "A.Example.com"), ShouldBeTrue)
+			So(netutil.MatchServerName("*.example.com", "a.b.example.com"), ShouldBeFalse)
+			So(netutil.MatchServerName("*.example.com", "example.com"), ShouldBeFalse)
+			So(netutil.MatchServerName("example.com", "example.com."), ShouldBeTrue)
+		})
+	})
+}
+
+func TestRegisterMatcherListener(t *testing.T) {
+	Convey("Test RegisterMatcherListener with invalid matchers", t, func() {
+		selector, err := netutil.NewCustomListenerSelector("tcp", "127.0.0.1", 0, 0, netutil.StartWith_Mode)
+		So(err, ShouldBeNil)
+		defer selector.Close()
+
+		_, err = selector.RegisterMatcherListener()
+		So(err, ShouldNotBeNil)
+		_, err = selector.RegisterMatcherListener(nil)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test protocol auto detection on one port", t, func() {
+		selector, err := netutil.NewCustomListenerSelector("tcp", "127.0.0.1", 0, 3, netutil.StartWith_Mode)
+		So(err, ShouldBeNil)
+		addr := selector.RegisterDefaultListener().Addr().String()
+
+		xmlListener, err := selector.RegisterListener("XML")
+		So(err, ShouldBeNil)
+		grpcListener, err := selector.RegisterWriteMatcherListener(netutil.MatchGRPCSendSettings())
+		So(err, ShouldBeNil)
+		httpListener, err := selector.RegisterMatcherListener(netutil.MatchHTTP1())
+		So(err, ShouldBeNil)
+		tlsListener, err := selector.RegisterMatcherListener(netutil.MatchTLSServerName("*.example.com"))
+		So(err, ShouldBeNil)
+		defaultListener := selector.RegisterDefaultListener()
+
+		go selector.Serve()
+
+		// grpc
+		grpcServer := grpc.NewServer()
+		grpc_health_v1.RegisterHealthServer(grpcServer, health.NewServer())
+		go grpcServer.Serve(grpcListener)
+
+		// http
+		httpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "http ok")
+		})}
+		go httpServer.Serve(httpListener)
+		defer func() {
+			// close selector first to unblock Accept of all listeners
+			selector.Close()
+			grpcServer.Stop()
+			httpServer.Close()
+		}()
+
+		// echo all data for xml and default listener
+		echo := func(l net.Listener, name string) {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			data, _ := io.ReadAll(conn)
+			conn.Write([]byte(name + ":" + string(data)))
+		}
+		go echo(xmlListener, "xml")
+		go echo(defaultListener, "default")
+		tlsC := make(chan bool, 1)
+		go func() {
+			conn, err := tlsListener.Accept()
+			if err != nil {
+				return
+			}
+			tlsC <- true
+			conn.Close()
+		}()
+
+		roundTrip := func(data string) string {
+			conn, err := net.DialTimeout("tcp", addr, time.Second)
+			if err != nil {
+				return err.Error()
+			}
+			defer conn.Close()
+			conn.Write([]byte(data))
+			conn.(*net.TCPConn).CloseWrite()
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			ret, _ := io.ReadAll(conn)
+			return string(ret)
+		}
+
+		So(roundTrip("XML<a/>"), ShouldEqual, "xml:XML<a/>")
+		So(roundTrip("\x00\x01binary"), ShouldEqual, "default:\x00\x01binary")
+
+		resp, err := http.Get("http://" + addr + "/")
+		So(err, ShouldBeNil)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		So(string(body), ShouldEqual, "http ok")
+
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		hresp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+		So(err, ShouldBeNil)
+		So(hresp.Status, ShouldEqual, grpc_health_v1.HealthCheckResponse_SERVING)
+
+		tlsConn, err := net.DialTimeout("tcp", addr, time.Second)
+		So(err, ShouldBeNil)
+		defer tlsConn.Close()
+		go tls.Client(tlsConn, &tls.Config{ServerName: "api.example.com", InsecureSkipVerify: true}).Handshake()
+		select {
+		case ok := <-tlsC:
+			So(ok, ShouldBeTrue)
+		case <-time.After(2 * time.Second):
+			So("tls connection not routed", ShouldBeEmpty)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package raftx
+
+import (
+	"strconv"
+
+	"github.com/hashicorp/raft"
+)
+
+// appliedFSM 包装用户的FSM, 记录FSM已执行的最后一条日志的index, 用于线性一致读等待本地状态
+type appliedFSM struct {
+	raft.FSM
+	r *RaftX
+}
+
+// Apply 执行日志并记录index
+func (f *appliedFSM) Apply(l *raft.Log) interface{} {
+	ret := f.FSM.Apply(l)
+	f.r.applied.Store(l.Index)
+	return ret
+}
+
+// StoreConfiguration 实现 raft.ConfigurationStore 接口, 记录配置日志的index
+func (f *appliedFSM) StoreConfiguration(index uint64, configuration raft.Configuration) {
+	if cs, ok := f.FSM.(raft.ConfigurationStore); ok {
+		cs.StoreConfiguration(index, configuration)
+	}
+	f.r.applied.Store(index)
+}
+
+// appliedBatchingFSM 包装实现了 raft.BatchingFSM 接口的FSM
+type appliedBatchingFSM struct {
+	appliedFSM
+	batching raft.BatchingFSM
+}
+
+// ApplyBatch 批量执行日志并记录最后一条日志的index
+func (f *appliedBatchingFSM) ApplyBatch(logs []*raft.Log) []interface{} {
+	ret := f.batching.ApplyBatch(logs)
+	if len(logs) > 0 {
+		f.r.applied.Store(logs[len(logs)-1].Index)
+	}
+	return ret
+}
+
+// wrapFSM 返回包装后的FSM, 保持用户FSM的 BatchingFSM 实现
+func (r *RaftX) wrapFSM() raft.FSM {
+	if batching, ok := r.fsm.(raft.BatchingFSM); ok {
+		return &appliedBatchingFSM{appliedFSM: appliedFSM{FSM: r.fsm, r: r}, batching: batching}
+	}
+	return &appliedFSM{FSM: r.fsm, r: r}
+}
+
+// lastFSMIndex 返回不大于index的最后一条会交给FSM执行的日志index, noop和barrier日志不交给FSM.
+// 日志已被压缩时返回0, 此时日志已包含在快照中
+func (r *RaftX) lastFSMIndex(index uint64) uint64 {
+	var l raft.Log
+	for ; index > 0; index-- {
+		if err := r.logs.GetLog(index, &l); err != nil {
+			return 0
+		}
+		if l.Type == raft.LogCommand || l.Type == raft.LogConfiguration {
+			return index
+		}
+	}
+	return 0
+}
+
+// lastSnapshotIndex 返回最后一个快照的index, FSM的状态至少包含到该快照
+func lastSnapshotIndex(ra *raft.Raft) uint64 {
+	index, _ := strconv.ParseUint(ra.Stats()["last_snapshot_index"], 10, 64)
+	return index
+}
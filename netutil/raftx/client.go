@@ -0,0 +1,122 @@
+package raftx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// LeaderClientConfig LeaderClient 配置
+type LeaderClientConfig struct {
+	Addrs         []string          // 集群节点地址, 用于发现leader
+	DialOptions   []grpc.DialOption // 连接节点使用的grpc选项, 为空时使用非加密连接
+	RetryInterval time.Duration     // leader切换时的重试间隔, 默认为 Leader_Retry_Interval
+}
+
+// LeaderClient 供集群外部应用使用的客户端, 自动发现leader并将Apply请求发送到leader, leader切换时自动重试
+type LeaderClient struct {
+	config  LeaderClientConfig
+	clients *clientCache
+
+	mu     sync.Mutex
+	leader string // 缓存的leader地址
+}
+
+// NewLeaderClient 创建 LeaderClient
+func NewLeaderClient(config LeaderClientConfig) (*LeaderClient, error) {
+	if len(config.Addrs) == 0 {
+		return nil, fmt.Errorf("raftx: no address of cluster")
+	}
+	if len(config.DialOptions) == 0 {
+		config.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = Leader_Retry_Interval
+	}
+	return &LeaderClient{config: config, clients: newClientCache()}, nil
+}
+
+// Leader 返回集群当前leader, 依次询问配置的节点直到获取到leader
+func (c *LeaderClient) Leader(ctx context.Context) (Node, error) {
+	var lastErr error = ErrNoLeader
+	for _, addr := range c.config.Addrs {
+		conn, err := c.clients.conn(addr, c.config.DialOptions)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp := &leaderResponse{}
+		if err := invokeForwarder(ctx, conn, "Leader", &leaderRequest{}, resp); err != nil {
+			lastErr = err
+			continue
+		}
+		c.mu.Lock()
+		c.leader = resp.Addr
+		c.mu.Unlock()
+		return Node{Id: resp.Id, Addr: resp.Addr}, nil
+	}
+	return Node{}, lastErr
+}
+
+// Apply 提交日志到leader并等待FSM执行, 连接leader失败或leader明确返回未执行时重新发现leader并重试直到ctx结束.
+// 请求发送后失去leader身份或连接中断时日志可能已提交, 不再重试, 返回 ErrApplyUnknown
+func (c *LeaderClient) Apply(ctx context.Context, data, extensions []byte) (*ApplyResult, error) {
+	var lastErr error = ErrNoLeader
+	for {
+		c.mu.Lock()
+		leader := c.leader
+		c.mu.Unlock()
+		if leader == "" {
+			if node, err := c.Leader(ctx); err == nil {
+				leader = node.Addr
+			} else {
+				lastErr = err
+			}
+		}
+
+		if leader != "" {
+			conn, err := c.clients.conn(leader, c.config.DialOptions)
+			if err != nil {
+				return nil, err
+			}
+			resp := &applyResponse{}
+			if connReady(ctx, conn) {
+				err = invokeForwarder(ctx, conn, "Apply", &applyRequest{Data: data, Extensions: extensions, Timeout: timeoutOf(ctx)}, resp)
+			} else {
+				err = fmt.Errorf("%w: connect to leader %s failed", ErrNoLeader, leader)
+			}
+			if err == nil {
+				result := &ApplyResult{Index: resp.Index, data: resp.Response}
+				if resp.Error != "" {
+					return result, errors.New(resp.Error)
+				}
+				return result, nil
+			}
+			if isOutcomeUnknown(err) {
+				return nil, errApplyUnknown(err)
+			}
+			if !isRetriable(err) {
+				return nil, err
+			}
+			lastErr = err
+			c.mu.Lock()
+			c.leader = ""
+			c.mu.Unlock()
+		}
+
+		if err := sleepContext(ctx, c.config.RetryInterval); err != nil {
+			return nil, fmt.Errorf("raftx: %w, last error: %v", err, lastErr)
+		}
+	}
+}
+
+// Close 关闭到集群节点的连接
+func (c *LeaderClient) Close() error {
+	c.clients.close()
+	return nil
+}
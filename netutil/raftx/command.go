@@ -0,0 +1,241 @@
+package raftx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// JSONCodec 使用 encoding/json 编解码命令
+	JSONCodec Codec = jsonCodec{}
+	// GobCodec 使用 encoding/gob 编解码命令
+	GobCodec Codec = gobCodec{}
+	// ProtoCodec 使用 protobuf 编解码命令, 命令和响应的类型必须实现 proto.Message
+	ProtoCodec Codec = protoCodec{}
+
+	// ErrUnknownCommand 日志中的命令没有注册处理函数
+	ErrUnknownCommand = errors.New("raftx: unknown command")
+)
+
+// Codec 命令和响应的编解码
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	// Unmarshal 解码到v, v为指针
+	Unmarshal(data []byte, v any) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("raftx: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal v 可以是 proto.Message 或指向 proto.Message 的指针, 后者为nil时自动创建
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() && rv.Elem().Kind() == reflect.Pointer {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		if m, ok := rv.Elem().Interface().(proto.Message); ok {
+			return proto.Unmarshal(data, m)
+		}
+	}
+	return fmt.Errorf("raftx: %T is not a proto.Message", v)
+}
+
+// State 由 CommandFSM 管理的应用状态, 用于生成快照和从快照恢复
+type State interface {
+	// Snapshot 将当前状态写入w, 执行期间不会有命令修改状态
+	Snapshot(w io.Writer) error
+	// Restore 从快照恢复状态, 替换当前所有状态
+	Restore(r io.Reader) error
+}
+
+// Command 命令的类型描述, C 为命令类型, R 为响应类型. 命令名称写入日志的 Extensions 用于分发
+type Command[C, R any] struct {
+	name  string
+	codec Codec
+}
+
+// NewCommand 创建命令描述, codec 用于编解码命令和响应
+func NewCommand[C, R any](name string, codec Codec) *Command[C, R] {
+	return &Command[C, R]{name: name, codec: codec}
+}
+
+// Name 返回命令名称
+func (c *Command[C, R]) Name() string {
+	return c.name
+}
+
+// Encode 编码命令, 返回 Apply 使用的 data 和 extensions
+func (c *Command[C, R]) Encode(cmd C) (data, extensions []byte, err error) {
+	data, err = c.codec.Marshal(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, []byte(c.name), nil
+}
+
+// DecodeResult 从 Apply 的结果中解码响应
+func (c *Command[C, R]) DecodeResult(result *ApplyResult) (R, error) {
+	var resp R
+	var data []byte
+	if err := result.Decode(&data); err != nil {
+		return resp, err
+	}
+	err := c.codec.Unmarshal(data, &resp)
+	return resp, err
+}
+
+// commandHandler 解码命令, 执行处理函数并编码响应
+type commandHandler func(data []byte) ([]byte, error)
+
+// CommandFSM 按命令名称分发日志到注册的处理函数的 raft.FSM 实现, 通过 State 自动生成快照和恢复.
+// 处理函数的响应使用命令的 codec 编码后作为FSM的返回值
+type CommandFSM struct {
+	mu         sync.RWMutex // 命令执行和恢复时加写锁, View 和快照加读锁
+	state      State
+	handlers   map[string]commandHandler
+	appendedAt time.Time // 正在执行的日志被leader追加的时间
+}
+
+var _ raft.FSM = &CommandFSM{} // check CommandFSM struct if implements raft.FSM interface
+
+// NewCommandFSM 创建 CommandFSM, state为nil时快照为空
+func NewCommandFSM(state State) *CommandFSM {
+	return &CommandFSM{state: state, handlers: make(map[string]commandHandler)}
+}
+
+// HandleCommand 注册命令的处理函数, 需要在启动raft前注册, 同一命令只能注册一次
+func HandleCommand[C, R any](f *CommandFSM, c *Command[C, R], handler func(cmd C) (R, error)) error {
+	if handler == nil {
+		return fmt.Errorf("raftx: handler of command %s is nil", c.name)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.handlers[c.name]; ok {
+		return fmt.Errorf("raftx: command %s already registered", c.name)
+	}
+	f.handlers[c.name] = func(data []byte) ([]byte, error) {
+		var cmd C
+		if err := c.codec.Unmarshal(data, &cmd); err != nil {
+			return nil, err
+		}
+		resp, err := handler(cmd)
+		if err != nil {
+			return nil, err
+		}
+		return c.codec.Marshal(resp)
+	}
+	return nil
+}
+
+// View 在没有命令执行时调用fn读取状态
+func (f *CommandFSM) View(fn func() error) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return fn()
+}
+
+// AppendedAt 返回正在执行的日志被leader追加的时间, 只能在处理函数中调用. 各副本执行同一日志时得到相同的时间,
+// 用于过期时间等依赖时间的命令, 避免依赖提交者的时钟. 日志没有记录时间时返回零值
+func (f *CommandFSM) AppendedAt() time.Time {
+	return f.appendedAt
+}
+
+// Apply 执行日志对应的命令, 返回编码后的响应或处理函数的错误
+func (f *CommandFSM) Apply(l *raft.Log) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.appendedAt = l.AppendedAt
+	handler, ok := f.handlers[string(l.Extensions)]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownCommand, l.Extensions)
+	}
+	resp, err := handler(l.Data)
+	if err != nil {
+		return err
+	}
+	return resp
+}
+
+// Snapshot 将状态写入内存, 由 Persist 保存
+func (f *CommandFSM) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	buf := bytes.NewBuffer(nil)
+	if f.state != nil {
+		if err := f.state.Snapshot(buf); err != nil {
+			return nil, err
+		}
+	}
+	return &commandSnapshot{data: buf.Bytes()}, nil
+}
+
+// Restore 从快照恢复状态
+func (f *CommandFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state == nil {
+		return nil
+	}
+	return f.state.Restore(rc)
+}
+
+type commandSnapshot struct {
+	data []byte
+}
+
+func (s *commandSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(s.data); err != nil {
+		sink.Cancel()
+		return fmt.Errorf("sink.Write(): %v", err)
+	}
+	return sink.Close()
+}
+
+func (s *commandSnapshot) Release() {
+}
+
+// ApplyCommand 编码命令提交到集群并等待执行, 返回处理函数的响应或错误. 本节点不是leader时自动转发到leader
+func ApplyCommand[C, R any](ctx context.Context, r *RaftX, c *Command[C, R], cmd C) (R, error) {
+	var resp R
+	data, ext, err := c.Encode(cmd)
+	if err != nil {
+		return resp, err
+	}
+	result, err := r.Apply(ctx, data, ext)
+	if err != nil {
+		return resp, err
+	}
+	return c.DecodeResult(result)
+}
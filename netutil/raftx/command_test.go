@@ -0,0 +1,172 @@
+package raftx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/netutil/raftx"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// kvState key value state with json snapshot
+type kvState struct {
+	data map[string]string
+}
+
+func (s *kvState) Snapshot(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s.data)
+}
+
+func (s *kvState) Restore(r io.Reader) error {
+	data := make(map[string]string)
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+type putCommand struct {
+	Key   string
+	Value string
+}
+
+var (
+	putCmd   = raftx.NewCommand[putCommand, int]("put", raftx.JSONCodec)
+	delCmd   = raftx.NewCommand[string, bool]("del", raftx.GobCodec)
+	upperCmd = raftx.NewCommand[*wrapperspb.StringValue, *wrapperspb.StringValue]("upper", raftx.ProtoCodec)
+	timeCmd  = raftx.NewCommand[string, int64]("time", raftx.GobCodec)
+)
+
+// newKVFSM create a command fsm with put, del, upper and time commands
+func newKVFSM() (*raftx.CommandFSM, *kvState) {
+	state := &kvState{data: make(map[string]string)}
+	f := raftx.NewCommandFSM(state)
+	So(raftx.HandleCommand(f, putCmd, func(cmd putCommand) (int, error) {
+		if cmd.Key == "" {
+			return 0, errors.New("empty key")
+		}
+		state.data[cmd.Key] = cmd.Value
+		return len(state.data), nil
+	}), ShouldBeNil)
+	So(raftx.HandleCommand(f, delCmd, func(key string) (bool, error) {
+		_, ok := state.data[key]
+		delete(state.data, key)
+		return ok, nil
+	}), ShouldBeNil)
+	So(raftx.HandleCommand(f, upperCmd, func(cmd *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		b := []byte(cmd.GetValue())
+		for i, c := range b {
+			if c >= 'a' && c <= 'z' {
+				b[i] = c - 'a' + 'A'
+			}
+		}
+		return wrapperspb.String(string(b)), nil
+	}), ShouldBeNil)
+	So(raftx.HandleCommand(f, timeCmd, func(string) (int64, error) {
+		return f.AppendedAt().UnixNano(), nil
+	}), ShouldBeNil)
+	return f, state
+}
+
+// startCommandNode start a raftx node with command fsm
+func startCommandNode(dataDir, id string, bootstrap bool) (*raftx.RaftX, *raftx.CommandFSM, *kvState, func()) {
+	f, state := newKVFSM()
+	r := startNode(dataDir, id, listen(), bootstrap, f, nil)
+	return r, f, state, func() {
+		r.Stop()
+	}
+}
+
+func TestCommandFSM(t *testing.T) {
+	Convey("Test typed commands", t, func() {
+		dir := t.TempDir()
+		n1, _, _, stop1 := startCommandNode(dir, "n1", true)
+		defer stop1()
+		n2, f2, state2, stop2 := startCommandNode(dir, "n2", false)
+		defer stop2()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := n1.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(n2.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+
+		size, err := raftx.ApplyCommand(ctx, n1, putCmd, putCommand{Key: "a", Value: "1"})
+		So(err, ShouldBeNil)
+		So(size, ShouldEqual, 1)
+		// forwarded from follower
+		size, err = raftx.ApplyCommand(ctx, n2, putCmd, putCommand{Key: "b", Value: "2"})
+		So(err, ShouldBeNil)
+		So(size, ShouldEqual, 2)
+		_, err = raftx.ApplyCommand(ctx, n2, putCmd, putCommand{})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "empty key")
+
+		existed, err := raftx.ApplyCommand(ctx, n2, delCmd, "a")
+		So(err, ShouldBeNil)
+		So(existed, ShouldBeTrue)
+		existed, err = raftx.ApplyCommand(ctx, n1, delCmd, "a")
+		So(err, ShouldBeNil)
+		So(existed, ShouldBeFalse)
+
+		upper, err := raftx.ApplyCommand(ctx, n2, upperCmd, wrapperspb.String("raft"))
+		So(err, ShouldBeNil)
+		So(upper.GetValue(), ShouldEqual, "RAFT")
+		upper, err = raftx.ApplyCommand(ctx, n1, upperCmd, wrapperspb.String(""))
+		So(err, ShouldBeNil)
+		So(upper.GetValue(), ShouldEqual, "")
+
+		// log time stamped by the leader
+		before := time.Now().UnixNano()
+		appendedAt, err := raftx.ApplyCommand(ctx, n2, timeCmd, "")
+		So(err, ShouldBeNil)
+		So(appendedAt, ShouldBeBetweenOrEqual, before, time.Now().UnixNano())
+
+		_, err = n1.Apply(ctx, []byte("x"), []byte("unknown"))
+		So(err, ShouldNotBeNil)
+
+		So(n2.Read(ctx, func() error {
+			return f2.View(func() error {
+				So(state2.data, ShouldResemble, map[string]string{"b": "2"})
+				return nil
+			})
+		}), ShouldBeNil)
+	})
+
+	Convey("Test snapshot and restore", t, func() {
+		f, state := newKVFSM()
+		state.data["a"] = "1"
+		So(raftx.HandleCommand(f, putCmd, func(putCommand) (int, error) { return 0, nil }), ShouldNotBeNil)
+
+		snap, err := f.Snapshot()
+		So(err, ShouldBeNil)
+		store := raft.NewInmemSnapshotStore()
+		sink, err := store.Create(raft.SnapshotVersionMax, 1, 1, raft.Configuration{}, 0, nil)
+		So(err, ShouldBeNil)
+		So(snap.Persist(sink), ShouldBeNil)
+
+		f2, state2 := newKVFSM()
+		state2.data["x"] = "y"
+		_, rc, err := store.Open(sink.ID())
+		So(err, ShouldBeNil)
+		So(f2.Restore(rc), ShouldBeNil)
+		So(state2.data, ShouldResemble, map[string]string{"a": "1"})
+
+		empty := raftx.NewCommandFSM(nil)
+		snap, err = empty.Snapshot()
+		So(err, ShouldBeNil)
+		sink, err = store.Create(raft.SnapshotVersionMax, 2, 1, raft.Configuration{}, 0, nil)
+		So(err, ShouldBeNil)
+		So(snap.Persist(sink), ShouldBeNil)
+		_, rc, err = store.Open(sink.ID())
+		So(err, ShouldBeNil)
+		So(empty.Restore(rc), ShouldBeNil)
+	})
+}
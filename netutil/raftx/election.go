@@ -0,0 +1,83 @@
+package raftx
+
+import (
+	"context"
+	"sync"
+)
+
+// leaderRunner 在本节点为leader期间执行函数
+type leaderRunner struct {
+	r  *RaftX
+	fn func(ctx context.Context)
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc // 正在执行的fn的取消函数, 未执行时为nil
+	done    chan struct{}      // 最后一次执行的fn返回时关闭
+	stopped bool
+}
+
+// RunOnLeader 本节点成为leader时在新的goroutine中执行fn, 失去leader身份或raft关闭时取消fn的ctx.
+// 再次成为leader时等待上一次的fn返回后才重新执行, 保证同一时间只有一个fn在执行; fn自行返回后直到下次成为leader才会再次执行.
+// 返回的stop函数取消正在执行的fn, 等待其返回并停止后续执行
+func (r *RaftX) RunOnLeader(fn func(ctx context.Context)) (stop func()) {
+	l := &leaderRunner{r: r, fn: fn}
+	r.OnLeaderChange(func(leader Node, isLeader bool) {
+		l.update(isLeader)
+	})
+	l.update(r.IsLeader())
+	return l.stop
+}
+
+func (l *leaderRunner) update(isLeader bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return
+	}
+	if !isLeader {
+		if l.cancel != nil {
+			l.cancel()
+			l.cancel = nil
+		}
+		return
+	}
+	if l.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	prev, done := l.done, make(chan struct{})
+	l.done = done
+	go func() {
+		defer close(done)
+		defer cancel()
+		if prev != nil {
+			<-prev
+		}
+		go func() {
+			select {
+			case <-l.r.stopC:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		if ctx.Err() == nil {
+			l.fn(ctx)
+		}
+	}()
+}
+
+func (l *leaderRunner) stop() {
+	l.mu.Lock()
+	l.stopped = true
+	if l.cancel != nil {
+		l.cancel()
+		l.cancel = nil
+	}
+	done := l.done
+	l.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
@@ -0,0 +1,50 @@
+package raftx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRunOnLeader(t *testing.T) {
+	Convey("Test run function only on leader", t, func() {
+		dir := t.TempDir()
+		n1, _, stop1 := startTestNode(dir, "n1", true)
+		defer stop1()
+		n2, _, stop2 := startTestNode(dir, "n2", false)
+		defer stop2()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := n1.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(n2.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+
+		events := &eventRecorder{}
+		run := func(id string) func(ctx context.Context) {
+			return func(ctx context.Context) {
+				events.add("start:" + id)
+				<-ctx.Done()
+				events.add("stop:" + id)
+			}
+		}
+		stopRun1 := n1.RunOnLeader(run("n1"))
+		defer stopRun1()
+		stopRun2 := n2.RunOnLeader(run("n2"))
+		So(waitEvent(ctx, events, "start:n1"), ShouldBeTrue)
+
+		for !n2.IsLeader() && ctx.Err() == nil {
+			if n1.IsLeader() {
+				n1.TransferLeadership(ctx, "n2")
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		So(waitEvent(ctx, events, "stop:n1"), ShouldBeTrue)
+		So(waitEvent(ctx, events, "start:n2"), ShouldBeTrue)
+
+		stopRun2()
+		So(events.has("stop:n2"), ShouldBeTrue)
+	})
+}
@@ -66,8 +66,8 @@ func StartRaft(addr, raftId, raftAddress, raftDir string, raftBootstrap bool, pe
 	// 添加 peers
 	rfx.AddPeers(peers...) // 设置 peer id与addr信息
 
-	// 创建 gRPC 服务
-	s := grpc.NewServer()
+	// 创建 gRPC 服务, 使用 raftx 的TLS和认证选项
+	s := grpc.NewServer(rfx.ServerOptions()...)
 
 	// 创建一个 CacheStatus 实例
 	status := &CacheStatus{}
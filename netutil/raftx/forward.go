@@ -0,0 +1,440 @@
+package raftx
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jille/raft-grpc-leader-rpc/rafterrors"
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Forward_Codec_Name grpc content subtype of forwarder service, messages are encoded by gob
+	Forward_Codec_Name = "raftx-gob"
+
+	Forward_Service_Name = "raftx.Forwarder"
+
+	Read_Index = 1 // 线性一致读, 每次读都通过心跳确认leader身份
+	Read_Lease = 2 // 租约读, 在 LeaderLeaseTimeout 内确认过leader身份则不再确认, 依赖时钟漂移有界
+)
+
+// ErrApplyUnknown 提交过程中leader切换, 无法确定日志是否已被提交
+var ErrApplyUnknown = errors.New("raftx: apply result unknown")
+
+func init() {
+	encoding.RegisterCodec(gobCodec{})
+}
+
+// gobCodec grpc codec by encoding/gob, avoids protobuf code generation for internal messages
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (gobCodec) Name() string {
+	return Forward_Codec_Name
+}
+
+type applyRequest struct {
+	Data       []byte
+	Extensions []byte
+	Timeout    time.Duration
+}
+
+type applyResponse struct {
+	Index    uint64
+	Response []byte // gob encoded FSM response
+	Error    string // error returned by FSM
+}
+
+type readIndexRequest struct {
+	Mode int
+}
+
+type readIndexResponse struct {
+	Index uint64
+}
+
+type leaderRequest struct{}
+
+type leaderResponse struct {
+	Id   string
+	Addr string
+}
+
+// forwarderServer 处理其它节点或 LeaderClient 转发的请求
+type forwarderServer interface {
+	apply(ctx context.Context, req *applyRequest) (*applyResponse, error)
+	readIndex(ctx context.Context, req *readIndexRequest) (*readIndexResponse, error)
+	leader(ctx context.Context, req *leaderRequest) (*leaderResponse, error)
+	status(ctx context.Context, req *statusRequest) (*statusResponse, error)
+	membership(ctx context.Context, req *membershipRequest) (*membershipResponse, error)
+	configuration(ctx context.Context, req *configurationRequest) (*configurationResponse, error)
+}
+
+func unaryHandler[Req any, Resp any](method string, call func(s forwarderServer, ctx context.Context, req *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			in := new(Req)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(forwarderServer), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + Forward_Service_Name + "/" + method}
+			return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+				return call(srv.(forwarderServer), ctx, req.(*Req))
+			})
+		},
+	}
+}
+
+var forwarderServiceDesc = grpc.ServiceDesc{
+	ServiceName: Forward_Service_Name,
+	HandlerType: (*forwarderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("Apply", forwarderServer.apply),
+		unaryHandler("ReadIndex", forwarderServer.readIndex),
+		unaryHandler("Leader", forwarderServer.leader),
+		unaryHandler("Status", forwarderServer.status),
+		unaryHandler("Membership", forwarderServer.membership),
+		unaryHandler("Configuration", forwarderServer.configuration),
+	},
+	Metadata: "raftx",
+}
+
+// invokeForwarder 调用addr节点的forwarder服务
+func invokeForwarder(ctx context.Context, conn *grpc.ClientConn, method string, req, resp any) error {
+	err := conn.Invoke(ctx, "/"+Forward_Service_Name+"/"+method, req, resp, grpc.CallContentSubtype(Forward_Codec_Name))
+	if st, ok := status.FromError(err); ok && st.Code() == codes.Unknown && strings.HasPrefix(st.Message(), ErrApplyUnknown.Error()) {
+		return fmt.Errorf("%w: %s", ErrApplyUnknown, strings.TrimPrefix(st.Message(), ErrApplyUnknown.Error()+": "))
+	}
+	return err
+}
+
+// forwarder 实现 forwarderServer 接口
+type forwarder struct {
+	r *RaftX
+}
+
+func (f *forwarder) apply(ctx context.Context, req *applyRequest) (*applyResponse, error) {
+	ra, err := f.r.getRaft()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	future := ra.ApplyLog(raft.Log{Data: req.Data, Extensions: req.Extensions}, req.Timeout)
+	if err := future.Error(); err != nil {
+		if err == raft.ErrLeadershipLost {
+			return nil, status.Error(codes.Unknown, errApplyUnknown(err).Error())
+		}
+		return nil, rafterrors.MarkRetriable(err)
+	}
+	resp := &applyResponse{Index: future.Index()}
+	switch v := future.Response().(type) {
+	case nil:
+	case error:
+		resp.Error = v.Error()
+	default:
+		data, err := gobCodec{}.Marshal(v)
+		if err != nil {
+			resp.Error = fmt.Sprintf("raftx: encode fsm response failed: %v", err)
+		}
+		resp.Response = data
+	}
+	return resp, nil
+}
+
+func (f *forwarder) readIndex(ctx context.Context, req *readIndexRequest) (*readIndexResponse, error) {
+	ra, err := f.r.getRaft()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if ra.State() != raft.Leader {
+		return nil, rafterrors.MarkRetriable(raft.ErrNotLeader)
+	}
+	index, err := f.r.leaderReadIndex(ra, req.Mode)
+	if err != nil {
+		return nil, rafterrors.MarkRetriable(err)
+	}
+	return &readIndexResponse{Index: index}, nil
+}
+
+func (f *forwarder) leader(ctx context.Context, req *leaderRequest) (*leaderResponse, error) {
+	leader, err := f.r.Leader()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &leaderResponse{Id: leader.Id, Addr: leader.Addr}, nil
+}
+
+// ApplyResult Apply 的执行结果
+type ApplyResult struct {
+	Index    uint64 // 日志索引
+	Response any    // FSM 返回值, 仅在本节点为leader时设置
+
+	data []byte // 从leader转发返回的gob编码的FSM返回值
+}
+
+// Decode 将FSM返回值解码到v, v必须为指针. 返回值在节点间转发时使用gob编码
+func (a *ApplyResult) Decode(v any) error {
+	if a.data != nil {
+		return gobCodec{}.Unmarshal(a.data, v)
+	}
+	if a.Response == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("raftx: decode target should be a non-nil pointer")
+	}
+	resp := reflect.ValueOf(a.Response)
+	if resp.Type().AssignableTo(rv.Elem().Type()) {
+		rv.Elem().Set(resp)
+		return nil
+	}
+	data, err := gobCodec{}.Marshal(a.Response)
+	if err != nil {
+		return err
+	}
+	return gobCodec{}.Unmarshal(data, v)
+}
+
+// Apply 提交日志到集群并等待FSM执行, 本节点不是leader时自动转发到leader.
+// 日志未提交的leader切换时自动重试直到ctx结束, FSM返回的error作为错误返回.
+// 提交过程中失去leader身份, 或请求已发送到leader后连接中断时, 日志可能已被提交, 此时不重试并返回 ErrApplyUnknown
+func (r *RaftX) Apply(ctx context.Context, data, extensions []byte) (*ApplyResult, error) {
+	var result *ApplyResult
+	err := r.forwardCall(ctx, false, func(ra *raft.Raft) error {
+		future := ra.ApplyLog(raft.Log{Data: data, Extensions: extensions}, timeoutOf(ctx))
+		if err := future.Error(); err != nil {
+			if err == raft.ErrLeadershipLost {
+				return errApplyUnknown(err)
+			}
+			return err
+		}
+		result = &ApplyResult{Index: future.Index(), Response: future.Response()}
+		if err, ok := result.Response.(error); ok {
+			return err
+		}
+		return nil
+	}, func(conn *grpc.ClientConn) error {
+		resp := &applyResponse{}
+		if err := invokeForwarder(ctx, conn, "Apply", &applyRequest{Data: data, Extensions: extensions, Timeout: timeoutOf(ctx)}, resp); err != nil {
+			return err
+		}
+		result = &ApplyResult{Index: resp.Index, data: resp.Response}
+		if resp.Error != "" {
+			return errors.New(resp.Error)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// SetReadMode 设置 LinearizableRead 的模式, Read_Index(默认) 或 Read_Lease
+func (r *RaftX) SetReadMode(mode int) error {
+	if mode != Read_Index && mode != Read_Lease {
+		return fmt.Errorf("invalid read mode value %d", mode)
+	}
+	r.readMode.Store(int32(mode))
+	return nil
+}
+
+// LinearizableRead 等待本节点FSM应用了调用前集群已提交的所有日志, 之后读取本地状态即为线性一致读.
+// 在follower上调用时从leader获取 read index
+func (r *RaftX) LinearizableRead(ctx context.Context) error {
+	mode := int(r.readMode.Load())
+	var index uint64
+	err := r.forwardCall(ctx, true, func(ra *raft.Raft) error {
+		var err error
+		index, err = r.leaderReadIndex(ra, mode)
+		return err
+	}, func(conn *grpc.ClientConn) error {
+		resp := &readIndexResponse{}
+		if err := invokeForwarder(ctx, conn, "ReadIndex", &readIndexRequest{Mode: mode}, resp); err != nil {
+			return err
+		}
+		index = resp.Index
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.waitApplied(ctx, index)
+}
+
+// Read 执行线性一致读, 在 LinearizableRead 成功后调用fn读取本地状态
+func (r *RaftX) Read(ctx context.Context, fn func() error) error {
+	if err := r.LinearizableRead(ctx); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// leaderReadIndex 在leader上确认leader身份后返回 read index, 即确认前的commit index.
+// 新任期首次读取前通过barrier等待本任期的日志提交, 保证commit index不小于之前leader已提交的日志
+func (r *RaftX) leaderReadIndex(ra *raft.Raft, mode int) (uint64, error) {
+	stats := ra.Stats()
+	term, _ := strconv.ParseUint(stats["term"], 10, 64)
+	if r.barrierTerm.Load() != term {
+		if err := ra.Barrier(0).Error(); err != nil {
+			return 0, err
+		}
+		r.barrierTerm.Store(term)
+		stats = ra.Stats()
+	}
+	index, _ := strconv.ParseUint(stats["commit_index"], 10, 64)
+	if mode == Read_Lease && time.Now().UnixNano() < r.leaseUntil.Load() {
+		return index, nil
+	}
+	start := time.Now()
+	if err := ra.VerifyLeader().Error(); err != nil {
+		return 0, err
+	}
+	r.leaseUntil.Store(start.Add(r.config.LeaderLeaseTimeout).UnixNano())
+	return index, nil
+}
+
+// waitApplied 等待本节点FSM应用到index
+func (r *RaftX) waitApplied(ctx context.Context, index uint64) error {
+	ra, err := r.getRaft()
+	if err != nil {
+		return err
+	}
+	// raft 在日志交给FSM goroutine后即更新 AppliedIndex, 还需要等待FSM实际执行完成
+	for ra.AppliedIndex() < index {
+		if err := sleepContext(ctx, time.Millisecond); err != nil {
+			return err
+		}
+	}
+	target := r.lastFSMIndex(index)
+	for r.applied.Load() < target && lastSnapshotIndex(ra) < target {
+		if err := sleepContext(ctx, time.Millisecond); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forwardCall 本节点是leader时执行local, 否则通过forwarder服务转发到leader执行remote.
+// leader明确返回未执行(非leader, leader转移中)时重试直到ctx结束; 请求已发送但结果未知(连接中断, 失去leader身份)时,
+// idempotent为true则重试, 否则返回 ErrApplyUnknown
+func (r *RaftX) forwardCall(ctx context.Context, idempotent bool, local func(ra *raft.Raft) error, remote func(conn *grpc.ClientConn) error) error {
+	ra, err := r.getRaft()
+	if err != nil {
+		return err
+	}
+	var lastErr error = ErrNoLeader
+	for {
+		if ra.State() == raft.Leader {
+			err = local(ra)
+		} else if leaderAddr, _ := ra.LeaderWithID(); leaderAddr != "" {
+			conn, dialErr := r.clients.conn(string(leaderAddr), r.dialOptions())
+			if dialErr != nil {
+				return dialErr
+			}
+			if connReady(ctx, conn) {
+				err = remote(conn)
+			} else {
+				err = fmt.Errorf("%w: connect to leader %s failed", ErrNoLeader, leaderAddr)
+			}
+		} else {
+			err = ErrNoLeader
+		}
+
+		switch {
+		case isRetriable(err):
+		case isOutcomeUnknown(err) && idempotent:
+		case isOutcomeUnknown(err):
+			return errApplyUnknown(err)
+		default:
+			return err
+		}
+		lastErr = err
+		if err := sleepContext(ctx, Leader_Retry_Interval); err != nil {
+			return fmt.Errorf("raftx: %w, last error: %v", err, lastErr)
+		}
+	}
+}
+
+// connReady 等待连接就绪, 连接失败时请求一定未发送, 可以安全地重试
+func connReady(ctx context.Context, conn *grpc.ClientConn) bool {
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return true
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return false
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return false
+		}
+	}
+}
+
+func errApplyUnknown(err error) error {
+	if errors.Is(err, ErrApplyUnknown) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrApplyUnknown, err)
+}
+
+// notExecuted leader明确返回的请求未执行的错误
+var notExecuted = []error{raft.ErrNotLeader, raft.ErrLeadershipTransferInProgress, raft.ErrRaftShutdown, ErrNoLeader, ErrNotStarted}
+
+// isRetriable 判断错误是否表示请求一定未执行(本节点或leader不是leader, leader转移中, 没有leader), 可以安全重试.
+// 本节点raft关闭时不重试
+func isRetriable(err error) bool {
+	if err == nil || err == raft.ErrRaftShutdown {
+		return false
+	}
+	if errors.Is(err, ErrNoLeader) || err == raft.ErrNotLeader || err == raft.ErrLeadershipTransferInProgress {
+		return true
+	}
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.Unavailable {
+		return false
+	}
+	for _, e := range notExecuted {
+		if st.Message() == e.Error() {
+			return true
+		}
+	}
+	return false
+}
+
+// isOutcomeUnknown 判断错误是否表示请求可能已执行: 失去leader身份, 或请求发送后连接中断等传输错误
+func isOutcomeUnknown(err error) bool {
+	if err == nil || isRetriable(err) {
+		return false
+	}
+	if err == raft.ErrLeadershipLost || errors.Is(err, ErrApplyUnknown) {
+		return true
+	}
+	return status.Code(err) == codes.Unavailable
+}
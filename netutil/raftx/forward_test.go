@@ -0,0 +1,89 @@
+package raftx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/netutil/raftx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestForward(t *testing.T) {
+	Convey("Test apply forwarding and linearizable read", t, func() {
+		dir := t.TempDir()
+		n1, fsm1, stop1 := startTestNode(dir, "n1", true)
+		defer stop1()
+		n2, fsm2, stop2 := startTestNode(dir, "n2", false)
+		defer stop2()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := n1.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(n2.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+
+		// apply on leader
+		result, err := n1.Apply(ctx, []byte("a"), nil)
+		So(err, ShouldBeNil)
+		So(result.Response, ShouldEqual, 1)
+		var count int
+		So(result.Decode(&count), ShouldBeNil)
+		So(count, ShouldEqual, 1)
+
+		// apply on follower is forwarded
+		result, err = n2.Apply(ctx, []byte("b"), nil)
+		So(err, ShouldBeNil)
+		So(result.Response, ShouldBeNil)
+		So(result.Decode(&count), ShouldBeNil)
+		So(count, ShouldEqual, 2)
+
+		_, err = n2.Apply(ctx, []byte("error"), nil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "bad command")
+		_, err = n1.Apply(ctx, []byte("error"), nil)
+		So(err.Error(), ShouldEqual, "bad command")
+
+		// follower sees all writes after linearizable read
+		_, err = n1.Apply(ctx, []byte("c"), nil)
+		So(err, ShouldBeNil)
+		So(n2.Read(ctx, func() error {
+			So(fsm2.Logs(), ShouldResemble, []string{"a", "b", "c"})
+			return nil
+		}), ShouldBeNil)
+
+		So(n1.SetReadMode(raftx.Read_Lease), ShouldBeNil)
+		So(n1.SetReadMode(3), ShouldNotBeNil)
+		So(n1.LinearizableRead(ctx), ShouldBeNil)
+		So(n1.LinearizableRead(ctx), ShouldBeNil)
+		So(fsm1.Logs(), ShouldResemble, []string{"a", "b", "c"})
+
+		Convey("leader client", func() {
+			client, err := raftx.NewLeaderClient(raftx.LeaderClientConfig{Addrs: []string{n2.GetAddress(), n1.GetAddress()}})
+			So(err, ShouldBeNil)
+			defer client.Close()
+
+			leader, err := client.Leader(ctx)
+			So(err, ShouldBeNil)
+			So(leader.Id, ShouldEqual, "n1")
+			result, err := client.Apply(ctx, []byte("d"), nil)
+			So(err, ShouldBeNil)
+			So(result.Decode(&count), ShouldBeNil)
+			So(count, ShouldEqual, 4)
+
+			// retry on new leader after leadership transfer
+			So(n1.TransferLeadership(ctx, "n2"), ShouldBeNil)
+			for (!n2.IsLeader() || n1.IsLeader()) && ctx.Err() == nil {
+				time.Sleep(10 * time.Millisecond)
+			}
+			result, err = client.Apply(ctx, []byte("e"), nil)
+			So(err, ShouldBeNil)
+			So(result.Decode(&count), ShouldBeNil)
+			So(count, ShouldEqual, 5)
+			So(n2.IsLeader(), ShouldBeTrue)
+
+			_, err = raftx.NewLeaderClient(raftx.LeaderClientConfig{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,113 @@
+package raftx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/netutil/raftx"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+)
+
+// testFSM records applied commands
+type testFSM struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (f *testFSM) Apply(l *raft.Log) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if string(l.Data) == "error" {
+		return errors.New("bad command")
+	}
+	f.logs = append(f.logs, string(l.Data))
+	return len(f.logs)
+}
+
+func (f *testFSM) Logs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.logs...)
+}
+
+func (f *testFSM) Snapshot() (raft.FSMSnapshot, error) {
+	return &testSnapshot{logs: f.Logs()}, nil
+}
+
+func (f *testFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	var logs []string
+	if err := json.NewDecoder(rc).Decode(&logs); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logs = logs
+	return nil
+}
+
+type testSnapshot struct {
+	logs []string
+}
+
+func (s *testSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := json.NewEncoder(sink).Encode(s.logs); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *testSnapshot) Release() {}
+
+// testConfig return raft config with short timeouts
+func testConfig() *raft.Config {
+	c := raft.DefaultConfig()
+	c.HeartbeatTimeout = 200 * time.Millisecond
+	c.ElectionTimeout = 200 * time.Millisecond
+	c.LeaderLeaseTimeout = 100 * time.Millisecond
+	c.CommitTimeout = 10 * time.Millisecond
+	c.LogOutput = io.Discard
+	return c
+}
+
+// startNode start a raftx node with fsm on listener l, customize is called before start and can be nil
+func startNode(dataDir, id string, l net.Listener, bootstrap bool, fsm raft.FSM, customize func(r *raftx.RaftX)) *raftx.RaftX {
+	r, err := raftx.NewRaftXWithConfig(testConfig(), &raftx.Node{Id: id, Addr: l.Addr().String()}, bootstrap, fsm)
+	So(err, ShouldBeNil)
+	So(r.SetDataDir(dataDir), ShouldBeNil)
+	if customize != nil {
+		customize(r)
+	}
+	So(r.StartWithListener(grpc.NewServer(r.ServerOptions()...), l, nil), ShouldBeNil)
+	return r
+}
+
+// startTestNode start a raftx node with testFSM, call the returned function to stop it
+func startTestNode(dataDir, id string, bootstrap bool) (*raftx.RaftX, *testFSM, func()) {
+	fsm := &testFSM{}
+	r := startNode(dataDir, id, listen(), bootstrap, fsm, nil)
+	return r, fsm, func() {
+		r.Stop()
+	}
+}
+
+func listen() net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	So(err, ShouldBeNil)
+	return l
+}
+
+func waitLogs(ctx context.Context, fsm *testFSM, n int) []string {
+	for len(fsm.Logs()) < n && ctx.Err() == nil {
+		time.Sleep(20 * time.Millisecond)
+	}
+	return fsm.Logs()
+}
@@ -0,0 +1,112 @@
+package kv
+
+import (
+	"context"
+	"time"
+
+	"github.com/jhunters/goassist/netutil/raftx"
+	"google.golang.org/grpc"
+)
+
+// Client 键值存储的grpc客户端, 可以连接集群中的任意节点, 写请求由节点转发到leader
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+var _ KV = &Client{} // check Client struct if implements KV interface
+
+// NewClient 使用已建立的grpc连接创建客户端, 连接由调用方关闭
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp any) error {
+	err := c.conn.Invoke(ctx, "/"+KV_Service_Name+"/"+method, req, resp, grpc.CallContentSubtype(raftx.Forward_Codec_Name))
+	return fromStatus(err)
+}
+
+// Put 写入键值, ttl大于0时键在ttl后过期
+func (c *Client) Put(ctx context.Context, key string, value []byte, ttl time.Duration) (*Entry, error) {
+	resp := &entryResponse{}
+	if err := c.invoke(ctx, "Put", &putRequest{Key: key, Value: value, TTL: ttl}, resp); err != nil {
+		return nil, err
+	}
+	return resp.Entry, nil
+}
+
+// Get 线性一致读取键值, 不存在或已过期时返回 ErrNotFound
+func (c *Client) Get(ctx context.Context, key string) (*Entry, error) {
+	resp := &entryResponse{}
+	if err := c.invoke(ctx, "Get", &getRequest{Key: key}, resp); err != nil {
+		return nil, err
+	}
+	return resp.Entry, nil
+}
+
+// Delete 删除键, 返回键是否存在
+func (c *Client) Delete(ctx context.Context, key string) (bool, error) {
+	resp := &deleteResponse{}
+	if err := c.invoke(ctx, "Delete", &deleteRequest{Key: key}, resp); err != nil {
+		return false, err
+	}
+	return resp.Deleted, nil
+}
+
+// CompareAndSwap 键的 ModRevision 等于revision时写入, revision为0表示键必须不存在. 不满足时返回当前值和 ErrCompareFailed
+func (c *Client) CompareAndSwap(ctx context.Context, key string, revision uint64, value []byte, ttl time.Duration) (*Entry, error) {
+	resp := &casResponse{}
+	if err := c.invoke(ctx, "CompareAndSwap", &casRequest{Key: key, Revision: revision, Value: value, TTL: ttl}, resp); err != nil {
+		return nil, err
+	}
+	if !resp.Swapped {
+		return resp.Entry, ErrCompareFailed
+	}
+	return resp.Entry, nil
+}
+
+// Scan 按键排序返回前缀为prefix的键值, limit小于等于0表示不限制
+func (c *Client) Scan(ctx context.Context, prefix string, limit int) ([]*Entry, error) {
+	resp := &scanResponse{}
+	if err := c.invoke(ctx, "Scan", &scanRequest{Prefix: prefix, Limit: limit}, resp); err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+// Watch 监听连接节点上前缀为prefix的键变化, ctx结束, 连接断开或消费不及时时关闭通道.
+// ctx必须可以取消, 否则返回 ErrWatchContext, 停止监听时取消ctx
+func (c *Client) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	if ctx.Done() == nil {
+		return nil, ErrWatchContext
+	}
+	stream, err := c.conn.NewStream(ctx, &watchStreamDesc, "/"+KV_Service_Name+"/Watch", grpc.CallContentSubtype(raftx.Forward_Codec_Name))
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	if err := stream.SendMsg(&watchRequest{Prefix: prefix}); err != nil {
+		return nil, fromStatus(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fromStatus(err)
+	}
+	// 等待服务端注册监听
+	if _, err := stream.Header(); err != nil {
+		return nil, fromStatus(err)
+	}
+	ch := make(chan Event, Watch_Buffer_Size)
+	go func() {
+		defer close(ch)
+		for {
+			ev := Event{}
+			if err := stream.RecvMsg(&ev); err != nil {
+				return
+			}
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
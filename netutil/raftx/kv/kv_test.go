@@ -0,0 +1,202 @@
+package kv_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/netutil/raftx"
+	"github.com/jhunters/goassist/netutil/raftx/kv"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// testConfig return raft config with short timeouts
+func testConfig() *raft.Config {
+	c := raft.DefaultConfig()
+	c.HeartbeatTimeout = 200 * time.Millisecond
+	c.ElectionTimeout = 200 * time.Millisecond
+	c.LeaderLeaseTimeout = 100 * time.Millisecond
+	c.CommitTimeout = 10 * time.Millisecond
+	c.LogOutput = io.Discard
+	return c
+}
+
+// startStore start a kv store node with grpc service, call the returned function to stop it
+func startStore(dataDir, id, addr string, bootstrap bool) (*kv.Store, func()) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	l, err := net.Listen("tcp", addr)
+	So(err, ShouldBeNil)
+	s, err := kv.NewStore(testConfig(), &raftx.Node{Id: id, Addr: l.Addr().String()}, bootstrap)
+	So(err, ShouldBeNil)
+	So(s.RaftX().SetDataDir(dataDir), ShouldBeNil)
+
+	gs := grpc.NewServer(s.RaftX().ServerOptions()...)
+	s.RegisterService(gs)
+	So(s.RaftX().StartWithListener(gs, l, nil), ShouldBeNil)
+	return s, func() {
+		s.RaftX().Stop()
+	}
+}
+
+// nextEvent wait next event from watch channel
+func nextEvent(ch <-chan kv.Event) kv.Event {
+	select {
+	case ev, ok := <-ch:
+		So(ok, ShouldBeTrue)
+		return ev
+	case <-time.After(5 * time.Second):
+		So("timeout", ShouldBeEmpty)
+	}
+	return kv.Event{}
+}
+
+// testKV run common cases on Store or Client
+func testKV(ctx context.Context, store kv.KV) {
+	_, err := store.Watch(context.Background(), "app/")
+	So(err, ShouldEqual, kv.ErrWatchContext)
+
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	events, err := store.Watch(watchCtx, "app/")
+	So(err, ShouldBeNil)
+
+	e, err := store.Put(ctx, "app/a", []byte("1"), 0)
+	So(err, ShouldBeNil)
+	So(e.Version, ShouldEqual, 1)
+	So(e.CreateRevision, ShouldEqual, e.ModRevision)
+	ev := nextEvent(events)
+	So(ev.Type, ShouldEqual, kv.Event_Put)
+	So(ev.Entry.Key, ShouldEqual, "app/a")
+	So(ev.Revision, ShouldEqual, e.ModRevision)
+
+	e2, err := store.Put(ctx, "app/a", []byte("2"), 0)
+	So(err, ShouldBeNil)
+	So(e2.Version, ShouldEqual, 2)
+	So(e2.CreateRevision, ShouldEqual, e.CreateRevision)
+	So(string(nextEvent(events).Entry.Value), ShouldEqual, "2")
+
+	got, err := store.Get(ctx, "app/a")
+	So(err, ShouldBeNil)
+	So(got, ShouldResemble, e2)
+	_, err = store.Get(ctx, "app/none")
+	So(err, ShouldEqual, kv.ErrNotFound)
+	_, err = store.Put(ctx, "", nil, 0)
+	So(err, ShouldEqual, kv.ErrEmptyKey)
+
+	// compare and swap
+	cur, err := store.CompareAndSwap(ctx, "app/a", e.ModRevision, []byte("3"), 0)
+	So(err, ShouldEqual, kv.ErrCompareFailed)
+	So(cur.ModRevision, ShouldEqual, e2.ModRevision)
+	e3, err := store.CompareAndSwap(ctx, "app/a", e2.ModRevision, []byte("3"), 0)
+	So(err, ShouldBeNil)
+	So(string(e3.Value), ShouldEqual, "3")
+	So(nextEvent(events).Revision, ShouldEqual, e3.ModRevision)
+	_, err = store.CompareAndSwap(ctx, "app/a", 0, []byte("4"), 0)
+	So(err, ShouldEqual, kv.ErrCompareFailed)
+	_, err = store.CompareAndSwap(ctx, "app/b", 0, []byte("b"), 0)
+	So(err, ShouldBeNil)
+	nextEvent(events)
+
+	// prefix scan
+	_, err = store.Put(ctx, "other", []byte("x"), 0)
+	So(err, ShouldBeNil)
+	entries, err := store.Scan(ctx, "app/", 0)
+	So(err, ShouldBeNil)
+	So(len(entries), ShouldEqual, 2)
+	So(entries[0].Key, ShouldEqual, "app/a")
+	So(entries[1].Key, ShouldEqual, "app/b")
+	entries, err = store.Scan(ctx, "", 1)
+	So(err, ShouldBeNil)
+	So(len(entries), ShouldEqual, 1)
+
+	deleted, err := store.Delete(ctx, "app/b")
+	So(err, ShouldBeNil)
+	So(deleted, ShouldBeTrue)
+	ev = nextEvent(events)
+	So(ev.Type, ShouldEqual, kv.Event_Delete)
+	So(ev.Entry.Key, ShouldEqual, "app/b")
+	deleted, err = store.Delete(ctx, "app/b")
+	So(err, ShouldBeNil)
+	So(deleted, ShouldBeFalse)
+
+	// ttl
+	_, err = store.Put(ctx, "app/ttl", []byte("t"), 300*time.Millisecond)
+	So(err, ShouldBeNil)
+	nextEvent(events)
+	_, err = store.Get(ctx, "app/ttl")
+	So(err, ShouldBeNil)
+	time.Sleep(400 * time.Millisecond)
+	_, err = store.Get(ctx, "app/ttl")
+	So(err, ShouldEqual, kv.ErrNotFound)
+	ev = nextEvent(events)
+	So(ev.Type, ShouldEqual, kv.Event_Expire)
+	So(ev.Entry.Key, ShouldEqual, "app/ttl")
+
+	cancelWatch()
+	for range events {
+	}
+}
+
+func TestStore(t *testing.T) {
+	Convey("Test replicated kv store", t, func() {
+		dir := t.TempDir()
+		s1, stop1 := startStore(dir, "n1", "", true)
+		defer stop1()
+		s2, stop2 := startStore(dir, "n2", "", false)
+		defer stop2()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_, err := s1.RaftX().WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(s2.RaftX().Join(ctx, true, s1.RaftX().GetAddress()), ShouldBeNil)
+
+		Convey("store on follower", func() {
+			testKV(ctx, s2)
+			got, err := s1.Get(ctx, "app/a")
+			So(err, ShouldBeNil)
+			So(string(got.Value), ShouldEqual, "3")
+		})
+
+		Convey("grpc client", func() {
+			conn, err := grpc.NewClient(s2.RaftX().GetAddress(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			testKV(ctx, kv.NewClient(conn))
+		})
+	})
+
+	Convey("Test restore from snapshot", t, func() {
+		dir := t.TempDir()
+		s, stop := startStore(dir, "n1", "", true)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := s.RaftX().WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		_, err = s.Put(ctx, "a", []byte("1"), 0)
+		So(err, ShouldBeNil)
+		_, err = s.Put(ctx, "b", []byte("2"), time.Hour)
+		So(err, ShouldBeNil)
+		So(s.RaftX().Raft().Snapshot().Error(), ShouldBeNil)
+		_, err = s.Put(ctx, "c", []byte("3"), 0)
+		So(err, ShouldBeNil)
+		addr := s.RaftX().GetAddress()
+		stop()
+
+		s, stop = startStore(dir, "n1", addr, true)
+		defer stop()
+		_, err = s.RaftX().WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		entries, err := s.Scan(ctx, "", 0)
+		So(err, ShouldBeNil)
+		So(len(entries), ShouldEqual, 3)
+		So(entries[1].ExpireAt, ShouldBeGreaterThan, 0)
+		So(entries[2].ModRevision, ShouldEqual, 3)
+	})
+}
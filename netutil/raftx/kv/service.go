@@ -0,0 +1,210 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jhunters/goassist/netutil/raftx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	KV_Service_Name = "raftx.KV"
+)
+
+type putRequest struct {
+	Key   string
+	Value []byte
+	TTL   time.Duration
+}
+
+type entryResponse struct {
+	Entry *Entry
+}
+
+type getRequest struct {
+	Key string
+}
+
+type deleteRequest struct {
+	Key string
+}
+
+type deleteResponse struct {
+	Deleted bool
+}
+
+type casRequest struct {
+	Key      string
+	Revision uint64
+	Value    []byte
+	TTL      time.Duration
+}
+
+type casResponse struct {
+	Entry   *Entry
+	Swapped bool
+}
+
+type scanRequest struct {
+	Prefix string
+	Limit  int
+}
+
+type scanResponse struct {
+	Entries []*Entry
+}
+
+type watchRequest struct {
+	Prefix string
+}
+
+// kvServer grpc服务, 请求转为 Store 调用
+type kvServer struct {
+	s *Store
+}
+
+func (k *kvServer) put(ctx context.Context, req *putRequest) (*entryResponse, error) {
+	e, err := k.s.Put(ctx, req.Key, req.Value, req.TTL)
+	return &entryResponse{Entry: e}, toStatus(err)
+}
+
+func (k *kvServer) get(ctx context.Context, req *getRequest) (*entryResponse, error) {
+	e, err := k.s.Get(ctx, req.Key)
+	return &entryResponse{Entry: e}, toStatus(err)
+}
+
+func (k *kvServer) delete(ctx context.Context, req *deleteRequest) (*deleteResponse, error) {
+	deleted, err := k.s.Delete(ctx, req.Key)
+	return &deleteResponse{Deleted: deleted}, toStatus(err)
+}
+
+func (k *kvServer) cas(ctx context.Context, req *casRequest) (*casResponse, error) {
+	e, err := k.s.CompareAndSwap(ctx, req.Key, req.Revision, req.Value, req.TTL)
+	if err == ErrCompareFailed {
+		// 返回当前值供调用方重试
+		return &casResponse{Entry: e}, nil
+	}
+	return &casResponse{Entry: e, Swapped: err == nil}, toStatus(err)
+}
+
+func (k *kvServer) scan(ctx context.Context, req *scanRequest) (*scanResponse, error) {
+	entries, err := k.s.Scan(ctx, req.Prefix, req.Limit)
+	return &scanResponse{Entries: entries}, toStatus(err)
+}
+
+func (k *kvServer) watch(req *watchRequest, stream grpc.ServerStream) error {
+	ch, err := k.s.Watch(stream.Context(), req.Prefix)
+	if err != nil {
+		return toStatus(err)
+	}
+	// 通知客户端监听已注册
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	for ev := range ch {
+		if err := stream.SendMsg(&ev); err != nil {
+			return err
+		}
+	}
+	if err := stream.Context().Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.ResourceExhausted, "kv: watch buffer overflow")
+}
+
+func unaryHandler[Req any, Resp any](method string, call func(k *kvServer, ctx context.Context, req *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			in := new(Req)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(*kvServer), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + KV_Service_Name + "/" + method}
+			return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+				return call(srv.(*kvServer), ctx, req.(*Req))
+			})
+		},
+	}
+}
+
+var watchStreamDesc = grpc.StreamDesc{
+	StreamName: "Watch",
+	Handler: func(srv any, stream grpc.ServerStream) error {
+		req := &watchRequest{}
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		return srv.(*kvServer).watch(req, stream)
+	},
+	ServerStreams: true,
+}
+
+var kvServiceDesc = grpc.ServiceDesc{
+	ServiceName: KV_Service_Name,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("Put", (*kvServer).put),
+		unaryHandler("Get", (*kvServer).get),
+		unaryHandler("Delete", (*kvServer).delete),
+		unaryHandler("CompareAndSwap", (*kvServer).cas),
+		unaryHandler("Scan", (*kvServer).scan),
+	},
+	Streams:  []grpc.StreamDesc{watchStreamDesc},
+	Metadata: "raftx/kv",
+}
+
+// RegisterService 注册键值存储的grpc服务, 消息使用gob编码, 需要在grpc服务启动前注册
+func (s *Store) RegisterService(gs *grpc.Server) {
+	gs.RegisterService(&kvServiceDesc, &kvServer{s: s})
+}
+
+// toStatus 将错误转为grpc状态
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrEmptyKey):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, raftx.ErrNoLeader), errors.Is(err, raftx.ErrNotStarted):
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// fromStatus 将grpc状态转为错误
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.OK:
+		return nil
+	case codes.NotFound:
+		return ErrNotFound
+	case codes.InvalidArgument:
+		if st.Message() == ErrEmptyKey.Error() {
+			return ErrEmptyKey
+		}
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	case codes.Canceled:
+		return context.Canceled
+	}
+	return err
+}
@@ -0,0 +1,419 @@
+// Package kv 基于raftx的多副本键值存储, 支持TTL, CAS, 前缀扫描和监听键变化, 提供grpc服务和客户端.
+package kv
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/netutil/raftx"
+)
+
+const (
+	// 过期键的清理间隔, 由leader定期提交清理命令
+	Expire_Interval = time.Second
+
+	// 监听通道的缓冲大小, 消费不及时缓冲满后关闭通道
+	Watch_Buffer_Size = 128
+
+	Event_Put    = 1 // 键被写入
+	Event_Delete = 2 // 键被删除
+	Event_Expire = 3 // 键过期被清理
+)
+
+var (
+	ErrNotFound      = errors.New("kv: key not found")
+	ErrCompareFailed = errors.New("kv: compare failed")
+	ErrEmptyKey      = errors.New("kv: key is empty")
+	ErrWatchContext  = errors.New("kv: watch context is not cancellable")
+)
+
+// Entry 键值对
+type Entry struct {
+	Key            string
+	Value          []byte
+	CreateRevision uint64 // 创建时的版本号
+	ModRevision    uint64 // 最后修改时的版本号, 用于 CompareAndSwap
+	Version        uint64 // 创建后的修改次数, 从1开始
+	ExpireAt       int64  // 过期时间, unix纳秒, 0表示不过期
+}
+
+// expired 判断在now时是否已过期
+func (e *Entry) expired(now int64) bool {
+	return e.ExpireAt > 0 && e.ExpireAt <= now
+}
+
+// Event 键变化事件
+type Event struct {
+	Type     int
+	Entry    Entry  // 写入后的键值, 删除和过期时为删除前的键值
+	Revision uint64 // 事件的版本号
+}
+
+// KV 键值存储接口, Store 和 Client 都实现该接口
+type KV interface {
+	// Put 写入键值, ttl大于0时键在ttl后过期
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) (*Entry, error)
+	// Get 线性一致读取键值, 不存在或已过期时返回 ErrNotFound
+	Get(ctx context.Context, key string) (*Entry, error)
+	// Delete 删除键, 返回键是否存在
+	Delete(ctx context.Context, key string) (bool, error)
+	// CompareAndSwap 键的 ModRevision 等于revision时写入, revision为0表示键必须不存在. 不满足时返回 ErrCompareFailed
+	CompareAndSwap(ctx context.Context, key string, revision uint64, value []byte, ttl time.Duration) (*Entry, error)
+	// Scan 按键排序返回前缀为prefix的键值, limit小于等于0表示不限制
+	Scan(ctx context.Context, prefix string, limit int) ([]*Entry, error)
+	// Watch 监听前缀为prefix的键变化, ctx结束或消费不及时时关闭通道. ctx必须可以取消, 否则返回 ErrWatchContext
+	Watch(ctx context.Context, prefix string) (<-chan Event, error)
+}
+
+// state 由raft复制的状态
+type state struct {
+	Revision uint64
+	Entries  map[string]*Entry
+}
+
+// 各副本使用leader追加日志的时间判断过期和计算过期时间, 保证执行结果一致且不依赖提交者的时钟.
+// 命令中的 Now 为提交者的时间, 仅在日志没有记录追加时间时使用
+
+type putCommand struct {
+	Key   string
+	Value []byte
+	TTL   time.Duration
+	Now   int64
+}
+
+type casCommand struct {
+	Put      putCommand
+	Revision uint64
+}
+
+type casResult struct {
+	Entry   *Entry
+	Swapped bool
+}
+
+type deleteCommand struct {
+	Key string
+	Now int64
+}
+
+type expireCommand struct {
+	Now int64
+}
+
+var (
+	putCmd    = raftx.NewCommand[putCommand, *Entry]("kv.put", raftx.GobCodec)
+	casCmd    = raftx.NewCommand[casCommand, casResult]("kv.cas", raftx.GobCodec)
+	deleteCmd = raftx.NewCommand[deleteCommand, bool]("kv.delete", raftx.GobCodec)
+	expireCmd = raftx.NewCommand[expireCommand, int]("kv.expire", raftx.GobCodec)
+)
+
+// watcher 监听者
+type watcher struct {
+	prefix string
+	ch     chan Event
+}
+
+// Store 基于raftx的键值存储, 写操作在follower上调用时自动转发到leader
+type Store struct {
+	r   *raftx.RaftX
+	fsm *raftx.CommandFSM
+	st  *state
+
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+var _ KV = &Store{} // check Store struct if implements KV interface
+
+// NewStore 创建 Store 和使用该存储作为FSM的 raftx 实例, 启动前通过 RaftX 设置数据目录等配置
+func NewStore(c *raft.Config, node *raftx.Node, raftBootstrap bool) (*Store, error) {
+	s := &Store{st: &state{Entries: make(map[string]*Entry)}, watchers: make(map[*watcher]struct{})}
+	s.fsm = raftx.NewCommandFSM(s)
+	err := errors.Join(
+		raftx.HandleCommand(s.fsm, putCmd, s.applyPut),
+		raftx.HandleCommand(s.fsm, casCmd, s.applyCAS),
+		raftx.HandleCommand(s.fsm, deleteCmd, s.applyDelete),
+		raftx.HandleCommand(s.fsm, expireCmd, s.applyExpire),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := raftx.NewRaftXWithConfig(c, node, raftBootstrap, s.fsm)
+	if err != nil {
+		return nil, err
+	}
+	s.r = r
+	r.RunOnLeader(s.expire)
+	return s, nil
+}
+
+// RaftX 返回 raftx 实例
+func (s *Store) RaftX() *raftx.RaftX {
+	return s.r
+}
+
+// Put 写入键值, ttl大于0时键在ttl后过期
+func (s *Store) Put(ctx context.Context, key string, value []byte, ttl time.Duration) (*Entry, error) {
+	if key == "" {
+		return nil, ErrEmptyKey
+	}
+	return raftx.ApplyCommand(ctx, s.r, putCmd, newPut(key, value, ttl))
+}
+
+// Get 线性一致读取键值, 不存在或已过期时返回 ErrNotFound. 读取时使用本节点的时钟判断是否过期
+func (s *Store) Get(ctx context.Context, key string) (*Entry, error) {
+	var ret *Entry
+	err := s.read(ctx, func(now int64) error {
+		e, ok := s.st.Entries[key]
+		if !ok || e.expired(now) {
+			return ErrNotFound
+		}
+		ret = cloneEntry(e)
+		return nil
+	})
+	return ret, err
+}
+
+// Delete 删除键, 返回键是否存在
+func (s *Store) Delete(ctx context.Context, key string) (bool, error) {
+	if key == "" {
+		return false, ErrEmptyKey
+	}
+	return raftx.ApplyCommand(ctx, s.r, deleteCmd, deleteCommand{Key: key, Now: time.Now().UnixNano()})
+}
+
+// CompareAndSwap 键的 ModRevision 等于revision时写入, revision为0表示键必须不存在. 不满足时返回 ErrCompareFailed
+func (s *Store) CompareAndSwap(ctx context.Context, key string, revision uint64, value []byte, ttl time.Duration) (*Entry, error) {
+	if key == "" {
+		return nil, ErrEmptyKey
+	}
+	result, err := raftx.ApplyCommand(ctx, s.r, casCmd, casCommand{Put: newPut(key, value, ttl), Revision: revision})
+	if err != nil {
+		return nil, err
+	}
+	if !result.Swapped {
+		return result.Entry, ErrCompareFailed
+	}
+	return result.Entry, nil
+}
+
+// Scan 按键排序返回前缀为prefix的键值, limit小于等于0表示不限制
+func (s *Store) Scan(ctx context.Context, prefix string, limit int) ([]*Entry, error) {
+	var ret []*Entry
+	err := s.read(ctx, func(now int64) error {
+		for k, e := range s.st.Entries {
+			if strings.HasPrefix(k, prefix) && !e.expired(now) {
+				ret = append(ret, cloneEntry(e))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
+
+// Watch 监听本节点前缀为prefix的键变化, ctx结束或消费不及时时关闭通道. 从快照恢复状态时不产生事件.
+// ctx必须可以取消, 否则返回 ErrWatchContext, 停止监听时取消ctx
+func (s *Store) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	if ctx.Done() == nil {
+		return nil, ErrWatchContext
+	}
+	w := &watcher{prefix: prefix, ch: make(chan Event, Watch_Buffer_Size)}
+	s.mu.Lock()
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		s.removeWatcher(w)
+	}()
+	return w.ch, nil
+}
+
+// read 线性一致读后在FSM读锁内调用fn
+func (s *Store) read(ctx context.Context, fn func(now int64) error) error {
+	return s.r.Read(ctx, func() error {
+		return s.fsm.View(func() error {
+			return fn(time.Now().UnixNano())
+		})
+	})
+}
+
+func (s *Store) removeWatcher(w *watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.watchers[w]; ok {
+		delete(s.watchers, w)
+		close(w.ch)
+	}
+}
+
+// notify 通知监听者, 在FSM中调用
+func (s *Store) notify(typ int, e *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for w := range s.watchers {
+		if !strings.HasPrefix(e.Key, w.prefix) {
+			continue
+		}
+		select {
+		case w.ch <- Event{Type: typ, Entry: *cloneEntry(e), Revision: s.st.Revision}:
+		default:
+			// 缓冲已满, 关闭通道由监听者重新同步
+			delete(s.watchers, w)
+			close(w.ch)
+		}
+	}
+}
+
+// expire 本节点为leader期间定期提交过期清理命令
+func (s *Store) expire(ctx context.Context) {
+	ticker := time.NewTicker(Expire_Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now().UnixNano()
+		if s.hasExpired(now) {
+			applyCtx, cancel := context.WithTimeout(ctx, Expire_Interval)
+			raftx.ApplyCommand(applyCtx, s.r, expireCmd, expireCommand{Now: now})
+			cancel()
+		}
+	}
+}
+
+func (s *Store) hasExpired(now int64) bool {
+	found := false
+	s.fsm.View(func() error {
+		for _, e := range s.st.Entries {
+			if e.expired(now) {
+				found = true
+				break
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+func newPut(key string, value []byte, ttl time.Duration) putCommand {
+	return putCommand{Key: key, Value: value, TTL: ttl, Now: time.Now().UnixNano()}
+}
+
+// now 返回命令执行的时间, 在FSM中调用
+func (s *Store) now(proposed int64) int64 {
+	if t := s.fsm.AppendedAt(); !t.IsZero() {
+		return t.UnixNano()
+	}
+	return proposed
+}
+
+func (s *Store) applyPut(cmd putCommand) (*Entry, error) {
+	now := s.now(cmd.Now)
+	s.st.Revision++
+	e, ok := s.st.Entries[cmd.Key]
+	if !ok || e.expired(now) {
+		e = &Entry{Key: cmd.Key, CreateRevision: s.st.Revision}
+		s.st.Entries[cmd.Key] = e
+	}
+	e.Value = cmd.Value
+	e.ModRevision = s.st.Revision
+	e.Version++
+	e.ExpireAt = 0
+	if cmd.TTL > 0 {
+		e.ExpireAt = now + int64(cmd.TTL)
+	}
+	s.notify(Event_Put, e)
+	return cloneEntry(e), nil
+}
+
+func (s *Store) applyCAS(cmd casCommand) (casResult, error) {
+	e, ok := s.st.Entries[cmd.Put.Key]
+	if ok && e.expired(s.now(cmd.Put.Now)) {
+		ok = false
+	}
+	if (!ok && cmd.Revision != 0) || (ok && e.ModRevision != cmd.Revision) {
+		if ok {
+			return casResult{Entry: cloneEntry(e)}, nil
+		}
+		return casResult{}, nil
+	}
+	e, err := s.applyPut(cmd.Put)
+	return casResult{Entry: e, Swapped: true}, err
+}
+
+func (s *Store) applyDelete(cmd deleteCommand) (bool, error) {
+	e, ok := s.st.Entries[cmd.Key]
+	if !ok {
+		return false, nil
+	}
+	delete(s.st.Entries, cmd.Key)
+	s.st.Revision++
+	if e.expired(s.now(cmd.Now)) {
+		// 已过期的键视为不存在
+		s.notify(Event_Expire, e)
+		return false, nil
+	}
+	s.notify(Event_Delete, e)
+	return true, nil
+}
+
+func (s *Store) applyExpire(cmd expireCommand) (int, error) {
+	// 按键排序清理, 保证各副本事件的版本号一致
+	now := s.now(cmd.Now)
+	var keys []string
+	for k, e := range s.st.Entries {
+		if e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e := s.st.Entries[k]
+		delete(s.st.Entries, k)
+		s.st.Revision++
+		s.notify(Event_Expire, e)
+	}
+	return len(keys), nil
+}
+
+// Snapshot 实现 raftx.State 接口
+func (s *Store) Snapshot(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(s.st)
+}
+
+// Restore 实现 raftx.State 接口
+func (s *Store) Restore(r io.Reader) error {
+	st := &state{}
+	if err := gob.NewDecoder(r).Decode(st); err != nil {
+		return err
+	}
+	if st.Entries == nil {
+		st.Entries = make(map[string]*Entry)
+	}
+	s.st = st
+	return nil
+}
+
+func cloneEntry(e *Entry) *Entry {
+	c := *e
+	return &c
+}
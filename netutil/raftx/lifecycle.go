@@ -0,0 +1,227 @@
+package raftx
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// 集群配置变化的检查间隔, 在leader和节点变化的通知之外定期检查, 保证follower也能感知节点变化
+	Config_Watch_Interval = time.Second
+)
+
+// Wait 等待grpc服务停止, 返回服务的错误
+func (r *RaftX) Wait() error {
+	if !r.started.Load() {
+		return ErrNotStarted
+	}
+	<-r.serveDone
+	return r.serveErr
+}
+
+// Shutdown 停止raft, 停止grpc服务并等待处理中的请求完成, 关闭存储. 其它节点到本节点的复制流在停止时直接结束, 不等待对方关闭.
+// ctx结束时强制停止grpc服务并返回ctx.Err()
+func (r *RaftX) Shutdown(ctx context.Context) error {
+	return r.shutdown(ctx, true)
+}
+
+// Stop 立即停止raft和grpc服务, 关闭所有连接, 关闭存储
+func (r *RaftX) Stop() error {
+	return r.shutdown(context.Background(), false)
+}
+
+func (r *RaftX) shutdown(ctx context.Context, graceful bool) error {
+	ra, err := r.getRaft()
+	if err != nil {
+		return err
+	}
+	r.shutdownOnce.Do(func() {
+		close(r.stopC)
+		if r.observer != nil {
+			ra.DeregisterObserver(r.observer)
+		}
+
+		// raft停止后不再处理transport收到的请求, 由drain回复错误, 避免grpc处理函数一直阻塞
+		trans := r.tm.Transport()
+		trans.SetHeartbeatHandler(nil)
+		if err := ra.Shutdown().Error(); err != nil {
+			r.shutdownErr = err
+		}
+		stopped := make(chan struct{})
+		go drain(trans.Consumer(), stopped)
+
+		if graceful {
+			// 等待处理中的grpc请求完成
+			done := make(chan struct{})
+			go func() {
+				r.grpcServer.GracefulStop()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-ctx.Done():
+				r.grpcServer.Stop()
+				<-done
+				if r.shutdownErr == nil {
+					r.shutdownErr = ctx.Err()
+				}
+			}
+		} else {
+			r.grpcServer.Stop()
+		}
+		close(stopped)
+
+		r.tm.Close()
+		r.clients.close()
+		if err := r.closeStores(); err != nil && r.shutdownErr == nil {
+			r.shutdownErr = err
+		}
+	})
+	return r.shutdownErr
+}
+
+// drain 回复raft停止后transport收到的请求, 直到stopped关闭
+func drain(ch <-chan raft.RPC, stopped <-chan struct{}) {
+	for {
+		select {
+		case rpc := <-ch:
+			rpc.Respond(nil, raft.ErrRaftShutdown)
+		case <-stopped:
+			return
+		}
+	}
+}
+
+// transportRegistrar 注册raft transport服务, 本节点停止时结束处理中的流.
+// leader到follower的复制流只在有新日志时才收到消息, 否则grpc服务的 GracefulStop 会一直等待
+type transportRegistrar struct {
+	s     grpc.ServiceRegistrar
+	stopC <-chan struct{}
+}
+
+func (t *transportRegistrar) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	d := *desc
+	d.Streams = make([]grpc.StreamDesc, len(desc.Streams))
+	for i, sd := range desc.Streams {
+		handler := sd.Handler
+		sd.Handler = func(srv any, stream grpc.ServerStream) error {
+			done := make(chan error, 1)
+			go func() {
+				done <- handler(srv, stream)
+			}()
+			select {
+			case err := <-done:
+				return err
+			case <-t.stopC:
+				// 返回后grpc结束流, 处理函数的Recv返回错误后退出
+				return status.Error(codes.Unavailable, raft.ErrRaftShutdown.Error())
+			}
+		}
+		d.Streams[i] = sd
+	}
+	t.s.RegisterService(&d, impl)
+}
+
+// OnLeaderChange 注册leader变化的回调函数, leader为空表示当前没有leader, isLeader表示本节点是否成为leader
+func (r *RaftX) OnLeaderChange(fn func(leader Node, isLeader bool)) {
+	r.hooksMu.Lock()
+	defer r.hooksMu.Unlock()
+	r.leaderHooks = append(r.leaderHooks, fn)
+}
+
+// OnPeerJoin 注册其它节点加入集群配置的回调函数
+func (r *RaftX) OnPeerJoin(fn func(peer Node)) {
+	r.hooksMu.Lock()
+	defer r.hooksMu.Unlock()
+	r.joinHooks = append(r.joinHooks, fn)
+}
+
+// OnPeerLeave 注册其它节点离开集群配置的回调函数
+func (r *RaftX) OnPeerLeave(fn func(peer Node)) {
+	r.hooksMu.Lock()
+	defer r.hooksMu.Unlock()
+	r.leaveHooks = append(r.leaveHooks, fn)
+}
+
+// watch 监听leader和集群配置变化并回调事件函数, 回调函数在同一个goroutine中依次执行
+func (r *RaftX) watch(ra *raft.Raft) {
+	ch := make(chan raft.Observation, 16)
+	r.observer = raft.NewObserver(ch, false, func(o *raft.Observation) bool {
+		switch o.Data.(type) {
+		case raft.LeaderObservation, raft.PeerObservation:
+			return true
+		}
+		return false
+	})
+	ra.RegisterObserver(r.observer)
+
+	go func() {
+		ticker := time.NewTicker(Config_Watch_Interval)
+		defer ticker.Stop()
+
+		var leader Node
+		peers := make(map[string]Node)
+		check := func() {
+			addr, id := ra.LeaderWithID()
+			if current := (Node{Id: string(id), Addr: string(addr)}); current != leader {
+				leader = current
+				r.fireLeaderChange(leader, leader.Id == r.node.Id)
+			}
+
+			f := ra.GetConfiguration()
+			if f.Error() != nil {
+				return
+			}
+			current := make(map[string]Node)
+			for _, s := range f.Configuration().Servers {
+				if string(s.ID) != r.node.Id {
+					current[string(s.ID)] = Node{Id: string(s.ID), Addr: string(s.Address)}
+				}
+			}
+			for id, peer := range peers {
+				if _, ok := current[id]; !ok {
+					r.firePeer(&r.leaveHooks, peer)
+				}
+			}
+			for id, peer := range current {
+				if _, ok := peers[id]; !ok {
+					r.firePeer(&r.joinHooks, peer)
+				}
+			}
+			peers = current
+		}
+
+		for {
+			select {
+			case <-r.stopC:
+				return
+			case <-ch:
+			case <-ticker.C:
+			}
+			check()
+		}
+	}()
+}
+
+func (r *RaftX) fireLeaderChange(leader Node, isLeader bool) {
+	r.hooksMu.Lock()
+	hooks := append([]func(Node, bool){}, r.leaderHooks...)
+	r.hooksMu.Unlock()
+	for _, fn := range hooks {
+		fn(leader, isLeader)
+	}
+}
+
+func (r *RaftX) firePeer(registered *[]func(Node), peer Node) {
+	r.hooksMu.Lock()
+	hooks := append([]func(Node){}, *registered...)
+	r.hooksMu.Unlock()
+	for _, fn := range hooks {
+		fn(peer)
+	}
+}
@@ -0,0 +1,181 @@
+package raftx_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/Jille/raft-grpc-transport/proto"
+	"github.com/jhunters/goassist/netutil/raftx"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// eventRecorder collects lifecycle events
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *eventRecorder) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *eventRecorder) has(event string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, v := range e.events {
+		if v == event {
+			return true
+		}
+	}
+	return false
+}
+
+func waitEvent(ctx context.Context, e *eventRecorder, event string) bool {
+	for !e.has(event) && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return e.has(event)
+}
+
+func TestLifecycle(t *testing.T) {
+	Convey("Test lifecycle hooks", t, func() {
+		dir := t.TempDir()
+		n1, _, stop1 := startTestNode(dir, "n1", true)
+		defer stop1()
+		n2, _, stop2 := startTestNode(dir, "n2", false)
+		defer stop2()
+
+		events := &eventRecorder{}
+		n1.OnLeaderChange(func(leader raftx.Node, isLeader bool) {
+			if isLeader {
+				events.add("leader:" + leader.Id)
+			} else {
+				events.add("follower:" + leader.Id)
+			}
+		})
+		n1.OnPeerJoin(func(peer raftx.Node) { events.add("join:" + peer.Id) })
+		n1.OnPeerLeave(func(peer raftx.Node) { events.add("leave:" + peer.Id) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := n1.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(waitEvent(ctx, events, "leader:n1"), ShouldBeTrue)
+
+		So(n2.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+		So(waitEvent(ctx, events, "join:n2"), ShouldBeTrue)
+
+		// leadership may go back to n1 on a loaded machine, retry until n2 is leader
+		for !n2.IsLeader() && ctx.Err() == nil {
+			if n1.IsLeader() {
+				n1.TransferLeadership(ctx, "n2")
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		So(waitEvent(ctx, events, "follower:n2"), ShouldBeTrue)
+
+		So(n2.RemovePeer(ctx, "n1"), ShouldBeNil)
+		So(n2.AddNonvoter(ctx, &raftx.Node{Id: "n3", Addr: "127.0.0.1:1"}), ShouldBeNil)
+		So(n2.RemovePeer(ctx, "n3"), ShouldBeNil)
+
+		events2 := &eventRecorder{}
+		n2.OnPeerJoin(func(peer raftx.Node) { events2.add("join:" + peer.Id) })
+		n2.OnPeerLeave(func(peer raftx.Node) { events2.add("leave:" + peer.Id) })
+		So(n2.AddNonvoter(ctx, &raftx.Node{Id: "n4", Addr: "127.0.0.1:1"}), ShouldBeNil)
+		So(waitEvent(ctx, events2, "join:n4"), ShouldBeTrue)
+		So(n2.RemovePeer(ctx, "n4"), ShouldBeNil)
+		So(waitEvent(ctx, events2, "leave:n4"), ShouldBeTrue)
+	})
+
+	Convey("Test shutdown and wait", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		r, err := raftx.NewRaftXWithConfig(testConfig(), &raftx.Node{Id: "n1", Addr: l.Addr().String()}, true, &testFSM{})
+		So(err, ShouldBeNil)
+		So(r.SetDataDir(t.TempDir()), ShouldBeNil)
+		So(r.Wait(), ShouldEqual, raftx.ErrNotStarted)
+
+		called := false
+		So(r.StartWithListener(grpc.NewServer(), l, func(*raftx.RaftWrapper) { called = true }), ShouldBeNil)
+		So(called, ShouldBeTrue)
+		So(r.StartWithListener(grpc.NewServer(), l, nil), ShouldNotBeNil)
+
+		waitDone := make(chan error, 1)
+		go func() { waitDone <- r.Wait() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = r.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(r.Shutdown(ctx), ShouldBeNil)
+		So(r.Shutdown(ctx), ShouldBeNil)
+
+		select {
+		case err = <-waitDone:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		So(err, ShouldBeNil)
+		_, err = r.Apply(ctx, []byte("a"), nil)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test wait after failed start", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer l.Close()
+		r, err := raftx.NewRaftXWithConfig(testConfig(), &raftx.Node{Id: "n1", Addr: l.Addr().String()}, true, &testFSM{})
+		So(err, ShouldBeNil)
+		// data dir is a file, opening stores fails
+		file := filepath.Join(t.TempDir(), "file")
+		So(os.WriteFile(file, nil, 0644), ShouldBeNil)
+		So(r.SetDataDir(file), ShouldBeNil)
+		err = r.StartWithListener(grpc.NewServer(), l, nil)
+		So(err, ShouldNotBeNil)
+
+		waitDone := make(chan error, 1)
+		go func() { waitDone <- r.Wait() }()
+		select {
+		case werr := <-waitDone:
+			So(werr, ShouldEqual, err)
+		case <-time.After(5 * time.Second):
+			So("wait blocked", ShouldBeEmpty)
+		}
+	})
+
+	Convey("Test shutdown with idle replication stream", t, func() {
+		r, _, stop := startTestNode(t.TempDir(), "n1", true)
+		defer stop()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := r.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+
+		// an idle leader keeps its pipeline stream open without sending
+		conn, err := grpc.NewClient(r.GetAddress(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		_, err = pb.NewRaftTransportClient(conn).AppendEntriesPipeline(ctx)
+		So(err, ShouldBeNil)
+		time.Sleep(100 * time.Millisecond)
+
+		shutdownDone := make(chan error, 1)
+		go func() { shutdownDone <- r.Shutdown(context.Background()) }()
+		select {
+		case err = <-shutdownDone:
+		case <-time.After(5 * time.Second):
+			err = errors.New("shutdown blocked")
+		}
+		So(err, ShouldBeNil)
+	})
+}
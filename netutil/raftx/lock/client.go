@@ -0,0 +1,70 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"github.com/jhunters/goassist/netutil/raftx"
+	"google.golang.org/grpc"
+)
+
+// Client 分布式锁的grpc客户端, 可以连接集群中的任意节点, 写请求由节点转发到leader
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+var _ Locker = &Client{} // check Client struct if implements Locker interface
+
+// NewClient 使用已建立的grpc连接创建客户端, 连接由调用方关闭
+func NewClient(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp any) error {
+	err := c.conn.Invoke(ctx, "/"+Lock_Service_Name+"/"+method, req, resp, grpc.CallContentSubtype(raftx.Forward_Codec_Name))
+	return fromStatus(err)
+}
+
+// TryLock 尝试获取锁, 锁被其它owner持有或有其它owner在等待时返回当前持有者的租约(可能为nil)和 ErrLocked
+func (c *Client) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (*Lease, error) {
+	resp := &acquireResponse{}
+	if err := c.invoke(ctx, "TryLock", &acquireRequest{Name: name, Owner: owner, TTL: ttl}, resp); err != nil {
+		return nil, err
+	}
+	if resp.Locked {
+		return resp.Lease, ErrLocked
+	}
+	return resp.Lease, nil
+}
+
+// Lock 获取锁, 由连接的节点等待, 直到获取成功或ctx结束
+func (c *Client) Lock(ctx context.Context, name, owner string, ttl time.Duration) (*Lease, error) {
+	resp := &leaseResponse{}
+	if err := c.invoke(ctx, "Lock", &acquireRequest{Name: name, Owner: owner, TTL: ttl}, resp); err != nil {
+		return nil, err
+	}
+	return resp.Lease, nil
+}
+
+// Renew 续约, 过期时间延长为当前时间加租约时长. 租约已过期或不是持有者时返回 ErrNotHeld
+func (c *Client) Renew(ctx context.Context, name, owner string, token uint64) (*Lease, error) {
+	resp := &leaseResponse{}
+	if err := c.invoke(ctx, "Renew", &renewRequest{Name: name, Owner: owner, Token: token}, resp); err != nil {
+		return nil, err
+	}
+	return resp.Lease, nil
+}
+
+// Unlock 释放锁, 不是持有者时返回 ErrNotHeld
+func (c *Client) Unlock(ctx context.Context, name, owner string, token uint64) error {
+	return c.invoke(ctx, "Unlock", &unlockRequest{Name: name, Owner: owner, Token: token}, &unlockResponse{})
+}
+
+// Get 线性一致读取锁的持有者, 锁未被持有时返回 ErrNotLocked
+func (c *Client) Get(ctx context.Context, name string) (*Lease, error) {
+	resp := &leaseResponse{}
+	if err := c.invoke(ctx, "Get", &getRequest{Name: name}, resp); err != nil {
+		return nil, err
+	}
+	return resp.Lease, nil
+}
@@ -0,0 +1,289 @@
+package lock_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/netutil/raftx"
+	"github.com/jhunters/goassist/netutil/raftx/lock"
+	"github.com/jhunters/goassist/netutil/raftx/raftxtest"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// startStore start a lock store node with grpc service, call the returned function to stop it
+func startStore(dataDir, id, addr string, bootstrap bool) (*lock.Store, func()) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	l, err := net.Listen("tcp", addr)
+	So(err, ShouldBeNil)
+	s, err := lock.NewStore(raftxtest.FastConfig(), &raftx.Node{Id: id, Addr: l.Addr().String()}, bootstrap)
+	So(err, ShouldBeNil)
+	So(s.RaftX().SetDataDir(dataDir), ShouldBeNil)
+
+	gs := grpc.NewServer(s.RaftX().ServerOptions()...)
+	s.RegisterService(gs)
+	So(s.RaftX().StartWithListener(gs, l, nil), ShouldBeNil)
+	return s, func() {
+		s.RaftX().Stop()
+	}
+}
+
+// lockAsync call Lock in a goroutine, the returned channel receives the lease or nil on error
+func lockAsync(ctx context.Context, l lock.Locker, name, owner string, ttl time.Duration) <-chan *lock.Lease {
+	ch := make(chan *lock.Lease, 1)
+	go func() {
+		lease, _ := l.Lock(ctx, name, owner, ttl)
+		ch <- lease
+	}()
+	return ch
+}
+
+// testLocker run common cases on Store or Client
+func testLocker(ctx context.Context, l lock.Locker) {
+	_, err := l.TryLock(ctx, "", "o1", time.Second)
+	So(err, ShouldEqual, lock.ErrInvalidArgument)
+	_, err = l.TryLock(ctx, "a", "o1", 0)
+	So(err, ShouldEqual, lock.ErrInvalidArgument)
+	_, err = l.Lock(ctx, "a", "o1", time.Millisecond)
+	So(err, ShouldEqual, lock.ErrInvalidArgument)
+	_, err = l.Get(ctx, "a")
+	So(err, ShouldEqual, lock.ErrNotLocked)
+
+	// try lock and fencing token
+	lease1, err := l.TryLock(ctx, "a", "o1", 5*time.Second)
+	So(err, ShouldBeNil)
+	So(lease1.Owner, ShouldEqual, "o1")
+	So(lease1.Token, ShouldBeGreaterThan, 0)
+	again, err := l.TryLock(ctx, "a", "o1", 5*time.Second)
+	So(err, ShouldBeNil)
+	So(again.Token, ShouldEqual, lease1.Token)
+	holder, err := l.TryLock(ctx, "a", "o2", 5*time.Second)
+	So(err, ShouldEqual, lock.ErrLocked)
+	So(holder.Owner, ShouldEqual, "o1")
+	got, err := l.Get(ctx, "a")
+	So(err, ShouldBeNil)
+	So(got, ShouldResemble, lease1)
+
+	// renew
+	_, err = l.Renew(ctx, "a", "o1", lease1.Token+1)
+	So(err, ShouldEqual, lock.ErrNotHeld)
+	renewed, err := l.Renew(ctx, "a", "o1", lease1.Token)
+	So(err, ShouldBeNil)
+	So(renewed.ExpireAt, ShouldBeGreaterThan, lease1.ExpireAt)
+	So(l.Unlock(ctx, "a", "o2", lease1.Token), ShouldEqual, lock.ErrNotHeld)
+
+	// waiters acquire in order
+	ch2 := lockAsync(ctx, l, "a", "o2", 5*time.Second)
+	time.Sleep(300 * time.Millisecond)
+	ch3 := lockAsync(ctx, l, "a", "o3", 5*time.Second)
+	time.Sleep(300 * time.Millisecond)
+	So(l.Unlock(ctx, "a", "o1", lease1.Token), ShouldBeNil)
+	lease2 := <-ch2
+	So(lease2, ShouldNotBeNil)
+	So(lease2.Owner, ShouldEqual, "o2")
+	So(lease2.Token, ShouldBeGreaterThan, lease1.Token)
+	_, err = l.TryLock(ctx, "a", "o4", 5*time.Second)
+	So(err, ShouldEqual, lock.ErrLocked)
+	So(l.Unlock(ctx, "a", "o2", lease2.Token), ShouldBeNil)
+	lease3 := <-ch3
+	So(lease3, ShouldNotBeNil)
+	So(lease3.Owner, ShouldEqual, "o3")
+	So(lease3.Token, ShouldBeGreaterThan, lease2.Token)
+	So(l.Unlock(ctx, "a", "o3", lease3.Token), ShouldBeNil)
+	_, err = l.Get(ctx, "a")
+	So(err, ShouldEqual, lock.ErrNotLocked)
+
+	// lease expires without renewal
+	lease, err := l.TryLock(ctx, "b", "o1", 300*time.Millisecond)
+	So(err, ShouldBeNil)
+	time.Sleep(400 * time.Millisecond)
+	_, err = l.Get(ctx, "b")
+	So(err, ShouldEqual, lock.ErrNotLocked)
+	_, err = l.Renew(ctx, "b", "o1", lease.Token)
+	So(err, ShouldEqual, lock.ErrNotHeld)
+	lease, err = l.TryLock(ctx, "b", "o2", time.Second)
+	So(err, ShouldBeNil)
+
+	// waiter leaves the queue when ctx is done
+	waitCtx, cancelWait := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancelWait()
+	_, err = l.Lock(waitCtx, "b", "o3", 5*time.Second)
+	So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+	So(l.Unlock(ctx, "b", "o2", lease.Token), ShouldBeNil)
+	_, err = l.TryLock(ctx, "b", "o4", time.Second)
+	So(err, ShouldBeNil)
+}
+
+func TestStore(t *testing.T) {
+	Convey("Test distributed lock", t, func() {
+		dir := t.TempDir()
+		s1, stop1 := startStore(dir, "n1", "", true)
+		defer stop1()
+		s2, stop2 := startStore(dir, "n2", "", false)
+		defer stop2()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_, err := s1.RaftX().WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(s2.RaftX().Join(ctx, true, s1.RaftX().GetAddress()), ShouldBeNil)
+
+		Convey("store on follower", func() {
+			testLocker(ctx, s2)
+		})
+
+		Convey("grpc client", func() {
+			conn, err := grpc.NewClient(s2.RaftX().GetAddress(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			testLocker(ctx, lock.NewClient(conn))
+		})
+	})
+
+	Convey("Test restore from snapshot", t, func() {
+		dir := t.TempDir()
+		s, stop := startStore(dir, "n1", "", true)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := s.RaftX().WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		lease, err := s.TryLock(ctx, "a", "o1", time.Hour)
+		So(err, ShouldBeNil)
+		So(s.RaftX().Raft().Snapshot().Error(), ShouldBeNil)
+		_, err = s.Lock(ctx, "b", "o1", time.Hour)
+		So(err, ShouldBeNil)
+		addr := s.RaftX().GetAddress()
+		stop()
+
+		s, stop = startStore(dir, "n1", addr, true)
+		defer stop()
+		_, err = s.RaftX().WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		got, err := s.Get(ctx, "a")
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, lease)
+		_, err = s.Get(ctx, "b")
+		So(err, ShouldBeNil)
+		next, err := s.TryLock(ctx, "c", "o1", time.Hour)
+		So(err, ShouldBeNil)
+		So(next.Token, ShouldEqual, lease.Token+2)
+	})
+}
+
+// hangingRenewer is a Locker whose TryLock response arrives late and Renew blocks until ctx is done
+type hangingRenewer struct {
+	lock.Locker
+}
+
+func (h hangingRenewer) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (*lock.Lease, error) {
+	lease, err := h.Locker.TryLock(ctx, name, owner, ttl)
+	time.Sleep(ttl / 3)
+	return lease, err
+}
+
+func (h hangingRenewer) Renew(ctx context.Context, name, owner string, token uint64) (*lock.Lease, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestMutex(t *testing.T) {
+	Convey("Test mutex and run with lock", t, func() {
+		s, stop := startStore(t.TempDir(), "n1", "", true)
+		defer stop()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_, err := s.RaftX().WaitLeader(ctx)
+		So(err, ShouldBeNil)
+
+		Convey("mutex rejects tiny ttl", func() {
+			m := lock.NewMutex(s, "m", "a", time.Millisecond)
+			So(m.Lock(ctx), ShouldEqual, lock.ErrInvalidArgument)
+			So(m.TryLock(ctx), ShouldEqual, lock.ErrInvalidArgument)
+			So(m.Lease(), ShouldBeNil)
+		})
+
+		Convey("mutex renews the lease", func() {
+			m1 := lock.NewMutex(s, "m", "a", 300*time.Millisecond)
+			So(m1.Lock(ctx), ShouldBeNil)
+			lease1 := m1.Lease()
+			time.Sleep(time.Second)
+			got, err := s.Get(ctx, "m")
+			So(err, ShouldBeNil)
+			So(got.Owner, ShouldEqual, "a")
+			So(got.Token, ShouldEqual, lease1.Token)
+
+			m2 := lock.NewMutex(s, "m", "b", 300*time.Millisecond)
+			So(m2.TryLock(ctx), ShouldEqual, lock.ErrLocked)
+			So(m2.Lease(), ShouldBeNil)
+			So(m1.Unlock(ctx), ShouldBeNil)
+			So(m1.Unlock(ctx), ShouldEqual, lock.ErrNotHeld)
+			So(m2.Lock(ctx), ShouldBeNil)
+			So(m2.Lease().Token, ShouldBeGreaterThan, lease1.Token)
+			So(m2.Unlock(ctx), ShouldBeNil)
+		})
+
+		Convey("mutex reports lost lock", func() {
+			m := lock.NewMutex(s, "m", "a", 300*time.Millisecond)
+			So(m.Lock(ctx), ShouldBeNil)
+			lease := m.Lease()
+			// release the lock behind the mutex
+			So(s.Unlock(ctx, "m", "a", lease.Token), ShouldBeNil)
+			select {
+			case <-m.Lost():
+			case <-time.After(2 * time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+			So(m.Unlock(ctx), ShouldEqual, lock.ErrNotHeld)
+		})
+
+		Convey("mutex reports lost lock at lease deadline when renew hangs", func() {
+			ttl := 300 * time.Millisecond
+			m := lock.NewMutex(hangingRenewer{s}, "m", "a", ttl)
+			start := time.Now()
+			So(m.TryLock(ctx), ShouldBeNil)
+			select {
+			case <-m.Lost():
+			case <-time.After(2 * time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+			So(time.Since(start), ShouldBeLessThan, ttl+50*time.Millisecond)
+			So(m.Unlock(ctx), ShouldEqual, lock.ErrNotHeld)
+		})
+
+		Convey("run with lock campaigns again after lost", func() {
+			calls := 0
+			err := lock.RunWithLock(ctx, s, "job", "a", 300*time.Millisecond, func(ctx context.Context) error {
+				calls++
+				lease, err := s.Get(ctx, "job")
+				So(err, ShouldBeNil)
+				So(lease.Owner, ShouldEqual, "a")
+				if calls == 1 {
+					So(s.Unlock(ctx, "job", "a", lease.Token), ShouldBeNil)
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(calls, ShouldEqual, 2)
+			_, err = s.Get(ctx, "job")
+			So(err, ShouldEqual, lock.ErrNotLocked)
+
+			runCtx, cancelRun := context.WithTimeout(ctx, 300*time.Millisecond)
+			defer cancelRun()
+			err = lock.RunWithLock(runCtx, s, "job", "a", 300*time.Millisecond, func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			})
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			_, err = s.Get(ctx, "job")
+			So(err, ShouldEqual, lock.ErrNotLocked)
+		})
+	})
+}
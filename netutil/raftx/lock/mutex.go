@@ -0,0 +1,197 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Mutex 自动续约的分布式互斥锁, 获取锁后每隔ttl/3续约一次, 直到 Unlock 或锁丢失
+type Mutex struct {
+	l     Locker
+	name  string
+	owner string
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	lease *Lease
+	lost  chan struct{} // 锁丢失时关闭
+	stop  chan struct{} // Unlock 时关闭, 停止续约
+	done  chan struct{} // 续约退出时关闭
+}
+
+// NewMutex 创建名称为name, 持有者为owner, 租约时长为ttl的互斥锁, ttl不能小于 Min_TTL. 同一owner同时只应有一个 Mutex 持有锁
+func NewMutex(l Locker, name, owner string, ttl time.Duration) *Mutex {
+	return &Mutex{l: l, name: name, owner: owner, ttl: ttl}
+}
+
+// Lock 获取锁, 锁被占用时等待, 直到获取成功或ctx结束
+func (m *Mutex) Lock(ctx context.Context) error {
+	if m.ttl < Min_TTL {
+		return ErrInvalidArgument
+	}
+	start := time.Now()
+	lease, err := m.l.Lock(ctx, m.name, m.owner, m.ttl)
+	if err != nil {
+		return err
+	}
+	if time.Since(start) > m.ttl/3 {
+		// 等待后获取的锁从发送请求前计算的到期时间太早, 续约一次重新计算. 续约失败时锁在租约到期后自动释放
+		start = time.Now()
+		if lease, err = m.l.Renew(ctx, lease.Name, lease.Owner, lease.Token); err != nil {
+			return err
+		}
+	}
+	m.hold(lease, start)
+	return nil
+}
+
+// TryLock 尝试获取锁, 锁被占用时返回 ErrLocked
+func (m *Mutex) TryLock(ctx context.Context) error {
+	if m.ttl < Min_TTL {
+		return ErrInvalidArgument
+	}
+	start := time.Now()
+	lease, err := m.l.TryLock(ctx, m.name, m.owner, m.ttl)
+	if err != nil {
+		return err
+	}
+	m.hold(lease, start)
+	return nil
+}
+
+// Unlock 停止续约并释放锁, 锁已丢失时返回 ErrNotHeld
+func (m *Mutex) Unlock(ctx context.Context) error {
+	m.mu.Lock()
+	lease, lost, stop, done := m.lease, m.lost, m.stop, m.done
+	m.lease = nil
+	m.mu.Unlock()
+	if lease == nil {
+		return ErrNotHeld
+	}
+	close(stop)
+	<-done
+	select {
+	case <-lost:
+		return ErrNotHeld
+	default:
+	}
+	return m.l.Unlock(ctx, lease.Name, lease.Owner, lease.Token)
+}
+
+// Lease 返回当前持有的租约, 未持有时返回nil. 访问受保护的资源时应携带租约的 Token
+func (m *Mutex) Lease() *Lease {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lease == nil {
+		return nil
+	}
+	return cloneLease(m.lease)
+}
+
+// Lost 返回锁丢失时关闭的通道: 续约返回 ErrNotHeld, 或本地计算的租约到期前续约未成功. 未持有锁时返回nil
+func (m *Mutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lost
+}
+
+// hold 记录租约并启动续约, start为发送获取请求前的本地时间
+func (m *Mutex) hold(lease *Lease, start time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lease != nil && m.lease.Token == lease.Token {
+		select {
+		case <-m.lost:
+		default:
+			// 重复获取, 续约已在运行
+			return
+		}
+	}
+	if m.stop != nil && m.lease != nil {
+		close(m.stop)
+	}
+	m.lease = lease
+	m.lost = make(chan struct{})
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go m.keepAlive(lease, start.Add(lease.TTL), m.lost, m.stop, m.done)
+}
+
+// keepAlive 定期续约, 以发送请求前的本地时间计算租约到期时间deadline, 到期前续约未成功视为锁丢失
+func (m *Mutex) keepAlive(lease *Lease, deadline time.Time, lost, stop, done chan struct{}) {
+	defer close(done)
+	interval := m.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	expired := time.NewTimer(time.Until(deadline))
+	defer expired.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-expired.C:
+			close(lost)
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), min(interval, time.Until(deadline)))
+		renewed, err := m.l.Renew(ctx, lease.Name, lease.Owner, lease.Token)
+		cancel()
+		if err == nil {
+			deadline = start.Add(renewed.TTL)
+			if !expired.Stop() {
+				<-expired.C
+			}
+			expired.Reset(time.Until(deadline))
+			m.mu.Lock()
+			if m.lease != nil && m.lease.Token == renewed.Token {
+				m.lease = renewed
+			}
+			m.mu.Unlock()
+			continue
+		}
+		if errors.Is(err, ErrNotHeld) || !time.Now().Before(deadline) {
+			close(lost)
+			return
+		}
+	}
+}
+
+// RunWithLock 获取锁后调用fn, fn的ctx在锁丢失或ctx结束时取消. 锁丢失后重新等待获取锁并再次调用fn,
+// fn在锁未丢失时返回或ctx结束时释放锁并返回fn的结果或ctx的错误
+func RunWithLock(ctx context.Context, l Locker, name, owner string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	m := NewMutex(l, name, owner, ttl)
+	for {
+		if err := m.Lock(ctx); err != nil {
+			return err
+		}
+		runCtx, cancel := context.WithCancel(ctx)
+		lost := m.Lost()
+		go func() {
+			select {
+			case <-lost:
+				cancel()
+			case <-runCtx.Done():
+			}
+		}()
+		err := fn(runCtx)
+		cancel()
+
+		select {
+		case <-lost:
+			m.Unlock(ctx)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		default:
+		}
+		unlockCtx, unlockCancel := context.WithTimeout(context.Background(), ttl)
+		m.Unlock(unlockCtx)
+		unlockCancel()
+		return err
+	}
+}
@@ -0,0 +1,170 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jhunters/goassist/netutil/raftx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	Lock_Service_Name = "raftx.Lock"
+)
+
+type acquireRequest struct {
+	Name  string
+	Owner string
+	TTL   time.Duration
+}
+
+type acquireResponse struct {
+	Lease  *Lease
+	Locked bool // 锁被其它owner持有, 此时 Lease 为当前持有者的租约
+}
+
+type renewRequest struct {
+	Name  string
+	Owner string
+	Token uint64
+}
+
+type leaseResponse struct {
+	Lease *Lease
+}
+
+type unlockRequest struct {
+	Name  string
+	Owner string
+	Token uint64
+}
+
+type unlockResponse struct{}
+
+type getRequest struct {
+	Name string
+}
+
+// lockServer grpc服务, 请求转为 Store 调用
+type lockServer struct {
+	s *Store
+}
+
+func (l *lockServer) tryLock(ctx context.Context, req *acquireRequest) (*acquireResponse, error) {
+	lease, err := l.s.TryLock(ctx, req.Name, req.Owner, req.TTL)
+	if err == ErrLocked {
+		// 返回当前持有者供调用方判断
+		return &acquireResponse{Lease: lease, Locked: true}, nil
+	}
+	return &acquireResponse{Lease: lease}, toStatus(err)
+}
+
+// lock 在服务端等待, 客户端取消请求时ctx结束并退出等待队列
+func (l *lockServer) lock(ctx context.Context, req *acquireRequest) (*leaseResponse, error) {
+	lease, err := l.s.Lock(ctx, req.Name, req.Owner, req.TTL)
+	return &leaseResponse{Lease: lease}, toStatus(err)
+}
+
+func (l *lockServer) renew(ctx context.Context, req *renewRequest) (*leaseResponse, error) {
+	lease, err := l.s.Renew(ctx, req.Name, req.Owner, req.Token)
+	return &leaseResponse{Lease: lease}, toStatus(err)
+}
+
+func (l *lockServer) unlock(ctx context.Context, req *unlockRequest) (*unlockResponse, error) {
+	return &unlockResponse{}, toStatus(l.s.Unlock(ctx, req.Name, req.Owner, req.Token))
+}
+
+func (l *lockServer) get(ctx context.Context, req *getRequest) (*leaseResponse, error) {
+	lease, err := l.s.Get(ctx, req.Name)
+	return &leaseResponse{Lease: lease}, toStatus(err)
+}
+
+func unaryHandler[Req any, Resp any](method string, call func(l *lockServer, ctx context.Context, req *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			in := new(Req)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(*lockServer), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + Lock_Service_Name + "/" + method}
+			return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+				return call(srv.(*lockServer), ctx, req.(*Req))
+			})
+		},
+	}
+}
+
+var lockServiceDesc = grpc.ServiceDesc{
+	ServiceName: Lock_Service_Name,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("TryLock", (*lockServer).tryLock),
+		unaryHandler("Lock", (*lockServer).lock),
+		unaryHandler("Renew", (*lockServer).renew),
+		unaryHandler("Unlock", (*lockServer).unlock),
+		unaryHandler("Get", (*lockServer).get),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "raftx/lock",
+}
+
+// RegisterService 注册分布式锁的grpc服务, 消息使用gob编码, 需要在grpc服务启动前注册
+func (s *Store) RegisterService(gs *grpc.Server) {
+	gs.RegisterService(&lockServiceDesc, &lockServer{s: s})
+}
+
+// toStatus 将错误转为grpc状态
+func toStatus(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotLocked):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrNotHeld):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrInvalidArgument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, raftx.ErrNoLeader), errors.Is(err, raftx.ErrNotStarted):
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// fromStatus 将grpc状态转为错误
+func fromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.OK:
+		return nil
+	case codes.NotFound:
+		return ErrNotLocked
+	case codes.FailedPrecondition:
+		if st.Message() == ErrNotHeld.Error() {
+			return ErrNotHeld
+		}
+	case codes.InvalidArgument:
+		if st.Message() == ErrInvalidArgument.Error() {
+			return ErrInvalidArgument
+		}
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	case codes.Canceled:
+		return context.Canceled
+	}
+	return err
+}
@@ -0,0 +1,414 @@
+// Package lock 基于raftx的分布式锁服务, 支持租约, fencing token, 续约和等待队列, 提供grpc服务和客户端.
+package lock
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/netutil/raftx"
+)
+
+const (
+	// Wait_Retry_Interval 等待锁时重新尝试获取的最长间隔, 释放锁的命令在本节点应用时会立即通知等待者
+	Wait_Retry_Interval = time.Second
+
+	// Min_TTL 租约的最小时长, 等待和续约的间隔为ttl/3
+	Min_TTL = 3 * time.Millisecond
+)
+
+var (
+	ErrLocked          = errors.New("lock: lock is held by another owner")
+	ErrNotHeld         = errors.New("lock: lock is not held by the owner")
+	ErrNotLocked       = errors.New("lock: lock is not held")
+	ErrInvalidArgument = errors.New("lock: empty name, empty owner or ttl less than 3ms")
+)
+
+// Lease 锁的租约
+type Lease struct {
+	Name     string
+	Owner    string
+	Token    uint64        // fencing token, 每次获取锁时递增. 受保护的资源应拒绝token小于已见过的最大token的请求
+	TTL      time.Duration // 租约时长, 续约时延长
+	ExpireAt int64         // 过期时间, unix纳秒
+}
+
+// expired 判断在now时是否已过期
+func (l *Lease) expired(now int64) bool {
+	return l.ExpireAt <= now
+}
+
+// Locker 分布式锁接口, Store 和 Client 都实现该接口. owner 标识锁的持有者, 同一owner重复获取时返回已持有的租约
+type Locker interface {
+	// TryLock 尝试获取锁, 锁被其它owner持有或有其它owner在等待时返回当前持有者的租约(可能为nil)和 ErrLocked
+	TryLock(ctx context.Context, name, owner string, ttl time.Duration) (*Lease, error)
+	// Lock 获取锁, 锁被占用时进入等待队列, 按先后顺序获取, 直到获取成功或ctx结束
+	Lock(ctx context.Context, name, owner string, ttl time.Duration) (*Lease, error)
+	// Renew 续约, 过期时间延长为当前时间加租约时长. 租约已过期或不是持有者时返回 ErrNotHeld
+	Renew(ctx context.Context, name, owner string, token uint64) (*Lease, error)
+	// Unlock 释放锁, 不是持有者时返回 ErrNotHeld
+	Unlock(ctx context.Context, name, owner string, token uint64) error
+	// Get 线性一致读取锁的持有者, 锁未被持有时返回 ErrNotLocked
+	Get(ctx context.Context, name string) (*Lease, error)
+}
+
+// waiter 等待队列中的owner, 等待者需要在过期前重新尝试获取以保持在队列中
+type waiter struct {
+	Owner    string
+	ExpireAt int64
+}
+
+// lockState 单个锁的状态
+type lockState struct {
+	Holder  *Lease
+	Waiters []waiter
+}
+
+// prune 清理在now时已过期的持有者和等待者
+func (ls *lockState) prune(now int64) {
+	if ls.Holder != nil && ls.Holder.expired(now) {
+		ls.Holder = nil
+	}
+	waiters := ls.Waiters[:0]
+	for _, w := range ls.Waiters {
+		if w.ExpireAt > now {
+			waiters = append(waiters, w)
+		}
+	}
+	ls.Waiters = waiters
+}
+
+// state 由raft复制的状态
+type state struct {
+	Token uint64 // 最后分配的fencing token
+	Locks map[string]*lockState
+}
+
+// 各副本使用leader追加日志的时间判断过期和计算过期时间, 保证执行结果一致且不依赖提交者的时钟.
+// 命令中的 Now 为提交者的时间, 仅在日志没有记录追加时间时使用
+
+type acquireCommand struct {
+	Name  string
+	Owner string
+	TTL   time.Duration
+	Wait  bool // 未获取时是否进入等待队列
+	Now   int64
+}
+
+type acquireResult struct {
+	Lease    *Lease // 获取成功时为本owner的租约, 否则为当前持有者的租约
+	Acquired bool
+}
+
+type renewCommand struct {
+	Name  string
+	Owner string
+	Token uint64
+	Now   int64
+}
+
+type renewResult struct {
+	Lease *Lease // 续约成功时为新的租约, 否则为nil
+}
+
+type releaseCommand struct {
+	Name  string
+	Owner string
+	Token uint64
+}
+
+type cancelCommand struct {
+	Name  string
+	Owner string
+}
+
+var (
+	acquireCmd = raftx.NewCommand[acquireCommand, acquireResult]("lock.acquire", raftx.GobCodec)
+	renewCmd   = raftx.NewCommand[renewCommand, renewResult]("lock.renew", raftx.GobCodec)
+	releaseCmd = raftx.NewCommand[releaseCommand, bool]("lock.release", raftx.GobCodec)
+	cancelCmd  = raftx.NewCommand[cancelCommand, bool]("lock.cancel", raftx.GobCodec)
+)
+
+// Store 基于raftx的分布式锁, 写操作在follower上调用时自动转发到leader
+type Store struct {
+	r   *raftx.RaftX
+	fsm *raftx.CommandFSM
+	st  *state
+
+	mu      sync.Mutex
+	changed map[string]chan struct{} // 锁被释放时关闭, 通知本节点的等待者
+}
+
+var _ Locker = &Store{} // check Store struct if implements Locker interface
+
+// NewStore 创建 Store 和使用该存储作为FSM的 raftx 实例, 启动前通过 RaftX 设置数据目录等配置
+func NewStore(c *raft.Config, node *raftx.Node, raftBootstrap bool) (*Store, error) {
+	s := &Store{st: &state{Locks: make(map[string]*lockState)}, changed: make(map[string]chan struct{})}
+	s.fsm = raftx.NewCommandFSM(s)
+	err := errors.Join(
+		raftx.HandleCommand(s.fsm, acquireCmd, s.applyAcquire),
+		raftx.HandleCommand(s.fsm, renewCmd, s.applyRenew),
+		raftx.HandleCommand(s.fsm, releaseCmd, s.applyRelease),
+		raftx.HandleCommand(s.fsm, cancelCmd, s.applyCancel),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := raftx.NewRaftXWithConfig(c, node, raftBootstrap, s.fsm)
+	if err != nil {
+		return nil, err
+	}
+	s.r = r
+	return s, nil
+}
+
+// RaftX 返回 raftx 实例
+func (s *Store) RaftX() *raftx.RaftX {
+	return s.r
+}
+
+// TryLock 尝试获取锁, 锁被其它owner持有或有其它owner在等待时返回当前持有者的租约(可能为nil)和 ErrLocked
+func (s *Store) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (*Lease, error) {
+	if name == "" || owner == "" || ttl < Min_TTL {
+		return nil, ErrInvalidArgument
+	}
+	result, err := raftx.ApplyCommand(ctx, s.r, acquireCmd, acquireCommand{Name: name, Owner: owner, TTL: ttl, Now: time.Now().UnixNano()})
+	if err != nil {
+		return nil, err
+	}
+	if !result.Acquired {
+		return result.Lease, ErrLocked
+	}
+	return result.Lease, nil
+}
+
+// Lock 获取锁, 锁被占用时进入等待队列, 按先后顺序获取, 直到获取成功或ctx结束.
+// 等待期间每隔ttl/3(最长 Wait_Retry_Interval)重新尝试, 等待者超过ttl未重试时移出队列
+func (s *Store) Lock(ctx context.Context, name, owner string, ttl time.Duration) (*Lease, error) {
+	if name == "" || owner == "" || ttl < Min_TTL {
+		return nil, ErrInvalidArgument
+	}
+	interval := min(ttl/3, Wait_Retry_Interval)
+	for {
+		changed := s.watch(name)
+		now := time.Now()
+		result, err := raftx.ApplyCommand(ctx, s.r, acquireCmd, acquireCommand{Name: name, Owner: owner, TTL: ttl, Wait: true, Now: now.UnixNano()})
+		if err != nil {
+			s.cancelWait(name, owner)
+			return nil, err
+		}
+		if result.Acquired {
+			return result.Lease, nil
+		}
+
+		wait := interval
+		if result.Lease != nil {
+			// 持有者的租约到期后立即重试
+			wait = min(wait, time.Duration(result.Lease.ExpireAt-now.UnixNano()))
+		}
+		timer := time.NewTimer(max(wait, time.Millisecond))
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			s.cancelWait(name, owner)
+			return nil, ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// cancelWait 将owner移出等待队列, ctx已结束时使用新的超时
+func (s *Store) cancelWait(name, owner string) {
+	ctx, cancel := context.WithTimeout(context.Background(), Wait_Retry_Interval)
+	defer cancel()
+	raftx.ApplyCommand(ctx, s.r, cancelCmd, cancelCommand{Name: name, Owner: owner})
+}
+
+// Renew 续约, 过期时间延长为当前时间加租约时长. 租约已过期或不是持有者时返回 ErrNotHeld
+func (s *Store) Renew(ctx context.Context, name, owner string, token uint64) (*Lease, error) {
+	result, err := raftx.ApplyCommand(ctx, s.r, renewCmd, renewCommand{Name: name, Owner: owner, Token: token, Now: time.Now().UnixNano()})
+	if err != nil {
+		return nil, err
+	}
+	if result.Lease == nil {
+		return nil, ErrNotHeld
+	}
+	return result.Lease, nil
+}
+
+// Unlock 释放锁, 不是持有者时返回 ErrNotHeld
+func (s *Store) Unlock(ctx context.Context, name, owner string, token uint64) error {
+	released, err := raftx.ApplyCommand(ctx, s.r, releaseCmd, releaseCommand{Name: name, Owner: owner, Token: token})
+	if err != nil {
+		return err
+	}
+	if !released {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Get 线性一致读取锁的持有者, 锁未被持有时返回 ErrNotLocked. 读取时使用本节点的时钟判断是否过期
+func (s *Store) Get(ctx context.Context, name string) (*Lease, error) {
+	var ret *Lease
+	err := s.r.Read(ctx, func() error {
+		return s.fsm.View(func() error {
+			ls, ok := s.st.Locks[name]
+			if !ok || ls.Holder == nil || ls.Holder.expired(time.Now().UnixNano()) {
+				return ErrNotLocked
+			}
+			ret = cloneLease(ls.Holder)
+			return nil
+		})
+	})
+	return ret, err
+}
+
+// watch 返回锁name被释放时关闭的通道
+func (s *Store) watch(name string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch, ok := s.changed[name]
+	if !ok {
+		ch = make(chan struct{})
+		s.changed[name] = ch
+	}
+	return ch
+}
+
+// notify 通知等待锁name的goroutine, 在FSM中调用
+func (s *Store) notify(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch, ok := s.changed[name]; ok {
+		close(ch)
+		delete(s.changed, name)
+	}
+}
+
+// cleanup 锁没有持有者和等待者时删除
+func (s *Store) cleanup(name string, ls *lockState) {
+	if ls.Holder == nil && len(ls.Waiters) == 0 {
+		delete(s.st.Locks, name)
+	}
+}
+
+// now 返回命令执行的时间, 在FSM中调用
+func (s *Store) now(proposed int64) int64 {
+	if t := s.fsm.AppendedAt(); !t.IsZero() {
+		return t.UnixNano()
+	}
+	return proposed
+}
+
+func (s *Store) applyAcquire(cmd acquireCommand) (acquireResult, error) {
+	now := s.now(cmd.Now)
+	ls, ok := s.st.Locks[cmd.Name]
+	if !ok {
+		ls = &lockState{}
+		s.st.Locks[cmd.Name] = ls
+	}
+	defer s.cleanup(cmd.Name, ls)
+	ls.prune(now)
+
+	if ls.Holder != nil && ls.Holder.Owner == cmd.Owner {
+		// 重复获取, 返回已持有的租约
+		return acquireResult{Lease: cloneLease(ls.Holder), Acquired: true}, nil
+	}
+	position := -1
+	for i, w := range ls.Waiters {
+		if w.Owner == cmd.Owner {
+			position = i
+			break
+		}
+	}
+	if ls.Holder == nil && (len(ls.Waiters) == 0 || position == 0) {
+		if position == 0 {
+			ls.Waiters = ls.Waiters[1:]
+		}
+		s.st.Token++
+		ls.Holder = &Lease{Name: cmd.Name, Owner: cmd.Owner, Token: s.st.Token, TTL: cmd.TTL, ExpireAt: now + int64(cmd.TTL)}
+		return acquireResult{Lease: cloneLease(ls.Holder), Acquired: true}, nil
+	}
+
+	if cmd.Wait {
+		w := waiter{Owner: cmd.Owner, ExpireAt: now + int64(cmd.TTL)}
+		if position >= 0 {
+			ls.Waiters[position] = w
+		} else {
+			ls.Waiters = append(ls.Waiters, w)
+		}
+	}
+	if ls.Holder == nil {
+		return acquireResult{}, nil
+	}
+	return acquireResult{Lease: cloneLease(ls.Holder)}, nil
+}
+
+func (s *Store) applyRenew(cmd renewCommand) (renewResult, error) {
+	now := s.now(cmd.Now)
+	ls, ok := s.st.Locks[cmd.Name]
+	if !ok || ls.Holder == nil || ls.Holder.expired(now) || ls.Holder.Owner != cmd.Owner || ls.Holder.Token != cmd.Token {
+		return renewResult{}, nil
+	}
+	ls.Holder.ExpireAt = now + int64(ls.Holder.TTL)
+	return renewResult{Lease: cloneLease(ls.Holder)}, nil
+}
+
+func (s *Store) applyRelease(cmd releaseCommand) (bool, error) {
+	ls, ok := s.st.Locks[cmd.Name]
+	if !ok || ls.Holder == nil || ls.Holder.Owner != cmd.Owner || ls.Holder.Token != cmd.Token {
+		return false, nil
+	}
+	ls.Holder = nil
+	s.cleanup(cmd.Name, ls)
+	s.notify(cmd.Name)
+	return true, nil
+}
+
+func (s *Store) applyCancel(cmd cancelCommand) (bool, error) {
+	ls, ok := s.st.Locks[cmd.Name]
+	if !ok {
+		return false, nil
+	}
+	for i, w := range ls.Waiters {
+		if w.Owner == cmd.Owner {
+			ls.Waiters = append(ls.Waiters[:i], ls.Waiters[i+1:]...)
+			s.cleanup(cmd.Name, ls)
+			// 队首的等待者可能变化
+			s.notify(cmd.Name)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Snapshot 实现 raftx.State 接口
+func (s *Store) Snapshot(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(s.st)
+}
+
+// Restore 实现 raftx.State 接口
+func (s *Store) Restore(r io.Reader) error {
+	st := &state{}
+	if err := gob.NewDecoder(r).Decode(st); err != nil {
+		return err
+	}
+	if st.Locks == nil {
+		st.Locks = make(map[string]*lockState)
+	}
+	s.st = st
+	return nil
+}
+
+func cloneLease(l *Lease) *Lease {
+	c := *l
+	return &c
+}
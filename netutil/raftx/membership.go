@@ -0,0 +1,382 @@
+package raftx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Jille/raft-grpc-leader-rpc/rafterrors"
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// 等待leader选举完成的重试间隔
+	Leader_Retry_Interval = 50 * time.Millisecond
+)
+
+var (
+	// ErrNotStarted raft 未启动
+	ErrNotStarted = errors.New("raftx: raft is not started")
+	// ErrNoLeader 集群当前没有leader
+	ErrNoLeader = errors.New("raftx: no leader")
+)
+
+// Member 集群配置中的节点信息
+type Member struct {
+	Node
+	Suffrage raft.ServerSuffrage // Voter, Nonvoter or Staging
+	Leader   bool                // 是否为当前leader
+}
+
+// Raft 返回底层 raft.Raft 实例, 未启动时返回nil
+func (r *RaftX) Raft() *raft.Raft {
+	return r.r.Load()
+}
+
+func (r *RaftX) getRaft() (*raft.Raft, error) {
+	ra := r.r.Load()
+	if ra == nil {
+		return nil, ErrNotStarted
+	}
+	return ra, nil
+}
+
+// IsLeader 本节点是否为leader
+func (r *RaftX) IsLeader() bool {
+	ra := r.r.Load()
+	return ra != nil && ra.State() == raft.Leader
+}
+
+// Leader 返回当前leader节点信息, 没有leader时返回ErrNoLeader
+func (r *RaftX) Leader() (Node, error) {
+	ra, err := r.getRaft()
+	if err != nil {
+		return Node{}, err
+	}
+	addr, id := ra.LeaderWithID()
+	if addr == "" {
+		return Node{}, ErrNoLeader
+	}
+	return Node{Id: string(id), Addr: string(addr)}, nil
+}
+
+// WaitLeader 等待直到集群选出leader或ctx结束
+func (r *RaftX) WaitLeader(ctx context.Context) (Node, error) {
+	for {
+		leader, err := r.Leader()
+		if err != ErrNoLeader {
+			return leader, err
+		}
+		if err := sleepContext(ctx, Leader_Retry_Interval); err != nil {
+			return Node{}, err
+		}
+	}
+}
+
+// GetConfiguration 查询集群当前配置, 在follower上调用时从leader查询最新配置
+func (r *RaftX) GetConfiguration(ctx context.Context) ([]Member, error) {
+	ra, err := r.getRaft()
+	if err != nil {
+		return nil, err
+	}
+	leaderAddr, _ := ra.LeaderWithID()
+	if ra.State() == raft.Leader || leaderAddr == "" {
+		f := ra.GetConfiguration()
+		if err := f.Error(); err != nil {
+			return nil, err
+		}
+		return toMembers(f.Configuration().Servers, leaderAddr), nil
+	}
+
+	conn, err := r.clients.conn(string(leaderAddr), r.dialOptions())
+	if err != nil {
+		return nil, err
+	}
+	resp := &configurationResponse{}
+	if err := invokeForwarder(ctx, conn, "Configuration", &configurationRequest{}, resp); err != nil {
+		return nil, err
+	}
+	return toMembers(resp.Servers, leaderAddr), nil
+}
+
+func toMembers(servers []raft.Server, leaderAddr raft.ServerAddress) []Member {
+	members := make([]Member, 0, len(servers))
+	for _, s := range servers {
+		members = append(members, Member{
+			Node:     Node{Id: string(s.ID), Addr: string(s.Address)},
+			Suffrage: s.Suffrage,
+			Leader:   s.Address == leaderAddr,
+		})
+	}
+	return members
+}
+
+// findMember 在集群配置中查找指定id的节点
+func (r *RaftX) findMember(ctx context.Context, id string) (Member, error) {
+	members, err := r.GetConfiguration(ctx)
+	if err != nil {
+		return Member{}, err
+	}
+	for _, m := range members {
+		if m.Id == id {
+			return m, nil
+		}
+	}
+	return Member{}, fmt.Errorf("raftx: node '%s' not found in configuration", id)
+}
+
+// AddVoter 添加有投票权的节点到运行中的集群, 在follower上调用时自动转发到leader
+func (r *RaftX) AddVoter(ctx context.Context, node *Node) error {
+	if node == nil {
+		return fmt.Errorf("node is nil")
+	}
+	return r.forward(ctx, &membershipRequest{Op: membership_Add_Voter, Id: node.Id, Addr: node.Addr})
+}
+
+// AddNonvoter 添加无投票权的节点到运行中的集群, 该节点只同步日志不参与选举
+func (r *RaftX) AddNonvoter(ctx context.Context, node *Node) error {
+	if node == nil {
+		return fmt.Errorf("node is nil")
+	}
+	return r.forward(ctx, &membershipRequest{Op: membership_Add_Nonvoter, Id: node.Id, Addr: node.Addr})
+}
+
+// RemovePeer 从集群中移除节点
+func (r *RaftX) RemovePeer(ctx context.Context, id string) error {
+	return r.forward(ctx, &membershipRequest{Op: membership_Remove, Id: id})
+}
+
+// Promote 将无投票权节点提升为有投票权节点
+func (r *RaftX) Promote(ctx context.Context, id string) error {
+	m, err := r.findMember(ctx, id)
+	if err != nil {
+		return err
+	}
+	if m.Suffrage == raft.Voter {
+		return nil
+	}
+	return r.AddVoter(ctx, &m.Node)
+}
+
+// Demote 取消节点的投票权, 节点保留在集群中继续同步日志
+func (r *RaftX) Demote(ctx context.Context, id string) error {
+	return r.forward(ctx, &membershipRequest{Op: membership_Demote, Id: id})
+}
+
+// TransferLeadership 转移leader到指定节点, id为空时由raft选择最新的节点.
+// 请求发送后leader切换或连接中断时不重试, 返回 ErrApplyUnknown
+func (r *RaftX) TransferLeadership(ctx context.Context, id string) error {
+	if id == "" {
+		return r.forward(ctx, &membershipRequest{Op: membership_Transfer})
+	}
+	m, err := r.findMember(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.forward(ctx, &membershipRequest{Op: membership_Transfer, Id: m.Id, Addr: m.Addr})
+}
+
+// Join 通过集群中任一节点地址将本节点加入运行中的集群, 请求通过forwarder服务转发到leader.
+// 未指定地址时使用 SetResolver 设置的解析器解析到的节点地址
+func (r *RaftX) Join(ctx context.Context, voter bool, addrs ...string) error {
+	if len(addrs) == 0 {
+		peers, err := r.resolvePeers(ctx)
+		if err != nil {
+			return fmt.Errorf("raftx: resolve peers failed: %v", err)
+		}
+		for _, p := range peers {
+			addrs = append(addrs, p.Addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("raftx: no address to join")
+	}
+	var lastErr error
+	for {
+		for _, addr := range addrs {
+			if lastErr = r.joinVia(ctx, voter, addr); lastErr == nil {
+				return nil
+			}
+		}
+		if err := sleepContext(ctx, Leader_Retry_Interval); err != nil {
+			return fmt.Errorf("raftx: join failed: %w, last error: %v", err, lastErr)
+		}
+	}
+}
+
+// joinVia 通过addr节点查询leader, 请求leader将本节点加入集群
+func (r *RaftX) joinVia(ctx context.Context, voter bool, addr string) error {
+	conn, err := r.clients.conn(addr, r.dialOptions())
+	if err != nil {
+		return err
+	}
+	leader := &leaderResponse{}
+	if err := invokeForwarder(ctx, conn, "Leader", &leaderRequest{}, leader); err != nil {
+		return err
+	}
+	if leader.Addr == "" {
+		return ErrNoLeader
+	}
+	conn, err = r.clients.conn(leader.Addr, r.dialOptions())
+	if err != nil {
+		return err
+	}
+	req := &membershipRequest{Op: membership_Add_Nonvoter, Id: r.node.Id, Addr: r.GetAddress(), Timeout: timeoutOf(ctx)}
+	if voter {
+		req.Op = membership_Add_Voter
+	}
+	return invokeForwarder(ctx, conn, "Membership", req, &membershipResponse{})
+}
+
+// forward 本节点是leader时执行成员变更, 否则通过forwarder服务转发到leader执行. leader切换时重试直到ctx结束
+func (r *RaftX) forward(ctx context.Context, req *membershipRequest) error {
+	// 增删节点和取消投票权是幂等的, 结果未知时可以重试; 重试leader转移可能再次转移
+	idempotent := req.Op != membership_Transfer
+	return r.forwardCall(ctx, idempotent, func(ra *raft.Raft) error {
+		return req.future(ra, timeoutOf(ctx)).Error()
+	}, func(conn *grpc.ClientConn) error {
+		req.Timeout = timeoutOf(ctx)
+		return invokeForwarder(ctx, conn, "Membership", req, &membershipResponse{})
+	})
+}
+
+const (
+	membership_Add_Voter = iota + 1
+	membership_Add_Nonvoter
+	membership_Remove
+	membership_Demote
+	membership_Transfer // Id为空时由raft选择转移的节点
+)
+
+type membershipRequest struct {
+	Op      int
+	Id      string
+	Addr    string
+	Timeout time.Duration
+}
+
+type membershipResponse struct{}
+
+type configurationRequest struct{}
+
+type configurationResponse struct {
+	Servers []raft.Server
+}
+
+// future 在leader上执行成员变更
+func (m *membershipRequest) future(ra *raft.Raft, timeout time.Duration) raft.Future {
+	id, addr := raft.ServerID(m.Id), raft.ServerAddress(m.Addr)
+	switch m.Op {
+	case membership_Add_Voter:
+		return ra.AddVoter(id, addr, 0, timeout)
+	case membership_Add_Nonvoter:
+		return ra.AddNonvoter(id, addr, 0, timeout)
+	case membership_Remove:
+		return ra.RemoveServer(id, 0, timeout)
+	case membership_Demote:
+		return ra.DemoteVoter(id, 0, timeout)
+	case membership_Transfer:
+		if m.Id == "" {
+			return ra.LeadershipTransfer()
+		}
+		return ra.LeadershipTransferToServer(id, addr)
+	}
+	return errorFuture{fmt.Errorf("raftx: unknown membership operation %d", m.Op)}
+}
+
+// errorFuture 直接返回错误的 raft.Future
+type errorFuture struct {
+	err error
+}
+
+func (e errorFuture) Error() error {
+	return e.err
+}
+
+func (f *forwarder) membership(ctx context.Context, req *membershipRequest) (*membershipResponse, error) {
+	ra, err := f.r.getRaft()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if err := req.future(ra, req.Timeout).Error(); err != nil {
+		return nil, rafterrors.MarkRetriable(err)
+	}
+	return &membershipResponse{}, nil
+}
+
+func (f *forwarder) configuration(ctx context.Context, req *configurationRequest) (*configurationResponse, error) {
+	ra, err := f.r.getRaft()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if ra.State() != raft.Leader {
+		return nil, rafterrors.MarkRetriable(raft.ErrNotLeader)
+	}
+	future := ra.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, rafterrors.MarkRetriable(err)
+	}
+	return &configurationResponse{Servers: future.Configuration().Servers}, nil
+}
+
+// timeoutOf 返回ctx剩余时间作为raft操作超时时间, 无deadline时返回0表示不超时
+func timeoutOf(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		if d := time.Until(deadline); d > 0 {
+			return d
+		}
+		return time.Nanosecond
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// clientCache 缓存到其它节点的grpc连接
+type clientCache struct {
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func newClientCache() *clientCache {
+	return &clientCache{conns: make(map[string]*grpc.ClientConn)}
+}
+
+// conn 返回到addr的grpc连接, 不存在时创建
+func (cc *clientCache) conn(addr string, opts []grpc.DialOption) (*grpc.ClientConn, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if c, ok := cc.conns[addr]; ok {
+		return c, nil
+	}
+	c, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	cc.conns[addr] = c
+	return c, nil
+}
+
+// close 关闭所有连接
+func (cc *clientCache) close() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for addr, c := range cc.conns {
+		c.Close()
+		delete(cc.conns, addr)
+	}
+}
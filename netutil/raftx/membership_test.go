@@ -0,0 +1,78 @@
+package raftx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/netutil/raftx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func suffrageOf(members []raftx.Member) map[string]raft.ServerSuffrage {
+	ret := make(map[string]raft.ServerSuffrage)
+	for _, m := range members {
+		ret[m.Id] = m.Suffrage
+	}
+	return ret
+}
+
+func TestMembership(t *testing.T) {
+	Convey("Test dynamic membership", t, func() {
+		dir := t.TempDir()
+		n1, _, stop1 := startTestNode(dir, "n1", true)
+		defer stop1()
+		n2, _, stop2 := startTestNode(dir, "n2", false)
+		defer stop2()
+		n3, _, stop3 := startTestNode(dir, "n3", false)
+		defer stop3()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		leader, err := n1.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(leader.Id, ShouldEqual, "n1")
+
+		// join through an existing member
+		So(n2.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+		So(n3.Join(ctx, false, n1.GetAddress()), ShouldBeNil)
+		_, err = n2.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+
+		// query on follower is forwarded to leader
+		members, err := n2.GetConfiguration(ctx)
+		So(err, ShouldBeNil)
+		So(suffrageOf(members), ShouldResemble, map[string]raft.ServerSuffrage{"n1": raft.Voter, "n2": raft.Voter, "n3": raft.Nonvoter})
+
+		// change membership on follower
+		So(n2.Promote(ctx, "n3"), ShouldBeNil)
+		So(n3.Demote(ctx, "n2"), ShouldBeNil)
+		members, err = n1.GetConfiguration(ctx)
+		So(err, ShouldBeNil)
+		So(suffrageOf(members), ShouldResemble, map[string]raft.ServerSuffrage{"n1": raft.Voter, "n2": raft.Nonvoter, "n3": raft.Voter})
+
+		So(n2.TransferLeadership(ctx, "n3"), ShouldBeNil)
+		for !n3.IsLeader() && ctx.Err() == nil {
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(n3.IsLeader(), ShouldBeTrue)
+
+		So(n1.RemovePeer(ctx, "n2"), ShouldBeNil)
+		members, err = n3.GetConfiguration(ctx)
+		So(err, ShouldBeNil)
+		So(suffrageOf(members), ShouldResemble, map[string]raft.ServerSuffrage{"n1": raft.Voter, "n3": raft.Voter})
+
+		_, err = n1.GetConfiguration(ctx)
+		So(err, ShouldBeNil)
+		So(n1.Promote(ctx, "n9"), ShouldNotBeNil)
+	})
+
+	Convey("Test not started", t, func() {
+		r, err := raftx.NewRaftX(&raftx.Node{Id: "x", Addr: "127.0.0.1:0"}, false, &testFSM{})
+		So(err, ShouldBeNil)
+		So(r.RemovePeer(context.Background(), "y"), ShouldEqual, raftx.ErrNotStarted)
+		_, err = r.Leader()
+		So(err, ShouldEqual, raftx.ErrNotStarted)
+	})
+}
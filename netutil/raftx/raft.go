@@ -2,21 +2,22 @@
 package raftx
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net"
 	"os"
-	"path/filepath"
-	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/Jille/raft-grpc-leader-rpc/leaderhealth"
 	transport "github.com/Jille/raft-grpc-transport"
 	"github.com/Jille/raftadmin"
 	"github.com/hashicorp/raft"
-	boltdb "github.com/hashicorp/raft-boltdb"
 	"github.com/jhunters/goassist/stringutil"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -33,7 +34,7 @@ const (
 // Node 实例节点信息
 type Node struct {
 	Id   string // 节点id
-	Addr string // 节点地址
+	Addr string // 节点通告地址, 其它节点通过该地址访问本节点
 	Desc string // 描述说明
 }
 
@@ -61,6 +62,27 @@ type RaftX struct {
 	// 集群其它节点列表
 	peers []*Node
 
+	// grpc服务监听地址, 为空时监听所有网卡上的 localport
+	bindAddr string
+
+	// 节点地址解析器和检查通告地址变化的间隔
+	resolver            Resolver
+	addressSyncInterval time.Duration
+
+	// 自定义存储, 为nil时使用数据目录下的boltdb和文件快照存储
+	logStore      raft.LogStore
+	stableStore   raft.StableStore
+	snapshotStore raft.SnapshotStore
+
+	// 是否使用内存存储, 用于单元测试
+	inmemStore bool
+
+	// 文件快照保留数量
+	snapshotRetain int
+
+	// 日志缓存大小, 0表示不使用缓存
+	logCacheSize int
+
 	// 标记RaftX是否已启动的原子布尔值
 	started atomic.Bool
 
@@ -79,11 +101,49 @@ type RaftX struct {
 	// 有限状态机（FSM）
 	fsm raft.FSM
 
-	// Raft 实例指针
-	r *raft.Raft
+	// Raft 实例指针, 启动后设置
+	r atomic.Pointer[raft.Raft]
+
+	// 转发请求到leader使用的grpc连接缓存
+	clients *clientCache
+
+	// LinearizableRead 的模式
+	readMode atomic.Int32
+
+	// 租约读模式下leader租约到期时间, unix纳秒
+	leaseUntil atomic.Int64
+
+	// 已通过barrier确认提交了本任期日志的任期, 此后leader的commit index包含之前任期提交的所有日志
+	barrierTerm atomic.Uint64
 
 	// 是否为引导Raft集群的标记
 	raftBootstrap bool
+
+	// 节点间通讯的TLS配置和认证token
+	tlsServer        *tls.Config
+	tlsClient        *tls.Config
+	authToken        string
+	extraDialOptions []grpc.DialOption
+
+	// 运行状态, 启动后设置
+	tm           *transport.Manager
+	grpcServer   *grpc.Server
+	closers      []io.Closer   // 需要在关闭时释放的存储
+	logs         raft.LogStore // raft使用的日志存储
+	snaps        raft.SnapshotStore
+	applied      atomic.Uint64 // FSM 已执行的最后一条日志的index
+	serveDone    chan struct{} // grpc服务停止时关闭
+	serveErr     error
+	stopC        chan struct{} // 关闭时通知事件监听退出
+	observer     *raft.Observer
+	shutdownOnce sync.Once
+	shutdownErr  error
+
+	// 事件回调函数
+	hooksMu     sync.Mutex
+	leaderHooks []func(leader Node, isLeader bool)
+	joinHooks   []func(peer Node)
+	leaveHooks  []func(peer Node)
 }
 
 // NewRaftX 函数用于创建一个新的RaftX实例。
@@ -137,7 +197,8 @@ func NewRaftXWithConfig(c *raft.Config, node *Node, raftBootstrap bool, fsm raft
 		return nil, err
 	}
 
-	if stringutil.IsBlank(host) || host == LOCAL_HOST {
+	// 通告地址未指定主机时使用主机名
+	if stringutil.IsBlank(host) {
 		host, err = os.Hostname()
 		if err != nil {
 			return nil, err
@@ -148,9 +209,14 @@ func NewRaftXWithConfig(c *raft.Config, node *Node, raftBootstrap bool, fsm raft
 	r.localip = host
 	r.localport = port
 	r.dataDir = RAFT_DATA_DIR
+	r.snapshotRetain = Default_Snapshot_Retain
 
 	// default set peers to empty
 	r.peers = make([]*Node, 0)
+	r.clients = newClientCache()
+	r.readMode.Store(Read_Index)
+	r.serveDone = make(chan struct{})
+	r.stopC = make(chan struct{})
 
 	return r, nil
 
@@ -194,6 +260,7 @@ func (r *RaftX) SetHealthService(name string) error {
 	return nil
 }
 
+// EnableRaftAdmin 注册raftadmin管理服务供命令行工具使用, 设置 SetAuthToken 后只有使用 ServerOptions 创建的grpc服务才校验token. 成员变更和 Join 通过forwarder服务转发, 不依赖该服务
 func (r *RaftX) EnableRaftAdmin() {
 	r.raftadmin = true
 }
@@ -202,8 +269,27 @@ func (r *RaftX) EnableRefelctionService() {
 	r.reflectionService = true
 }
 
-// Start 启动 RaftX 实例，并返回一个 raft.Raft 实例
+// Start 启动 RaftX 实例并监听 ":port", 阻塞直到grpc服务停止. 非阻塞启动使用 StartWithListener
 func (r *RaftX) Start(s *grpc.Server, fn func(*RaftWrapper)) error {
+	// 启动网络服务监听, 未设置监听地址时监听所有网卡
+	bind := r.bindAddr
+	if bind == "" {
+		bind = fmt.Sprintf(":%s", r.localport)
+	}
+	sock, err := net.Listen("tcp", bind)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %v", err)
+	}
+	if err := r.StartWithListener(s, sock, fn); err != nil {
+		sock.Close()
+		return err
+	}
+	return r.Wait()
+}
+
+// StartWithListener 启动 RaftX 实例, 在后台使用已有的监听l启动grpc服务后立即返回.
+// fn 在grpc服务启动前回调, 可用于注册业务服务, 可以为nil. 启动失败后 Wait 返回启动的错误
+func (r *RaftX) StartWithListener(s *grpc.Server, l net.Listener, fn func(*RaftWrapper)) (err error) {
 	if r == nil || r.config == nil {
 		return fmt.Errorf("raftx is nil or config is nil")
 	}
@@ -212,58 +298,66 @@ func (r *RaftX) Start(s *grpc.Server, fn func(*RaftWrapper)) error {
 		return fmt.Errorf("grpc server is nil")
 	}
 
+	if l == nil {
+		return fmt.Errorf("listener is nil")
+	}
+
 	if !r.started.CompareAndSwap(false, true) {
 		return fmt.Errorf("raftx is already started")
 	}
+	defer func() {
+		if err != nil {
+			// grpc服务不会启动, 结束 Wait
+			r.serveErr = err
+			close(r.serveDone)
+		}
+	}()
 
-	// 数据存储目录
-	baseDir := filepath.Join(r.dataDir, string(r.config.LocalID))
-	os.MkdirAll(baseDir, os.ModeDir)
-
-	// 使用 boltdb进行wal日志存储
-	// 1 存储 配置信息 rafe.Configuration 包含集群信息 LogType=LogConfiguration。包含集群的配置信息。 在启动时用于加载集群信息，进configuration.latest字段
-	// 2 存储 wal日志信息 LogType=LogCommand 包含命令， 状态机执行结果
-	wal, err := boltdb.NewBoltStore(filepath.Join(baseDir, Logs_File))
+	wal, sdb, fss, err := r.openStores()
 	if err != nil {
-		return fmt.Errorf(`boltdb.NewBoltStore(%q): %v`, filepath.Join(baseDir, Logs_File), err)
+		return err
 	}
 
-	// 使用 boltdb进行 stable 存储 内容包含 最后的投票节点信息LastVoteCand，CurrentTerm LastVoteTerm
-	sdb, err := boltdb.NewBoltStore(filepath.Join(baseDir, Stable_File))
-	if err != nil {
-		return fmt.Errorf(`boltdb.NewBoltStore(%q): %v`, filepath.Join(baseDir, Stable_File), err)
-	}
+	// 创建 grpc 传输 transport.Manager 对象， 实现了 raft 接口同步协议实现
+	tm := transport.New(raft.ServerAddress(r.GetAddress()), r.dialOptions())
 
-	// snap 数据目录
-	// mss := raft.NewInmemSnapshotStore() // 仅使用内存的snapshot
-	fss, err := raft.NewFileSnapshotStore(baseDir, 3, os.Stderr)
-	if err != nil {
-		return fmt.Errorf(`raft.NewFileSnapshotStore(%q, ...): %v`, baseDir, err)
+	// 数据目录下存在 Peers_File 时强制设置集群配置
+	if err := r.recoverIfNeed(wal, sdb, fss, tm.Transport()); err != nil {
+		tm.Close()
+		r.closeStores()
+		return err
 	}
 
-	// 创建 grpc 传输 transport.Manager 对象， 实现了 raft 接口同步协议实现
-	tm := transport.New(raft.ServerAddress(r.GetAddress()),
-		[]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
-
 	// fsm 需要实现日志同步的接口
-	r.r, err = raft.NewRaft(r.config, r.fsm, wal, sdb, fss, tm.Transport())
+	ra, err := raft.NewRaft(r.config, r.wrapFSM(), wal, sdb, fss, addressTransport{tm.Transport()})
 	if err != nil {
+		tm.Close()
+		r.closeStores()
 		return fmt.Errorf("raft.NewRaft: %v", err)
 	}
+	r.tm = tm
+	r.logs = wal
+	r.snaps = fss
+	r.grpcServer = s
+	r.r.Store(ra)
 
 	// 使用grpc作为 raft 通讯服务
-	tm.Register(s)
+	registrar := &authRegistrar{r: r, s: s}
+	tm.Register(&transportRegistrar{s: registrar, stopC: r.stopC})
+
+	// 注册转发服务, 用于follower转发请求到leader
+	registrar.RegisterService(&forwarderServiceDesc, &forwarder{r})
 
 	if r.healthService {
 		// 注册健康检查服务
 		services := []string{r.healthServiceName}
 		// 创建  建康心跳服务， 会发布 CacheManager 和 quis.RaftLeader 服务， 由grpc在负载时检测
-		leaderhealth.Setup(r.r, s, services)
+		leaderhealth.Setup(ra, s, services)
 	}
 
 	if r.raftadmin {
 		// 注册 raft管理服务， 工具可用 go get github.com/Jille/raftadmin 安装后，提供命令行功能方式管理
-		raftadmin.Register(s, r.r)
+		raftadmin.Register(s, ra)
 	}
 
 	if r.reflectionService {
@@ -272,26 +366,33 @@ func (r *RaftX) Start(s *grpc.Server, fn func(*RaftWrapper)) error {
 		reflection.Register(s)
 	}
 
+	// 监听leader和集群节点变化, 回调事件函数
+	r.watch(ra)
+
+	// 检查节点通告地址变化, 更新集群配置
+	r.syncAddresses(ra)
+
 	// 判断是否作为集群bootstrap节点启动，  配置 Servers 添加 ID和Address
 	if r.raftBootstrap {
 		err = r.startWithBootstrapIfNeed(wal, sdb, fss)
 		if err != nil {
+			r.Shutdown(context.Background())
 			return err
 		}
 	}
 
 	// call back FSM 接口
-	fn(&RaftWrapper{r.r, *r.node})
-
-	// 启动网络服务监听
-	sock, err := net.Listen("tcp", fmt.Sprintf(":%s", r.localport) /* r.getAddress() */)
-	if err != nil {
-		return fmt.Errorf("failed to listen: %v", err)
+	if fn != nil {
+		fn(&RaftWrapper{ra, *r.node})
 	}
+
 	// 启动rpc服务， 绑定socket监听
-	if err := s.Serve(sock); err != nil {
-		return fmt.Errorf("failed to listen: %v", err)
-	}
+	go func() {
+		defer close(r.serveDone)
+		if err := s.Serve(l); err != nil {
+			r.serveErr = fmt.Errorf("failed to serve: %v", err)
+		}
+	}()
 
 	return nil
 }
@@ -338,11 +439,19 @@ func (r *RaftX) startWithBootstrapIfNeed(logs raft.LogStore, stable raft.StableS
 		},
 	}
 
-	// 添加peer信息
-	processPeers(&cfg, r.peers)
+	// 添加peer信息, 包括解析器解析到的节点
+	peers := r.peers
+	resolved, err := r.resolvePeers(context.Background())
+	if err != nil {
+		return fmt.Errorf("raftx: resolve peers failed: %v", err)
+	}
+	for i := range resolved {
+		peers = append(peers, &resolved[i])
+	}
+	processPeers(&cfg, peers)
 
 	// 作为集群bootstrap节点的模式设置, 只有第一次启动生效，一旦集群信息写入db后，就不能再调用BootstrapCluster方法
-	f := r.r.BootstrapCluster(cfg)
+	f := r.r.Load().BootstrapCluster(cfg)
 	if err := f.Error(); err != nil {
 		e := fmt.Errorf("raft.Raft.BootstrapCluster: %v", err)
 		return e
@@ -360,14 +469,19 @@ func (r *RaftX) startWithBootstrapIfNeed(logs raft.LogStore, stable raft.StableS
 // 返回值：
 // 无
 func processPeers(cfg *raft.Configuration, peers []*Node) {
+	exists := make(map[raft.ServerID]bool)
+	for _, s := range cfg.Servers {
+		exists[s.ID] = true
+	}
 	for _, n := range peers {
-
-		host, _ := os.Hostname()
-		addr := strings.Replace(n.Addr, LOCAL_HOST, host, 1)
+		if exists[raft.ServerID(n.Id)] {
+			continue
+		}
+		exists[raft.ServerID(n.Id)] = true
 
 		cfg.Servers = append(cfg.Servers, raft.Server{
 			ID:       raft.ServerID(n.Id),
-			Address:  raft.ServerAddress(addr),
+			Address:  raft.ServerAddress(n.Addr),
 			Suffrage: raft.Voter,
 		})
 	}
@@ -0,0 +1,404 @@
+// Package raftxtest 在单个进程中启动多个raftx节点的测试工具, 节点之间使用内存网络和内存存储,
+// 支持网络分区和恢复, 停止和重启节点, 等待leader选举以及校验日志收敛.
+package raftxtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/netutil"
+	"github.com/jhunters/goassist/netutil/raftx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	// 内存网络连接的缓冲大小
+	Buffer_Size = 1 << 20
+
+	// 节点地址的端口, 节点地址为 "<id>:<port>"
+	Node_Port = "7000"
+
+	// 等待时的检查间隔
+	Poll_Interval = 10 * time.Millisecond
+)
+
+var (
+	ErrNodeNotFound = errors.New("raftxtest: node not found")
+	ErrNodeRunning  = errors.New("raftxtest: node is running")
+	ErrNodeStopped  = errors.New("raftxtest: node is stopped")
+)
+
+// Config 集群配置
+type Config struct {
+	Nodes int                      // 节点数量, 节点id为 n1, n2, ...
+	FSM   func(id string) raft.FSM // 创建节点的FSM, 节点每次启动时调用
+	// Raft 创建节点的raft配置, 为nil时使用 FastConfig
+	Raft func() *raft.Config
+	// Customize 节点启动前调用, 可用于设置raftx选项, 不能修改存储和dial选项
+	Customize func(r *raftx.RaftX) error
+}
+
+// FastConfig 返回选举和心跳超时较短的raft配置, 日志输出被丢弃
+func FastConfig() *raft.Config {
+	c := raft.DefaultConfig()
+	c.HeartbeatTimeout = 100 * time.Millisecond
+	c.ElectionTimeout = 100 * time.Millisecond
+	c.LeaderLeaseTimeout = 50 * time.Millisecond
+	c.CommitTimeout = 5 * time.Millisecond
+	c.LogOutput = io.Discard
+	return c
+}
+
+// Node 集群中的节点, 停止后存储被保留, 重启时从存储恢复
+type Node struct {
+	ID   string
+	Addr string
+
+	cluster *Cluster
+	fi      *netutil.FaultInjector // 注入本节点发起的连接
+
+	logs   raft.LogStore
+	stable raft.StableStore
+	snaps  raft.SnapshotStore
+
+	mu       sync.Mutex
+	r        *raftx.RaftX
+	fsm      raft.FSM
+	listener *bufconn.Listener
+}
+
+// RaftX 返回节点当前的raftx实例, 每次重启后为新的实例
+func (n *Node) RaftX() *raftx.RaftX {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.r
+}
+
+// FSM 返回节点当前的FSM
+func (n *Node) FSM() raft.FSM {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.fsm
+}
+
+// Running 返回节点是否在运行
+func (n *Node) Running() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.listener != nil
+}
+
+// dial 通过内存网络连接addr, 连接注入本节点的网络故障
+func (n *Node) dial(ctx context.Context, addr string) (net.Conn, error) {
+	return n.fi.Dialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		target := n.cluster.Node(addr)
+		if target == nil {
+			return nil, fmt.Errorf("raftxtest: unknown address %s", addr)
+		}
+		target.mu.Lock()
+		l := target.listener
+		target.mu.Unlock()
+		if l == nil {
+			return nil, fmt.Errorf("raftxtest: dial %s: %w", addr, ErrNodeStopped)
+		}
+		return l.DialContext(ctx)
+	})(ctx, "bufconn", addr)
+}
+
+// Cluster 进程内的raftx集群
+type Cluster struct {
+	config Config
+	nodes  []*Node
+}
+
+// NewCluster 创建并启动集群, 第一个节点使用全部节点的配置引导集群
+func NewCluster(config Config) (*Cluster, error) {
+	if config.Nodes <= 0 {
+		return nil, fmt.Errorf("raftxtest: invalid nodes count %d", config.Nodes)
+	}
+	if config.FSM == nil {
+		return nil, fmt.Errorf("raftxtest: fsm factory is nil")
+	}
+	if config.Raft == nil {
+		config.Raft = FastConfig
+	}
+	c := &Cluster{config: config}
+	for i := 1; i <= config.Nodes; i++ {
+		id := fmt.Sprintf("n%d", i)
+		c.nodes = append(c.nodes, &Node{
+			ID:      id,
+			Addr:    net.JoinHostPort(id, Node_Port),
+			cluster: c,
+			fi:      netutil.NewFaultInjector(),
+			logs:    raft.NewInmemStore(),
+			stable:  raft.NewInmemStore(),
+			snaps:   raft.NewInmemSnapshotStore(),
+		})
+	}
+	for _, n := range c.nodes {
+		if err := c.start(n); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Nodes 返回所有节点
+func (c *Cluster) Nodes() []*Node {
+	return append([]*Node(nil), c.nodes...)
+}
+
+// Node 按id或地址返回节点, 不存在时返回nil
+func (c *Cluster) Node(idOrAddr string) *Node {
+	for _, n := range c.nodes {
+		if n.ID == idOrAddr || n.Addr == idOrAddr {
+			return n
+		}
+	}
+	return nil
+}
+
+// Close 停止所有节点
+func (c *Cluster) Close() {
+	for _, n := range c.nodes {
+		if n.Running() {
+			c.Kill(n.ID)
+		}
+	}
+}
+
+func (c *Cluster) start(n *Node) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.listener != nil {
+		return ErrNodeRunning
+	}
+
+	fsm := c.config.FSM(n.ID)
+	bootstrap := n == c.nodes[0]
+	r, err := raftx.NewRaftXWithConfig(c.config.Raft(), &raftx.Node{Id: n.ID, Addr: n.Addr}, bootstrap, fsm)
+	if err != nil {
+		return err
+	}
+	if bootstrap {
+		for _, peer := range c.nodes[1:] {
+			r.AddPeer(&raftx.Node{Id: peer.ID, Addr: peer.Addr})
+		}
+	}
+	r.SetLogStore(n.logs)
+	r.SetStableStore(n.stable)
+	r.SetSnapshotStore(n.snaps)
+	// 快速重连, 分区恢复后尽快恢复通讯
+	r.SetDialOptions(grpc.WithContextDialer(n.dial), grpc.WithConnectParams(grpc.ConnectParams{
+		Backoff:           backoff.Config{BaseDelay: 20 * time.Millisecond, Multiplier: 1.6, MaxDelay: 200 * time.Millisecond},
+		MinConnectTimeout: time.Second,
+	}))
+	if c.config.Customize != nil {
+		if err := c.config.Customize(r); err != nil {
+			return err
+		}
+	}
+
+	l := bufconn.Listen(Buffer_Size)
+	if err := r.StartWithListener(grpc.NewServer(r.ServerOptions()...), l, nil); err != nil {
+		l.Close()
+		return err
+	}
+	n.r, n.fsm, n.listener = r, fsm, l
+	return nil
+}
+
+// Kill 立即停止节点, 保留存储
+func (c *Cluster) Kill(id string) error {
+	n := c.Node(id)
+	if n == nil {
+		return ErrNodeNotFound
+	}
+	n.mu.Lock()
+	r, l := n.r, n.listener
+	n.listener = nil
+	n.mu.Unlock()
+	if l == nil {
+		return ErrNodeStopped
+	}
+	err := r.Stop()
+	l.Close()
+	n.fi.DisconnectAll()
+	return err
+}
+
+// Restart 使用保留的存储重新启动已停止的节点, 创建新的raftx实例和FSM
+func (c *Cluster) Restart(id string) error {
+	n := c.Node(id)
+	if n == nil {
+		return ErrNodeNotFound
+	}
+	return c.start(n)
+}
+
+// Partition 将ids中的节点与其它节点隔离, 分区内的节点之间可以通讯. 已有连接被断开, 新的连接失败直到 Heal
+func (c *Cluster) Partition(ids ...string) error {
+	group := make(map[*Node]bool)
+	for _, id := range ids {
+		n := c.Node(id)
+		if n == nil {
+			return ErrNodeNotFound
+		}
+		group[n] = true
+	}
+	for _, n := range c.nodes {
+		for _, peer := range c.nodes {
+			if group[n] != group[peer] {
+				n.fi.Partition(peer.Addr)
+			}
+		}
+	}
+	for _, n := range c.nodes {
+		n.fi.DisconnectAll()
+	}
+	return nil
+}
+
+// Heal 恢复所有网络分区
+func (c *Cluster) Heal() {
+	for _, n := range c.nodes {
+		n.fi.Heal()
+	}
+}
+
+// Running 返回运行中的节点
+func (c *Cluster) Running() []*Node {
+	var ret []*Node
+	for _, n := range c.nodes {
+		if n.Running() {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+// Leader 返回运行中的节点里被多数节点认可的leader, 没有时返回nil
+func (c *Cluster) Leader() *Node {
+	votes := make(map[string]int)
+	for _, n := range c.Running() {
+		if leader, err := n.RaftX().Leader(); err == nil && leader.Id != "" {
+			votes[leader.Id]++
+		}
+	}
+	for id, count := range votes {
+		n := c.Node(id)
+		if count > len(c.nodes)/2 && n.Running() && n.RaftX().IsLeader() {
+			return n
+		}
+	}
+	return nil
+}
+
+// WaitLeader 等待多数节点认可的leader产生
+func (c *Cluster) WaitLeader(ctx context.Context) (*Node, error) {
+	for {
+		if n := c.Leader(); n != nil {
+			return n, nil
+		}
+		if err := sleep(ctx); err != nil {
+			return nil, fmt.Errorf("raftxtest: wait leader: %w", err)
+		}
+	}
+}
+
+// WaitConverged 等待所有运行中节点的日志一致并且都已应用到FSM
+func (c *Cluster) WaitConverged(ctx context.Context) error {
+	for {
+		err := c.CheckConverged()
+		if err == nil {
+			// raft 的 AppliedIndex 在FSM执行完成前更新, 通过线性一致读等待FSM执行完成
+			err = c.waitApplied(ctx)
+		}
+		if err == nil {
+			return nil
+		}
+		if e := sleep(ctx); e != nil {
+			return fmt.Errorf("raftxtest: wait converged: %w, last error: %v", e, err)
+		}
+	}
+}
+
+func (c *Cluster) waitApplied(ctx context.Context) error {
+	for _, n := range c.Running() {
+		readCtx, cancel := context.WithTimeout(ctx, time.Second)
+		err := n.RaftX().LinearizableRead(readCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("linearizable read on %s: %v", n.ID, err)
+		}
+	}
+	return c.CheckConverged()
+}
+
+// CheckConverged 检查所有运行中节点的日志一致并且raft已应用, 不一致时返回错误描述
+func (c *Cluster) CheckConverged() error {
+	nodes := c.Running()
+	if len(nodes) == 0 {
+		return nil
+	}
+	first := nodes[0]
+	lastIndex := first.RaftX().Raft().LastIndex()
+	for _, n := range nodes {
+		ra := n.RaftX().Raft()
+		if ra.LastIndex() != lastIndex {
+			return fmt.Errorf("last index of %s is %d, %s is %d", n.ID, ra.LastIndex(), first.ID, lastIndex)
+		}
+		if ra.AppliedIndex() != lastIndex {
+			return fmt.Errorf("applied index of %s is %d, last index is %d", n.ID, ra.AppliedIndex(), lastIndex)
+		}
+	}
+
+	// 比较所有节点都保留的日志
+	var low uint64
+	for _, n := range nodes {
+		index, err := n.logs.FirstIndex()
+		if err != nil {
+			return err
+		}
+		if index > low {
+			low = index
+		}
+	}
+	if low == 0 {
+		return nil
+	}
+	for index := low; index <= lastIndex; index++ {
+		var expected raft.Log
+		if err := first.logs.GetLog(index, &expected); err != nil {
+			return fmt.Errorf("get log %d of %s: %v", index, first.ID, err)
+		}
+		for _, n := range nodes[1:] {
+			var l raft.Log
+			if err := n.logs.GetLog(index, &l); err != nil {
+				return fmt.Errorf("get log %d of %s: %v", index, n.ID, err)
+			}
+			if l.Term != expected.Term || l.Type != expected.Type || string(l.Data) != string(expected.Data) {
+				return fmt.Errorf("log %d of %s is different from %s", index, n.ID, first.ID)
+			}
+		}
+	}
+	return nil
+}
+
+func sleep(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(Poll_Interval):
+		return nil
+	}
+}
@@ -0,0 +1,143 @@
+package raftxtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/netutil/raftx/raftxtest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// listFSM records applied commands
+type listFSM struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (f *listFSM) Apply(l *raft.Log) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logs = append(f.logs, string(l.Data))
+	return len(f.logs)
+}
+
+func (f *listFSM) Logs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.logs...)
+}
+
+func (f *listFSM) Snapshot() (raft.FSMSnapshot, error) {
+	return &listSnapshot{logs: f.Logs()}, nil
+}
+
+func (f *listFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	var logs []string
+	if err := json.NewDecoder(rc).Decode(&logs); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logs = logs
+	return nil
+}
+
+type listSnapshot struct {
+	logs []string
+}
+
+func (s *listSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := json.NewEncoder(sink).Encode(s.logs); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *listSnapshot) Release() {}
+
+func logsOf(n *raftxtest.Node) []string {
+	return n.FSM().(*listFSM).Logs()
+}
+
+func TestCluster(t *testing.T) {
+	Convey("Test in-process cluster", t, func() {
+		c, err := raftxtest.NewCluster(raftxtest.Config{Nodes: 3, FSM: func(string) raft.FSM { return &listFSM{} }})
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		leader, err := c.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(leader.ID, ShouldEqual, "n1")
+
+		// apply through a follower
+		_, err = c.Node("n2").RaftX().Apply(ctx, []byte("a"), nil)
+		So(err, ShouldBeNil)
+		So(c.WaitConverged(ctx), ShouldBeNil)
+		for _, n := range c.Nodes() {
+			So(logsOf(n), ShouldResemble, []string{"a"})
+		}
+
+		Convey("partition and heal", func() {
+			So(c.Partition(leader.ID), ShouldBeNil)
+			var newLeader *raftxtest.Node
+			for newLeader == nil || newLeader == leader {
+				newLeader, err = c.WaitLeader(ctx)
+				So(err, ShouldBeNil)
+			}
+			_, err = newLeader.RaftX().Apply(ctx, []byte("b"), nil)
+			So(err, ShouldBeNil)
+			So(c.CheckConverged(), ShouldNotBeNil)
+			So(logsOf(leader), ShouldResemble, []string{"a"})
+
+			c.Heal()
+			So(c.WaitConverged(ctx), ShouldBeNil)
+			So(logsOf(leader), ShouldResemble, []string{"a", "b"})
+		})
+
+		Convey("kill and restart", func() {
+			So(c.Kill("n3"), ShouldBeNil)
+			So(c.Kill("n3"), ShouldEqual, raftxtest.ErrNodeStopped)
+			So(c.Node("n3").Running(), ShouldBeFalse)
+			_, err = leader.RaftX().Apply(ctx, []byte("b"), nil)
+			So(err, ShouldBeNil)
+			So(leader.RaftX().Raft().Snapshot().Error(), ShouldBeNil)
+			_, err = leader.RaftX().Apply(ctx, []byte("c"), nil)
+			So(err, ShouldBeNil)
+			So(c.WaitConverged(ctx), ShouldBeNil)
+
+			So(c.Restart("n3"), ShouldBeNil)
+			So(c.Restart("n3"), ShouldEqual, raftxtest.ErrNodeRunning)
+			So(c.WaitConverged(ctx), ShouldBeNil)
+			So(logsOf(c.Node("n3")), ShouldResemble, []string{"a", "b", "c"})
+
+			// kill leader, the rest elect a new one
+			So(c.Kill(leader.ID), ShouldBeNil)
+			newLeader, err := c.WaitLeader(ctx)
+			So(err, ShouldBeNil)
+			So(newLeader.ID, ShouldNotEqual, leader.ID)
+			_, err = newLeader.RaftX().Apply(ctx, []byte("d"), nil)
+			So(err, ShouldBeNil)
+			So(c.Restart(leader.ID), ShouldBeNil)
+			So(c.WaitConverged(ctx), ShouldBeNil)
+			So(logsOf(c.Node(leader.ID)), ShouldResemble, []string{"a", "b", "c", "d"})
+		})
+
+		So(c.Kill("n9"), ShouldEqual, raftxtest.ErrNodeNotFound)
+	})
+
+	Convey("Test invalid config", t, func() {
+		_, err := raftxtest.NewCluster(raftxtest.Config{Nodes: 0})
+		So(err, ShouldNotBeNil)
+		_, err = raftxtest.NewCluster(raftxtest.Config{Nodes: 1})
+		So(err, ShouldNotBeNil)
+	})
+}
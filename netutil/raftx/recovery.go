@@ -0,0 +1,421 @@
+package raftx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/raft"
+	boltdb "github.com/hashicorp/raft-boltdb"
+)
+
+const (
+	// Peers_File 节点数据目录下存在该文件时, 启动前按文件中的节点强制设置集群配置, 格式与 FileResolver 相同.
+	// 恢复完成后文件重命名为 Peers_Info_File
+	Peers_File = "peers.json"
+
+	Peers_Info_File = "peers.info"
+
+	// Open_Timeout 离线打开boltdb等待文件锁的超时时间, 节点运行中时打开失败
+	Open_Timeout = time.Second
+
+	snapshot_Archive_Magic = "raftx-snapshot-v1\n"
+)
+
+var (
+	// ErrSnapshotCorrupt 快照备份文件格式错误或校验失败
+	ErrSnapshotCorrupt = errors.New("raftx: snapshot archive is corrupt")
+	// ErrNoSnapshot 没有可用的快照
+	ErrNoSnapshot = errors.New("raftx: no snapshot")
+	// ErrDataDirReadOnly 只读打开的数据目录不能修改
+	ErrDataDirReadOnly = errors.New("raftx: data dir is opened read only")
+)
+
+// DataDir 离线访问已停止节点的数据目录, 用于灾难恢复
+type DataDir struct {
+	id       string
+	dir      string
+	readOnly bool
+	logs     *boltdb.BoltStore
+	stable   *boltdb.BoltStore
+	snaps    *raft.FileSnapshotStore
+}
+
+// DataDirInfo 数据目录中的raft状态
+type DataDirInfo struct {
+	Dir                string
+	FirstIndex         uint64 // 日志存储中的第一条日志index, 没有日志时为0
+	LastIndex          uint64 // 日志存储中的最后一条日志index, 没有日志时为0
+	LastTerm           uint64
+	CurrentTerm        uint64
+	LastVoteTerm       uint64
+	LastVoteCandidate  string
+	Configuration      raft.Configuration // 最新的集群配置, 来自日志或快照
+	ConfigurationIndex uint64
+	Snapshots          []*raft.SnapshotMeta // 按新旧排序
+}
+
+// OpenDataDir 打开dataDir下节点id的数据目录, 即 SetDataDir 设置的目录. readOnly为true时只能查看和导出,
+// 修改操作返回 ErrDataDirReadOnly
+func OpenDataDir(dataDir, id string, readOnly bool) (*DataDir, error) {
+	dir := filepath.Join(dataDir, id)
+	if _, err := os.Stat(filepath.Join(dir, Logs_File)); err != nil {
+		return nil, err
+	}
+	d := &DataDir{id: id, dir: dir, readOnly: readOnly}
+	var err error
+	options := &bolt.Options{Timeout: Open_Timeout, ReadOnly: readOnly}
+	if d.logs, err = boltdb.New(boltdb.Options{Path: filepath.Join(dir, Logs_File), BoltOptions: options}); err != nil {
+		return nil, fmt.Errorf("raftx: open %s failed, the node may be running: %v", Logs_File, err)
+	}
+	if d.stable, err = boltdb.New(boltdb.Options{Path: filepath.Join(dir, Stable_File), BoltOptions: options}); err != nil {
+		d.logs.Close()
+		return nil, fmt.Errorf("raftx: open %s failed, the node may be running: %v", Stable_File, err)
+	}
+	if d.snaps, err = raft.NewFileSnapshotStore(dir, Default_Snapshot_Retain, io.Discard); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close 关闭数据目录
+func (d *DataDir) Close() error {
+	err := d.logs.Close()
+	if err2 := d.stable.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Inspect 返回数据目录中的raft状态
+func (d *DataDir) Inspect() (*DataDirInfo, error) {
+	info := &DataDirInfo{Dir: d.dir}
+	var err error
+	if info.FirstIndex, err = d.logs.FirstIndex(); err != nil {
+		return nil, err
+	}
+	if info.LastIndex, err = d.logs.LastIndex(); err != nil {
+		return nil, err
+	}
+	var l raft.Log
+	if info.LastIndex > 0 {
+		if err := d.logs.GetLog(info.LastIndex, &l); err != nil {
+			return nil, err
+		}
+		info.LastTerm = l.Term
+	}
+	// stable 存储中的key由raft定义
+	info.CurrentTerm, _ = d.stable.GetUint64([]byte("CurrentTerm"))
+	info.LastVoteTerm, _ = d.stable.GetUint64([]byte("LastVoteTerm"))
+	cand, _ := d.stable.Get([]byte("LastVoteCand"))
+	info.LastVoteCandidate = string(cand)
+
+	if info.Snapshots, err = d.snaps.List(); err != nil {
+		return nil, err
+	}
+	logLast := info.LastIndex
+	if len(info.Snapshots) > 0 {
+		latest := info.Snapshots[0]
+		info.Configuration, info.ConfigurationIndex = latest.Configuration, latest.ConfigurationIndex
+		if latest.Index > info.LastIndex {
+			info.LastIndex, info.LastTerm = latest.Index, latest.Term
+		}
+	}
+	for index := logLast; index >= info.FirstIndex && index > info.ConfigurationIndex; index-- {
+		if err := d.logs.GetLog(index, &l); err == raft.ErrLogNotFound {
+			continue
+		} else if err != nil {
+			break
+		}
+		if l.Type == raft.LogConfiguration {
+			info.Configuration, info.ConfigurationIndex = raft.DecodeConfiguration(l.Data), l.Index
+			break
+		}
+	}
+	return info, nil
+}
+
+// Logs 从from开始依次回调日志存储中的日志, fn返回false时停止. 恢复快照后日志index可能不连续, 缺少的日志被跳过
+func (d *DataDir) Logs(from uint64, fn func(l *raft.Log) bool) error {
+	first, err := d.logs.FirstIndex()
+	if err != nil {
+		return err
+	}
+	last, err := d.logs.LastIndex()
+	if err != nil {
+		return err
+	}
+	if from < first {
+		from = first
+	}
+	for index := from; index <= last && index > 0; index++ {
+		l := &raft.Log{}
+		if err := d.logs.GetLog(index, l); err == raft.ErrLogNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !fn(l) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// ExportSnapshot 将快照导出到w, id为空时导出最新的快照
+func (d *DataDir) ExportSnapshot(w io.Writer, id string) (*raft.SnapshotMeta, error) {
+	if id == "" {
+		snapshots, err := d.snaps.List()
+		if err != nil {
+			return nil, err
+		}
+		if len(snapshots) == 0 {
+			return nil, ErrNoSnapshot
+		}
+		id = snapshots[0].ID
+	}
+	meta, rc, err := d.snaps.Open(id)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return meta, writeSnapshotArchive(w, meta, rc)
+}
+
+// ImportSnapshot 从rd导入 ExportSnapshot 或 BackupSnapshot 导出的快照, 替换节点的全部状态: 删除日志存储中的日志,
+// 新快照的index和term不小于节点已有的日志和快照. 集群配置为快照中的配置, 可以随后调用 ForceConfiguration 修改
+func (d *DataDir) ImportSnapshot(rd io.Reader) (*raft.SnapshotMeta, error) {
+	if d.readOnly {
+		return nil, ErrDataDirReadOnly
+	}
+	meta, data, err := readSnapshotArchive(rd)
+	if err != nil {
+		return nil, err
+	}
+	info, err := d.Inspect()
+	if err != nil {
+		return nil, err
+	}
+	index, term := max(meta.Index, info.LastIndex), max(meta.Term, info.LastTerm, info.CurrentTerm)
+	last, err := d.logs.LastIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	_, trans := raft.NewInmemTransport("")
+	sink, err := d.snaps.Create(meta.Version, index, term, meta.Configuration, meta.ConfigurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(sink, data); err != nil {
+		sink.Cancel()
+		return nil, err
+	}
+	if err := sink.Close(); err != nil {
+		return nil, err
+	}
+	if info.FirstIndex > 0 {
+		if err := d.logs.DeleteRange(info.FirstIndex, last); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.stable.SetUint64([]byte("CurrentTerm"), term); err != nil {
+		return nil, err
+	}
+
+	snapshots, err := d.snaps.List()
+	if err != nil {
+		return nil, err
+	}
+	return snapshots[0], nil
+}
+
+// ForceConfiguration 使用fsm按已有的快照和日志恢复状态后, 强制设置新的集群配置. 用于集群失去多数节点后从存活节点恢复,
+// 所有使用新配置的节点都需要在启动前执行相同的恢复. fsm只用于生成新快照, 恢复后可以丢弃
+func (d *DataDir) ForceConfiguration(fsm raft.FSM, configuration raft.Configuration) error {
+	if d.readOnly {
+		return ErrDataDirReadOnly
+	}
+	c := raft.DefaultConfig()
+	c.LocalID = raft.ServerID(d.id)
+	c.LogOutput = io.Discard
+	_, trans := raft.NewInmemTransport("")
+	return raft.RecoverCluster(c, fsm, d.logs, d.stable, d.snaps, trans, configuration)
+}
+
+// ForceSingleNode 强制设置只包含本节点的集群配置, addr为本节点的通告地址. 节点启动后成为leader, 其它节点可以重新加入
+func (d *DataDir) ForceSingleNode(fsm raft.FSM, addr string) error {
+	return d.ForceConfiguration(fsm, raft.Configuration{Servers: []raft.Server{
+		{Suffrage: raft.Voter, ID: raft.ServerID(d.id), Address: raft.ServerAddress(addr)},
+	}})
+}
+
+// recoverIfNeed 数据目录下存在 Peers_File 时按文件强制设置集群配置, 完成后重命名为 Peers_Info_File
+func (r *RaftX) recoverIfNeed(logs raft.LogStore, stable raft.StableStore, snaps raft.SnapshotStore, trans raft.Transport) error {
+	path := filepath.Join(r.dataDir, string(r.config.LocalID), Peers_File)
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	configuration, err := raft.ReadConfigJSON(path)
+	if err != nil {
+		return fmt.Errorf("raftx: read %s failed: %v", path, err)
+	}
+	if err := raft.RecoverCluster(r.config, r.fsm, logs, stable, snaps, trans, configuration); err != nil {
+		return fmt.Errorf("raftx: recover cluster from %s failed: %v", path, err)
+	}
+	return os.Rename(path, filepath.Join(filepath.Dir(path), Peers_Info_File))
+}
+
+// BackupSnapshot 生成快照并写入w, 没有新的日志时写入最新的快照. 写入的内容可以用 RestoreSnapshot 或 DataDir.ImportSnapshot 恢复
+func (r *RaftX) BackupSnapshot(w io.Writer) (*raft.SnapshotMeta, error) {
+	ra, err := r.getRaft()
+	if err != nil {
+		return nil, err
+	}
+	var meta *raft.SnapshotMeta
+	var rc io.ReadCloser
+	f := ra.Snapshot()
+	switch err := f.Error(); err {
+	case nil:
+		meta, rc, err = f.Open()
+		if err != nil {
+			return nil, err
+		}
+	case raft.ErrNothingNewToSnapshot:
+		snapshots, err := r.snaps.List()
+		if err != nil {
+			return nil, err
+		}
+		if len(snapshots) == 0 {
+			return nil, ErrNoSnapshot
+		}
+		meta, rc, err = r.snaps.Open(snapshots[0].ID)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	defer rc.Close()
+	return meta, writeSnapshotArchive(w, meta, rc)
+}
+
+// BackupSnapshotToFile 生成快照并写入path文件, 写入完成前不会覆盖已有的文件
+func (r *RaftX) BackupSnapshotToFile(path string) (*raft.SnapshotMeta, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	meta, err := r.BackupSnapshot(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meta, os.Rename(f.Name(), path)
+}
+
+// RestoreSnapshot 将 BackupSnapshot 备份的快照恢复到运行中的集群, 覆盖FSM的全部状态. 只能在leader上调用
+func (r *RaftX) RestoreSnapshot(ctx context.Context, rd io.Reader) error {
+	ra, err := r.getRaft()
+	if err != nil {
+		return err
+	}
+	meta, data, err := readSnapshotArchive(rd)
+	if err != nil {
+		return err
+	}
+	return ra.Restore(meta, data, timeoutOf(ctx))
+}
+
+// writeSnapshotArchive 写入快照备份: 格式标识, JSON编码的快照元信息, 快照数据和数据的sha256
+func writeSnapshotArchive(w io.Writer, meta *raft.SnapshotMeta, data io.Reader) error {
+	header, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(snapshot_Archive_Magic)
+	bw.Write(header)
+	bw.WriteByte('\n')
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(bw, h), data)
+	if err != nil {
+		return err
+	}
+	if n != meta.Size {
+		return fmt.Errorf("raftx: snapshot size mismatch, expect %d got %d", meta.Size, n)
+	}
+	bw.Write(h.Sum(nil))
+	return bw.Flush()
+}
+
+// readSnapshotArchive 读取快照备份的元信息, 返回的data读到结尾时校验sha256
+func readSnapshotArchive(rd io.Reader) (*raft.SnapshotMeta, io.Reader, error) {
+	br := bufio.NewReader(rd)
+	magic := make([]byte, len(snapshot_Archive_Magic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != snapshot_Archive_Magic {
+		return nil, nil, ErrSnapshotCorrupt
+	}
+	header, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, nil, ErrSnapshotCorrupt
+	}
+	meta := &raft.SnapshotMeta{}
+	if err := json.Unmarshal(header, meta); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	return meta, &archiveReader{r: br, remain: meta.Size, h: sha256.New()}, nil
+}
+
+// archiveReader 读取快照数据, 读完后校验sha256
+type archiveReader struct {
+	r      io.Reader
+	remain int64
+	h      hash.Hash
+	err    error // 数据读完后的结果
+}
+
+func (a *archiveReader) Read(p []byte) (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	if a.remain == 0 {
+		sum := make([]byte, sha256.Size)
+		if _, err := io.ReadFull(a.r, sum); err != nil || !bytes.Equal(sum, a.h.Sum(nil)) {
+			a.err = ErrSnapshotCorrupt
+		} else {
+			a.err = io.EOF
+		}
+		return 0, a.err
+	}
+	if int64(len(p)) > a.remain {
+		p = p[:a.remain]
+	}
+	n, err := a.r.Read(p)
+	a.h.Write(p[:n])
+	a.remain -= int64(n)
+	if err == io.EOF {
+		if a.remain > 0 {
+			return n, ErrSnapshotCorrupt
+		}
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,185 @@
+package raftx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/netutil/raftx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	Convey("Test backup and restore snapshot of running node", t, func() {
+		dir := t.TempDir()
+		r, fsm, stop := startSingleNode(dir, func(r *raftx.RaftX) {})
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		for _, cmd := range []string{"a", "b"} {
+			_, err := r.Apply(ctx, []byte(cmd), nil)
+			So(err, ShouldBeNil)
+		}
+		backup := filepath.Join(dir, "backup.snap")
+		meta, err := r.BackupSnapshotToFile(backup)
+		So(err, ShouldBeNil)
+		So(meta.Index, ShouldBeGreaterThan, 0)
+		meta2, err := r.BackupSnapshot(&bytes.Buffer{})
+		So(err, ShouldBeNil)
+		So(meta2.Index, ShouldEqual, meta.Index)
+
+		_, err = r.Apply(ctx, []byte("c"), nil)
+		So(err, ShouldBeNil)
+		f, err := os.Open(backup)
+		So(err, ShouldBeNil)
+		So(r.RestoreSnapshot(ctx, f), ShouldBeNil)
+		f.Close()
+		So(fsm.Logs(), ShouldResemble, []string{"a", "b"})
+
+		// data dir is locked while running
+		_, err = raftx.OpenDataDir(dir, "single", true)
+		So(err, ShouldNotBeNil)
+		stop()
+
+		Convey("inspect and export offline", func() {
+			d, err := raftx.OpenDataDir(dir, "single", true)
+			So(err, ShouldBeNil)
+			defer d.Close()
+			info, err := d.Inspect()
+			So(err, ShouldBeNil)
+			So(info.LastIndex, ShouldBeGreaterThan, meta.Index)
+			So(info.CurrentTerm, ShouldBeGreaterThan, 0)
+			So(len(info.Configuration.Servers), ShouldEqual, 1)
+			So(info.Configuration.Servers[0].ID, ShouldEqual, raft.ServerID("single"))
+			So(len(info.Snapshots), ShouldBeGreaterThanOrEqualTo, 2)
+
+			var commands []string
+			So(d.Logs(0, func(l *raft.Log) bool {
+				if l.Type == raft.LogCommand {
+					commands = append(commands, string(l.Data))
+				}
+				return true
+			}), ShouldBeNil)
+			So(commands, ShouldResemble, []string{"a", "b", "c"})
+
+			var buf bytes.Buffer
+			exported, err := d.ExportSnapshot(&buf, "")
+			So(err, ShouldBeNil)
+			So(exported.ID, ShouldEqual, info.Snapshots[0].ID)
+
+			// read only data dir is not modified
+			_, err = d.ImportSnapshot(bytes.NewReader(buf.Bytes()))
+			So(err, ShouldEqual, raftx.ErrDataDirReadOnly)
+			So(d.ForceSingleNode(&testFSM{}, "127.0.0.1:1"), ShouldEqual, raftx.ErrDataDirReadOnly)
+			info2, err := d.Inspect()
+			So(err, ShouldBeNil)
+			So(info2, ShouldResemble, info)
+		})
+
+		Convey("import into a new node", func() {
+			l := listen()
+			n, _ := startNodeOn(dir, "n9", l, false, nil)
+			n.Stop()
+
+			d, err := raftx.OpenDataDir(dir, "n9", false)
+			So(err, ShouldBeNil)
+			data, err := os.ReadFile(backup)
+			So(err, ShouldBeNil)
+			_, err = d.ImportSnapshot(bytes.NewReader(data))
+			So(err, ShouldBeNil)
+			addr := listen()
+			So(d.ForceSingleNode(&testFSM{}, addr.Addr().String()), ShouldBeNil)
+			So(d.Close(), ShouldBeNil)
+
+			n, fsm := startNodeOn(dir, "n9", addr, false, nil)
+			defer n.Stop()
+			_, err = n.WaitLeader(ctx)
+			So(err, ShouldBeNil)
+			So(fsm.Logs(), ShouldResemble, []string{"a", "b"})
+
+			// corrupt archive
+			data[len(data)-40] ^= 0xff
+			err = n.RestoreSnapshot(ctx, bytes.NewReader(data))
+			So(err, ShouldNotBeNil)
+			So(errors.Is(n.RestoreSnapshot(ctx, bytes.NewReader([]byte("bad"))), raftx.ErrSnapshotCorrupt), ShouldBeTrue)
+		})
+	})
+}
+
+// stoppedCluster start a three nodes cluster, apply "a" and stop all nodes
+func stoppedCluster(dir string) {
+	n1, _, stop1 := startTestNode(dir, "n1", true)
+	n2, _, stop2 := startTestNode(dir, "n2", false)
+	n3, _, stop3 := startTestNode(dir, "n3", false)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	_, err := n1.WaitLeader(ctx)
+	So(err, ShouldBeNil)
+	So(n2.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+	So(n3.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+	_, err = n1.Apply(ctx, []byte("a"), nil)
+	So(err, ShouldBeNil)
+	stop3()
+	stop2()
+	stop1()
+}
+
+func TestRecoverCluster(t *testing.T) {
+	Convey("Test force single node after quorum loss", t, func() {
+		dir := t.TempDir()
+		stoppedCluster(dir)
+
+		d, err := raftx.OpenDataDir(dir, "n1", false)
+		So(err, ShouldBeNil)
+		info, err := d.Inspect()
+		So(err, ShouldBeNil)
+		So(len(info.Configuration.Servers), ShouldEqual, 3)
+		l := listen()
+		So(d.ForceSingleNode(&testFSM{}, l.Addr().String()), ShouldBeNil)
+		So(d.Close(), ShouldBeNil)
+
+		n1, fsm := startNodeOn(dir, "n1", l, false, nil)
+		defer n1.Stop()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err = n1.Apply(ctx, []byte("b"), nil)
+		So(err, ShouldBeNil)
+		So(fsm.Logs(), ShouldResemble, []string{"a", "b"})
+		members, err := n1.GetConfiguration(ctx)
+		So(err, ShouldBeNil)
+		So(len(members), ShouldEqual, 1)
+	})
+
+	Convey("Test recover from peers.json", t, func() {
+		dir := t.TempDir()
+		stoppedCluster(dir)
+
+		l1, l2 := listen(), listen()
+		peers := `[{"id": "n1", "address": "` + l1.Addr().String() + `"}, {"id": "n2", "address": "` + l2.Addr().String() + `"}]`
+		for _, id := range []string{"n1", "n2"} {
+			So(os.WriteFile(filepath.Join(dir, id, raftx.Peers_File), []byte(peers), 0644), ShouldBeNil)
+		}
+		n1, fsm1 := startNodeOn(dir, "n1", l1, false, nil)
+		defer n1.Stop()
+		n2, fsm2 := startNodeOn(dir, "n2", l2, false, nil)
+		defer n2.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := n2.Apply(ctx, []byte("b"), nil)
+		So(err, ShouldBeNil)
+		So(n1.LinearizableRead(ctx), ShouldBeNil)
+		So(n2.LinearizableRead(ctx), ShouldBeNil)
+		So(fsm1.Logs(), ShouldResemble, []string{"a", "b"})
+		So(fsm2.Logs(), ShouldResemble, []string{"a", "b"})
+
+		_, err = os.Stat(filepath.Join(dir, "n1", raftx.Peers_Info_File))
+		So(err, ShouldBeNil)
+		_, err = os.Stat(filepath.Join(dir, "n1", raftx.Peers_File))
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,258 @@
+package raftx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// Address_Sync_Interval 默认检查节点通告地址变化的间隔
+	Address_Sync_Interval = 10 * time.Second
+)
+
+// Resolver 解析集群节点的id和通告地址, 用于引导集群, Join 以及节点地址变化时自动更新集群配置
+type Resolver interface {
+	Resolve(ctx context.Context) ([]Node, error)
+}
+
+// StaticResolver 返回固定的节点列表
+type StaticResolver []Node
+
+func (s StaticResolver) Resolve(ctx context.Context) ([]Node, error) {
+	return append([]Node(nil), s...), nil
+}
+
+// DNSSRVResolver 通过DNS SRV记录解析节点, 节点id为目标主机名的第一段, 例如 "n1.raft.example.com." 的id为 "n1"
+type DNSSRVResolver struct {
+	Service string
+	Proto   string
+	Name    string
+
+	// LookupSRV 查询SRV记录, 默认使用 net.DefaultResolver.LookupSRV
+	LookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// NewDNSSRVResolver 创建查询 _service._proto.name SRV记录的解析器, service和proto为空时直接查询name
+func NewDNSSRVResolver(service, proto, name string) *DNSSRVResolver {
+	return &DNSSRVResolver{Service: service, Proto: proto, Name: name, LookupSRV: net.DefaultResolver.LookupSRV}
+}
+
+func (d *DNSSRVResolver) Resolve(ctx context.Context) ([]Node, error) {
+	lookup := d.LookupSRV
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupSRV
+	}
+	_, records, err := lookup(ctx, d.Service, d.Proto, d.Name)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]Node, 0, len(records))
+	for _, srv := range records {
+		host := strings.TrimSuffix(srv.Target, ".")
+		id, _, _ := strings.Cut(host, ".")
+		nodes = append(nodes, Node{Id: id, Addr: net.JoinHostPort(host, strconv.Itoa(int(srv.Port)))})
+	}
+	return nodes, nil
+}
+
+// FileResolver 从JSON文件解析节点, 每次解析时重新读取文件. 文件格式与raft的peers.json相同:
+//
+//	[{"id": "n1", "address": "10.0.0.1:7000", "non_voter": false}]
+type FileResolver struct {
+	Path string
+}
+
+// NewFileResolver 创建从path文件解析节点的解析器
+func NewFileResolver(path string) *FileResolver {
+	return &FileResolver{Path: path}
+}
+
+func (f *FileResolver) Resolve(ctx context.Context) ([]Node, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	var peers []struct {
+		Id      string `json:"id"`
+		Address string `json:"address"`
+	}
+	if err := json.Unmarshal(data, &peers); err != nil {
+		return nil, fmt.Errorf("raftx: parse %s failed: %v", f.Path, err)
+	}
+	nodes := make([]Node, 0, len(peers))
+	for _, p := range peers {
+		nodes = append(nodes, Node{Id: p.Id, Addr: p.Address})
+	}
+	return nodes, nil
+}
+
+// SetBindAddress 设置grpc服务的监听地址, 仅用于 Start. 默认监听所有网卡上通告地址的端口.
+// 通告地址即 Node.Addr, 是其它节点访问本节点的地址, 写入集群配置
+func (r *RaftX) SetBindAddress(addr string) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set bind address while raft is started")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return err
+	}
+	r.bindAddr = addr
+	return nil
+}
+
+// SetResolver 设置节点地址解析器. 引导集群时解析到的节点加入初始配置, Join 未指定地址时通过解析到的节点加入,
+// leader定期按解析结果更新集群配置中变化的节点地址
+func (r *RaftX) SetResolver(resolver Resolver) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set resolver while raft is started")
+	}
+	r.resolver = resolver
+	return nil
+}
+
+// SetAddressSyncInterval 设置检查节点通告地址变化的间隔, 默认 Address_Sync_Interval
+func (r *RaftX) SetAddressSyncInterval(d time.Duration) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set address sync interval while raft is started")
+	}
+	if d <= 0 {
+		return fmt.Errorf("address sync interval must be positive")
+	}
+	r.addressSyncInterval = d
+	return nil
+}
+
+// resolvePeers 解析除本节点外的其它节点, 未设置解析器时返回nil
+func (r *RaftX) resolvePeers(ctx context.Context) ([]Node, error) {
+	if r.resolver == nil {
+		return nil, nil
+	}
+	nodes, err := r.resolver.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		if n.Id != r.node.Id && n.Addr != "" {
+			peers = append(peers, n)
+		}
+	}
+	return peers, nil
+}
+
+// syncAddresses 定期检查节点通告地址, 直到raft关闭
+func (r *RaftX) syncAddresses(ra *raft.Raft) {
+	interval := r.addressSyncInterval
+	if interval <= 0 {
+		interval = Address_Sync_Interval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stopC:
+				return
+			case <-ticker.C:
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			r.syncAddressesOnce(ctx, ra)
+			cancel()
+		}
+	}()
+}
+
+// syncAddressesOnce leader更新集群配置中本节点和解析到的变化的节点地址;
+// follower在配置中本节点的地址与通告地址不同时, 通过leader或其它节点重新加入以更新地址. 失败时等待下次检查
+func (r *RaftX) syncAddressesOnce(ctx context.Context, ra *raft.Raft) {
+	f := ra.GetConfiguration()
+	if f.Error() != nil {
+		return
+	}
+	servers := f.Configuration().Servers
+	self := raft.ServerAddress(r.GetAddress())
+
+	if ra.State() == raft.Leader {
+		changed := make(map[raft.ServerID]raft.ServerAddress)
+		if peers, err := r.resolvePeers(ctx); err == nil {
+			for _, p := range peers {
+				changed[raft.ServerID(p.Id)] = raft.ServerAddress(p.Addr)
+			}
+		}
+		changed[r.config.LocalID] = self
+		for _, s := range servers {
+			addr, ok := changed[s.ID]
+			if !ok || addr == s.Address {
+				continue
+			}
+			if s.Suffrage == raft.Nonvoter {
+				ra.AddNonvoter(s.ID, addr, 0, timeoutOf(ctx)).Error()
+			} else {
+				ra.AddVoter(s.ID, addr, 0, timeoutOf(ctx)).Error()
+			}
+		}
+		return
+	}
+
+	var addrs []string
+	voter := true
+	outdated := false
+	for _, s := range servers {
+		if s.ID == r.config.LocalID {
+			outdated = s.Address != self
+			voter = s.Suffrage != raft.Nonvoter
+		} else {
+			addrs = append(addrs, string(s.Address))
+		}
+	}
+	if !outdated {
+		return
+	}
+	if leaderAddr, _ := ra.LeaderWithID(); leaderAddr != "" {
+		addrs = append([]string{string(leaderAddr)}, addrs...)
+	}
+	if peers, err := r.resolvePeers(ctx); err == nil {
+		for _, p := range peers {
+			addrs = append(addrs, p.Addr)
+		}
+	}
+	for _, addr := range addrs {
+		if r.joinVia(ctx, voter, addr) == nil {
+			return
+		}
+	}
+}
+
+// addressTransport 以节点地址代替节点id作为grpc传输的连接缓存key.
+// grpc传输按节点id缓存连接, 节点通告地址变化后仍会连接旧地址
+type addressTransport struct {
+	raft.Transport
+}
+
+func (t addressTransport) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
+	return t.Transport.AppendEntriesPipeline(raft.ServerID(target), target)
+}
+
+func (t addressTransport) AppendEntries(id raft.ServerID, target raft.ServerAddress, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) error {
+	return t.Transport.AppendEntries(raft.ServerID(target), target, args, resp)
+}
+
+func (t addressTransport) RequestVote(id raft.ServerID, target raft.ServerAddress, args *raft.RequestVoteRequest, resp *raft.RequestVoteResponse) error {
+	return t.Transport.RequestVote(raft.ServerID(target), target, args, resp)
+}
+
+func (t addressTransport) InstallSnapshot(id raft.ServerID, target raft.ServerAddress, args *raft.InstallSnapshotRequest, resp *raft.InstallSnapshotResponse, data io.Reader) error {
+	return t.Transport.InstallSnapshot(raft.ServerID(target), target, args, resp, data)
+}
+
+func (t addressTransport) TimeoutNow(id raft.ServerID, target raft.ServerAddress, args *raft.TimeoutNowRequest, resp *raft.TimeoutNowResponse) error {
+	return t.Transport.TimeoutNow(raft.ServerID(target), target, args, resp)
+}
@@ -0,0 +1,140 @@
+package raftx_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/netutil/raftx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// startNodeOn start a raftx node on listener l, customize is called before start
+func startNodeOn(dataDir, id string, l net.Listener, bootstrap bool, customize func(r *raftx.RaftX)) (*raftx.RaftX, *testFSM) {
+	fsm := &testFSM{}
+	r := startNode(dataDir, id, l, bootstrap, fsm, func(r *raftx.RaftX) {
+		So(r.SetAddressSyncInterval(100*time.Millisecond), ShouldBeNil)
+		if customize != nil {
+			customize(r)
+		}
+	})
+	return r, fsm
+}
+
+func TestResolvers(t *testing.T) {
+	Convey("Test static resolver", t, func() {
+		nodes, err := raftx.StaticResolver{{Id: "n1", Addr: "10.0.0.1:7000"}}.Resolve(context.Background())
+		So(err, ShouldBeNil)
+		So(nodes, ShouldResemble, []raftx.Node{{Id: "n1", Addr: "10.0.0.1:7000"}})
+	})
+
+	Convey("Test dns srv resolver", t, func() {
+		r := raftx.NewDNSSRVResolver("raft", "tcp", "example.com")
+		r.LookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			So(service+proto+name, ShouldEqual, "rafttcpexample.com")
+			return "", []*net.SRV{{Target: "n1.example.com.", Port: 7000}, {Target: "n2.example.com.", Port: 7001}}, nil
+		}
+		nodes, err := r.Resolve(context.Background())
+		So(err, ShouldBeNil)
+		So(nodes, ShouldResemble, []raftx.Node{{Id: "n1", Addr: "n1.example.com:7000"}, {Id: "n2", Addr: "n2.example.com:7001"}})
+
+		r.LookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			return "", nil, errors.New("no such host")
+		}
+		_, err = r.Resolve(context.Background())
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test file resolver", t, func() {
+		path := filepath.Join(t.TempDir(), "peers.json")
+		r := raftx.NewFileResolver(path)
+		_, err := r.Resolve(context.Background())
+		So(err, ShouldNotBeNil)
+
+		So(os.WriteFile(path, []byte(`[{"id": "n1", "address": "10.0.0.1:7000"}, {"id": "n2", "address": "10.0.0.2:7000", "non_voter": true}]`), 0644), ShouldBeNil)
+		nodes, err := r.Resolve(context.Background())
+		So(err, ShouldBeNil)
+		So(nodes, ShouldResemble, []raftx.Node{{Id: "n1", Addr: "10.0.0.1:7000"}, {Id: "n2", Addr: "10.0.0.2:7000"}})
+
+		So(os.WriteFile(path, []byte(`{`), 0644), ShouldBeNil)
+		_, err = r.Resolve(context.Background())
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test bind address", t, func() {
+		r, err := raftx.NewRaftX(&raftx.Node{Id: "n1", Addr: "localhost:7000"}, true, &testFSM{})
+		So(err, ShouldBeNil)
+		So(r.GetAddress(), ShouldEqual, "localhost:7000")
+		So(r.SetBindAddress("127.0.0.1:7000"), ShouldBeNil)
+		So(r.SetBindAddress("127.0.0.1"), ShouldNotBeNil)
+		So(r.SetAddressSyncInterval(0), ShouldNotBeNil)
+	})
+}
+
+func TestResolveCluster(t *testing.T) {
+	Convey("Test bootstrap and join by resolver", t, func() {
+		dir := t.TempDir()
+		l1, l2, l3 := listen(), listen(), listen()
+		resolver := raftx.StaticResolver{{Id: "n1", Addr: l1.Addr().String()}, {Id: "n2", Addr: l2.Addr().String()}}
+		n1, _ := startNodeOn(dir, "n1", l1, true, func(r *raftx.RaftX) { So(r.SetResolver(resolver), ShouldBeNil) })
+		defer n1.Stop()
+		n2, fsm2 := startNodeOn(dir, "n2", l2, false, nil)
+		defer n2.Stop()
+		n3, fsm3 := startNodeOn(dir, "n3", l3, false, func(r *raftx.RaftX) { So(r.SetResolver(resolver), ShouldBeNil) })
+		defer n3.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := n1.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(n3.Join(ctx, false), ShouldBeNil)
+		So(n2.Join(ctx, false), ShouldNotBeNil)
+
+		members, err := n1.GetConfiguration(ctx)
+		So(err, ShouldBeNil)
+		So(len(members), ShouldEqual, 3)
+
+		_, err = n1.Apply(ctx, []byte("a"), nil)
+		So(err, ShouldBeNil)
+		So(waitLogs(ctx, fsm2, 1), ShouldResemble, []string{"a"})
+		So(waitLogs(ctx, fsm3, 1), ShouldResemble, []string{"a"})
+	})
+
+	Convey("Test advertised address change", t, func() {
+		dir := t.TempDir()
+		n1, _ := startNodeOn(dir, "n1", listen(), true, nil)
+		defer n1.Stop()
+		n2, _ := startNodeOn(dir, "n2", listen(), false, nil)
+		n3, _ := startNodeOn(dir, "n3", listen(), false, nil)
+		defer n3.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := n1.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(n2.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+		So(n3.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+		_, err = n1.Apply(ctx, []byte("a"), nil)
+		So(err, ShouldBeNil)
+		So(n2.LinearizableRead(ctx), ShouldBeNil)
+		n2.Stop()
+
+		// restart n2 with a new address, it announces the address to the leader
+		n2, fsm2 := startNodeOn(dir, "n2", listen(), false, nil)
+		defer n2.Stop()
+		_, err = n1.Apply(ctx, []byte("b"), nil)
+		So(err, ShouldBeNil)
+		So(waitLogs(ctx, fsm2, 2), ShouldResemble, []string{"a", "b"})
+		members, err := n1.GetConfiguration(ctx)
+		So(err, ShouldBeNil)
+		for _, m := range members {
+			if m.Id == "n2" {
+				So(m.Addr, ShouldEqual, n2.GetAddress())
+			}
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package raftx
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Auth_Metadata_Key 认证token所在的grpc metadata, 值为 "Bearer <token>"
+	Auth_Metadata_Key = "authorization"
+
+	auth_Scheme = "Bearer "
+)
+
+// tokenCredentials 每个RPC携带认证token
+type tokenCredentials struct {
+	token      string
+	requireTLS bool
+}
+
+// NewTokenCredentials 创建携带认证token的 credentials.PerRPCCredentials, 用于 LeaderClientConfig.DialOptions 等外部客户端.
+// requireTLS为true时只能在TLS连接上使用
+func NewTokenCredentials(token string, requireTLS bool) credentials.PerRPCCredentials {
+	return tokenCredentials{token: token, requireTLS: requireTLS}
+}
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{Auth_Metadata_Key: auth_Scheme + t.token}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return t.requireTLS
+}
+
+// SetTLSConfig 设置节点间通讯的TLS配置. server 用于 ServerOptions 返回的grpc服务端证书, 要求客户端证书时即为mTLS;
+// client 用于连接其它节点, 需要验证对方证书并在mTLS时提供本节点证书. 可以使用 netutil.NewServerTLSConfig,
+// netutil.NewMutualTLSConfig 和 netutil.NewClientTLSConfig 创建
+func (r *RaftX) SetTLSConfig(server, client *tls.Config) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set tls config while raft is started")
+	}
+	if server == nil || client == nil {
+		return fmt.Errorf("tls config is nil")
+	}
+	r.tlsServer = server
+	r.tlsClient = client
+	return nil
+}
+
+// SetAuthToken 设置节点间共享的认证token, 连接其它节点时每个RPC携带该token. raft transport和forwarder服务总是校验token,
+// 同一grpc服务上的其它服务由 ServerOptions 返回的拦截器校验. 未设置TLS时token以明文传输
+func (r *RaftX) SetAuthToken(token string) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set auth token while raft is started")
+	}
+	if token == "" {
+		return fmt.Errorf("auth token is empty")
+	}
+	r.authToken = token
+	return nil
+}
+
+// SetDialOptions 设置连接其它节点的额外grpc选项, 例如 grpc.WithKeepaliveParams, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(n)),
+// grpc.WithConnectParams 设置重连退避. 传输安全和认证由 SetTLSConfig 和 SetAuthToken 设置
+func (r *RaftX) SetDialOptions(opts ...grpc.DialOption) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set dial options while raft is started")
+	}
+	r.extraDialOptions = opts
+	return nil
+}
+
+// ServerOptions 返回创建grpc服务需要的选项, 包括TLS证书和认证token拦截器, 设置TLS或token后需要使用该选项创建传给 Start 的grpc服务.
+// 拦截器校验该grpc服务上所有服务的请求
+func (r *RaftX) ServerOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if r.tlsServer != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(r.tlsServer)))
+	}
+	if r.authToken != "" {
+		opts = append(opts, grpc.ChainUnaryInterceptor(r.authUnaryInterceptor), grpc.ChainStreamInterceptor(r.authStreamInterceptor))
+	}
+	return opts
+}
+
+// dialOptions 返回连接其它节点使用的grpc选项
+func (r *RaftX) dialOptions() []grpc.DialOption {
+	opts := make([]grpc.DialOption, 0, len(r.extraDialOptions)+2)
+	if r.tlsClient != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(r.tlsClient)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if r.authToken != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(NewTokenCredentials(r.authToken, r.tlsClient != nil)))
+	}
+	return append(opts, r.extraDialOptions...)
+}
+
+// authorize 校验请求携带的token
+func (r *RaftX) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	expected := []byte(auth_Scheme + r.authToken)
+	for _, v := range md.Get(Auth_Metadata_Key) {
+		if subtle.ConstantTimeCompare([]byte(v), expected) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "raftx: invalid auth token")
+}
+
+func (r *RaftX) authUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := r.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (r *RaftX) authStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := r.authorize(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// authRegistrar 注册grpc服务时在处理函数中校验token, 不依赖grpc服务是否使用 ServerOptions 创建
+type authRegistrar struct {
+	r *RaftX
+	s grpc.ServiceRegistrar
+}
+
+func (a *authRegistrar) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	if a.r.authToken == "" {
+		a.s.RegisterService(desc, impl)
+		return
+	}
+	d := *desc
+	d.Methods = make([]grpc.MethodDesc, len(desc.Methods))
+	for i, md := range desc.Methods {
+		handler := md.Handler
+		md.Handler = func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			if err := a.r.authorize(ctx); err != nil {
+				return nil, err
+			}
+			return handler(srv, ctx, dec, interceptor)
+		}
+		d.Methods[i] = md
+	}
+	d.Streams = make([]grpc.StreamDesc, len(desc.Streams))
+	for i, sd := range desc.Streams {
+		handler := sd.Handler
+		sd.Handler = func(srv any, stream grpc.ServerStream) error {
+			if err := a.r.authorize(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}
+		d.Streams[i] = sd
+	}
+	a.s.RegisterService(&d, impl)
+}
@@ -0,0 +1,132 @@
+package raftx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/netutil"
+	"github.com/jhunters/goassist/netutil/raftx"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// startSecureNode start a raftx node with mTLS and auth token
+func startSecureNode(dataDir, id string, bootstrap bool, ca *netutil.SelfSignedCA) (*raftx.RaftX, *testFSM, func()) {
+	fsm := &testFSM{}
+	cert, err := ca.IssueTLS(id, []string{"127.0.0.1"}, time.Hour)
+	So(err, ShouldBeNil)
+	r := startNode(dataDir, id, listen(), bootstrap, fsm, func(r *raftx.RaftX) {
+		So(r.SetTLSConfig(netutil.NewMutualTLSConfig(netutil.StaticCert(cert), ca.CertPool()), netutil.NewClientTLSConfig("", ca.CertPool(), cert)), ShouldBeNil)
+		So(r.SetAuthToken("secret"), ShouldBeNil)
+		So(r.SetDialOptions(grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: 10 * time.Second}),
+			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(8<<20))), ShouldBeNil)
+	})
+	return r, fsm, func() {
+		r.Stop()
+	}
+}
+
+func TestSecurity(t *testing.T) {
+	Convey("Test mTLS and auth token between peers", t, func() {
+		ca, err := netutil.NewSelfSignedCA("raftx test ca", time.Hour)
+		So(err, ShouldBeNil)
+		dir := t.TempDir()
+		n1, _, stop1 := startSecureNode(dir, "n1", true, ca)
+		defer stop1()
+		n2, fsm2, stop2 := startSecureNode(dir, "n2", false, ca)
+		defer stop2()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err = n1.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(n2.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+
+		result, err := n2.Apply(ctx, []byte("a"), nil)
+		So(err, ShouldBeNil)
+		So(result.Index, ShouldBeGreaterThan, 0)
+		So(n2.Read(ctx, func() error {
+			So(fsm2.Logs(), ShouldResemble, []string{"a"})
+			return nil
+		}), ShouldBeNil)
+
+		So(n1.SetAuthToken("other"), ShouldNotBeNil)
+		So(n1.SetTLSConfig(nil, nil), ShouldNotBeNil)
+
+		clientCert, err := ca.IssueTLS("client", nil, time.Hour)
+		So(err, ShouldBeNil)
+		tlsCreds := grpc.WithTransportCredentials(credentials.NewTLS(netutil.NewClientTLSConfig("", ca.CertPool(), clientCert)))
+
+		// valid client
+		client, err := raftx.NewLeaderClient(raftx.LeaderClientConfig{Addrs: []string{n2.GetAddress()},
+			DialOptions: []grpc.DialOption{tlsCreds, grpc.WithPerRPCCredentials(raftx.NewTokenCredentials("secret", true))}})
+		So(err, ShouldBeNil)
+		defer client.Close()
+		_, err = client.Apply(ctx, []byte("b"), nil)
+		So(err, ShouldBeNil)
+
+		// wrong token
+		client2, err := raftx.NewLeaderClient(raftx.LeaderClientConfig{Addrs: []string{n2.GetAddress()},
+			DialOptions: []grpc.DialOption{tlsCreds, grpc.WithPerRPCCredentials(raftx.NewTokenCredentials("wrong", true))}})
+		So(err, ShouldBeNil)
+		defer client2.Close()
+		_, err = client2.Leader(ctx)
+		So(status.Code(err), ShouldEqual, codes.Unauthenticated)
+
+		// no client certificate
+		noCert := grpc.WithTransportCredentials(credentials.NewTLS(netutil.NewClientTLSConfig("", ca.CertPool(), nil)))
+		client3, err := raftx.NewLeaderClient(raftx.LeaderClientConfig{Addrs: []string{n2.GetAddress()},
+			DialOptions: []grpc.DialOption{noCert, grpc.WithPerRPCCredentials(raftx.NewTokenCredentials("secret", true))}})
+		So(err, ShouldBeNil)
+		defer client3.Close()
+		shortCtx, shortCancel := context.WithTimeout(ctx, time.Second)
+		defer shortCancel()
+		_, err = client3.Leader(shortCtx)
+		So(err, ShouldNotBeNil)
+
+		// plain text connection is refused by tls server
+		client4, err := raftx.NewLeaderClient(raftx.LeaderClientConfig{Addrs: []string{n2.GetAddress()}})
+		So(err, ShouldBeNil)
+		defer client4.Close()
+		shortCtx2, shortCancel2 := context.WithTimeout(ctx, time.Second)
+		defer shortCancel2()
+		_, err = client4.Leader(shortCtx2)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test auth token without server options", t, func() {
+		l := listen()
+		r, err := raftx.NewRaftXWithConfig(testConfig(), &raftx.Node{Id: "n1", Addr: l.Addr().String()}, true, &testFSM{})
+		So(err, ShouldBeNil)
+		So(r.SetDataDir(t.TempDir()), ShouldBeNil)
+		So(r.SetAuthToken("secret"), ShouldBeNil)
+		// plain grpc server without the auth interceptors
+		So(r.StartWithListener(grpc.NewServer(), l, nil), ShouldBeNil)
+		defer r.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err = r.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+
+		client, err := raftx.NewLeaderClient(raftx.LeaderClientConfig{Addrs: []string{r.GetAddress()}})
+		So(err, ShouldBeNil)
+		defer client.Close()
+		_, err = client.Leader(ctx)
+		So(status.Code(err), ShouldEqual, codes.Unauthenticated)
+
+		client2, err := raftx.NewLeaderClient(raftx.LeaderClientConfig{Addrs: []string{r.GetAddress()},
+			DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithPerRPCCredentials(raftx.NewTokenCredentials("secret", false))}})
+		So(err, ShouldBeNil)
+		defer client2.Close()
+		_, err = client2.Apply(ctx, []byte("a"), nil)
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,279 @@
+package raftx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/web"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Status_Peer_Timeout 查询其它节点状态的超时时间
+	Status_Peer_Timeout = time.Second
+
+	// Metrics_Prefix Prometheus指标名前缀
+	Metrics_Prefix = "raftx_"
+)
+
+// NodeStatus 单个节点的raft状态
+type NodeStatus struct {
+	Id                string `json:"id"`
+	Addr              string `json:"addr"`
+	State             string `json:"state"` // Follower, Candidate, Leader or Shutdown
+	Term              uint64 `json:"term"`
+	LastLogIndex      uint64 `json:"last_log_index"`
+	LastLogTerm       uint64 `json:"last_log_term"`
+	CommitIndex       uint64 `json:"commit_index"`
+	AppliedIndex      uint64 `json:"applied_index"`
+	FSMIndex          uint64 `json:"fsm_index"` // FSM 已执行的最后一条日志的index
+	LastSnapshotIndex uint64 `json:"last_snapshot_index"`
+	LastSnapshotTerm  uint64 `json:"last_snapshot_term"`
+	LastContact       string `json:"last_contact,omitempty"` // follower 最后一次收到leader消息距今的时间
+}
+
+// PeerStatus 集群配置中节点的状态和复制延迟
+type PeerStatus struct {
+	NodeStatus
+	Suffrage string `json:"suffrage"`
+	Leader   bool   `json:"leader"`
+	Self     bool   `json:"self"`
+	Lag      uint64 `json:"lag"`             // leader 最后日志index与该节点applied index的差值
+	Error    string `json:"error,omitempty"` // 查询节点状态失败的原因, 此时只有 Id 和 Addr 有效
+}
+
+// Status 本节点和集群的状态
+type Status struct {
+	NodeStatus
+	Leader Node         `json:"leader"`
+	Peers  []PeerStatus `json:"peers"`
+}
+
+type statusRequest struct{}
+
+type statusResponse struct {
+	Status NodeStatus
+}
+
+func (f *forwarder) status(ctx context.Context, req *statusRequest) (*statusResponse, error) {
+	s, err := f.r.NodeStatus()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &statusResponse{Status: s}, nil
+}
+
+// NodeStatus 返回本节点的raft状态
+func (r *RaftX) NodeStatus() (NodeStatus, error) {
+	ra, err := r.getRaft()
+	if err != nil {
+		return NodeStatus{}, err
+	}
+	stats := ra.Stats()
+	parse := func(key string) uint64 {
+		v, _ := strconv.ParseUint(stats[key], 10, 64)
+		return v
+	}
+	s := NodeStatus{
+		Id:                r.node.Id,
+		Addr:              r.GetAddress(),
+		State:             ra.State().String(),
+		Term:              parse("term"),
+		LastLogIndex:      parse("last_log_index"),
+		LastLogTerm:       parse("last_log_term"),
+		CommitIndex:       parse("commit_index"),
+		AppliedIndex:      parse("applied_index"),
+		FSMIndex:          r.applied.Load(),
+		LastSnapshotIndex: parse("last_snapshot_index"),
+		LastSnapshotTerm:  parse("last_snapshot_term"),
+	}
+	if ra.State() != raft.Leader {
+		s.LastContact = stats["last_contact"]
+	}
+	return s, nil
+}
+
+// Status 返回本节点状态和本地集群配置中所有节点的状态, 其它节点的状态通过forwarder服务并发查询.
+// 复制延迟以leader的最后日志index计算, 无法查询到leader时为0
+func (r *RaftX) Status(ctx context.Context) (*Status, error) {
+	ra, err := r.getRaft()
+	if err != nil {
+		return nil, err
+	}
+	self, err := r.NodeStatus()
+	if err != nil {
+		return nil, err
+	}
+	f := ra.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return nil, err
+	}
+	leaderAddr, leaderId := ra.LeaderWithID()
+	result := &Status{NodeStatus: self, Leader: Node{Id: string(leaderId), Addr: string(leaderAddr)}}
+
+	members := toMembers(f.Configuration().Servers, leaderAddr)
+	result.Peers = make([]PeerStatus, len(members))
+	ctx, cancel := context.WithTimeout(ctx, Status_Peer_Timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i, m := range members {
+		p := &result.Peers[i]
+		p.Id, p.Addr = m.Id, m.Addr
+		p.Suffrage = m.Suffrage.String()
+		p.Leader = m.Leader
+		if m.Id == r.node.Id {
+			p.NodeStatus = self
+			p.Self = true
+			continue
+		}
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			s, err := r.peerStatus(ctx, addr)
+			if err != nil {
+				p.Error = err.Error()
+				return
+			}
+			p.NodeStatus = s
+		}(m.Addr)
+	}
+	wg.Wait()
+
+	for _, p := range result.Peers {
+		if p.Leader && p.Error == "" {
+			for i := range result.Peers {
+				if p.LastLogIndex > result.Peers[i].AppliedIndex && result.Peers[i].Error == "" {
+					result.Peers[i].Lag = p.LastLogIndex - result.Peers[i].AppliedIndex
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// peerStatus 通过forwarder服务查询addr节点的状态
+func (r *RaftX) peerStatus(ctx context.Context, addr string) (NodeStatus, error) {
+	conn, err := r.clients.conn(addr, r.dialOptions())
+	if err != nil {
+		return NodeStatus{}, err
+	}
+	resp := &statusResponse{}
+	if err := invokeForwarder(ctx, conn, "Status", &statusRequest{}, resp); err != nil {
+		return NodeStatus{}, err
+	}
+	return resp.Status, nil
+}
+
+// StatusHandler 返回以JSON格式输出 Status 的http处理器
+func (r *RaftX) StatusHandler() http.Handler {
+	return http.HandlerFunc(web.JSONHandler(func(req *http.Request) (any, error) {
+		return r.Status(req.Context())
+	}))
+}
+
+// MetricsHandler 返回以Prometheus文本格式输出 Status 指标的http处理器
+func (r *RaftX) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s, err := r.Status(req.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(web.HTTP_HEADER_CONTENT_TYPE, web.HTTP_HEADER_CONTENT_TYPE_PROMETHEUS)
+		WriteMetrics(w, s)
+	})
+}
+
+// WriteMetrics 以Prometheus文本格式输出状态指标, 所有指标带有本节点id标签, 节点相关指标另带有peer标签
+func WriteMetrics(w io.Writer, s *Status) error {
+	m := &metricsWriter{w: w, id: s.Id}
+	states := []raft.RaftState{raft.Follower, raft.Candidate, raft.Leader, raft.Shutdown}
+	m.header("state", "Current raft state, 1 for the state the node is in")
+	for _, state := range states {
+		m.value("state", boolValue(s.State == state.String()), "state", state.String())
+	}
+	m.gauge("term", "Current raft term", s.Term)
+	m.gauge("last_log_index", "Index of the last log entry", s.LastLogIndex)
+	m.gauge("last_log_term", "Term of the last log entry", s.LastLogTerm)
+	m.gauge("commit_index", "Index of the last committed log entry", s.CommitIndex)
+	m.gauge("applied_index", "Index of the last applied log entry", s.AppliedIndex)
+	m.gauge("fsm_index", "Index of the last log entry applied to the FSM", s.FSMIndex)
+	m.gauge("last_snapshot_index", "Index of the last snapshot", s.LastSnapshotIndex)
+	m.gauge("last_snapshot_term", "Term of the last snapshot", s.LastSnapshotTerm)
+	m.gauge("has_leader", "Whether the cluster has a known leader", boolValue(s.Leader.Id != ""))
+	m.gauge("peers", "Number of servers in the configuration", uint64(len(s.Peers)))
+
+	peers := append([]PeerStatus(nil), s.Peers...)
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Id < peers[j].Id })
+	m.header("peer_up", "Whether the peer status is reachable")
+	for _, p := range peers {
+		m.value("peer_up", boolValue(p.Error == ""), "peer", p.Id)
+	}
+	m.header("peer_applied_index", "Index of the last log entry applied by the peer")
+	for _, p := range peers {
+		if p.Error == "" {
+			m.value("peer_applied_index", p.AppliedIndex, "peer", p.Id)
+		}
+	}
+	m.header("replication_lag", "Log entries the peer is behind the leader")
+	for _, p := range peers {
+		if p.Error == "" {
+			m.value("replication_lag", p.Lag, "peer", p.Id)
+		}
+	}
+	return m.err
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// metricsWriter 输出Prometheus文本格式, 记录第一个写入错误
+type metricsWriter struct {
+	w   io.Writer
+	id  string
+	err error
+}
+
+func (m *metricsWriter) printf(format string, args ...any) {
+	if m.err == nil {
+		_, m.err = fmt.Fprintf(m.w, format, args...)
+	}
+}
+
+func (m *metricsWriter) header(name, help string) {
+	m.printf("# HELP %s%s %s\n# TYPE %s%s gauge\n", Metrics_Prefix, name, help, Metrics_Prefix, name)
+}
+
+func (m *metricsWriter) gauge(name, help string, v uint64) {
+	m.header(name, help)
+	m.value(name, v)
+}
+
+// value 输出一个指标值, labels 为成对的标签名和值
+func (m *metricsWriter) value(name string, v uint64, labels ...string) {
+	var sb strings.Builder
+	sb.WriteString(`id="` + escapeLabel(m.id) + `"`)
+	for i := 0; i+1 < len(labels); i += 2 {
+		sb.WriteString(`,` + labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+	}
+	m.printf("%s%s{%s} %d\n", Metrics_Prefix, name, sb.String(), v)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelReplacer.Replace(v)
+}
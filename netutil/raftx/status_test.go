@@ -0,0 +1,87 @@
+package raftx_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/netutil/raftx"
+	"github.com/jhunters/goassist/web"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatus(t *testing.T) {
+	Convey("Test cluster status and metrics", t, func() {
+		dir := t.TempDir()
+		n1, _, stop1 := startTestNode(dir, "n1", true)
+		defer stop1()
+		n2, _, stop2 := startTestNode(dir, "n2", false)
+		defer stop2()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		_, err := n1.WaitLeader(ctx)
+		So(err, ShouldBeNil)
+		So(n2.Join(ctx, true, n1.GetAddress()), ShouldBeNil)
+		result, err := n2.Apply(ctx, []byte("a"), nil)
+		So(err, ShouldBeNil)
+		So(n2.LinearizableRead(ctx), ShouldBeNil)
+
+		s, err := n2.Status(ctx)
+		So(err, ShouldBeNil)
+		So(s.Id, ShouldEqual, "n2")
+		So(s.State, ShouldEqual, "Follower")
+		So(s.Leader.Id, ShouldEqual, "n1")
+		So(s.FSMIndex, ShouldEqual, result.Index)
+		So(len(s.Peers), ShouldEqual, 2)
+		for _, p := range s.Peers {
+			So(p.Error, ShouldBeEmpty)
+			So(p.Suffrage, ShouldEqual, "Voter")
+			So(p.Leader, ShouldEqual, p.Id == "n1")
+			So(p.Self, ShouldEqual, p.Id == "n2")
+			So(p.Term, ShouldEqual, s.Term)
+		}
+
+		Convey("json endpoint", func() {
+			ts := httptest.NewServer(n1.StatusHandler())
+			defer ts.Close()
+			resp, err := http.Get(ts.URL)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			So(resp.Header.Get(web.HTTP_HEADER_CONTENT_TYPE), ShouldEqual, web.HTTP_HEADER_CONTENT_TYPE_JSON)
+			var got raftx.Status
+			So(json.NewDecoder(resp.Body).Decode(&got), ShouldBeNil)
+			So(got.State, ShouldEqual, "Leader")
+			So(got.CommitIndex, ShouldBeGreaterThanOrEqualTo, result.Index)
+			So(len(got.Peers), ShouldEqual, 2)
+		})
+
+		Convey("prometheus endpoint", func() {
+			ts := httptest.NewServer(n1.MetricsHandler())
+			defer ts.Close()
+			resp, err := http.Get(ts.URL)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			So(resp.Header.Get(web.HTTP_HEADER_CONTENT_TYPE), ShouldEqual, web.HTTP_HEADER_CONTENT_TYPE_PROMETHEUS)
+			body, err := io.ReadAll(resp.Body)
+			So(err, ShouldBeNil)
+			So(string(body), ShouldContainSubstring, "# TYPE raftx_term gauge\n")
+			So(string(body), ShouldContainSubstring, `raftx_state{id="n1",state="Leader"} 1`)
+			So(string(body), ShouldContainSubstring, `raftx_peer_up{id="n1",peer="n2"} 1`)
+			So(string(body), ShouldContainSubstring, `raftx_replication_lag{id="n1",peer="n2"}`)
+		})
+
+		Convey("unreachable peer", func() {
+			stop2()
+			s, err := n1.Status(ctx)
+			So(err, ShouldBeNil)
+			for _, p := range s.Peers {
+				So(p.Error == "", ShouldEqual, p.Id == "n1")
+			}
+		})
+	})
+}
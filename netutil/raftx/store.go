@@ -0,0 +1,182 @@
+package raftx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/raft"
+	boltdb "github.com/hashicorp/raft-boltdb"
+)
+
+const (
+	// 默认保留的快照数量
+	Default_Snapshot_Retain = 3
+
+	// raft允许的最小快照检查间隔
+	Min_Snapshot_Interval = 5 * time.Millisecond
+)
+
+// SetLogStore 设置自定义日志存储, 替代默认的boltdb存储
+func (r *RaftX) SetLogStore(store raft.LogStore) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set log store while raft is started")
+	}
+	r.logStore = store
+	return nil
+}
+
+// SetStableStore 设置自定义stable存储, 保存任期和投票信息, 替代默认的boltdb存储
+func (r *RaftX) SetStableStore(store raft.StableStore) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set stable store while raft is started")
+	}
+	r.stableStore = store
+	return nil
+}
+
+// SetSnapshotStore 设置自定义快照存储, 替代默认的文件快照存储
+func (r *RaftX) SetSnapshotStore(store raft.SnapshotStore) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set snapshot store while raft is started")
+	}
+	r.snapshotStore = store
+	return nil
+}
+
+// EnableInmemStore 使用内存存储日志, stable信息和快照, 不写入数据目录, 重启后数据丢失. 用于单元测试
+// 通过 SetLogStore 等方法设置的自定义存储优先
+func (r *RaftX) EnableInmemStore() error {
+	if r.started.Load() {
+		return fmt.Errorf("can't enable inmem store while raft is started")
+	}
+	r.inmemStore = true
+	return nil
+}
+
+// SetSnapshotRetain 设置文件快照保留数量, 默认 Default_Snapshot_Retain
+func (r *RaftX) SetSnapshotRetain(retain int) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set snapshot retain while raft is started")
+	}
+	if retain < 1 {
+		return fmt.Errorf("snapshot retain must be at least 1")
+	}
+	r.snapshotRetain = retain
+	return nil
+}
+
+// SetSnapshotThreshold 设置快照触发条件, 每隔interval检查一次, 未快照的日志数超过threshold时生成快照.
+// interval不能小于 Min_Snapshot_Interval
+func (r *RaftX) SetSnapshotThreshold(threshold uint64, interval time.Duration) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set snapshot threshold while raft is started")
+	}
+	if interval < Min_Snapshot_Interval {
+		return fmt.Errorf("snapshot interval must be at least %v", Min_Snapshot_Interval)
+	}
+	r.config.SnapshotThreshold = threshold
+	r.config.SnapshotInterval = interval
+	return nil
+}
+
+// SetLogCache 设置日志存储的内存缓存大小, 缓存最近的size条日志以减少读取存储, 0表示不使用缓存
+func (r *RaftX) SetLogCache(size int) error {
+	if r.started.Load() {
+		return fmt.Errorf("can't set log cache while raft is started")
+	}
+	if size < 0 {
+		return fmt.Errorf("log cache size must not be negative")
+	}
+	r.logCacheSize = size
+	return nil
+}
+
+// openStores 打开日志, stable和快照存储, 未设置自定义存储时使用内存存储或数据目录下的默认存储
+func (r *RaftX) openStores() (logs raft.LogStore, stable raft.StableStore, snaps raft.SnapshotStore, err error) {
+	logs, stable, snaps = r.logStore, r.stableStore, r.snapshotStore
+
+	// 出错时关闭已打开的boltdb
+	var opened []io.Closer
+	defer func() {
+		if err != nil {
+			for _, c := range opened {
+				c.Close()
+			}
+		}
+	}()
+
+	if r.inmemStore {
+		inmem := raft.NewInmemStore()
+		if logs == nil {
+			logs = inmem
+		}
+		if stable == nil {
+			stable = inmem
+		}
+		if snaps == nil {
+			snaps = raft.NewInmemSnapshotStore()
+		}
+	}
+
+	// 数据存储目录
+	baseDir := filepath.Join(r.dataDir, string(r.config.LocalID))
+	if logs == nil || stable == nil || snaps == nil {
+		if err = os.MkdirAll(baseDir, 0755); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// 使用 boltdb进行wal日志存储
+	// 1 存储 配置信息 rafe.Configuration 包含集群信息 LogType=LogConfiguration。包含集群的配置信息。 在启动时用于加载集群信息，进configuration.latest字段
+	// 2 存储 wal日志信息 LogType=LogCommand 包含命令， 状态机执行结果
+	if logs == nil {
+		wal, err := boltdb.NewBoltStore(filepath.Join(baseDir, Logs_File))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf(`boltdb.NewBoltStore(%q): %v`, filepath.Join(baseDir, Logs_File), err)
+		}
+		opened = append(opened, wal)
+		logs = wal
+	}
+
+	// 使用 boltdb进行 stable 存储 内容包含 最后的投票节点信息LastVoteCand，CurrentTerm LastVoteTerm
+	if stable == nil {
+		sdb, err := boltdb.NewBoltStore(filepath.Join(baseDir, Stable_File))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf(`boltdb.NewBoltStore(%q): %v`, filepath.Join(baseDir, Stable_File), err)
+		}
+		opened = append(opened, sdb)
+		stable = sdb
+	}
+
+	// snap 数据目录
+	if snaps == nil {
+		snaps, err = raft.NewFileSnapshotStore(baseDir, r.snapshotRetain, os.Stderr)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf(`raft.NewFileSnapshotStore(%q, ...): %v`, baseDir, err)
+		}
+	}
+
+	if r.logCacheSize > 0 {
+		logs, err = raft.NewLogCache(r.logCacheSize, logs)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	r.closers = opened
+	return logs, stable, snaps, nil
+}
+
+// closeStores 关闭由 openStores 打开的boltdb
+func (r *RaftX) closeStores() error {
+	var errRet error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil {
+			errRet = err
+		}
+	}
+	r.closers = nil
+	return errRet
+}
@@ -0,0 +1,102 @@
+package raftx_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/jhunters/goassist/netutil/raftx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// startSingleNode start a bootstrap node with customize function called before start
+func startSingleNode(dataDir string, customize func(r *raftx.RaftX)) (*raftx.RaftX, *testFSM, func()) {
+	fsm := &testFSM{}
+	r := startNode(dataDir, "single", listen(), true, fsm, customize)
+	return r, fsm, func() {
+		r.Stop()
+	}
+}
+
+func TestStores(t *testing.T) {
+	Convey("Test in-memory store with log cache", t, func() {
+		dir := t.TempDir()
+		r, fsm, stop := startSingleNode(dir, func(r *raftx.RaftX) {
+			So(r.EnableInmemStore(), ShouldBeNil)
+			So(r.SetLogCache(16), ShouldBeNil)
+			So(r.SetLogCache(-1), ShouldNotBeNil)
+		})
+		defer stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		for _, cmd := range []string{"a", "b", "c"} {
+			_, err := r.Apply(ctx, []byte(cmd), nil)
+			So(err, ShouldBeNil)
+		}
+		So(fsm.Logs(), ShouldResemble, []string{"a", "b", "c"})
+		So(r.Raft().Snapshot().Error(), ShouldBeNil)
+
+		// nothing is written to data dir
+		entries, err := os.ReadDir(dir)
+		So(err, ShouldBeNil)
+		So(entries, ShouldBeEmpty)
+		So(r.EnableInmemStore(), ShouldNotBeNil)
+	})
+
+	Convey("Test custom stores and snapshot retain", t, func() {
+		dir := t.TempDir()
+		logs := raft.NewInmemStore()
+		snaps, err := raft.NewFileSnapshotStore(dir, 1, os.Stderr)
+		So(err, ShouldBeNil)
+		r, _, stop := startSingleNode(dir, func(r *raftx.RaftX) {
+			So(r.SetLogStore(logs), ShouldBeNil)
+			So(r.SetStableStore(logs), ShouldBeNil)
+			So(r.SetSnapshotStore(snaps), ShouldBeNil)
+			So(r.SetSnapshotRetain(0), ShouldNotBeNil)
+			So(r.SetSnapshotThreshold(1024, 0), ShouldNotBeNil)
+			So(r.SetSnapshotThreshold(1024, time.Minute), ShouldBeNil)
+		})
+		defer stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		for i := 0; i < 3; i++ {
+			_, err := r.Apply(ctx, []byte("x"), nil)
+			So(err, ShouldBeNil)
+			So(r.Raft().Snapshot().Error(), ShouldBeNil)
+		}
+		last, err := logs.LastIndex()
+		So(err, ShouldBeNil)
+		So(last, ShouldBeGreaterThan, 3)
+
+		list, err := snaps.List()
+		So(err, ShouldBeNil)
+		So(list, ShouldHaveLength, 1)
+		_, err = os.Stat(filepath.Join(dir, "single", raftx.Logs_File))
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+
+	Convey("Test default file stores", t, func() {
+		dir := t.TempDir()
+		r, _, stop := startSingleNode(dir, func(r *raftx.RaftX) {
+			So(r.SetSnapshotRetain(2), ShouldBeNil)
+		})
+		defer stop()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		for i := 0; i < 3; i++ {
+			_, err := r.Apply(ctx, []byte("x"), nil)
+			So(err, ShouldBeNil)
+			So(r.Raft().Snapshot().Error(), ShouldBeNil)
+		}
+		_, err := os.Stat(filepath.Join(dir, "single", raftx.Logs_File))
+		So(err, ShouldBeNil)
+		entries, err := os.ReadDir(filepath.Join(dir, "single", "snapshots"))
+		So(err, ShouldBeNil)
+		So(entries, ShouldHaveLength, 2)
+	})
+}
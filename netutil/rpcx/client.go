@@ -0,0 +1,215 @@
+package rpcx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jhunters/goassist/netutil/framing"
+)
+
+// ClientConfig configuration of Client
+type ClientConfig struct {
+	Codec        Codec         // codec of arguments and results, JSONCodec if nil
+	MagicCode    string        // magic code sent at the beginning of connection, Default_Magic_Code if empty
+	DialTimeout  time.Duration // timeout of dial, zero means no timeout
+	CallTimeout  time.Duration // default timeout of Call if context has no deadline, zero means no timeout
+	MaxFrameSize int           // max size of response frame, zero means framing.Default_Max_Frame_Size
+}
+
+// Client is a rpc client, it is safe to call methods concurrently over one connection
+type Client struct {
+	conn   net.Conn
+	fc     *framing.FrameConn
+	codec  Codec
+	config ClientConfig
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]chan *response
+	err     error // set when connection is broken or closed
+}
+
+// Dial connect to rpc server at address
+func Dial(network, address string, config ClientConfig) (*Client, error) {
+	conn, err := net.DialTimeout(network, address, config.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClient(conn, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient create client over conn, magic code and codec id are sent immediately
+func NewClient(conn net.Conn, config ClientConfig) (*Client, error) {
+	if config.Codec == nil {
+		config.Codec = JSONCodec{}
+	}
+	if config.MagicCode == "" {
+		config.MagicCode = Default_Magic_Code
+	}
+	fc, err := framing.NewLengthFieldConn(conn, framing.LengthFieldConfig{LengthType: framing.Length_Varint, MaxFrameSize: config.MaxFrameSize})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append([]byte(config.MagicCode), config.Codec.ID())); err != nil {
+		return nil, err
+	}
+
+	c := &Client{conn: conn, fc: fc, codec: config.Codec, config: config, pending: make(map[uint64]chan *response)}
+	go c.receive()
+	return c, nil
+}
+
+// receive read responses and deliver them to pending calls
+func (c *Client) receive() {
+	var err error
+	for {
+		var frame []byte
+		frame, err = c.fc.ReadFrame()
+		if err != nil {
+			break
+		}
+		resp := &response{}
+		if err = c.codec.Unmarshal(frame, resp); err != nil {
+			break
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[resp.Seq]
+		delete(c.pending, resp.Seq)
+		c.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = fmt.Errorf("%w: %v", ErrShutdown, err)
+	}
+	for seq, ch := range c.pending {
+		close(ch)
+		delete(c.pending, seq)
+	}
+	c.mu.Unlock()
+	c.conn.Close()
+}
+
+// Call call remote method with default timeout, see CallContext
+func (c *Client) Call(method string, args []any, replies ...any) error {
+	return c.CallContext(context.Background(), method, args, replies...)
+}
+
+// CallContext call remote method "Service.Method" with args and decode results into replies which should be pointers.
+// error returned by remote method is returned as ServerError, ctx deadline is also passed to remote method
+func (c *Client) CallContext(ctx context.Context, method string, args []any, replies ...any) error {
+	if _, ok := ctx.Deadline(); !ok && c.config.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.CallTimeout)
+		defer cancel()
+	}
+
+	req := &request{Method: method, Args: make([][]byte, len(args))}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Timeout = int64(time.Until(deadline))
+		if req.Timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+	}
+	for i, arg := range args {
+		if arg == nil {
+			continue
+		}
+		data, err := c.codec.Marshal(arg)
+		if err != nil {
+			return fmt.Errorf("rpcx: encode argument %d failed: %w", i, err)
+		}
+		req.Args[i] = data
+	}
+
+	ch := make(chan *response, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.seq++
+	req.Seq = c.seq
+	c.pending[req.Seq] = ch
+	c.mu.Unlock()
+
+	data, err := c.codec.Marshal(req)
+	if err != nil {
+		c.removePending(req.Seq)
+		return err
+	}
+	if err := c.fc.WriteFrame(data); err != nil {
+		// a partially written frame corrupts the stream, the connection can not be used any more
+		c.removePending(req.Seq)
+		return c.broken(err)
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return c.err
+		}
+		if resp.Error != "" {
+			// remote method may be cancelled by the deadline passed with request
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return ServerError(resp.Error)
+		}
+		for i := 0; i < len(replies) && i < len(resp.Results); i++ {
+			if replies[i] == nil || resp.Results[i] == nil {
+				continue
+			}
+			if err := c.codec.Unmarshal(resp.Results[i], replies[i]); err != nil {
+				return fmt.Errorf("rpcx: decode result %d failed: %w", i, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		c.removePending(req.Seq)
+		return ctx.Err()
+	}
+}
+
+// broken mark client broken by err and close the connection, pending calls are failed by receive
+func (c *Client) broken(err error) error {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = fmt.Errorf("%w: %v", ErrShutdown, err)
+	}
+	err = c.err
+	c.mu.Unlock()
+	c.conn.Close()
+	return err
+}
+
+func (c *Client) removePending(seq uint64) {
+	c.mu.Lock()
+	delete(c.pending, seq)
+	c.mu.Unlock()
+}
+
+// Close close the connection, pending calls return ErrShutdown
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil
+	}
+	c.err = ErrShutdown
+	c.mu.Unlock()
+	return c.conn.Close()
+}
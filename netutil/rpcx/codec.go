@@ -0,0 +1,75 @@
+package rpcx
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+const (
+	Codec_JSON byte = 1
+	Codec_Gob  byte = 2
+)
+
+// Codec serializes request, response and arguments
+type Codec interface {
+	// ID is sent to server after magic code to select codec of the connection
+	ID() byte
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec codec by encoding/json
+type JSONCodec struct{}
+
+// ID return Codec_JSON
+func (JSONCodec) ID() byte {
+	return Codec_JSON
+}
+
+// Marshal marshal v to json
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal unmarshal json data to v
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec codec by encoding/gob, each value is encoded with its type information
+type GobCodec struct{}
+
+// ID return Codec_Gob
+func (GobCodec) ID() byte {
+	return Codec_Gob
+}
+
+// Marshal marshal v to gob
+func (GobCodec) Marshal(v any) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal unmarshal gob data to v
+func (GobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// request is sent by client for each call
+type request struct {
+	Seq     uint64
+	Method  string // "Service.Method"
+	Timeout int64  // timeout in nanoseconds, zero means no timeout
+	Args    [][]byte
+}
+
+// response is sent by server for each request
+type response struct {
+	Seq     uint64
+	Error   string
+	Results [][]byte // nil element means nil value
+}
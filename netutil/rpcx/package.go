@@ -0,0 +1,6 @@
+/*
+ * Package rpcx provides a lightweight RPC framework without code generation.
+ * methods are registered by reflection, arguments are serialized by JSON or gob and framed over TCP.
+ * connections could be dispatched by magic code of netutil.CustomListenerSelector
+ */
+package rpcx
@@ -0,0 +1,233 @@
+package rpcx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/netutil"
+	"github.com/jhunters/goassist/netutil/rpcx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type Item struct {
+	Name string
+	Tags []string
+}
+
+type Arith struct{}
+
+func (Arith) Add(a, b int) int {
+	return a + b
+}
+
+func (Arith) Div(a, b int) (int, int, error) {
+	if b == 0 {
+		return 0, 0, errors.New("divide by zero")
+	}
+	return a / b, a % b, nil
+}
+
+func (Arith) Sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (Arith) Echo(item *Item) *Item {
+	return item
+}
+
+func (Arith) Panic() {
+	panic("oops")
+}
+
+// startServer start rpc server on a selector routes by magic code
+func startServer() (*netutil.CustomListenerSelector, *rpcx.Server, string) {
+	selector, err := netutil.NewCustomListenerSelector("tcp", "127.0.0.1", 0, 4, netutil.Equal_Mode)
+	So(err, ShouldBeNil)
+	server := rpcx.NewServer()
+	So(server.Register(&Arith{}), ShouldBeNil)
+	l, err := server.RegisterSelector(selector)
+	So(err, ShouldBeNil)
+	go selector.Serve()
+	return selector, server, l.Addr().String()
+}
+
+func TestRPC(t *testing.T) {
+	Convey("Test rpc over CustomListenerSelector", t, func() {
+		selector, server, addr := startServer()
+		defer selector.Close()
+		defer server.Close()
+		So(server.Methods(), ShouldContain, "Arith.Add")
+
+		for _, codec := range []rpcx.Codec{rpcx.JSONCodec{}, rpcx.GobCodec{}} {
+			client, err := rpcx.Dial("tcp", addr, rpcx.ClientConfig{Codec: codec, CallTimeout: 2 * time.Second})
+			So(err, ShouldBeNil)
+
+			var sum int
+			So(client.Call("Arith.Add", []any{1, 2}, &sum), ShouldBeNil)
+			So(sum, ShouldEqual, 3)
+
+			var quo, rem int
+			So(client.Call("Arith.Div", []any{7, 2}, &quo, &rem), ShouldBeNil)
+			So(quo, ShouldEqual, 3)
+			So(rem, ShouldEqual, 1)
+
+			err = client.Call("Arith.Div", []any{1, 0}, &quo)
+			So(err, ShouldEqual, rpcx.ServerError("divide by zero"))
+
+			item := &Item{}
+			So(client.Call("Arith.Echo", []any{&Item{Name: "a", Tags: []string{"x"}}}, item), ShouldBeNil)
+			So(item, ShouldResemble, &Item{Name: "a", Tags: []string{"x"}})
+			item = &Item{Name: "unchanged"}
+			So(client.Call("Arith.Echo", []any{nil}, item), ShouldBeNil)
+			So(item.Name, ShouldEqual, "unchanged")
+
+			So(client.Call("Arith.Panic", nil), ShouldNotBeNil)
+			So(client.Call("Arith.NotExist", nil), ShouldNotBeNil)
+			So(client.Call("Arith.Add", []any{1}, &sum), ShouldNotBeNil)
+			So(client.Close(), ShouldBeNil)
+			So(errors.Is(client.Call("Arith.Add", []any{1, 2}, &sum), rpcx.ErrShutdown), ShouldBeTrue)
+		}
+	})
+
+	Convey("Test concurrent calls and timeout", t, func() {
+		selector, server, addr := startServer()
+		defer selector.Close()
+		defer server.Close()
+
+		client, err := rpcx.Dial("tcp", addr, rpcx.ClientConfig{Codec: rpcx.GobCodec{}})
+		So(err, ShouldBeNil)
+		defer client.Close()
+
+		var wg sync.WaitGroup
+		errs := make([]error, 20)
+		results := make([]int, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = client.Call("Arith.Add", []any{i, i}, &results[i])
+			}(i)
+		}
+		wg.Wait()
+		for i := 0; i < 20; i++ {
+			So(errs[i], ShouldBeNil)
+			So(results[i], ShouldEqual, 2*i)
+		}
+
+		// slow call does not block others
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err = client.CallContext(ctx, "Arith.Sleep", []any{time.Second})
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+		So(time.Since(start), ShouldBeLessThan, 500*time.Millisecond)
+		So(client.Call("Arith.Sleep", []any{time.Millisecond}), ShouldBeNil)
+	})
+
+	Convey("Test server closed", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		server := rpcx.NewServer()
+		So(server.RegisterName("math", Arith{}), ShouldBeNil)
+		done := make(chan error, 1)
+		go func() { done <- server.Serve(l) }()
+
+		client, err := rpcx.Dial("tcp", l.Addr().String(), rpcx.ClientConfig{})
+		So(err, ShouldBeNil)
+		var sum int
+		So(client.Call("math.Add", []any{2, 3}, &sum), ShouldBeNil)
+		So(sum, ShouldEqual, 5)
+
+		server.Close()
+		So(<-done, ShouldEqual, rpcx.ErrShutdown)
+		So(errors.Is(client.Call("math.Add", []any{2, 3}, &sum), rpcx.ErrShutdown), ShouldBeTrue)
+	})
+
+	Convey("Test server closed on selector", t, func() {
+		selector, err := netutil.NewCustomListenerSelector("tcp", "127.0.0.1", 0, 4, netutil.Equal_Mode)
+		So(err, ShouldBeNil)
+		defer selector.Close()
+		server := rpcx.NewServer()
+		So(server.Register(&Arith{}), ShouldBeNil)
+		l, err := selector.RegisterListener(rpcx.Default_Magic_Code)
+		So(err, ShouldBeNil)
+		done := make(chan error, 1)
+		go func() { done <- server.Serve(l) }()
+		go selector.Serve()
+
+		client, err := rpcx.Dial("tcp", l.Addr().String(), rpcx.ClientConfig{})
+		So(err, ShouldBeNil)
+		defer client.Close()
+		var sum int
+		So(client.Call("Arith.Add", []any{2, 3}, &sum), ShouldBeNil)
+
+		server.Close()
+		select {
+		case err := <-done:
+			So(err, ShouldEqual, rpcx.ErrShutdown)
+		case <-time.After(2 * time.Second):
+			So("serve not returned", ShouldBeEmpty)
+		}
+	})
+
+	Convey("Test client broken by write error", t, func() {
+		c1, c2 := net.Pipe()
+		defer c2.Close()
+		go func() {
+			buf := make([]byte, 1024)
+			for {
+				if _, err := c2.Read(buf); err != nil {
+					return
+				}
+			}
+		}()
+		conn := &failConn{Conn: c1}
+		client, err := rpcx.NewClient(conn, rpcx.ClientConfig{})
+		So(err, ShouldBeNil)
+		conn.fail.Store(true)
+		var sum int
+		So(errors.Is(client.Call("Arith.Add", []any{1, 2}, &sum), rpcx.ErrShutdown), ShouldBeTrue)
+		So(errors.Is(client.Call("Arith.Add", []any{1, 2}, &sum), rpcx.ErrShutdown), ShouldBeTrue)
+	})
+}
+
+// failConn fails writes once fail is set
+type failConn struct {
+	net.Conn
+	fail atomic.Bool
+}
+
+func (c *failConn) Write(b []byte) (int, error) {
+	if c.fail.Load() {
+		return 0, errors.New("write failed")
+	}
+	return c.Conn.Write(b)
+}
+
+func ExampleServer() {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := rpcx.NewServer()
+	server.Register(&Arith{})
+	go server.Serve(l)
+	defer server.Close()
+
+	client, _ := rpcx.Dial("tcp", l.Addr().String(), rpcx.ClientConfig{Codec: rpcx.GobCodec{}})
+	defer client.Close()
+	var sum int
+	client.Call("Arith.Add", []any{1, 2}, &sum)
+	fmt.Println(sum)
+
+	// Output:
+	// 3
+}
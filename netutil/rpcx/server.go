@@ -0,0 +1,374 @@
+package rpcx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jhunters/goassist/netutil"
+	"github.com/jhunters/goassist/netutil/framing"
+	"github.com/jhunters/goassist/reflectutil"
+)
+
+const (
+	// Default_Magic_Code is written by client at the beginning of each connection
+	Default_Magic_Code = "XRPC"
+
+	// Default_Handshake_Timeout timeout to read magic code and codec id
+	Default_Handshake_Timeout = 10 * time.Second
+)
+
+var (
+	// ErrShutdown is returned when client or server is closed
+	ErrShutdown = errors.New("rpcx: connection is shut down")
+
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// ServerError represents an error returned by remote method
+type ServerError string
+
+// Error return error message
+func (e ServerError) Error() string {
+	return string(e)
+}
+
+type methodType struct {
+	rcvr     reflect.Value
+	method   *reflect.Method
+	withCtx  bool           // first parameter is context.Context
+	args     []reflect.Type // parameter types exclude receiver and context
+	withErr  bool           // last result is error
+	nResults int            // result count exclude error
+}
+
+// Server is a rpc server dispatches requests to methods registered by reflection.
+// an exported method could be called remotely if all parameters and results could be serialized by codec,
+// context.Context is passed if it is the first parameter, error is propagated to client if it is the last result
+type Server struct {
+	magicCode string
+	frameSize int
+
+	mu      sync.RWMutex
+	methods map[string]*methodType
+	codecs  map[byte]Codec
+
+	connMu    sync.Mutex
+	conns     map[net.Conn]struct{}
+	listeners map[net.Listener]struct{}
+	closed    bool
+}
+
+// NewServer create a rpc server supports JSON and gob codec
+func NewServer() *Server {
+	s := &Server{
+		magicCode: Default_Magic_Code,
+		methods:   make(map[string]*methodType),
+		codecs:    make(map[byte]Codec),
+		conns:     make(map[net.Conn]struct{}),
+		listeners: make(map[net.Listener]struct{}),
+	}
+	s.RegisterCodec(JSONCodec{})
+	s.RegisterCodec(GobCodec{})
+	return s
+}
+
+// SetMagicCode set magic code expected at the beginning of each connection, should be called before serve
+func (s *Server) SetMagicCode(magicCode string) {
+	s.magicCode = magicCode
+}
+
+// SetMaxFrameSize set max size of request frame, zero means framing.Default_Max_Frame_Size
+func (s *Server) SetMaxFrameSize(size int) {
+	s.frameSize = size
+}
+
+// RegisterCodec register a custom codec, codec with same id is replaced
+func (s *Server) RegisterCodec(codec Codec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codecs[codec.ID()] = codec
+}
+
+// Register register exported methods of rcvr with its type name as service name
+func (s *Server) Register(rcvr any) error {
+	typ, _ := reflectutil.TypeOf(rcvr)
+	return s.RegisterName(typ.Name(), rcvr)
+}
+
+// RegisterName register exported methods of rcvr as "name.Method"
+func (s *Server) RegisterName(name string, rcvr any) error {
+	if rcvr == nil || name == "" {
+		return fmt.Errorf("rpcx: invalid service name '%s' or receiver", name)
+	}
+	methods := reflectutil.GetMethods(reflect.TypeOf(rcvr))
+	if len(methods) == 0 {
+		return fmt.Errorf("rpcx: type of '%s' has no exported methods", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for mname, method := range methods {
+		s.methods[name+"."+mname] = newMethodType(reflect.ValueOf(rcvr), method)
+	}
+	return nil
+}
+
+func newMethodType(rcvr reflect.Value, method *reflect.Method) *methodType {
+	mt := &methodType{rcvr: rcvr, method: method}
+	mtype := method.Type
+	// skip receiver
+	for i := 1; i < mtype.NumIn(); i++ {
+		in := mtype.In(i)
+		if i == 1 && in == contextType {
+			mt.withCtx = true
+			continue
+		}
+		mt.args = append(mt.args, in)
+	}
+	mt.nResults = mtype.NumOut()
+	if mt.nResults > 0 && mtype.Out(mt.nResults-1) == errorType {
+		mt.withErr = true
+		mt.nResults--
+	}
+	return mt
+}
+
+// Methods return all registered method names
+func (s *Server) Methods() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ret := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+// Serve accept connections on listener and serve them until listener closed
+func (s *Server) Serve(l net.Listener) error {
+	s.connMu.Lock()
+	if s.closed {
+		s.connMu.Unlock()
+		return ErrShutdown
+	}
+	s.listeners[l] = struct{}{}
+	s.connMu.Unlock()
+	defer func() {
+		s.connMu.Lock()
+		delete(s.listeners, l)
+		s.connMu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.connMu.Lock()
+			closed := s.closed
+			s.connMu.Unlock()
+			if closed {
+				return ErrShutdown
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// RegisterSelector register a listener of magic code on selector and serve connections routed to it in background.
+// it should be called before selector.Serve
+func (s *Server) RegisterSelector(selector *netutil.CustomListenerSelector) (net.Listener, error) {
+	l, err := selector.RegisterListener(s.magicCode)
+	if err != nil {
+		return nil, err
+	}
+	go s.Serve(l)
+	return l, nil
+}
+
+// ServeConn serve a single connection until it is closed
+func (s *Server) ServeConn(conn net.Conn) {
+	s.connMu.Lock()
+	if s.closed {
+		s.connMu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.connMu.Unlock()
+	defer func() {
+		s.connMu.Lock()
+		delete(s.conns, conn)
+		s.connMu.Unlock()
+		conn.Close()
+	}()
+
+	codec, err := s.handshake(conn)
+	if err != nil {
+		return
+	}
+	fc, err := framing.NewLengthFieldConn(conn, framing.LengthFieldConfig{LengthType: framing.Length_Varint, MaxFrameSize: s.frameSize})
+	if err != nil {
+		return
+	}
+
+	// cancel context of running methods before waiting for them when connection closed
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for {
+		frame, err := fc.ReadFrame()
+		if err != nil {
+			return
+		}
+		req := &request{}
+		if err := codec.Unmarshal(frame, req); err != nil {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := s.call(ctx, codec, req)
+			data, err := codec.Marshal(resp)
+			if err != nil {
+				data, _ = codec.Marshal(&response{Seq: req.Seq, Error: fmt.Sprintf("rpcx: marshal response failed: %v", err)})
+			}
+			if err := fc.WriteFrame(data); err != nil {
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// handshake read magic code and codec id
+func (s *Server) handshake(conn net.Conn) (Codec, error) {
+	conn.SetReadDeadline(time.Now().Add(Default_Handshake_Timeout))
+	defer conn.SetReadDeadline(time.Time{})
+	head := make([]byte, len(s.magicCode)+1)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return nil, err
+	}
+	if string(head[:len(s.magicCode)]) != s.magicCode {
+		return nil, fmt.Errorf("rpcx: invalid magic code '%s'", head[:len(s.magicCode)])
+	}
+	s.mu.RLock()
+	codec, ok := s.codecs[head[len(s.magicCode)]]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("rpcx: unsupported codec %d", head[len(s.magicCode)])
+	}
+	return codec, nil
+}
+
+// call invoke method of request and build response
+func (s *Server) call(ctx context.Context, codec Codec, req *request) (resp *response) {
+	resp = &response{Seq: req.Seq}
+	defer func() {
+		if r := recover(); r != nil {
+			resp.Error = fmt.Sprintf("rpcx: method '%s' panic: %v", req.Method, r)
+			resp.Results = nil
+		}
+	}()
+
+	s.mu.RLock()
+	mt, ok := s.methods[req.Method]
+	s.mu.RUnlock()
+	if !ok {
+		resp.Error = fmt.Sprintf("rpcx: method '%s' not found", req.Method)
+		return
+	}
+	if len(req.Args) != len(mt.args) {
+		resp.Error = fmt.Sprintf("rpcx: method '%s' expects %d arguments but got %d", req.Method, len(mt.args), len(req.Args))
+		return
+	}
+
+	in := make([]reflect.Value, 0, len(mt.args)+2)
+	in = append(in, mt.rcvr)
+	if mt.withCtx {
+		if req.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Timeout))
+			defer cancel()
+		}
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	for i, typ := range mt.args {
+		v := reflect.New(typ)
+		if len(req.Args[i]) > 0 {
+			if err := codec.Unmarshal(req.Args[i], v.Interface()); err != nil {
+				resp.Error = fmt.Sprintf("rpcx: decode argument %d of '%s' failed: %v", i, req.Method, err)
+				return
+			}
+		}
+		in = append(in, v.Elem())
+	}
+
+	var out []reflect.Value
+	if mt.method.Type.IsVariadic() {
+		out = mt.method.Func.CallSlice(in)
+	} else {
+		out = mt.method.Func.Call(in)
+	}
+	if mt.withErr {
+		if err, _ := out[mt.nResults].Interface().(error); err != nil {
+			resp.Error = err.Error()
+			return
+		}
+	}
+	resp.Results = make([][]byte, mt.nResults)
+	for i := 0; i < mt.nResults; i++ {
+		if isNil(out[i]) {
+			continue
+		}
+		data, err := codec.Marshal(out[i].Interface())
+		if err != nil {
+			resp.Error = fmt.Sprintf("rpcx: encode result %d of '%s' failed: %v", i, req.Method, err)
+			resp.Results = nil
+			return
+		}
+		resp.Results[i] = data
+	}
+	return
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+// Close close all listeners and connections served by the server
+func (s *Server) Close() error {
+	s.connMu.Lock()
+	if s.closed {
+		s.connMu.Unlock()
+		return nil
+	}
+	s.closed = true
+	listeners := make([]net.Listener, 0, len(s.listeners))
+	for l := range s.listeners {
+		listeners = append(listeners, l)
+	}
+	conns := make([]net.Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.connMu.Unlock()
+
+	for _, l := range listeners {
+		l.Close()
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package netutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Default_Cert_Valid_Duration valid duration of generated certificates if not set
+	Default_Cert_Valid_Duration = 365 * 24 * time.Hour
+)
+
+// CertGetter returns certificate for the ClientHello, same as tls.Config.GetCertificate
+type CertGetter func(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+
+// StaticCert return a CertGetter always returns target certificate
+func StaticCert(cert *tls.Certificate) CertGetter {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return cert, nil
+	}
+}
+
+// NewTLSListener wrap listener with TLS, it works for plain net.Listener and listeners returned by CustomListenerSelector
+func NewTLSListener(l net.Listener, config *tls.Config) (net.Listener, error) {
+	if config == nil {
+		return nil, fmt.Errorf("tls config is nil")
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, fmt.Errorf("tls config has no certificate")
+	}
+	return tls.NewListener(l, config), nil
+}
+
+// RegisterTLSListener register a TLS listener to the selector. connections with TLS ClientHello are routed to it,
+// and only those with server name matches serverNames if given, see MatchTLSServerName.
+// returned listener accepts connections already wrapped by TLS server
+func (server *CustomListenerSelector) RegisterTLSListener(config *tls.Config, serverNames ...string) (net.Listener, error) {
+	matcher := MatchTLS()
+	if len(serverNames) > 0 {
+		matcher = MatchTLSServerName(serverNames...)
+	}
+	l, err := server.RegisterMatcherListener(matcher)
+	if err != nil {
+		return nil, err
+	}
+	return NewTLSListener(l, config)
+}
+
+// NewServerTLSConfig create server side tls.Config with certificate getter, minimum version is TLS 1.2
+func NewServerTLSConfig(getCert CertGetter) *tls.Config {
+	return &tls.Config{GetCertificate: getCert, MinVersion: tls.VersionTLS12}
+}
+
+// NewMutualTLSConfig create server side tls.Config requires and verifies client certificate signed by clientCAs
+func NewMutualTLSConfig(getCert CertGetter, clientCAs *x509.CertPool) *tls.Config {
+	config := NewServerTLSConfig(getCert)
+	config.ClientCAs = clientCAs
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return config
+}
+
+// NewClientTLSConfig create client side tls.Config. rootCAs is used to verify server certificate, system pool is used if nil.
+// clientCert is optional and presented to server for mTLS
+func NewClientTLSConfig(serverName string, rootCAs *x509.CertPool, clientCert *tls.Certificate) *tls.Config {
+	config := &tls.Config{ServerName: serverName, RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+	if clientCert != nil {
+		config.Certificates = []tls.Certificate{*clientCert}
+	}
+	return config
+}
+
+// LoadCertPool load PEM encoded certificates from files into a new pool
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in file '%s'", f)
+		}
+	}
+	return pool, nil
+}
+
+// CertSelector selects certificate by server name indication(SNI) of ClientHello.
+// exact names take precedence over wildcard names like "*.example.com", default certificate is used if nothing matched.
+type CertSelector struct {
+	mu         sync.RWMutex
+	getters    map[string]CertGetter // lower case server name pattern to getter
+	defaultGet CertGetter
+}
+
+// NewCertSelector create a new CertSelector
+func NewCertSelector() *CertSelector {
+	return &CertSelector{getters: make(map[string]CertGetter)}
+}
+
+// Add set certificate getter of server name, which could start with "*." to match any sub domain in one level
+func (s *CertSelector) Add(serverName string, getCert CertGetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.getters[strings.ToLower(serverName)] = getCert
+}
+
+// AddCertificate set static certificate of server name
+func (s *CertSelector) AddCertificate(serverName string, cert *tls.Certificate) {
+	s.Add(serverName, StaticCert(cert))
+}
+
+// Remove remove certificate getter of server name
+func (s *CertSelector) Remove(serverName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.getters, strings.ToLower(serverName))
+}
+
+// SetDefault set certificate getter used if no server name matched or client sends no SNI
+func (s *CertSelector) SetDefault(getCert CertGetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultGet = getCert
+}
+
+// GetCertificate select certificate for ClientHello, could be used as tls.Config.GetCertificate
+func (s *CertSelector) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	getCert := s.lookup(hello.ServerName)
+	s.mu.RUnlock()
+	if getCert == nil {
+		return nil, fmt.Errorf("no certificate found for server name '%s'", hello.ServerName)
+	}
+	return getCert(hello)
+}
+
+func (s *CertSelector) lookup(serverName string) CertGetter {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name != "" {
+		if getCert, ok := s.getters[name]; ok {
+			return getCert
+		}
+		for pattern, getCert := range s.getters {
+			if strings.HasPrefix(pattern, "*.") && MatchServerName(pattern, name) {
+				return getCert
+			}
+		}
+	}
+	return s.defaultGet
+}
+
+// CertReloader holds a certificate loaded from cert and key files, and reloads it when files changed
+type CertReloader struct {
+	certFile, keyFile string
+
+	cert    atomic.Pointer[tls.Certificate]
+	modTime time.Time
+
+	mu      sync.Mutex
+	stopC   chan struct{}
+	onError func(error)
+}
+
+// NewCertReloader load certificate from PEM encoded cert and key files
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload load certificate from files, current certificate is kept if failed
+func (r *CertReloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+	r.cert.Store(&cert)
+	r.mu.Lock()
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// SetErrorHandler set handler of errors met in Watch, errors are logged by default
+func (r *CertReloader) SetErrorHandler(onError func(error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onError = onError
+}
+
+// Watch check modification time of files every interval in a new goroutine and reload certificate if changed.
+// call Stop to stop watching
+func (r *CertReloader) Watch(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %v, must be large than zero", interval)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopC != nil {
+		return errors.New("cert reloader is already watching")
+	}
+	r.stopC = make(chan struct{})
+	go r.watch(interval, r.stopC)
+	return nil
+}
+
+func (r *CertReloader) watch(interval time.Duration, stopC chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.reloadIfChanged(); err != nil {
+				r.mu.Lock()
+				onError := r.onError
+				r.mu.Unlock()
+				if onError != nil {
+					onError(err)
+				} else {
+					log.Println("CertReloader reload certificate failed.", err)
+				}
+			}
+		case <-stopC:
+			return
+		}
+	}
+}
+
+func (r *CertReloader) reloadIfChanged() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	changed := !modTime.Equal(r.modTime)
+	r.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	return r.Reload()
+}
+
+// Stop stop watching files
+func (r *CertReloader) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopC != nil {
+		close(r.stopC)
+		r.stopC = nil
+	}
+}
+
+// Certificate return current certificate
+func (r *CertReloader) Certificate() *tls.Certificate {
+	return r.cert.Load()
+}
+
+// GetCertificate return current certificate, could be used as tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// GetClientCertificate return current certificate, could be used as tls.Config.GetClientCertificate
+func (r *CertReloader) GetClientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// SelfSignedCA a self-signed certificate authority to issue certificates for tests
+type SelfSignedCA struct {
+	Cert    *x509.Certificate
+	CertPEM []byte
+	key     crypto.Signer
+}
+
+// NewSelfSignedCA create a new self-signed CA with ECDSA P-256 key, Default_Cert_Valid_Duration is used if validFor is not positive
+func NewSelfSignedCA(commonName string, validFor time.Duration) (*SelfSignedCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template, err := newCertTemplate(commonName, validFor)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &SelfSignedCA{Cert: cert, CertPEM: encodePEM("CERTIFICATE", der), key: key}, nil
+}
+
+// CertPool return a new pool contains the CA certificate
+func (ca *SelfSignedCA) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	return pool
+}
+
+// Issue issue a PEM encoded certificate and key for hosts signed by the CA. hosts could be domain names or ip addresses,
+// the certificate could be used for both server and client authentication
+func (ca *SelfSignedCA) Issue(commonName string, hosts []string, validFor time.Duration) (certPEM, keyPEM []byte, err error) {
+	return issueCert(commonName, hosts, validFor, ca.Cert, ca.key)
+}
+
+// IssueTLS issue a certificate like Issue and return it as tls.Certificate
+func (ca *SelfSignedCA) IssueTLS(commonName string, hosts []string, validFor time.Duration) (*tls.Certificate, error) {
+	certPEM, keyPEM, err := ca.Issue(commonName, hosts, validFor)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// GenerateSelfSignedCert generate a PEM encoded self-signed certificate and key for hosts, the first host is used as common name
+func GenerateSelfSignedCert(hosts []string, validFor time.Duration) (certPEM, keyPEM []byte, err error) {
+	commonName := "localhost"
+	if len(hosts) > 0 {
+		commonName = hosts[0]
+	}
+	return issueCert(commonName, hosts, validFor, nil, nil)
+}
+
+// issueCert issue certificate signed by parent, or self-signed if parent is nil
+func issueCert(commonName string, hosts []string, validFor time.Duration, parent *x509.Certificate, parentKey crypto.Signer) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := newCertTemplate(commonName, validFor)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encodePEM("CERTIFICATE", der), encodePEM("EC PRIVATE KEY", keyDer), nil
+}
+
+func newCertTemplate(commonName string, validFor time.Duration) (*x509.Certificate, error) {
+	if validFor <= 0 {
+		validFor = Default_Cert_Valid_Duration
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(validFor),
+	}, nil
+}
+
+func encodePEM(typ string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
@@ -0,0 +1,205 @@
+package netutil_test
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jhunters/goassist/netutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// tlsEcho accept connections from l and echo data back until l is closed
+func tlsEcho(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			io.Copy(conn, conn)
+		}()
+	}
+}
+
+// tlsRoundTrip dial addr with TLS, send data and return peer certificate common name and echoed data
+func tlsRoundTrip(addr string, config *tls.Config, data string) (string, string, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", addr, config)
+	if err != nil {
+		return "", "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err = conn.Write([]byte(data)); err != nil {
+		return "", "", err
+	}
+	buf := make([]byte, len(data))
+	if _, err = io.ReadFull(conn, buf); err != nil {
+		return "", "", err
+	}
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, string(buf), nil
+}
+
+func TestSelfSignedCert(t *testing.T) {
+	Convey("Test generate self-signed certificates", t, func() {
+		certPEM, keyPEM, err := netutil.GenerateSelfSignedCert([]string{"localhost", "127.0.0.1"}, time.Hour)
+		So(err, ShouldBeNil)
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		So(err, ShouldBeNil)
+		So(cert.Certificate, ShouldHaveLength, 1)
+
+		ca, err := netutil.NewSelfSignedCA("test ca", 0)
+		So(err, ShouldBeNil)
+		So(ca.Cert.IsCA, ShouldBeTrue)
+		leaf, err := ca.IssueTLS("server", []string{"a.example.com"}, time.Hour)
+		So(err, ShouldBeNil)
+		So(leaf, ShouldNotBeNil)
+	})
+}
+
+func TestTLSListener(t *testing.T) {
+	Convey("Test TLS listener with SNI certificate selection", t, func() {
+		ca, err := netutil.NewSelfSignedCA("test ca", time.Hour)
+		So(err, ShouldBeNil)
+		apiCert, err := ca.IssueTLS("api", []string{"api.example.com"}, time.Hour)
+		So(err, ShouldBeNil)
+		wildcardCert, err := ca.IssueTLS("wildcard", []string{"*.example.com"}, time.Hour)
+		So(err, ShouldBeNil)
+		defaultCert, err := ca.IssueTLS("default", []string{"localhost"}, time.Hour)
+		So(err, ShouldBeNil)
+
+		selector := netutil.NewCertSelector()
+		selector.AddCertificate("api.example.com", apiCert)
+		selector.AddCertificate("*.example.com", wildcardCert)
+		selector.SetDefault(netutil.StaticCert(defaultCert))
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		tl, err := netutil.NewTLSListener(l, netutil.NewServerTLSConfig(selector.GetCertificate))
+		So(err, ShouldBeNil)
+		defer tl.Close()
+		go tlsEcho(tl)
+
+		addr := l.Addr().String()
+		for serverName, expect := range map[string]string{"api.example.com": "api", "www.example.com": "wildcard", "localhost": "default"} {
+			cn, data, err := tlsRoundTrip(addr, netutil.NewClientTLSConfig(serverName, ca.CertPool(), nil), "hello")
+			So(err, ShouldBeNil)
+			So(cn, ShouldEqual, expect)
+			So(data, ShouldEqual, "hello")
+		}
+
+		selector.Remove("*.example.com")
+		_, _, err = tlsRoundTrip(addr, netutil.NewClientTLSConfig("www.example.com", ca.CertPool(), nil), "hello")
+		So(err, ShouldNotBeNil)
+
+		_, err = netutil.NewTLSListener(l, &tls.Config{})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Test mutual TLS on CustomListenerSelector", t, func() {
+		ca, err := netutil.NewSelfSignedCA("test ca", time.Hour)
+		So(err, ShouldBeNil)
+		serverCert, err := ca.IssueTLS("server", []string{"127.0.0.1"}, time.Hour)
+		So(err, ShouldBeNil)
+		clientCert, err := ca.IssueTLS("client", nil, time.Hour)
+		So(err, ShouldBeNil)
+		otherCA, err := netutil.NewSelfSignedCA("other ca", time.Hour)
+		So(err, ShouldBeNil)
+		otherClientCert, err := otherCA.IssueTLS("other", nil, time.Hour)
+		So(err, ShouldBeNil)
+
+		selector, err := netutil.NewCustomListenerSelector("tcp", "127.0.0.1", 0, 0, netutil.Equal_Mode)
+		So(err, ShouldBeNil)
+		tl, err := selector.RegisterTLSListener(netutil.NewMutualTLSConfig(netutil.StaticCert(serverCert), ca.CertPool()))
+		So(err, ShouldBeNil)
+		go selector.Serve()
+		defer selector.Close()
+		go tlsEcho(tl)
+
+		addr := tl.Addr().String()
+		cn, data, err := tlsRoundTrip(addr, netutil.NewClientTLSConfig("127.0.0.1", ca.CertPool(), clientCert), "ping")
+		So(err, ShouldBeNil)
+		So(cn, ShouldEqual, "server")
+		So(data, ShouldEqual, "ping")
+
+		// no client certificate or signed by unknown CA
+		_, _, err = tlsRoundTrip(addr, netutil.NewClientTLSConfig("127.0.0.1", ca.CertPool(), nil), "ping")
+		So(err, ShouldNotBeNil)
+		_, _, err = tlsRoundTrip(addr, netutil.NewClientTLSConfig("127.0.0.1", ca.CertPool(), otherClientCert), "ping")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCertReloader(t *testing.T) {
+	Convey("Test hot reload certificate from files", t, func() {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		ca, err := netutil.NewSelfSignedCA("test ca", time.Hour)
+		So(err, ShouldBeNil)
+		writeCert := func(cn string, modTime time.Time) {
+			certPEM, keyPEM, err := ca.Issue(cn, []string{"127.0.0.1"}, time.Hour)
+			So(err, ShouldBeNil)
+			So(os.WriteFile(certFile, certPEM, 0600), ShouldBeNil)
+			So(os.WriteFile(keyFile, keyPEM, 0600), ShouldBeNil)
+			So(os.Chtimes(certFile, modTime, modTime), ShouldBeNil)
+			So(os.Chtimes(keyFile, modTime, modTime), ShouldBeNil)
+		}
+
+		_, err = netutil.NewCertReloader(certFile, keyFile)
+		So(err, ShouldNotBeNil)
+
+		writeCert("v1", time.Now().Add(-time.Hour))
+		reloader, err := netutil.NewCertReloader(certFile, keyFile)
+		So(err, ShouldBeNil)
+		So(reloader.Watch(20*time.Millisecond), ShouldBeNil)
+		So(reloader.Watch(20*time.Millisecond), ShouldNotBeNil)
+		defer reloader.Stop()
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		tl, err := netutil.NewTLSListener(l, netutil.NewServerTLSConfig(reloader.GetCertificate))
+		So(err, ShouldBeNil)
+		defer tl.Close()
+		go tlsEcho(tl)
+
+		clientConfig := netutil.NewClientTLSConfig("127.0.0.1", ca.CertPool(), nil)
+		cn, _, err := tlsRoundTrip(l.Addr().String(), clientConfig, "a")
+		So(err, ShouldBeNil)
+		So(cn, ShouldEqual, "v1")
+
+		writeCert("v2", time.Now())
+		for i := 0; i < 100; i++ {
+			if reloader.Certificate().Leaf != nil && reloader.Certificate().Leaf.Subject.CommonName == "v2" {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cn, _, err = tlsRoundTrip(l.Addr().String(), clientConfig, "a")
+		So(err, ShouldBeNil)
+		So(cn, ShouldEqual, "v2")
+
+		// broken files keep current certificate
+		errC := make(chan error, 1)
+		reloader.SetErrorHandler(func(err error) {
+			select {
+			case errC <- err:
+			default:
+			}
+		})
+		So(os.WriteFile(keyFile, []byte("broken"), 0600), ShouldBeNil)
+		select {
+		case err := <-errC:
+			So(err, ShouldNotBeNil)
+		case <-time.After(2 * time.Second):
+			So("reload error not reported", ShouldBeEmpty)
+		}
+		cn, _, err = tlsRoundTrip(l.Addr().String(), clientConfig, "a")
+		So(err, ShouldBeNil)
+		So(cn, ShouldEqual, "v2")
+	})
+}
@@ -7,6 +7,9 @@ const (
 	HTTP_HEADER_CONTENT_TYPE_HTML = "text/html"
 	HTTP_HEADER_CONTENT_TYPE_ES   = "text/event-stream"
 
+	// Prometheus 文本格式的指标
+	HTTP_HEADER_CONTENT_TYPE_PROMETHEUS = "text/plain; version=0.0.4; charset=utf-8"
+
 	HTTP_HEADER_CACHE_CONTROL            = "Cache-Control"
 	HTTP_HEADER_CONTENT_Control_NO_CACHE = "no-cache"
 
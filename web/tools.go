@@ -1,6 +1,7 @@
 package web
 
 import (
+	"encoding/json"
 	"net/http"
 	"os/exec"
 	"runtime"
@@ -62,3 +63,22 @@ func EventStreamHandler(onEvent func(*http.Request, chan<- []byte)) func(http.Re
 
 	return f
 }
+
+// JSONHandler 返回以JSON格式输出 fn 结果的处理函数, fn 返回错误时输出 {"error": "..."} 和500状态码
+func JSONHandler(fn func(*http.Request) (any, error)) func(http.ResponseWriter, *http.Request) {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HTTP_HEADER_CONTENT_TYPE, HTTP_HEADER_CONTENT_TYPE_JSON)
+		w.Header().Set(HTTP_HEADER_CACHE_CONTROL, HTTP_HEADER_CONTENT_Control_NO_CACHE)
+
+		v, err := fn(r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			v = map[string]string{"error": err.Error()}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+	}
+
+	return f
+}
@@ -2,6 +2,7 @@ package web_test
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -96,3 +97,41 @@ func TestStreamClientRequest(t *testing.T) {
 		fmt.Printf("Received: %s", line)
 	}
 }
+
+func TestJSONHandler(t *testing.T) {
+	handler := web.JSONHandler(func(r *http.Request) (any, error) {
+		if r.URL.Query().Get("fail") != "" {
+			return nil, errors.New("failed")
+		}
+		return map[string]int{"value": 1}, nil
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result map[string]int
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get(web.HTTP_HEADER_CONTENT_TYPE) != web.HTTP_HEADER_CONTENT_TYPE_JSON || result["value"] != 1 {
+		t.Errorf("unexpected response %v %v", resp.Header, result)
+	}
+
+	resp2, err := http.Get(ts.URL + "?fail=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp2.Body.Close()
+	var errResult map[string]string
+	if err := json.NewDecoder(resp2.Body).Decode(&errResult); err != nil {
+		t.Fatal(err)
+	}
+	if resp2.StatusCode != http.StatusInternalServerError || errResult["error"] != "failed" {
+		t.Errorf("unexpected error response %d %v", resp2.StatusCode, errResult)
+	}
+}